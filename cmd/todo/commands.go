@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/client"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+const dateLayout = "2006-01-02"
+
+func (c *cli) add(args []string) error {
+	fs := c.flags("add")
+	desc := fs.String("desc", "", "description")
+	due := fs.String("due", "", "due date, as YYYY-MM-DD")
+	priority := fs.Int("priority", 0, "priority")
+	listId := fs.Int("list", 0, "id of the list to add the todo to")
+	positional, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("usage: todo add TITLE [--desc TEXT] [--due YYYY-MM-DD] [--priority N] [--list ID]")
+	}
+	dto := todo.CreateTodoDto{Title: positional[0], Description: *desc, Priority: *priority}
+	if *due != "" {
+		dueDate, err := time.Parse(dateLayout, *due)
+		if err != nil {
+			return fmt.Errorf("invalid due date %q, expected YYYY-MM-DD", *due)
+		}
+		dto.DueDate = &dueDate
+	}
+	if *listId != 0 {
+		dto.ListId = listId
+	}
+	api, err := c.api()
+	if err != nil {
+		return err
+	}
+	created, err := api.Todos.Create(context.Background(), dto)
+	if err != nil {
+		return err
+	}
+	return c.print([]todo.Todo{*created}, created)
+}
+
+func (c *cli) list(args []string) error {
+	fs := c.flags("ls")
+	done := fs.Bool("done", false, "only completed todos")
+	open := fs.Bool("open", false, "only open todos")
+	listId := fs.Int("list", 0, "only the todos of this list")
+	archived := fs.Bool("archived", false, "include archived todos")
+	mine := fs.Bool("mine", false, "only the todos assigned to me")
+	if _, err := parse(fs, args); err != nil {
+		return err
+	}
+	if *done && *open {
+		return errors.New("--done and --open can't be combined")
+	}
+	options := client.ListOptions{ListId: *listId, IncludeArchived: *archived}
+	if *done || *open {
+		options.Completed = done
+	}
+	if *mine {
+		options.Assignee = "me"
+	}
+	api, err := c.api()
+	if err != nil {
+		return err
+	}
+	todos, err := api.Todos.List(context.Background(), options).All()
+	if err != nil {
+		return err
+	}
+	return c.print(todos, todos)
+}
+
+func (c *cli) show(args []string) error {
+	id, err := c.idArgument("show", args)
+	if err != nil {
+		return err
+	}
+	api, err := c.api()
+	if err != nil {
+		return err
+	}
+	t, err := api.Todos.Retrieve(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJson(t)
+	}
+	fmt.Fprintf(c.stdout, "#%d %s\n", t.Id, t.Title)
+	fmt.Fprintf(c.stdout, "completed: %t\n", t.Completed)
+	fmt.Fprintf(c.stdout, "priority:  %d\n", t.Priority)
+	if t.DueDate != nil {
+		fmt.Fprintf(c.stdout, "due:       %s\n", t.DueDate.Format(dateLayout))
+	}
+	if t.ListId != nil {
+		fmt.Fprintf(c.stdout, "list:      %d\n", *t.ListId)
+	}
+	if t.Description != "" {
+		fmt.Fprintf(c.stdout, "\n%s\n", t.Description)
+	}
+	return nil
+}
+
+func (c *cli) done(args []string) error {
+	return c.setCompleted("done", args, true)
+}
+
+func (c *cli) undo(args []string) error {
+	return c.setCompleted("undo", args, false)
+}
+
+func (c *cli) setCompleted(name string, args []string, completed bool) error {
+	id, err := c.idArgument(name, args)
+	if err != nil {
+		return err
+	}
+	api, err := c.api()
+	if err != nil {
+		return err
+	}
+	t, err := api.Todos.Retrieve(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	update := updateOf(*t)
+	update.Completed = completed
+	return c.update(api, id, update)
+}
+
+func (c *cli) assign(args []string) error {
+	positional, err := parse(c.flags("assign"), args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return errors.New("usage: todo assign ID USER_ID")
+	}
+	assigneeId, err := strconv.Atoi(positional[1])
+	if err != nil {
+		return fmt.Errorf("invalid user id %q", positional[1])
+	}
+	return c.setAssignee("assign", positional[:1], &assigneeId)
+}
+
+func (c *cli) unassign(args []string) error {
+	return c.setAssignee("unassign", args, nil)
+}
+
+func (c *cli) setAssignee(name string, args []string, assigneeId *int) error {
+	id, err := c.idArgument(name, args)
+	if err != nil {
+		return err
+	}
+	api, err := c.api()
+	if err != nil {
+		return err
+	}
+	t, err := api.Todos.Retrieve(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	update := updateOf(*t)
+	update.AssigneeId = assigneeId
+	return c.update(api, id, update)
+}
+
+func (c *cli) archive(args []string) error {
+	return c.setArchived("archive", args, true)
+}
+
+func (c *cli) unarchive(args []string) error {
+	return c.setArchived("unarchive", args, false)
+}
+
+func (c *cli) setArchived(name string, args []string, archived bool) error {
+	id, err := c.idArgument(name, args)
+	if err != nil {
+		return err
+	}
+	api, err := c.api()
+	if err != nil {
+		return err
+	}
+	t, err := api.Todos.Archive(context.Background(), id, archived)
+	if err != nil {
+		return err
+	}
+	return c.print([]todo.Todo{*t}, t)
+}
+
+func (c *cli) edit(args []string) error {
+	id, err := c.idArgument("edit", args)
+	if err != nil {
+		return err
+	}
+	api, err := c.api()
+	if err != nil {
+		return err
+	}
+	t, err := api.Todos.Retrieve(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	original, err := json.MarshalIndent(updateOf(*t), "", "  ")
+	if err != nil {
+		return err
+	}
+	edited, err := c.editInEditor(append(original, '\n'))
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(bytes.TrimSpace(edited), bytes.TrimSpace(original)) {
+		fmt.Fprintln(c.stderr, "no changes")
+		return nil
+	}
+	var update todo.UpdateTodoDto
+	if err := json.Unmarshal(edited, &update); err != nil {
+		return fmt.Errorf("the edited todo isn't valid JSON: %w", err)
+	}
+	return c.update(api, id, update)
+}
+
+// editInEditor opens the content in $VISUAL or $EDITOR, vi by default, and
+// returns what was saved
+func (c *cli) editInEditor(content []byte) ([]byte, error) {
+	file, err := os.CreateTemp("", "todo-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// the editor may come with arguments, as in EDITOR="code --wait"
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], file.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, c.stdout, c.stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running %s: %w", editor, err)
+	}
+	return os.ReadFile(file.Name())
+}
+
+func (c *cli) remove(args []string) error {
+	id, err := c.idArgument("rm", args)
+	if err != nil {
+		return err
+	}
+	api, err := c.api()
+	if err != nil {
+		return err
+	}
+	if err := api.Todos.Delete(context.Background(), id); err != nil {
+		return err
+	}
+	if !c.json {
+		fmt.Fprintf(c.stdout, "deleted #%d\n", id)
+	}
+	return nil
+}
+
+func (c *cli) login(args []string) error {
+	fs := c.flags("login")
+	server := fs.String("server", "", "URL of the server")
+	key := fs.String("key", "", "API key")
+	org := fs.String("org", "", "organization to scope requests to, by id or slug")
+	if _, err := parse(fs, args); err != nil {
+		return err
+	}
+	name := c.profileName()
+	profile := c.config.Profiles[name]
+	if *server != "" {
+		profile.Server = *server
+	}
+	if profile.Server == "" {
+		profile.Server = defaultServer
+	}
+	if *org != "" {
+		profile.Org = *org
+	}
+	if *key == "" {
+		fmt.Fprint(c.stderr, "API key: ")
+		line, err := bufio.NewReader(c.stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return errors.New("no API key given")
+		}
+		*key = strings.TrimSpace(line)
+	}
+	profile.ApiKey = *key
+	c.config.Profiles[name] = profile
+	if len(c.config.Profiles) == 1 {
+		c.config.Current = name
+	}
+	if err := c.config.save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "saved profile %s for %s\n", name, profile.Server)
+	return nil
+}
+
+func (c *cli) logout(args []string) error {
+	if _, err := parse(c.flags("logout"), args); err != nil {
+		return err
+	}
+	name := c.profileName()
+	profile, ok := c.config.Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+	profile.ApiKey = ""
+	c.config.Profiles[name] = profile
+	return c.config.save()
+}
+
+func (c *cli) profiles(args []string) error {
+	if _, err := parse(c.flags("profiles"), args); err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJson(c.config)
+	}
+	for _, name := range c.config.names() {
+		marker := " "
+		if name == c.config.Current {
+			marker = "*"
+		}
+		fmt.Fprintf(c.stdout, "%s %s\t%s\n", marker, name, c.config.Profiles[name].Server)
+	}
+	return nil
+}
+
+func (c *cli) use(args []string) error {
+	positional, err := parse(c.flags("use"), args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("usage: todo use NAME")
+	}
+	if _, ok := c.config.Profiles[positional[0]]; !ok {
+		return fmt.Errorf("unknown profile %q, create it with todo --profile %s login", positional[0], positional[0])
+	}
+	c.config.Current = positional[0]
+	return c.config.save()
+}
+
+func (c *cli) profileName() string {
+	if c.profile != "" {
+		return c.profile
+	}
+	return c.config.Current
+}
+
+func (c *cli) idArgument(name string, args []string) (int, error) {
+	positional, err := parse(c.flags(name), args)
+	if err != nil {
+		return 0, err
+	}
+	if len(positional) != 1 {
+		return 0, fmt.Errorf("usage: todo %s ID", name)
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(positional[0], "#"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid id %q", positional[0])
+	}
+	return id, nil
+}
+
+func (c *cli) update(api *client.Client, id int, update todo.UpdateTodoDto) error {
+	updated, err := api.Todos.Update(context.Background(), id, update)
+	if err != nil {
+		return err
+	}
+	return c.print([]todo.Todo{*updated}, updated)
+}
+
+// updateOf returns the update that leaves the todo as it is, since PUT
+// replaces every field
+func updateOf(t todo.Todo) todo.UpdateTodoDto {
+	return todo.UpdateTodoDto{
+		Title:       t.Title,
+		Description: t.Description,
+		Completed:   t.Completed,
+		DueDate:     t.DueDate,
+		Priority:    t.Priority,
+		ListId:      t.ListId,
+		AssigneeId:  t.AssigneeId,
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const defaultServer = "http://localhost:3000"
+
+// Profile is a server the CLI talks to, with the API key it authenticates with
+type Profile struct {
+	Server string `json:"server"`
+	ApiKey string `json:"api_key,omitempty"`
+	// Org is the organization requests are scoped to, by id or slug
+	Org string `json:"org,omitempty"`
+}
+
+// Config is stored in the user's config directory, readable only by them
+// since it holds API keys
+type Config struct {
+	Current  string             `json:"current"`
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+func configPath() (string, error) {
+	if path := os.Getenv("TODO_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "todo", "config.json"), nil
+}
+
+func loadConfig() (*Config, error) {
+	config := &Config{Current: "default", Profiles: map[string]Profile{}}
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if config.Profiles == nil {
+		config.Profiles = map[string]Profile{}
+	}
+	return config, nil
+}
+
+func (c *Config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// profile returns the named profile, or the current one for an empty name.
+// TODO_SERVER, TODO_API_KEY and TODO_ORG override what it stores.
+func (c *Config) profile(name string) (Profile, error) {
+	if name == "" {
+		name = c.Current
+	}
+	profile, ok := c.Profiles[name]
+	if !ok && name != "default" {
+		return Profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	if profile.Server == "" {
+		profile.Server = defaultServer
+	}
+	if server := os.Getenv("TODO_SERVER"); server != "" {
+		profile.Server = server
+	}
+	if key := os.Getenv("TODO_API_KEY"); key != "" {
+		profile.ApiKey = key
+	}
+	if org := os.Getenv("TODO_ORG"); org != "" {
+		profile.Org = org
+	}
+	return profile, nil
+}
+
+func (c *Config) names() []string {
+	names := []string{}
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
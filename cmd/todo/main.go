@@ -0,0 +1,146 @@
+// Command todo is a command-line client for the To Do API.
+//
+// Usage:
+//
+//	todo [--profile NAME] [--json] COMMAND [ARGS]
+//
+// Run todo help for the list of commands.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/client"
+)
+
+const usage = `Usage: todo [--profile NAME] [--json] COMMAND [ARGS]
+
+Commands:
+  add TITLE [--desc TEXT] [--due YYYY-MM-DD] [--priority N] [--list ID]
+  ls [--done | --open] [--list ID] [--archived] [--mine]
+  show ID
+  done ID
+  undo ID             mark a completed todo as open again
+  assign ID USER_ID   assign the todo to a user who can see it
+  unassign ID
+  archive ID          hide the todo from ls without deleting it
+  unarchive ID
+  edit ID             edit the todo in $EDITOR
+  rm ID
+  login [--server URL] [--key KEY] [--org ORG]
+                      save the server and API key of the profile; the key
+                      is read from stdin when --key is omitted
+  logout              forget the API key of the profile
+  profiles            list the profiles
+  use NAME            make NAME the current profile
+
+Flags can be given before or after the command. TODO_PROFILE picks the
+profile and TODO_SERVER, TODO_API_KEY and TODO_ORG override what it stores.
+`
+
+// cli holds what commands need, so tests can run them without a terminal
+type cli struct {
+	config  *Config
+	profile string
+	json    bool
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+func main() {
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "todo:", err)
+		os.Exit(1)
+	}
+	c := &cli{config: config, stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	if err := c.run(os.Args[1:]); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "todo:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+type command func(c *cli, args []string) error
+
+var commands = map[string]command{
+	"add":       (*cli).add,
+	"ls":        (*cli).list,
+	"show":      (*cli).show,
+	"done":      (*cli).done,
+	"undo":      (*cli).undo,
+	"assign":    (*cli).assign,
+	"unassign":  (*cli).unassign,
+	"archive":   (*cli).archive,
+	"unarchive": (*cli).unarchive,
+	"edit":      (*cli).edit,
+	"rm":        (*cli).remove,
+	"login":     (*cli).login,
+	"logout":    (*cli).logout,
+	"profiles":  (*cli).profiles,
+	"use":       (*cli).use,
+}
+
+func (c *cli) run(args []string) error {
+	c.profile = os.Getenv("TODO_PROFILE")
+	global := c.flags("todo")
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+	args = global.Args()
+	if len(args) == 0 || args[0] == "help" {
+		fmt.Fprint(c.stdout, usage)
+		return nil
+	}
+	run, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, see todo help", args[0])
+	}
+	return run(c, args[1:])
+}
+
+// flags returns a flag set with the flags every command accepts
+func (c *cli) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() { fmt.Fprint(c.stderr, usage) }
+	fs.StringVar(&c.profile, "profile", c.profile, "profile to use")
+	fs.BoolVar(&c.json, "json", c.json, "print JSON instead of tables")
+	return fs
+}
+
+// parse parses flags wherever they are among the arguments, so commands read
+// naturally as todo add "title" --desc "..."
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		// everything after -- is positional, even if it looks like a flag
+		if len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+func (c *cli) api() (*client.Client, error) {
+	profile, err := c.config.profile(c.profile)
+	if err != nil {
+		return nil, err
+	}
+	return client.New(profile.Server, client.WithApiKey(profile.ApiKey), client.WithOrg(profile.Org),
+		client.WithUserAgent("todo-cli")), nil
+}
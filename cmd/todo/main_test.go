@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+// fakeServer records the requests it gets and answers with a fixed todo
+type fakeServer struct {
+	requests []*http.Request
+	bodies   []string
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := new(bytes.Buffer)
+	body.ReadFrom(r.Body)
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, body.String())
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "missing API key", "status_code": 401}`))
+		return
+	}
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/api/todos":
+		json.NewEncoder(w).Encode([]todo.Todo{{Id: 1, Title: "first"}, {Id: 2, Title: "second", Completed: true}})
+	case r.URL.Path == "/api/todos/1/archive":
+		json.NewEncoder(w).Encode(todo.Todo{Id: 1, Title: "first", Archived: true})
+	case r.URL.Path == "/api/todos/1" && r.Method == "DELETE":
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/api/todos/1":
+		json.NewEncoder(w).Encode(todo.Todo{Id: 1, Title: "first", Priority: 2})
+	case r.Method == "POST" && r.URL.Path == "/api/todos":
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(todo.Todo{Id: 3, Title: "third"})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": "todo not found", "status_code": 404}`))
+	}
+}
+
+func newCli(t *testing.T, stdin string) (*cli, *bytes.Buffer) {
+	t.Setenv("TODO_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	t.Setenv("TODO_PROFILE", "")
+	t.Setenv("TODO_SERVER", "")
+	t.Setenv("TODO_API_KEY", "")
+	t.Setenv("TODO_ORG", "")
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := new(bytes.Buffer)
+	return &cli{config: config, stdin: strings.NewReader(stdin), stdout: stdout, stderr: new(bytes.Buffer)}, stdout
+}
+
+func TestCommands(t *testing.T) {
+	server := &fakeServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		args     []string
+		request  string
+		body     string
+		output   string
+		hasError bool
+	}{
+		{"test ls", []string{"ls"}, "GET /api/todos?limit=100", "", "second", false},
+		{"test ls filtered", []string{"ls", "--done", "--list", "4"}, "GET /api/todos?completed=true&limit=100&list_id=4", "", "first", false},
+		{"test ls json", []string{"--json", "ls", "--open"}, "GET /api/todos?completed=false&limit=100", "", `"title": "first"`, false},
+		{"test add", []string{"add", "third", "--desc", "text", "--due", "2024-05-01"}, "POST /api/todos", `"due_date":"2024-05-01T00:00:00Z"`, "third", false},
+		{"test add flag after --", []string{"add", "--", "--third"}, "POST /api/todos", `"title":"--third"`, "third", false},
+		{"test done", []string{"done", "1"}, "PUT /api/todos/1", `"completed":true,"due_date":null,"priority":2`, "first", false},
+		{"test rm", []string{"rm", "#1"}, "DELETE /api/todos/1", "", "deleted #1", false},
+		{"test archive", []string{"archive", "1"}, "POST /api/todos/1/archive", "", "first", false},
+		{"test ls archived", []string{"ls", "--archived"}, "GET /api/todos?include=archived&limit=100", "", "second", false},
+		{"test ls mine", []string{"ls", "--mine"}, "GET /api/todos?assignee=me&limit=100", "", "second", false},
+		{"test assign", []string{"assign", "1", "7"}, "PUT /api/todos/1", `"assignee_id":7`, "first", false},
+		{"test unassign", []string{"unassign", "1"}, "PUT /api/todos/1", `"assignee_id":null`, "first", false},
+		{"test assign invalid user", []string{"assign", "1", "ana"}, "", "", "", true},
+		{"test show not found", []string{"show", "9"}, "GET /api/todos/9", "", "", true},
+		{"test invalid id", []string{"done", "one"}, "", "", "", true},
+		{"test invalid due date", []string{"add", "third", "--due", "tomorrow"}, "", "", "", true},
+		{"test unknown command", []string{"frobnicate"}, "", "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, stdout := newCli(t, "secret\n")
+			if err := c.run([]string{"login", "--server", ts.URL}); err != nil {
+				t.Fatal(err)
+			}
+			server.requests, server.bodies = nil, nil
+			err := c.run(test.args)
+			if (err != nil) != test.hasError {
+				t.Fatalf("expected error: %v, got %v", test.hasError, err)
+			}
+			if test.request == "" {
+				if len(server.requests) != 0 {
+					t.Errorf("expected no requests, got %d", len(server.requests))
+				}
+				return
+			}
+			last := len(server.requests) - 1
+			if last < 0 {
+				t.Fatal("expected a request")
+			}
+			request := server.requests[last].Method + " " + server.requests[last].URL.RequestURI()
+			if request != test.request {
+				t.Errorf("expected %s, got %s", test.request, request)
+			}
+			if !strings.Contains(server.bodies[last], test.body) {
+				t.Errorf("expected the body to contain %s, got %s", test.body, server.bodies[last])
+			}
+			if !strings.Contains(stdout.String(), test.output) {
+				t.Errorf("expected the output to contain %s, got %s", test.output, stdout.String())
+			}
+		})
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	c, _ := newCli(t, "")
+	if err := c.run([]string{"login", "--server", "http://one", "--key", "k1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.run([]string{"--profile", "work", "login", "--server", "http://two", "--key", "k2", "--org", "acme"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.run([]string{"use", "nope"}); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+
+	path, _ := configPath()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected the config to be readable only by its owner, got %v", info.Mode().Perm())
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Current != "default" {
+		t.Errorf("expected default to stay current, got %s", config.Current)
+	}
+	work, err := config.profile("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if work.Server != "http://two" || work.ApiKey != "k2" || work.Org != "acme" {
+		t.Errorf("unexpected profile %+v", work)
+	}
+
+	c.profile = ""
+	if err := c.run([]string{"use", "work"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.run([]string{"logout"}); err != nil {
+		t.Fatal(err)
+	}
+	config, _ = loadConfig()
+	if config.Current != "work" || config.Profiles["work"].ApiKey != "" {
+		t.Errorf("expected work to be current and logged out, got %+v", config)
+	}
+	if config.Profiles["default"].ApiKey != "k1" {
+		t.Error("expected the default profile to keep its key")
+	}
+}
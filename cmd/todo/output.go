@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+// print writes the todos as a table, or the value as JSON with --json
+func (c *cli) print(todos []todo.Todo, value any) error {
+	if c.json {
+		return c.printJson(value)
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDONE\tPRIORITY\tDUE\tLIST\tTITLE")
+	for _, t := range todos {
+		done, due, list := "", "", ""
+		if t.Completed {
+			done = "x"
+		}
+		if t.DueDate != nil {
+			due = t.DueDate.Format(dateLayout)
+		}
+		if t.ListId != nil {
+			list = strconv.Itoa(*t.ListId)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\n", t.Id, done, t.Priority, due, list, t.Title)
+	}
+	return w.Flush()
+}
+
+func (c *cli) printJson(value any) error {
+	encoder := json.NewEncoder(c.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/admin"
+	"github.com/raphael-foliveira/fiber-todo/pkg/auth"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/list"
+	"github.com/raphael-foliveira/fiber-todo/pkg/org"
+	"github.com/raphael-foliveira/fiber-todo/pkg/server"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"github.com/raphael-foliveira/fiber-todo/pkg/user"
+)
+
+func openDatabase() (*database.Database, error) {
+	config, err := database.ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return database.Open(config)
+}
+
+func serve(args []string) error {
+	if err := flags("serve").Parse(args); err != nil {
+		return err
+	}
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if _, err := db.Migrate(); err != nil {
+		return err
+	}
+	server.StartServer(db)
+	return nil
+}
+
+func migrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: main migrate up|down|status")
+	}
+	fs := flags("migrate " + args[0])
+	steps := 1
+	if args[0] == "down" {
+		fs.IntVar(&steps, "steps", 1, "number of migrations to revert")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	switch args[0] {
+	case "up":
+		applied, err := db.Migrate()
+		for _, migration := range applied {
+			fmt.Printf("applied %d %s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("already up to date")
+		}
+		return err
+	case "down":
+		reverted, err := db.Rollback(steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %d %s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "status":
+		status, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+}
+
+func seed(args []string) error {
+	fs := flags("seed")
+	count := fs.Int("count", 20, "number of todos to create")
+	orgRef := fs.String("org", "", "organization id or slug")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	orgId, err := findOrg(db, *orgRef)
+	if err != nil {
+		return err
+	}
+	seeded, err := admin.Seed(todo.NewTodoRepository(db), orgId, *count)
+	fmt.Printf("created %d todos\n", len(seeded))
+	return err
+}
+
+func export(args []string) error {
+	fs := flags("export")
+	orgRef := fs.String("org", "", "organization id or slug")
+	out := fs.String("out", "", "file to write to instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	orgId, err := findOrg(db, *orgRef)
+	if err != nil {
+		return err
+	}
+	dump, err := admin.Export(todo.NewTodoRepository(db), list.NewListRepository(db), orgId)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(dump)
+}
+
+func importDump(args []string) error {
+	fs := flags("import")
+	orgRef := fs.String("org", "", "organization id or slug")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var r io.Reader = os.Stdin
+	if fs.NArg() > 0 {
+		file, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	var dump admin.Dump
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return fmt.Errorf("reading the export: %w", err)
+	}
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	orgId, err := findOrg(db, *orgRef)
+	if err != nil {
+		return err
+	}
+	// an import that fails halfway leaves nothing behind
+	var result admin.ImportResult
+	err = db.WithTx(context.Background(), func(tx *database.Database) error {
+		result, err = admin.Import(todo.NewTodoRepository(tx), list.NewListRepository(tx), orgId, dump)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created %d lists and %d todos, skipped %d that already existed\n", result.Lists, result.Todos, result.Skipped)
+	return nil
+}
+
+func createUser(args []string) error {
+	fs := flags("create-user")
+	email := fs.String("email", "", "email of the user")
+	name := fs.String("name", "", "name of the user")
+	scopes := fs.String("scopes", strings.Join(auth.Scopes, ","), "comma-separated scopes of the API key")
+	orgRef := fs.String("org", "", "organization to add the user to, by id or slug")
+	role := fs.String("role", string(org.RoleMember), "role in the organization")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	orgRepository := org.NewOrgRepository(db)
+	var orgId *int
+	if *orgRef != "" {
+		found, err := org.Find(orgRepository, *orgRef)
+		if err != nil {
+			return fmt.Errorf("organization %q: %w", *orgRef, err)
+		}
+		orgId = &found.Id
+	}
+	created, err := admin.CreateUser(user.NewUserRepository(db), auth.NewApiKeyRepository(db), orgRepository,
+		user.CreateUserDto{Email: *email, Name: *name}, strings.Split(*scopes, ","), orgId, org.Role(*role))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created user %d <%s>\nAPI key (shown only once): %s\n", created.User.Id, created.User.Email, created.Key)
+	return nil
+}
+
+// findOrg resolves an organization by id or slug, the default one when ref is
+// empty
+func findOrg(db *database.Database, ref string) (int, error) {
+	if ref == "" {
+		return common.DefaultOrgId, nil
+	}
+	found, err := org.Find(org.NewOrgRepository(db), ref)
+	if err != nil {
+		return 0, fmt.Errorf("organization %q: %w", ref, err)
+	}
+	return found.Id, nil
+}
@@ -1,15 +1,35 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 
 	"github.com/joho/godotenv"
 	_ "github.com/raphael-foliveira/fiber-todo/docs"
-	"github.com/raphael-foliveira/fiber-todo/pkg/database"
-
-	"github.com/raphael-foliveira/fiber-todo/pkg/server"
 )
 
+const usage = `Usage: main [COMMAND] [ARGS]
+
+Commands:
+  serve                     apply pending migrations and serve the API (default)
+  migrate up                apply pending migrations
+  migrate down [--steps N]  revert the last N migrations, 1 by default
+  migrate status            list migrations and when they were applied
+  seed [--count N] [--org ORG]
+                            create N todos with fake content, 20 by default
+  export [--org ORG] [--out FILE]
+                            write the lists and todos of the organization as JSON
+  import [--org ORG] [FILE] create the lists and todos of an export, read from
+                            stdin without FILE; existing ones are skipped
+  create-user --email EMAIL --name NAME [--scopes read,write] [--org ORG] [--role ROLE]
+                            create a user with an API key, printed once
+
+ORG is an organization id or slug and defaults to the default organization.
+The database is read from DATABASE_URL.
+`
+
 // @title           Fiber To Do API
 // @version         1.0
 // @description     A To Do app built with the Fiber framework
@@ -19,8 +39,42 @@ import (
 // @BasePath /api
 func main() {
 	godotenv.Load()
-	db := database.MustGetDatabase(os.Getenv("DATABASE_URL"))
-	db.CreateSchema()
-	defer db.Close()
-	server.StartServer(db)
+	if err := run(os.Args[1:]); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+type command func(args []string) error
+
+var commands = map[string]command{
+	"serve":       serve,
+	"migrate":     migrate,
+	"seed":        seed,
+	"export":      export,
+	"import":      importDump,
+	"create-user": createUser,
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return serve(args)
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Print(usage)
+		return nil
+	}
+	run, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, see main help", args[0])
+	}
+	return run(args[1:])
+}
+
+func flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	return fs
 }
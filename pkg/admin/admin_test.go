@@ -0,0 +1,193 @@
+package admin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/auth"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/list"
+	"github.com/raphael-foliveira/fiber-todo/pkg/org"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"github.com/raphael-foliveira/fiber-todo/pkg/user"
+)
+
+type mockTodoRepository struct {
+	todo.ITodoRepository
+	todos []todo.Todo
+}
+
+func (mr *mockTodoRepository) Create(dto todo.CreateTodoDto) (*todo.Todo, error) {
+	for _, t := range mr.todos {
+		if t.OrgId == dto.OrgId && t.Title == dto.Title {
+			return nil, errors.New("duplicate title")
+		}
+	}
+	t := todo.Todo{Id: len(mr.todos) + 1, Title: dto.Title, Description: dto.Description, Completed: dto.Completed,
+		DueDate: dto.DueDate, Priority: dto.Priority, ListId: dto.ListId, OrgId: dto.OrgId}
+	mr.todos = append(mr.todos, t)
+	return &t, nil
+}
+
+func (mr *mockTodoRepository) List(filter todo.ListFilter) ([]todo.Todo, error) {
+	todos := []todo.Todo{}
+	for _, t := range mr.todos {
+		if t.OrgId == filter.OrgId {
+			todos = append(todos, t)
+		}
+	}
+	return todos, nil
+}
+
+type mockListRepository struct {
+	list.IListRepository
+	lists []list.List
+}
+
+func (mr *mockListRepository) Create(dto list.CreateListDto) (*list.List, error) {
+	l := list.List{Id: len(mr.lists) + 10, Name: dto.Name, OrgId: dto.OrgId}
+	mr.lists = append(mr.lists, l)
+	return &l, nil
+}
+
+func (mr *mockListRepository) List(orgId int, audience common.Audience, includeArchived bool) ([]list.List, error) {
+	lists := []list.List{}
+	for _, l := range mr.lists {
+		if l.OrgId == orgId {
+			lists = append(lists, l)
+		}
+	}
+	return lists, nil
+}
+
+func TestSeed(t *testing.T) {
+	mr := new(mockTodoRepository)
+	seeded, err := Seed(mr, 2, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seeded) != 25 || len(mr.todos) != 25 {
+		t.Fatalf("Expected 25 todos, got %d", len(seeded))
+	}
+	for _, s := range seeded {
+		if s.OrgId != 2 || s.Title == "" {
+			t.Errorf("Unexpected todo %+v", s)
+		}
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	lists := &mockListRepository{lists: []list.List{{Id: 1, Name: "work", OrgId: 1}, {Id: 2, Name: "home", OrgId: 1}}}
+	todos := &mockTodoRepository{}
+	listId := 2
+	todos.Create(todo.CreateTodoDto{Title: "dishes", ListId: &listId, OrgId: 1})
+	todos.Create(todo.CreateTodoDto{Title: "report", OrgId: 1})
+
+	dump, err := Export(todos, lists, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dump.Lists) != 2 || len(dump.Todos) != 2 || dump.Version != DumpVersion {
+		t.Fatalf("Unexpected dump %+v", dump)
+	}
+
+	home, _ := lists.Create(list.CreateListDto{Name: "home", OrgId: 3})
+	result, err := Import(todos, lists, 3, *dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (ImportResult{Lists: 1, Todos: 2, Skipped: 1}) {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	imported, _ := todos.List(todo.ListFilter{OrgId: 3})
+	if imported[0].ListId == nil || *imported[0].ListId != home.Id {
+		t.Errorf("Expected dishes to move to the existing home list, got %+v", imported[0].ListId)
+	}
+
+	result, err = Import(todos, lists, 3, *dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (ImportResult{Skipped: 4}) {
+		t.Errorf("Expected importing again to skip everything, got %+v", result)
+	}
+
+	dump.Version = 99
+	if _, err := Import(todos, lists, 3, *dump); err == nil {
+		t.Error("Expected an error for an unknown version")
+	}
+}
+
+type mockUserRepository struct {
+	user.IUserRepository
+	users []user.User
+}
+
+func (mr *mockUserRepository) Create(dto user.CreateUserDto) (*user.User, error) {
+	u := user.User{Id: len(mr.users) + 1, Email: dto.Email, Name: dto.Name}
+	mr.users = append(mr.users, u)
+	return &u, nil
+}
+
+type mockKeyRepository struct {
+	auth.IApiKeyRepository
+	keys []auth.CreateApiKeyDto
+	hash string
+}
+
+func (mr *mockKeyRepository) Create(dto auth.CreateApiKeyDto, prefix string, hash string) (*auth.ApiKey, error) {
+	mr.keys = append(mr.keys, dto)
+	mr.hash = hash
+	return &auth.ApiKey{Id: len(mr.keys), Name: dto.Name, Scopes: dto.Scopes, UserId: dto.UserId}, nil
+}
+
+type mockOrgRepository struct {
+	org.IOrgRepository
+	members []org.Member
+}
+
+func (mr *mockOrgRepository) SetMember(orgId int, userId int, role org.Role) (*org.Member, error) {
+	member := org.Member{OrgId: orgId, UserId: userId, Role: role}
+	mr.members = append(mr.members, member)
+	return &member, nil
+}
+
+func TestCreateUser(t *testing.T) {
+	orgId := 4
+	tests := []struct {
+		name     string
+		dto      user.CreateUserDto
+		scopes   []string
+		orgId    *int
+		role     org.Role
+		hasError bool
+	}{
+		{"test create user", user.CreateUserDto{Email: "ada@example.com", Name: "Ada"}, auth.Scopes, nil, org.RoleMember, false},
+		{"test create user in org", user.CreateUserDto{Email: "ada@example.com", Name: "Ada"}, []string{"read"}, &orgId, org.RoleAdmin, false},
+		{"test invalid email", user.CreateUserDto{Email: "ada", Name: "Ada"}, auth.Scopes, nil, org.RoleMember, true},
+		{"test unknown scope", user.CreateUserDto{Email: "ada@example.com", Name: "Ada"}, []string{"admin"}, nil, org.RoleMember, true},
+		{"test unknown role", user.CreateUserDto{Email: "ada@example.com", Name: "Ada"}, auth.Scopes, &orgId, "owner", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			users, keys, orgs := new(mockUserRepository), new(mockKeyRepository), new(mockOrgRepository)
+			created, err := CreateUser(users, keys, orgs, test.dto, test.scopes, test.orgId, test.role)
+			if (err != nil) != test.hasError {
+				t.Fatalf("Expected error: %v, got %v", test.hasError, err)
+			}
+			if test.hasError {
+				if len(users.users) != 0 {
+					t.Error("Expected no user to be created")
+				}
+				return
+			}
+			if len(keys.keys) != 1 || *keys.keys[0].UserId != created.User.Id || keys.hash != auth.HashKey(created.Key) {
+				t.Errorf("Expected a key for the user, got %+v", keys.keys)
+			}
+			if (test.orgId != nil) != (len(orgs.members) == 1) {
+				t.Errorf("Unexpected memberships %+v", orgs.members)
+			}
+		})
+	}
+}
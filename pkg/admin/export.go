@@ -0,0 +1,129 @@
+package admin
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/list"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+// DumpVersion is bumped when the format of Dump changes
+const DumpVersion = 1
+
+// Dump holds the lists and todos of an organization
+type Dump struct {
+	Version    int         `json:"version"`
+	OrgId      int         `json:"org_id"`
+	ExportedAt time.Time   `json:"exported_at"`
+	Lists      []list.List `json:"lists"`
+	Todos      []todo.Todo `json:"todos"`
+}
+
+// ImportResult counts what an import created and what it left alone because
+// it already existed
+type ImportResult struct {
+	Lists   int `json:"lists"`
+	Todos   int `json:"todos"`
+	Skipped int `json:"skipped"`
+}
+
+func Export(todos todo.ITodoRepository, lists list.IListRepository, orgId int) (*Dump, error) {
+	everyone := common.Audience{All: true}
+	exportedLists, err := lists.List(orgId, everyone, true)
+	if err != nil {
+		return nil, err
+	}
+	exportedTodos, err := todos.List(todo.ListFilter{OrgId: orgId, Audience: everyone, IncludeArchived: true})
+	if err != nil {
+		return nil, err
+	}
+	return &Dump{
+		Version:    DumpVersion,
+		OrgId:      orgId,
+		ExportedAt: time.Now().UTC(),
+		Lists:      exportedLists,
+		Todos:      exportedTodos,
+	}, nil
+}
+
+// Import creates the lists and todos of the dump in the organization. Lists
+// are matched by name and todos by title, so importing twice is harmless.
+// Owners aren't carried over since user ids differ between deployments. Run
+// it with repositories bound to a transaction to import all or nothing.
+func Import(todos todo.ITodoRepository, lists list.IListRepository, orgId int, dump Dump) (ImportResult, error) {
+	var result ImportResult
+	if dump.Version != DumpVersion {
+		return result, fmt.Errorf("unsupported dump version %d", dump.Version)
+	}
+	everyone := common.Audience{All: true}
+	existingLists, err := lists.List(orgId, everyone, true)
+	if err != nil {
+		return result, err
+	}
+	listIds := map[string]int{}
+	for _, l := range existingLists {
+		listIds[l.Name] = l.Id
+	}
+	// the ids in the dump are those of the deployment it was exported from
+	newListIds := map[int]int{}
+	for _, l := range dump.Lists {
+		if id, ok := listIds[l.Name]; ok {
+			newListIds[l.Id] = id
+			result.Skipped++
+			continue
+		}
+		created, err := lists.Create(list.CreateListDto{Name: l.Name, OrgId: orgId})
+		if err != nil {
+			return result, fmt.Errorf("importing list %q: %w", l.Name, err)
+		}
+		if l.Archived {
+			if _, err := lists.Archive(orgId, created.Id, true); err != nil {
+				return result, fmt.Errorf("archiving list %q: %w", l.Name, err)
+			}
+		}
+		listIds[created.Name] = created.Id
+		newListIds[l.Id] = created.Id
+		result.Lists++
+	}
+	existingTodos, err := todos.List(todo.ListFilter{OrgId: orgId, Audience: everyone, IncludeArchived: true})
+	if err != nil {
+		return result, err
+	}
+	titles := map[string]bool{}
+	for _, t := range existingTodos {
+		titles[t.Title] = true
+	}
+	for _, t := range dump.Todos {
+		if titles[t.Title] {
+			result.Skipped++
+			continue
+		}
+		dto := todo.CreateTodoDto{
+			Title:       t.Title,
+			Description: t.Description,
+			Completed:   t.Completed,
+			DueDate:     t.DueDate,
+			Priority:    t.Priority,
+			OrgId:       orgId,
+		}
+		if t.ListId != nil {
+			if id, ok := newListIds[*t.ListId]; ok {
+				dto.ListId = &id
+			}
+		}
+		created, err := todos.Create(dto)
+		if err != nil {
+			return result, fmt.Errorf("importing todo %q: %w", t.Title, err)
+		}
+		if t.Archived {
+			if _, err := todos.Archive(orgId, created.Id, true); err != nil {
+				return result, fmt.Errorf("archiving todo %q: %w", t.Title, err)
+			}
+		}
+		titles[t.Title] = true
+		result.Todos++
+	}
+	return result, nil
+}
@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/go-faker/faker/v4"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+// Seed creates count todos with fake content in the organization, so there's
+// something to look at in development
+func Seed(repository todo.ITodoRepository, orgId int, count int) ([]todo.Todo, error) {
+	seeded := []todo.Todo{}
+	titles := map[string]bool{}
+	for len(seeded) < count {
+		title := strings.TrimSuffix(faker.Sentence(), ".")
+		if titles[title] {
+			continue
+		}
+		titles[title] = true
+		dto := todo.CreateTodoDto{
+			Title:       title,
+			Description: faker.Paragraph(),
+			Completed:   rand.Intn(3) == 0,
+			Priority:    rand.Intn(4),
+			OrgId:       orgId,
+		}
+		if rand.Intn(2) == 0 {
+			due := time.Now().AddDate(0, 0, rand.Intn(60)-15).Truncate(24 * time.Hour)
+			dto.DueDate = &due
+		}
+		created, err := repository.Create(dto)
+		if err != nil {
+			return seeded, err
+		}
+		seeded = append(seeded, *created)
+	}
+	return seeded, nil
+}
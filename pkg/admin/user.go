@@ -0,0 +1,54 @@
+package admin
+
+import (
+	"fmt"
+	"net/mail"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/auth"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/org"
+	"github.com/raphael-foliveira/fiber-todo/pkg/user"
+)
+
+// CreateUserResponse includes the API key of the user, which is only ever
+// shown once
+type CreateUserResponse struct {
+	User user.User `json:"user"`
+	Key  string    `json:"key"`
+}
+
+// CreateUser creates a user with an API key, and makes them a member of the
+// organization when one is given
+func CreateUser(users user.IUserRepository, keys auth.IApiKeyRepository, orgs org.IOrgRepository,
+	dto user.CreateUserDto, scopes []string, orgId *int, role org.Role) (*CreateUserResponse, error) {
+	if _, err := mail.ParseAddress(dto.Email); err != nil || dto.Name == "" {
+		return nil, fmt.Errorf("a name and a valid email are required")
+	}
+	for _, scope := range scopes {
+		if !common.Contains(auth.Scopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	if orgId != nil && !common.Contains(org.Roles, role) {
+		return nil, fmt.Errorf("unknown role %q", role)
+	}
+	created, err := users.Create(dto)
+	if err != nil {
+		return nil, err
+	}
+	if orgId != nil {
+		if _, err := orgs.SetMember(*orgId, created.Id, role); err != nil {
+			return nil, err
+		}
+	}
+	key, err := auth.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	_, err = keys.Create(auth.CreateApiKeyDto{Name: created.Email, Scopes: scopes, UserId: &created.Id},
+		auth.DisplayPrefix(key), auth.HashKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return &CreateUserResponse{User: *created, Key: key}, nil
+}
@@ -0,0 +1,23 @@
+package attachment
+
+import (
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type AttachmentModule struct {
+	Repository IAttachmentRepository
+	Controller *AttachmentController
+	// Collector removes the content of deleted attachments
+	Collector *Collector
+}
+
+func New(db *database.Database, todos todo.ITodoRepository, config Config) *AttachmentModule {
+	repository := NewAttachmentRepository(db)
+	controller := NewAttachmentController(repository, todos, config)
+	return &AttachmentModule{
+		Repository: repository,
+		Controller: controller,
+		Collector:  NewCollector(repository, config.Store),
+	}
+}
@@ -0,0 +1,29 @@
+package attachment
+
+import "time"
+
+// collectGrace leaves content alone for a while after an attachment last
+// referred to it, so uploads in flight keep theirs
+const collectGrace = time.Hour
+
+// Collector removes the content that no attachment refers to any more
+type Collector struct {
+	repository IAttachmentRepository
+	store      Store
+}
+
+func NewCollector(repository IAttachmentRepository, store Store) *Collector {
+	return &Collector{repository: repository, store: store}
+}
+
+// Collect removes unreferenced content until there is none left
+func (co *Collector) Collect() (int, error) {
+	total := 0
+	for {
+		collected, err := co.repository.CollectBlobs(collectGrace, co.store.Delete)
+		total += collected
+		if err != nil || collected < collectBatch {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package attachment
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultMaxSize = 10 << 20
+	DefaultDir     = "data/attachments"
+	DefaultTypes   = "image/*,application/pdf,text/plain,application/zip"
+)
+
+// Config is where attachments are kept and which are accepted
+type Config struct {
+	Store Store
+	// MaxSize is the largest attachment accepted, in bytes
+	MaxSize int64
+	// Types are the accepted content types, where type/* accepts every
+	// subtype
+	Types []string
+}
+
+// Accepts tells whether the content type, with or without parameters, is
+// one of the accepted types
+func (c Config) Accepts(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, accepted := range c.Types {
+		if accepted == mediaType || (strings.HasSuffix(accepted, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(accepted, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigFromEnv reads ATTACHMENT_STORE, "local" to keep content in
+// ATTACHMENT_DIR or "s3" to keep it in ATTACHMENT_S3_BUCKET at
+// ATTACHMENT_S3_ENDPOINT, signing in to ATTACHMENT_S3_REGION with
+// ATTACHMENT_S3_ACCESS_KEY and ATTACHMENT_S3_SECRET_KEY.
+// ATTACHMENT_MAX_SIZE is the largest attachment in bytes and
+// ATTACHMENT_TYPES a comma-separated list of accepted content types.
+func ConfigFromEnv() (Config, error) {
+	config := Config{MaxSize: DefaultMaxSize, Types: splitTypes(DefaultTypes)}
+	if value := os.Getenv("ATTACHMENT_MAX_SIZE"); value != "" {
+		maxSize, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || maxSize < 1 {
+			return Config{}, fmt.Errorf("invalid ATTACHMENT_MAX_SIZE %q", value)
+		}
+		config.MaxSize = maxSize
+	}
+	if value := os.Getenv("ATTACHMENT_TYPES"); value != "" {
+		config.Types = splitTypes(value)
+	}
+	switch store := os.Getenv("ATTACHMENT_STORE"); store {
+	case "", "local":
+		dir := os.Getenv("ATTACHMENT_DIR")
+		if dir == "" {
+			dir = DefaultDir
+		}
+		local, err := NewLocalStore(dir)
+		if err != nil {
+			return Config{}, fmt.Errorf("ATTACHMENT_DIR: %w", err)
+		}
+		config.Store = local
+	case "s3":
+		s3, err := NewS3Store(S3Config{
+			Endpoint:  os.Getenv("ATTACHMENT_S3_ENDPOINT"),
+			Bucket:    os.Getenv("ATTACHMENT_S3_BUCKET"),
+			Region:    os.Getenv("ATTACHMENT_S3_REGION"),
+			AccessKey: os.Getenv("ATTACHMENT_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("ATTACHMENT_S3_SECRET_KEY"),
+		})
+		if err != nil {
+			return Config{}, fmt.Errorf("ATTACHMENT_S3: %w", err)
+		}
+		config.Store = s3
+	default:
+		return Config{}, fmt.Errorf("invalid ATTACHMENT_STORE %q", store)
+	}
+	return config, nil
+}
+
+func splitTypes(value string) []string {
+	types := []string{}
+	for _, t := range strings.Split(value, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
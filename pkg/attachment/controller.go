@@ -0,0 +1,274 @@
+package attachment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+// maxNameLength is the longest file name kept, in characters
+const maxNameLength = 255
+
+type AttachmentController struct {
+	repository IAttachmentRepository
+	todos      todo.ITodoRepository
+	config     Config
+}
+
+func NewAttachmentController(repository IAttachmentRepository, todos todo.ITodoRepository, config Config) *AttachmentController {
+	return &AttachmentController{repository: repository, todos: todos, config: config}
+}
+
+// @Upload godoc
+// @Summary Attach a file to a To Do
+// @Description Upload a file as multipart form data in the file field. Its content type is detected from the content and must be one of the accepted types. Files with the same content are stored once.
+// @Tags Attachments
+// @Accept mpfd
+// @Produce json
+// @Param id path int true "To Do ID"
+// @Param file formData file true "File"
+// @Success 201 {object} Attachment
+// @Failure 400 {object} string "Bad Request"
+// @Failure 404 {object} string "Not Found"
+// @Failure 413 {object} string "Request Entity Too Large"
+// @Failure 415 {object} string "Unsupported Media Type"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /todos/{id}/attachments [post]
+func (ac *AttachmentController) Upload(c *fiber.Ctx) error {
+	todoId, err := ac.todoId(c)
+	if err != nil {
+		return err
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "the file field is required")
+	}
+	if header.Size > ac.config.MaxSize {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("attachments are limited to %d bytes", ac.config.MaxSize))
+	}
+	file, err := header.Open()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "the file can't be read")
+	}
+	defer file.Close()
+	sniffed := make([]byte, 512)
+	n, err := io.ReadFull(file, sniffed)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return fiber.NewError(fiber.StatusBadRequest, "the file can't be read")
+	}
+	contentType := http.DetectContentType(sniffed[:n])
+	if !ac.config.Accepts(contentType) {
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, fmt.Sprintf("%s files are not accepted", contentType))
+	}
+	checksum, err := hashContent(file)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "the file can't be read")
+	}
+	created, err := ac.repository.Create(CreateAttachmentDto{
+		TodoId:      todoId,
+		Name:        cleanName(header.Filename),
+		ContentType: contentType,
+		Size:        header.Size,
+		Checksum:    checksum,
+		UploadedBy:  common.UserIdOf(common.GetPrincipal(c)),
+	}, func() error {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return ac.config.Store.Put(checksum, file, header.Size)
+	})
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// @List godoc
+// @Summary List the attachments of a To Do
+// @Description List the attachments of a To Do, oldest first
+// @Tags Attachments
+// @Produce json
+// @Param id path int true "To Do ID"
+// @Success 200 {array} Attachment
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /todos/{id}/attachments [get]
+func (ac *AttachmentController) List(c *fiber.Ctx) error {
+	todoId, err := ac.todoId(c)
+	if err != nil {
+		return err
+	}
+	attachments, err := ac.repository.List(todoId)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(attachments)
+}
+
+// @Retrieve godoc
+// @Summary Retrieve an attachment
+// @Description Retrieve the details of an attachment
+// @Tags Attachments
+// @Produce json
+// @Param id path int true "To Do ID"
+// @Param attachmentId path int true "Attachment ID"
+// @Success 200 {object} Attachment
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Router /todos/{id}/attachments/{attachmentId} [get]
+func (ac *AttachmentController) Retrieve(c *fiber.Ctx) error {
+	attachment, err := ac.attachment(c)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(attachment)
+}
+
+// @Download godoc
+// @Summary Download an attachment
+// @Description Download the content of an attachment. A single byte range can be asked for with the Range header.
+// @Tags Attachments
+// @Produce octet-stream
+// @Param id path int true "To Do ID"
+// @Param attachmentId path int true "Attachment ID"
+// @Param Range header string false "Byte range, such as bytes=0-1023"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Failure 404 {object} string "Not Found"
+// @Failure 416 {object} string "Range Not Satisfiable"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /todos/{id}/attachments/{attachmentId}/content [get]
+func (ac *AttachmentController) Download(c *fiber.Ctx) error {
+	attachment, err := ac.attachment(c)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderETag, `"`+attachment.Checksum+`"`)
+	part, err := parseRange(c.Get(fiber.HeaderRange), attachment.Size)
+	if err != nil {
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", attachment.Size))
+		return fiber.NewError(fiber.StatusRequestedRangeNotSatisfiable)
+	}
+	content, err := ac.config.Store.Open(attachment.Checksum, part.offset, part.length)
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	c.Set(fiber.HeaderContentType, attachment.ContentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	c.Status(fiber.StatusOK)
+	if part.partial {
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", part.offset, part.offset+part.length-1, attachment.Size))
+		c.Status(fiber.StatusPartialContent)
+	}
+	// the response closes content once it is sent
+	return c.SendStream(content, int(part.length))
+}
+
+// @Delete godoc
+// @Summary Delete an attachment
+// @Description Delete an attachment. Its content is removed later unless other attachments share it.
+// @Tags Attachments
+// @Param id path int true "To Do ID"
+// @Param attachmentId path int true "Attachment ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /todos/{id}/attachments/{attachmentId} [delete]
+func (ac *AttachmentController) Delete(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("attachmentId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	todoId, err := ac.todoId(c)
+	if err != nil {
+		return err
+	}
+	affected, err := ac.repository.Delete(todoId, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	if affected == 0 {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// todoId returns the id of the todo of the route, after checking it exists
+// in the organization of the request
+func (ac *AttachmentController) todoId(c *fiber.Ctx) (int, error) {
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return 0, fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	if _, err := ac.todos.Retrieve(common.GetOrgId(c), id); err != nil {
+		return 0, fiber.NewError(fiber.StatusNotFound)
+	}
+	return id, nil
+}
+
+// attachment returns the attachment of the route
+func (ac *AttachmentController) attachment(c *fiber.Ctx) (*Attachment, error) {
+	id, err := strconv.Atoi(c.Params("attachmentId"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	todoId, err := ac.todoId(c)
+	if err != nil {
+		return nil, err
+	}
+	attachment, err := ac.repository.Retrieve(todoId, id)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound)
+	}
+	return attachment, nil
+}
+
+// hashContent returns the hex SHA-256 of the whole file
+func hashContent(file io.ReadSeeker) (string, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// cleanName keeps the base name of an uploaded file without control
+// characters, so it is safe to send back in Content-Disposition
+func cleanName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > maxNameLength {
+		name = string(runes[:maxNameLength])
+	}
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+	return name
+}
@@ -0,0 +1,11 @@
+package attachment
+
+// CreateAttachmentDto is built from a multipart upload
+type CreateAttachmentDto struct {
+	TodoId      int
+	Name        string
+	ContentType string
+	Size        int64
+	Checksum    string
+	UploadedBy  *int
+}
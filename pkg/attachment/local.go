@@ -0,0 +1,84 @@
+package attachment
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore keeps content in a directory, spread over subdirectories named
+// after the first two characters of the keys
+type LocalStore struct {
+	dir string
+}
+
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{dir: dir}, nil
+}
+
+func (ls *LocalStore) path(key string) string {
+	if len(key) < 2 {
+		return filepath.Join(ls.dir, key)
+	}
+	return filepath.Join(ls.dir, key[:2], key)
+}
+
+// Put writes to a temporary file first, so readers never see partial content
+func (ls *LocalStore) Put(key string, content io.Reader, size int64) error {
+	path := ls.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	written, err := io.Copy(file, content)
+	if err == nil && written != size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func (ls *LocalStore) Open(key string, offset int64, length int64) (io.ReadCloser, error) {
+	file, err := os.Open(ls.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &limitedFile{Reader: io.LimitReader(file, length), Closer: file}, nil
+}
+
+func (ls *LocalStore) Delete(key string) error {
+	err := os.Remove(ls.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+type limitedFile struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,17 @@
+package attachment
+
+import "time"
+
+type Attachment struct {
+	Id     int    `json:"id"`
+	TodoId int    `json:"todo_id"`
+	Name   string `json:"name"`
+	// ContentType is detected from the content, not taken from the upload
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// Checksum is the hex SHA-256 of the content. Attachments with the same
+	// content share one stored copy.
+	Checksum   string    `json:"checksum"`
+	UploadedBy *int      `json:"uploaded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,65 @@
+package attachment
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// errUnsatisfiableRange is returned for a range that starts past the content
+var errUnsatisfiableRange = errors.New("range not satisfiable")
+
+// byteRange is the part of the content a download sends
+type byteRange struct {
+	offset int64
+	length int64
+	// partial is set when the request asked for a part of the content
+	partial bool
+}
+
+// parseRange reads a Range header for content of the size. Only a single
+// range of bytes is supported; other headers, as RFC 9110 allows, are ignored
+// and the whole content is sent.
+func parseRange(header string, size int64) (byteRange, error) {
+	whole := byteRange{offset: 0, length: size}
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") || size == 0 {
+		return whole, nil
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return whole, nil
+	}
+	if first == "" {
+		// the last bytes of the content
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return whole, nil
+		}
+		if suffix == 0 {
+			return byteRange{}, errUnsatisfiableRange
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return byteRange{offset: size - suffix, length: suffix, partial: true}, nil
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return whole, nil
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return whole, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return byteRange{}, errUnsatisfiableRange
+	}
+	return byteRange{offset: start, length: end - start + 1, partial: true}, nil
+}
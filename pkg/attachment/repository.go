@@ -0,0 +1,161 @@
+package attachment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type IAttachmentRepository interface {
+	// Create records the attachment. store is called in the transaction when
+	// nothing with the same checksum is stored yet, to store the content.
+	Create(attachment CreateAttachmentDto, store func() error) (*Attachment, error)
+	List(todoId int) ([]Attachment, error)
+	Retrieve(todoId int, id int) (*Attachment, error)
+	Delete(todoId int, id int) (int64, error)
+	// CollectBlobs calls remove for content no attachment has referred to
+	// for the grace period, forgetting it when remove succeeds, and returns
+	// how much it removed
+	CollectBlobs(grace time.Duration, remove func(checksum string) error) (int, error)
+}
+
+type AttachmentRepository struct {
+	Db *database.Database
+}
+
+func NewAttachmentRepository(db *database.Database) *AttachmentRepository {
+	return &AttachmentRepository{Db: db}
+}
+
+const attachmentColumns = `attachment.id, attachment.todo_id, attachment.name, attachment.content_type, attachment_blob.size,
+	attachment.checksum, attachment.uploaded_by, attachment.created_at`
+
+const attachmentFrom = "attachment JOIN attachment_blob ON attachment_blob.checksum = attachment.checksum"
+
+// collectBatch is how many blobs CollectBlobs removes in one transaction
+const collectBatch = 100
+
+func scanAttachment(row todo.Scanner) (Attachment, error) {
+	var attachment Attachment
+	err := row.Scan(&attachment.Id, &attachment.TodoId, &attachment.Name, &attachment.ContentType, &attachment.Size,
+		&attachment.Checksum, &attachment.UploadedBy, &attachment.CreatedAt)
+	return attachment, err
+}
+
+// Create locks the blob row of the checksum until the attachment is
+// recorded, so CollectBlobs can't remove the content in between
+func (ar *AttachmentRepository) Create(attachment CreateAttachmentDto, store func() error) (*Attachment, error) {
+	var created Attachment
+	err := ar.Db.WithTx(context.Background(), func(tx *database.Database) error {
+		// xmax is 0 for a row this statement inserted rather than updated
+		var inserted bool
+		err := tx.QueryRow(`
+		INSERT INTO attachment_blob (checksum, size) VALUES ($1, $2)
+		ON CONFLICT (checksum) DO UPDATE SET referenced_at = NOW()
+		RETURNING xmax = 0`, attachment.Checksum, attachment.Size).Scan(&inserted)
+		if err != nil {
+			return err
+		}
+		if inserted {
+			if err := store(); err != nil {
+				return fmt.Errorf("storing content: %w", err)
+			}
+		}
+		var id int
+		err = tx.QueryRow(`
+		INSERT INTO attachment (todo_id, checksum, name, content_type, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`, attachment.TodoId, attachment.Checksum, attachment.Name, attachment.ContentType, attachment.UploadedBy).Scan(&id)
+		if err != nil {
+			return err
+		}
+		created, err = scanAttachment(tx.QueryRow("SELECT "+attachmentColumns+" FROM "+attachmentFrom+" WHERE attachment.id = $1", id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (ar *AttachmentRepository) List(todoId int) ([]Attachment, error) {
+	rows, err := ar.Db.Query("SELECT "+attachmentColumns+" FROM "+attachmentFrom+" WHERE attachment.todo_id = $1 ORDER BY attachment.id", todoId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attachments := []Attachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+func (ar *AttachmentRepository) Retrieve(todoId int, id int) (*Attachment, error) {
+	attachment, err := scanAttachment(ar.Db.QueryRow("SELECT "+attachmentColumns+" FROM "+attachmentFrom+" WHERE attachment.id = $1 AND attachment.todo_id = $2",
+		id, todoId))
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// Delete removes the attachment. Its content is left to CollectBlobs, which
+// also picks up the content of attachments deleted along with their todo.
+func (ar *AttachmentRepository) Delete(todoId int, id int) (int64, error) {
+	result, err := ar.Db.Exec("DELETE FROM attachment WHERE id = $1 AND todo_id = $2", id, todoId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CollectBlobs holds the rows of the blobs it removes locked while it does,
+// so uploads of the same content wait and store it again
+func (ar *AttachmentRepository) CollectBlobs(grace time.Duration, remove func(checksum string) error) (int, error) {
+	collected := 0
+	err := ar.Db.WithTx(context.Background(), func(tx *database.Database) error {
+		collected = 0
+		rows, err := tx.Query(`
+		SELECT checksum FROM attachment_blob
+		WHERE referenced_at < NOW() - $1 * INTERVAL '1 millisecond'
+			AND NOT EXISTS (SELECT 1 FROM attachment WHERE attachment.checksum = attachment_blob.checksum)
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`, grace.Milliseconds(), collectBatch)
+		if err != nil {
+			return err
+		}
+		checksums := []string{}
+		for rows.Next() {
+			var checksum string
+			if err := rows.Scan(&checksum); err != nil {
+				rows.Close()
+				return err
+			}
+			checksums = append(checksums, checksum)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, checksum := range checksums {
+			if err := remove(checksum); err != nil {
+				fmt.Println("error removing attachment content:", err)
+				continue
+			}
+			if _, err := tx.Exec("DELETE FROM attachment_blob WHERE checksum = $1", checksum); err != nil {
+				return err
+			}
+			collected++
+		}
+		return nil
+	})
+	return collected, err
+}
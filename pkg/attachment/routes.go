@@ -0,0 +1,13 @@
+package attachment
+
+import "github.com/gofiber/fiber/v2"
+
+// GetAttachmentRoutes adds the attachment routes to the todo router
+func GetAttachmentRoutes(router fiber.Router, controller *AttachmentController) fiber.Router {
+	router.Post("/:id/attachments", controller.Upload)
+	router.Get("/:id/attachments", controller.List)
+	router.Get("/:id/attachments/:attachmentId", controller.Retrieve)
+	router.Get("/:id/attachments/:attachmentId/content", controller.Download)
+	router.Delete("/:id/attachments/:attachmentId", controller.Delete)
+	return router
+}
@@ -0,0 +1,217 @@
+package attachment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3Timeout = 30 * time.Second
+	// emptyPayloadHash is the SHA-256 of an empty body
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	// unsignedPayload lets uploads stream without hashing the body twice
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// S3Config is where an S3Store keeps content
+type S3Config struct {
+	// Endpoint is the URL of the service, such as https://s3.us-east-1.amazonaws.com
+	// or http://localhost:9000 for a local stand-in
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Store keeps content in a bucket of Amazon S3 or any service speaking its
+// API. It addresses objects by path, which every such service supports, and
+// signs requests with Signature Version 4.
+type S3Store struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3Store checks that the bucket can be reached, creating it when it
+// doesn't exist, so a fresh local stand-in works out of the box
+func NewS3Store(config S3Config) (*S3Store, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, errors.New("the S3 endpoint must be an http or https URL")
+	}
+	if config.Bucket == "" {
+		return nil, errors.New("the S3 bucket is required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	ss := &S3Store{config: config, endpoint: endpoint, client: &http.Client{Timeout: s3Timeout}}
+	response, err := ss.do(http.MethodHead, "", nil, -1, nil)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+		return ss, nil
+	case http.StatusNotFound:
+		response, err := ss.do(http.MethodPut, "", nil, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		return ss, ss.check(response, "creating bucket")
+	default:
+		return nil, fmt.Errorf("checking bucket %s: %s", config.Bucket, response.Status)
+	}
+}
+
+func (ss *S3Store) Put(key string, content io.Reader, size int64) error {
+	response, err := ss.do(http.MethodPut, key, content, size, nil)
+	if err != nil {
+		return err
+	}
+	return ss.check(response, "storing "+key)
+}
+
+func (ss *S3Store) Open(key string, offset int64, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	if length == 0 {
+		// ranges can't be empty
+		header = nil
+	}
+	response, err := ss.do(http.MethodGet, key, nil, -1, header)
+	if err != nil {
+		return nil, err
+	}
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return &limitedFile{Reader: io.LimitReader(response.Body, length), Closer: response.Body}, nil
+	case http.StatusNotFound:
+		response.Body.Close()
+		return nil, ErrBlobNotFound
+	default:
+		return nil, ss.check(response, "reading "+key)
+	}
+}
+
+func (ss *S3Store) Delete(key string) error {
+	response, err := ss.do(http.MethodDelete, key, nil, -1, nil)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil
+	}
+	return ss.check(response, "deleting "+key)
+}
+
+// do sends a signed request for the object with the key, or for the bucket
+// when key is empty. size is the length of body, -1 when there is none.
+func (ss *S3Store) do(method string, key string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	target := *ss.endpoint
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + ss.config.Bucket
+	if key != "" {
+		target.Path += "/" + key
+	}
+	request, err := http.NewRequest(method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	payloadHash := emptyPayloadHash
+	if size >= 0 {
+		request.ContentLength = size
+		if size > 0 {
+			payloadHash = unsignedPayload
+		}
+	}
+	if size <= 0 {
+		// an empty body must not be sent as chunked
+		request.Body = http.NoBody
+	}
+	sign(request, ss.config, payloadHash, time.Now())
+	return ss.client.Do(request)
+}
+
+// check closes the response, returning an error unless it is a success
+func (ss *S3Store) check(response *http.Response, action string) error {
+	defer response.Body.Close()
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+	return fmt.Errorf("%s: %s %s", action, response.Status, strings.TrimSpace(string(message)))
+}
+
+// sign adds the Signature Version 4 headers to the request, signing the
+// host, the range and the x-amz-* headers
+func sign(request *http.Request, config S3Config, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(canonicalRequest))
+
+	key := hmacSha256([]byte("AWS4"+config.SecretKey), date)
+	key = hmacSha256(key, config.Region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		config.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
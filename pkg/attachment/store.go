@@ -0,0 +1,20 @@
+package attachment
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrBlobNotFound is returned by Store.Open for content that isn't stored
+var ErrBlobNotFound = errors.New("blob not found")
+
+// Store keeps the content of attachments, keyed by checksum
+type Store interface {
+	// Put stores size bytes of content under key. Putting a key again
+	// replaces its content.
+	Put(key string, content io.Reader, size int64) error
+	// Open reads length bytes of the content from offset
+	Open(key string, offset int64, length int64) (io.ReadCloser, error)
+	// Delete removes the content, and succeeds when there is none
+	Delete(key string) error
+}
@@ -0,0 +1,17 @@
+package auth
+
+import "github.com/raphael-foliveira/fiber-todo/pkg/database"
+
+type AuthModule struct {
+	Repository IApiKeyRepository
+	Controller *ApiKeyController
+}
+
+func New(db *database.Database) *AuthModule {
+	repository := NewApiKeyRepository(db)
+	controller := NewApiKeyController(repository)
+	return &AuthModule{
+		Repository: repository,
+		Controller: controller,
+	}
+}
@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+type mockRepository struct {
+	keys    []ApiKey
+	touched []int
+}
+
+func (mr *mockRepository) Create(dto CreateApiKeyDto, prefix string, hash string) (*ApiKey, error) {
+	key := ApiKey{Id: len(mr.keys) + 1, Name: dto.Name, Prefix: prefix, Hash: hash, Scopes: dto.Scopes, ExpiresAt: dto.ExpiresAt, UserId: dto.UserId}
+	mr.keys = append(mr.keys, key)
+	return &key, nil
+}
+
+func (mr *mockRepository) List() ([]ApiKey, error) {
+	return mr.keys, nil
+}
+
+func (mr *mockRepository) Retrieve(id int) (*ApiKey, error) {
+	for _, k := range mr.keys {
+		if k.Id == id {
+			return &k, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (mr *mockRepository) Revoke(id int) (int64, error) {
+	for i := range mr.keys {
+		if mr.keys[i].Id == id {
+			now := time.Now()
+			mr.keys[i].RevokedAt = &now
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (mr *mockRepository) FindByHash(hash string) (*ApiKey, error) {
+	for _, k := range mr.keys {
+		if k.Hash == hash {
+			return &k, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (mr *mockRepository) Touch(id int) error {
+	mr.touched = append(mr.touched, id)
+	return nil
+}
+
+func authTestsSetup(required bool) (*fiber.App, *mockRepository) {
+	mr := new(mockRepository)
+	app := fiber.New()
+	app.Use(Authenticate(mr, required))
+	GetApiKeyRoutes(app.Group("/keys"), NewApiKeyController(mr))
+	app.All("/whoami", func(c *fiber.Ctx) error {
+		return c.SendString(common.ClientKey(c))
+	})
+	return app, mr
+}
+
+func createKey(t *testing.T, mr *mockRepository, scopes []string, modify func(*ApiKey)) string {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, _ := mr.Create(CreateApiKeyDto{Name: "test", Scopes: scopes}, DisplayPrefix(key), HashKey(key))
+	if modify != nil {
+		modify(&mr.keys[created.Id-1])
+	}
+	return key
+}
+
+func TestAuthenticate(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name         string
+		required     bool
+		method       string
+		header       func(key string) (string, string)
+		scopes       []string
+		modify       func(*ApiKey)
+		expectStatus int
+	}{
+		{"anonymous allowed", false, "GET", nil, nil, nil, 200},
+		{"anonymous refused when required", true, "GET", nil, nil, nil, 401},
+		{"bearer key", true, "GET", func(k string) (string, string) { return "Authorization", "Bearer " + k }, []string{ScopeRead}, nil, 200},
+		{"x-api-key header", true, "GET", func(k string) (string, string) { return HeaderApiKey, k }, []string{ScopeRead}, nil, 200},
+		{"unknown key", false, "GET", func(k string) (string, string) { return HeaderApiKey, k + "x" }, []string{ScopeRead}, nil, 401},
+		{"read key writing", false, "POST", func(k string) (string, string) { return HeaderApiKey, k }, []string{ScopeRead}, nil, 403},
+		{"write key writing", false, "POST", func(k string) (string, string) { return HeaderApiKey, k }, []string{ScopeWrite}, nil, 200},
+		{"expired key", false, "GET", func(k string) (string, string) { return HeaderApiKey, k }, []string{ScopeRead}, func(a *ApiKey) { a.ExpiresAt = &past }, 401},
+		{"revoked key", false, "GET", func(k string) (string, string) { return HeaderApiKey, k }, []string{ScopeRead}, func(a *ApiKey) { a.RevokedAt = &past }, 401},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app, mr := authTestsSetup(test.required)
+			req, _ := http.NewRequest(test.method, "/whoami", nil)
+			if test.header != nil {
+				req.Header.Set(test.header(createKey(t, mr, test.scopes, test.modify)))
+			}
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Errorf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+			if test.expectStatus == 200 && test.header != nil && len(mr.touched) != 1 {
+				t.Errorf("Expected key use to be recorded")
+			}
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	t.Run("should return the key once and store only its hash", func(t *testing.T) {
+		app, mr := authTestsSetup(false)
+		service := createKey(t, mr, Scopes, nil)
+		req, _ := http.NewRequest("POST", "/keys", strings.NewReader(`{"name": "ci", "scopes": ["read", "write"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(HeaderApiKey, service)
+		res, _ := app.Test(req)
+		if res.StatusCode != 201 {
+			t.Fatalf("Expected status code 201, got %v", res.StatusCode)
+		}
+		stored := mr.keys[1]
+		if !strings.HasPrefix(stored.Prefix, KeyPrefix) || stored.Hash == "" || strings.Contains(stored.Hash, stored.Prefix) {
+			t.Errorf("Unexpected stored key %+v", stored)
+		}
+	})
+
+	t.Run("should refuse unknown scopes", func(t *testing.T) {
+		app, mr := authTestsSetup(false)
+		service := createKey(t, mr, Scopes, nil)
+		req, _ := http.NewRequest("POST", "/keys", strings.NewReader(`{"name": "ci", "scopes": ["root"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(HeaderApiKey, service)
+		res, _ := app.Test(req)
+		if res.StatusCode != 400 {
+			t.Errorf("Expected status code 400, got %v", res.StatusCode)
+		}
+	})
+
+	t.Run("should refuse anonymous callers even when authentication isn't required", func(t *testing.T) {
+		app, mr := authTestsSetup(false)
+		createKey(t, mr, Scopes, nil)
+		requests := []struct {
+			method string
+			url    string
+			body   string
+		}{
+			{"POST", "/keys", `{"name": "mine"}`},
+			{"POST", "/keys", `{"name": "theirs", "user_id": 7}`},
+			{"GET", "/keys", ""},
+			{"GET", "/keys/1", ""},
+			{"DELETE", "/keys/1", ""},
+		}
+		for _, r := range requests {
+			req, _ := http.NewRequest(r.method, r.url, strings.NewReader(r.body))
+			req.Header.Set("Content-Type", "application/json")
+			res, _ := app.Test(req)
+			if res.StatusCode != 401 {
+				t.Errorf("%s %s: expected status code 401, got %v", r.method, r.url, res.StatusCode)
+			}
+		}
+		if len(mr.keys) != 1 || mr.keys[0].RevokedAt != nil {
+			t.Errorf("Expected the keys to be left alone, got %+v", mr.keys)
+		}
+	})
+
+	t.Run("should keep users to their own keys", func(t *testing.T) {
+		app, mr := authTestsSetup(false)
+		createKey(t, mr, Scopes, nil)
+		userId := 7
+		key := createKey(t, mr, Scopes, func(a *ApiKey) { a.UserId = &userId })
+		requests := []struct {
+			method       string
+			url          string
+			body         string
+			expectStatus int
+		}{
+			{"POST", "/keys", `{"name": "other", "user_id": 8}`, 403},
+			{"POST", "/keys", `{"name": "mine"}`, 201},
+			{"GET", "/keys/1", "", 404},
+			{"DELETE", "/keys/1", "", 404},
+		}
+		for _, r := range requests {
+			req, _ := http.NewRequest(r.method, r.url, strings.NewReader(r.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(HeaderApiKey, key)
+			res, _ := app.Test(req)
+			if res.StatusCode != r.expectStatus {
+				t.Errorf("%s %s: expected status code %v, got %v", r.method, r.url, r.expectStatus, res.StatusCode)
+			}
+		}
+		if created := mr.keys[2]; created.UserId == nil || *created.UserId != userId {
+			t.Errorf("Expected the new key to belong to the user, got %+v", created)
+		}
+		if mr.keys[0].RevokedAt != nil {
+			t.Errorf("Expected the service key to be left alone")
+		}
+	})
+}
+
+func TestCreateForUser(t *testing.T) {
+	app, mr := authTestsSetup(false)
+	service := createKey(t, mr, Scopes, nil)
+	req, _ := http.NewRequest("POST", "/keys", strings.NewReader(`{"name": "theirs", "user_id": 8}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderApiKey, service)
+	res, _ := app.Test(req)
+	if res.StatusCode != 201 {
+		t.Fatalf("Expected status code 201, got %v", res.StatusCode)
+	}
+	if created := mr.keys[1]; created.UserId == nil || *created.UserId != 8 {
+		t.Errorf("Expected a service key to create a key for the user, got %+v", created)
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	mr := new(mockRepository)
+	for i := 0; i < 2; i++ {
+		if err := Bootstrap(mr, "operator-secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(mr.keys) != 1 || mr.keys[0].Hash != HashKey("operator-secret") {
+		t.Errorf("Expected a single bootstrap key, got %+v", mr.keys)
+	}
+}
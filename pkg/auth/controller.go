@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+type ApiKeyController struct {
+	repository IApiKeyRepository
+}
+
+func NewApiKeyController(repository IApiKeyRepository) *ApiKeyController {
+	return &ApiKeyController{repository: repository}
+}
+
+// @Create godoc
+// @Summary Create an API key
+// @Description Create an API key. The key is only ever returned by this call; scopes default to read. Keys created by a user belong to that user; service keys can create keys for any user. Creating keys takes an API key even when authentication isn't required; the first one comes from BOOTSTRAP_API_KEY or the create-user command.
+// @Tags API Keys
+// @Accept json
+// @Produce json
+// @Param key body CreateApiKeyDto true "API Key Create"
+// @Success 201 {object} CreateApiKeyResponse
+// @Failure 400 {object} string "Bad Request"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /keys [post]
+func (ac *ApiKeyController) Create(c *fiber.Ctx) error {
+	var dto CreateApiKeyDto
+	if err := c.BodyParser(&dto); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "bad request body")
+	}
+	principal := common.GetPrincipal(c)
+	if principal == nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "missing API key")
+	}
+	// only service keys pick who a key belongs to; left empty, they create
+	// another service key
+	if !principal.Service() {
+		if dto.UserId != nil && *dto.UserId != *principal.UserId {
+			return fiber.NewError(fiber.StatusForbidden, "users can only create their own keys")
+		}
+		dto.UserId = principal.UserId
+	}
+	if len(dto.Scopes) == 0 {
+		dto.Scopes = []string{ScopeRead}
+	}
+	if err := validateApiKey(dto); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	key, err := GenerateKey()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	created, err := ac.repository.Create(dto, DisplayPrefix(key), HashKey(key))
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusCreated).JSON(CreateApiKeyResponse{ApiKey: *created, Key: key})
+}
+
+// @List godoc
+// @Summary List API keys
+// @Description List API keys, including expired and revoked ones. Users only see their own keys.
+// @Tags API Keys
+// @Produce json
+// @Success 200 {array} ApiKey
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /keys [get]
+func (ac *ApiKeyController) List(c *fiber.Ctx) error {
+	keys, err := ac.repository.List()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	userId := common.UserIdOf(common.GetPrincipal(c))
+	owned := []ApiKey{}
+	for _, key := range keys {
+		if key.OwnedBy(userId) {
+			owned = append(owned, key)
+		}
+	}
+	return c.Status(fiber.StatusOK).JSON(owned)
+}
+
+// @Retrieve godoc
+// @Summary Retrieve an API key
+// @Description Retrieve an API key
+// @Tags API Keys
+// @Produce json
+// @Param id path int true "API Key ID"
+// @Success 200 {object} ApiKey
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Router /keys/{id} [get]
+func (ac *ApiKeyController) Retrieve(c *fiber.Ctx) error {
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	key, err := ac.repository.Retrieve(id)
+	if err != nil || !key.OwnedBy(common.UserIdOf(common.GetPrincipal(c))) {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.Status(fiber.StatusOK).JSON(key)
+}
+
+// @Revoke godoc
+// @Summary Revoke an API key
+// @Description Revoke an API key. Revoked keys are kept for auditing.
+// @Tags API Keys
+// @Param id path int true "API Key ID"
+// @Success 204 "No Content"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /keys/{id} [delete]
+func (ac *ApiKeyController) Revoke(c *fiber.Ctx) error {
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	key, err := ac.repository.Retrieve(id)
+	if err != nil || !key.OwnedBy(common.UserIdOf(common.GetPrincipal(c))) {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	affected, err := ac.repository.Revoke(key.Id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	if affected == 0 {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func validateApiKey(dto CreateApiKeyDto) error {
+	if dto.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	for _, scope := range dto.Scopes {
+		if !common.Contains(Scopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	if dto.ExpiresAt != nil && dto.ExpiresAt.Before(time.Now()) {
+		return fmt.Errorf("expires_at must be in the future")
+	}
+	return nil
+}
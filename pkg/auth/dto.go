@@ -0,0 +1,18 @@
+package auth
+
+import "time"
+
+type CreateApiKeyDto struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	// UserId binds the key to a user, making sharing apply to its requests.
+	// Keys created by a user always belong to that user.
+	UserId *int `json:"user_id"`
+}
+
+// CreateApiKeyResponse is the only response that includes the key itself
+type CreateApiKeyResponse struct {
+	ApiKey
+	Key string `json:"key"`
+}
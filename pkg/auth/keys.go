@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+)
+
+// KeyPrefix starts every generated key, so keys are easy to spot in config
+// files and secret scanners
+const KeyPrefix = "ftd_"
+
+const displayPrefixLength = len(KeyPrefix) + 8
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateKey returns a new random key
+func GenerateKey() (string, error) {
+	b := make([]byte, 30)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return KeyPrefix + strings.ToLower(encoding.EncodeToString(b)), nil
+}
+
+// HashKey returns what is stored for a key. Keys are long random strings, so
+// a fast hash is enough to keep them from being recovered from the database.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// DisplayPrefix is the part of a key that is kept in clear to identify it
+func DisplayPrefix(key string) string {
+	if len(key) < displayPrefixLength {
+		return key
+	}
+	return key[:displayPrefixLength]
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+const HeaderApiKey = "X-API-Key"
+
+// Authenticate resolves the API key sent with Authorization: Bearer or
+// X-API-Key and checks it grants the scope the method needs: read for safe
+// methods and write for the rest. Requests without a key are let through as
+// anonymous unless required is set.
+func Authenticate(repository IApiKeyRepository, required bool) fiber.Handler {
+	return authenticate(repository, required, true)
+}
+
+// Identify is Authenticate without the scope check, for endpoints such as
+// /graphql where the operation rather than the method decides which scope it
+// needs
+func Identify(repository IApiKeyRepository, required bool) fiber.Handler {
+	return authenticate(repository, required, false)
+}
+
+func authenticate(repository IApiKeyRepository, required bool, checkScope bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := credentials(c)
+		if key == "" {
+			if required {
+				c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+				return fiber.NewError(fiber.StatusUnauthorized, "missing API key")
+			}
+			return c.Next()
+		}
+		principal, err := Resolve(repository, key)
+		if errors.Is(err, ErrInvalidKey) {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError)
+		}
+		scope := requiredScope(c.Method())
+		if checkScope && !principal.HasScope(scope) {
+			return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("API key lacks the %s scope", scope))
+		}
+		common.SetPrincipal(c, principal)
+		return c.Next()
+	}
+}
+
+// Authenticated refuses anonymous requests even when authentication isn't
+// required, for endpoints such as /keys that hand out credentials. The
+// first key comes from Bootstrap or the create-user admin command.
+func Authenticated(c *fiber.Ctx) error {
+	if common.GetPrincipal(c) == nil {
+		c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+		return fiber.NewError(fiber.StatusUnauthorized, "missing API key")
+	}
+	return c.Next()
+}
+
+var ErrInvalidKey = errors.New("invalid API key")
+
+// Resolve returns the principal an API key authenticates, or ErrInvalidKey
+// when it is unknown, expired or revoked, and records that the key was used
+func Resolve(repository IApiKeyRepository, key string) (*common.Principal, error) {
+	apiKey, err := repository.FindByHash(HashKey(key))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !apiKey.Active(time.Now())) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := repository.Touch(apiKey.Id); err != nil {
+		fmt.Println("error recording API key use:", err)
+	}
+	return &common.Principal{KeyId: apiKey.Id, Scopes: apiKey.Scopes, UserId: apiKey.UserId}, nil
+}
+
+func credentials(c *fiber.Ctx) string {
+	if key := c.Get(HeaderApiKey); key != "" {
+		return key
+	}
+	scheme, token, found := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func requiredScope(method string) string {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return ScopeRead
+	default:
+		return ScopeWrite
+	}
+}
+
+// Bootstrap makes sure the given key exists with every scope, so a
+// deployment that requires authentication can create its first keys
+func Bootstrap(repository IApiKeyRepository, key string) error {
+	hash := HashKey(key)
+	_, err := repository.FindByHash(hash)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	_, err = repository.Create(CreateApiKeyDto{Name: "bootstrap", Scopes: Scopes}, DisplayPrefix(key), hash)
+	return err
+}
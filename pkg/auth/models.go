@@ -0,0 +1,34 @@
+package auth
+
+import "time"
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+var Scopes = []string{ScopeRead, ScopeWrite}
+
+type ApiKey struct {
+	Id         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	UserId     *int       `json:"user_id"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// OwnedBy reports whether the key belongs to the user. Service callers,
+// with a nil user, own every key.
+func (k *ApiKey) OwnedBy(userId *int) bool {
+	return userId == nil || (k.UserId != nil && *k.UserId == *userId)
+}
+
+// Active reports whether the key can still be used
+func (k *ApiKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
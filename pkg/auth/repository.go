@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"github.com/lib/pq"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+)
+
+type IApiKeyRepository interface {
+	Create(key CreateApiKeyDto, prefix string, hash string) (*ApiKey, error)
+	List() ([]ApiKey, error)
+	Retrieve(id int) (*ApiKey, error)
+	Revoke(id int) (int64, error)
+	FindByHash(hash string) (*ApiKey, error)
+	Touch(id int) error
+}
+
+type ApiKeyRepository struct {
+	Db *database.Database
+}
+
+func NewApiKeyRepository(db *database.Database) *ApiKeyRepository {
+	return &ApiKeyRepository{Db: db}
+}
+
+const apiKeyColumns = "id, name, prefix, hash, scopes, user_id, expires_at, revoked_at, last_used_at, created_at"
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanApiKey(row scanner) (*ApiKey, error) {
+	var key ApiKey
+	err := row.Scan(&key.Id, &key.Name, &key.Prefix, &key.Hash, pq.Array(&key.Scopes), &key.UserId,
+		&key.ExpiresAt, &key.RevokedAt, &key.LastUsedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (ar *ApiKeyRepository) Create(key CreateApiKeyDto, prefix string, hash string) (*ApiKey, error) {
+	row := ar.Db.QueryRow(`
+	INSERT INTO api_key
+		(name, prefix, hash, scopes, expires_at, user_id)
+	VALUES
+		($1, $2, $3, $4, $5, $6)
+	RETURNING `+apiKeyColumns, key.Name, prefix, hash, pq.Array(key.Scopes), key.ExpiresAt, key.UserId)
+	return scanApiKey(row)
+}
+
+func (ar *ApiKeyRepository) List() ([]ApiKey, error) {
+	rows, err := ar.Db.Query("SELECT " + apiKeyColumns + " FROM api_key ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []ApiKey{}
+	for rows.Next() {
+		key, err := scanApiKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (ar *ApiKeyRepository) Retrieve(id int) (*ApiKey, error) {
+	return scanApiKey(ar.Db.QueryRow("SELECT "+apiKeyColumns+" FROM api_key WHERE id = $1", id))
+}
+
+func (ar *ApiKeyRepository) Revoke(id int) (int64, error) {
+	result, err := ar.Db.Exec("UPDATE api_key SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL", id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (ar *ApiKeyRepository) FindByHash(hash string) (*ApiKey, error) {
+	return scanApiKey(ar.Db.QueryRow("SELECT "+apiKeyColumns+" FROM api_key WHERE hash = $1", hash))
+}
+
+// Touch records that the key was used. It only writes when the last recorded
+// use is over a minute old, so busy keys don't cost a write per request.
+func (ar *ApiKeyRepository) Touch(id int) error {
+	_, err := ar.Db.Exec(`
+	UPDATE api_key SET last_used_at = NOW()
+	WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, id)
+	return err
+}
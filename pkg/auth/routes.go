@@ -0,0 +1,12 @@
+package auth
+
+import "github.com/gofiber/fiber/v2"
+
+func GetApiKeyRoutes(router fiber.Router, controller *ApiKeyController) fiber.Router {
+	router.Use(Authenticated)
+	router.Post("/", controller.Create)
+	router.Get("/", controller.List)
+	router.Get("/:id", controller.Retrieve)
+	router.Delete("/:id", controller.Revoke)
+	return router
+}
@@ -0,0 +1,145 @@
+// Package cache caches read results in a Store, either in process or in
+// Redis. Cached entries are grouped in scopes, such as the todos of an
+// organization, which are invalidated as a whole when they change.
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// BypassHeader is the request header that skips the cache, as sent by
+// clients that must not see stale data
+const BypassHeader = "Cache-Control"
+
+type Store interface {
+	// Get returns the value of the key, and false when it isn't cached
+	Get(key string) ([]byte, bool, error)
+	// Set caches the value for ttl, or until evicted when ttl is 0
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// Cache is a Store with the time entries are cached for and the metrics of
+// their use
+type Cache struct {
+	Store   Store
+	Ttl     time.Duration
+	Metrics Metrics
+}
+
+func New(store Store, ttl time.Duration) *Cache {
+	return &Cache{Store: store, Ttl: ttl}
+}
+
+// Key is a key of a scope at the generation the scope was at when the key
+// was made, see Cache.Key
+type Key string
+
+// Key returns the key in the current generation of the scope. Take it before
+// reading what will be cached under it: a value read while the scope is
+// invalidated is then set in the generation that was invalidated, where it
+// is never found, rather than in the new one.
+func (c *Cache) Key(scope string, key string) Key {
+	return Key(scope + ":" + c.generation(scope) + ":" + key)
+}
+
+// Get returns the cached value of the key. A store that fails is counted and
+// treated as a miss, so that reads fall back to the database.
+func (c *Cache) Get(key Key) ([]byte, bool) {
+	value, ok, err := c.Store.Get(string(key))
+	switch {
+	case err != nil:
+		fmt.Println("cache:", err)
+		c.Metrics.errors.Add(1)
+		c.Metrics.misses.Add(1)
+	case ok:
+		c.Metrics.hits.Add(1)
+	default:
+		c.Metrics.misses.Add(1)
+	}
+	return value, ok && err == nil
+}
+
+func (c *Cache) Set(key Key, value []byte) {
+	if err := c.Store.Set(string(key), value, c.Ttl); err != nil {
+		fmt.Println("cache:", err)
+		c.Metrics.errors.Add(1)
+	}
+}
+
+// Invalidate drops every entry of the scope. Entries are keyed by the
+// generation of their scope, so starting a new generation orphans them until
+// they expire.
+func (c *Cache) Invalidate(scope string) {
+	if err := c.Store.Set(generationKey(scope), newGeneration(), 0); err != nil {
+		fmt.Println("cache:", err)
+		c.Metrics.errors.Add(1)
+	}
+	c.Metrics.invalidations.Add(1)
+}
+
+// generation returns the current generation of the scope, starting one when
+// there is none. A generation evicted from the store is replaced by a new
+// one rather than by an empty one, which could bring back entries of an
+// invalidated generation.
+func (c *Cache) generation(scope string) string {
+	generation, ok, err := c.Store.Get(generationKey(scope))
+	if err == nil && ok {
+		return string(generation)
+	}
+	generation = newGeneration()
+	if err == nil {
+		err = c.Store.Set(generationKey(scope), generation, 0)
+	}
+	if err != nil {
+		// entries cached under this generation won't be found again, which
+		// makes every read a miss until the store is back
+		fmt.Println("cache:", err)
+		c.Metrics.errors.Add(1)
+	}
+	return string(generation)
+}
+
+func generationKey(scope string) string {
+	return scope + ":generation"
+}
+
+// newGeneration returns a random generation, since one repeated after an
+// invalidation would bring its entries back
+func newGeneration() []byte {
+	generation := make([]byte, 8)
+	rand.Read(generation)
+	return []byte(hex.EncodeToString(generation))
+}
+
+// Metrics count how the cache is used
+type Metrics struct {
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	errors        atomic.Uint64
+	invalidations atomic.Uint64
+}
+
+type Stats struct {
+	Hits          uint64  `json:"hits"`
+	Misses        uint64  `json:"misses"`
+	Errors        uint64  `json:"errors"`
+	Invalidations uint64  `json:"invalidations"`
+	HitRatio      float64 `json:"hit_ratio"`
+}
+
+func (m *Metrics) Stats() Stats {
+	stats := Stats{
+		Hits:          m.hits.Load(),
+		Misses:        m.misses.Load(),
+		Errors:        m.errors.Load(),
+		Invalidations: m.invalidations.Load(),
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
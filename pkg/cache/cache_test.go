@@ -0,0 +1,259 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+	ms := NewMemoryStore(2)
+	ms.now = func() time.Time { return now }
+
+	ms.Set("a", []byte("1"), time.Minute)
+	ms.Set("b", []byte("2"), 0)
+	ms.Get("a")
+	ms.Set("c", []byte("3"), time.Minute)
+	if _, ok, _ := ms.Get("b"); ok {
+		t.Error("expected the least recently used entry to be evicted")
+	}
+	if value, ok, _ := ms.Get("a"); !ok || string(value) != "1" {
+		t.Errorf("expected a to be cached, got %q", value)
+	}
+	now = now.Add(time.Minute)
+	if _, ok, _ := ms.Get("a"); ok {
+		t.Error("expected a to expire")
+	}
+	if ms.Len() != 1 {
+		t.Errorf("expected 1 entry, got %d", ms.Len())
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Get(key string) ([]byte, bool, error) {
+	return nil, false, errors.New("down")
+}
+
+func (failingStore) Set(key string, value []byte, ttl time.Duration) error {
+	return errors.New("down")
+}
+
+func TestCache(t *testing.T) {
+	t.Run("should invalidate a scope", func(t *testing.T) {
+		c := New(NewMemoryStore(100), time.Minute)
+		c.Set(c.Key("org:1", "todos"), []byte("[1]"))
+		c.Set(c.Key("org:2", "todos"), []byte("[2]"))
+		if value, ok := c.Get(c.Key("org:1", "todos")); !ok || string(value) != "[1]" {
+			t.Fatalf("expected a hit, got %q", value)
+		}
+		c.Invalidate("org:1")
+		if _, ok := c.Get(c.Key("org:1", "todos")); ok {
+			t.Error("expected the scope to be invalidated")
+		}
+		if _, ok := c.Get(c.Key("org:2", "todos")); !ok {
+			t.Error("expected other scopes to stay cached")
+		}
+		stats := c.Metrics.Stats()
+		if stats.Hits != 2 || stats.Misses != 1 || stats.Invalidations != 1 || stats.HitRatio < 0.66 || stats.HitRatio > 0.67 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("should not bring back entries when the generation is evicted", func(t *testing.T) {
+		store := NewMemoryStore(100)
+		c := New(store, time.Minute)
+		c.Set(c.Key("org:1", "todos"), []byte("[1]"))
+		store.mu.Lock()
+		store.remove(store.entries[generationKey("org:1")])
+		store.mu.Unlock()
+		if _, ok := c.Get(c.Key("org:1", "todos")); ok {
+			t.Error("expected a miss")
+		}
+	})
+
+	t.Run("should not cache a value read while the scope is invalidated", func(t *testing.T) {
+		c := New(NewMemoryStore(100), time.Minute)
+		key := c.Key("org:1", "todos")
+		// a write invalidates the scope while the value is being read
+		c.Invalidate("org:1")
+		c.Set(key, []byte("[stale]"))
+		if value, ok := c.Get(c.Key("org:1", "todos")); ok {
+			t.Errorf("expected a miss, got %q", value)
+		}
+	})
+
+	t.Run("should count store errors as misses", func(t *testing.T) {
+		c := New(failingStore{}, time.Minute)
+		c.Set(c.Key("org:1", "todos"), []byte("[1]"))
+		if _, ok := c.Get(c.Key("org:1", "todos")); ok {
+			t.Error("expected a miss")
+		}
+		stats := c.Metrics.Stats()
+		if stats.Misses != 1 || stats.Errors == 0 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+}
+
+// fakeRedis answers GET, SET, AUTH and SELECT from a map
+type fakeRedis struct {
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func (fr *fakeRedis) serve(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go fr.handle(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func (fr *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, count)
+		for i := range args {
+			line, _ = reader.ReadString('\n')
+			length, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			value := make([]byte, length+2)
+			io.ReadFull(reader, value)
+			args[i] = string(value[:length])
+		}
+		fr.mu.Lock()
+		fr.commands = append(fr.commands, strings.Join(args, " "))
+		switch args[0] {
+		case "GET":
+			if value, ok := fr.values[args[1]]; ok {
+				io.WriteString(conn, "$"+strconv.Itoa(len(value))+"\r\n"+value+"\r\n")
+			} else {
+				io.WriteString(conn, "$-1\r\n")
+			}
+		case "SET":
+			fr.values[args[1]] = args[2]
+			io.WriteString(conn, "+OK\r\n")
+		case "AUTH":
+			if args[len(args)-1] != "secret" {
+				io.WriteString(conn, "-WRONGPASS invalid password\r\n")
+			} else {
+				io.WriteString(conn, "+OK\r\n")
+			}
+		default:
+			io.WriteString(conn, "+OK\r\n")
+		}
+		fr.mu.Unlock()
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	fr := &fakeRedis{values: map[string]string{}}
+	addr := fr.serve(t)
+
+	if _, err := NewRedisStore("redis://:wrong@" + addr); err == nil {
+		t.Error("expected an error for a wrong password")
+	}
+	if _, err := NewRedisStore("http://" + addr); err == nil {
+		t.Error("expected an error for a wrong scheme")
+	}
+	rs, err := NewRedisStore("redis://:secret@" + addr + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+
+	if _, ok, err := rs.Get("missing"); ok || err != nil {
+		t.Errorf("expected a miss, got %v, %v", ok, err)
+	}
+	if err := rs.Set("key", []byte("multi\r\nline"), 1500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok, err := rs.Get("key"); !ok || err != nil || string(value) != "multi\r\nline" {
+		t.Errorf("expected the value back, got %q, %v, %v", value, ok, err)
+	}
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	expected := []string{"AUTH wrong", "AUTH secret", "SELECT 2", "GET missing", "SET key multi\r\nline PX 1500", "GET key"}
+	if strings.Join(fr.commands, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected commands %q, got %q", expected, fr.commands)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		store    string
+		ttl      string
+		size     string
+		enabled  bool
+		hasError bool
+	}{
+		{"test disabled", "", "", "", false, false},
+		{"test memory", "memory", "1m", "10", true, false},
+		{"test invalid store", "disk", "", "", false, true},
+		{"test invalid ttl", "memory", "soon", "", false, true},
+		{"test invalid size", "memory", "", "0", false, true},
+		{"test unreachable redis", "redis", "", "", false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("CACHE_STORE", test.store)
+			t.Setenv("CACHE_TTL", test.ttl)
+			t.Setenv("CACHE_SIZE", test.size)
+			// nothing listens on port 1
+			t.Setenv("CACHE_REDIS_URL", "redis://127.0.0.1:1")
+			c, err := FromEnv()
+			if (err != nil) != test.hasError {
+				t.Fatalf("expected error: %v, got %v", test.hasError, err)
+			}
+			if (c != nil) != test.enabled {
+				t.Errorf("expected enabled: %v, got %v", test.enabled, c)
+			}
+		})
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	c := New(NewMemoryStore(100), time.Minute)
+	app := fiber.New()
+	app.Use(Invalidate(c, func(*fiber.Ctx) string { return "org:1" }))
+	app.All("/", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	app.All("/fail", func(c *fiber.Ctx) error { return fiber.NewError(fiber.StatusBadRequest) })
+
+	for _, request := range []struct{ method, path string }{{"GET", "/"}, {"POST", "/fail"}, {"DELETE", "/"}} {
+		if _, err := app.Test(httptest.NewRequest(request.method, request.path, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if invalidations := c.Metrics.Stats().Invalidations; invalidations != 1 {
+		t.Errorf("expected only the successful write to invalidate, got %d invalidations", invalidations)
+	}
+}
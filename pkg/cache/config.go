@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultTtl  = 30 * time.Second
+	DefaultSize = 10000
+)
+
+// FromEnv builds the cache from CACHE_STORE ("memory", or "redis" for
+// deployments with several instances, which connects to CACHE_REDIS_URL),
+// CACHE_TTL and CACHE_SIZE, the most entries the memory store holds. Caching
+// is off by default, which is reported by a nil Cache.
+func FromEnv() (*Cache, error) {
+	ttl := DefaultTtl
+	if value := os.Getenv("CACHE_TTL"); value != "" {
+		var err error
+		ttl, err = time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid CACHE_TTL %q", value)
+		}
+	}
+	switch store := os.Getenv("CACHE_STORE"); store {
+	case "", "none":
+		return nil, nil
+	case "memory":
+		size := DefaultSize
+		if value := os.Getenv("CACHE_SIZE"); value != "" {
+			var err error
+			size, err = strconv.Atoi(value)
+			if err != nil || size < 1 {
+				return nil, fmt.Errorf("invalid CACHE_SIZE %q", value)
+			}
+		}
+		return New(NewMemoryStore(size), ttl), nil
+	case "redis":
+		redis, err := NewRedisStore(os.Getenv("CACHE_REDIS_URL"))
+		if err != nil {
+			return nil, fmt.Errorf("CACHE_REDIS_URL: %w", err)
+		}
+		return New(redis, ttl), nil
+	default:
+		return nil, fmt.Errorf("invalid CACHE_STORE %q", store)
+	}
+}
@@ -0,0 +1,22 @@
+package cache
+
+import "github.com/gofiber/fiber/v2"
+
+type CacheController struct {
+	cache *Cache
+}
+
+func NewCacheController(cache *Cache) *CacheController {
+	return &CacheController{cache: cache}
+}
+
+// @Stats godoc
+// @Summary Cache statistics
+// @Description Hits, misses, errors and invalidations of the cache since the server started
+// @Tags Cache
+// @Produce json
+// @Success 200 {object} Stats
+// @Router /cache/stats [get]
+func (cc *CacheController) Stats(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(cc.cache.Metrics.Stats())
+}
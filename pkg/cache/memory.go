@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// MemoryStore is an LRU cache of at most size entries in process, which is
+// enough for a single instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	// recent holds the entries, most recently used first
+	recent *list.List
+	now    func() time.Time
+}
+
+func NewMemoryStore(size int) *MemoryStore {
+	return &MemoryStore{size: size, entries: map[string]*list.Element{}, recent: list.New(), now: time.Now}
+}
+
+func (ms *MemoryStore) Get(key string) ([]byte, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	element, ok := ms.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := element.Value.(*entry)
+	if !e.expires.IsZero() && !ms.now().Before(e.expires) {
+		ms.remove(element)
+		return nil, false, nil
+	}
+	ms.recent.MoveToFront(element)
+	return e.value, true, nil
+}
+
+func (ms *MemoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var expires time.Time
+	if ttl > 0 {
+		expires = ms.now().Add(ttl)
+	}
+	if element, ok := ms.entries[key]; ok {
+		e := element.Value.(*entry)
+		e.value, e.expires = value, expires
+		ms.recent.MoveToFront(element)
+		return nil
+	}
+	ms.entries[key] = ms.recent.PushFront(&entry{key: key, value: value, expires: expires})
+	for ms.recent.Len() > ms.size {
+		ms.remove(ms.recent.Back())
+	}
+	return nil
+}
+
+// Len returns how many entries are cached, expired ones included until
+// they're looked up or evicted
+func (ms *MemoryStore) Len() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.recent.Len()
+}
+
+func (ms *MemoryStore) remove(element *list.Element) {
+	ms.recent.Remove(element)
+	delete(ms.entries, element.Value.(*entry).key)
+}
@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Bypass tells whether the request asked not to be served from the cache,
+// with Cache-Control: no-cache
+func Bypass(c *fiber.Ctx) bool {
+	return strings.Contains(strings.ToLower(c.Get(BypassHeader)), "no-cache")
+}
+
+// Invalidate returns a middleware that invalidates the scope of each
+// successful write, for data cached in a scope that changes along with
+// other resources
+func Invalidate(cache *Cache, scope func(c *fiber.Ctx) string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		method := c.Method()
+		if err == nil && method != fiber.MethodGet && method != fiber.MethodHead && c.Response().StatusCode() < fiber.StatusBadRequest {
+			cache.Invalidate(scope(c))
+		}
+		return err
+	}
+}
@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisTimeout   = 2 * time.Second
+	redisIdleConns = 16
+)
+
+// RedisStore keeps entries in Redis, or any server speaking its protocol, so
+// that instances share them. It speaks just enough of the protocol for GET
+// and SET.
+type RedisStore struct {
+	addr     string
+	username string
+	password string
+	db       int
+	idle     chan *redisConn
+}
+
+// NewRedisStore connects to redis://[[user]:password@]host[:port][/db]
+func NewRedisStore(rawUrl string) (*RedisStore, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Scheme != "redis" || u.Hostname() == "" {
+		return nil, errors.New("the Redis URL must look like redis://[:password@]host[:port][/db]")
+	}
+	rs := &RedisStore{addr: u.Host, idle: make(chan *redisConn, redisIdleConns)}
+	if u.Port() == "" {
+		rs.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		rs.username = u.User.Username()
+		rs.password, _ = u.User.Password()
+	}
+	if path := strings.TrimPrefix(u.Path, "/"); path != "" {
+		if rs.db, err = strconv.Atoi(path); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", path)
+		}
+	}
+	// fail at startup rather than on the first request
+	conn, err := rs.dial()
+	if err != nil {
+		return nil, err
+	}
+	rs.release(conn)
+	return rs, nil
+}
+
+func (rs *RedisStore) Get(key string) ([]byte, bool, error) {
+	reply, err := rs.do("GET", key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected reply to GET: %v", reply)
+	}
+	return value, true, nil
+}
+
+func (rs *RedisStore) Set(key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := rs.do(args...)
+	return err
+}
+
+// Close closes the idle connections
+func (rs *RedisStore) Close() {
+	for {
+		select {
+		case conn := <-rs.idle:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (rs *RedisStore) do(args ...string) (any, error) {
+	var conn *redisConn
+	select {
+	case conn = <-rs.idle:
+	default:
+		var err error
+		if conn, err = rs.dial(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := conn.do(args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// the connection is in an unknown state
+		conn.Close()
+		return nil, err
+	}
+	rs.release(conn)
+	return reply, err
+}
+
+func (rs *RedisStore) release(conn *redisConn) {
+	select {
+	case rs.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (rs *RedisStore) dial() (*redisConn, error) {
+	netConn, err := net.DialTimeout("tcp", rs.addr, redisTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+	if rs.password != "" {
+		args := []string{"AUTH", rs.password}
+		if rs.username != "" {
+			args = []string{"AUTH", rs.username, rs.password}
+		}
+		if _, err := conn.do(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if rs.db != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(rs.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// redisError is an error reply, after which the connection is still usable
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (rc *redisConn) do(args ...string) (any, error) {
+	rc.SetDeadline(time.Now().Add(redisTimeout))
+	command := new(strings.Builder)
+	fmt.Fprintf(command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(rc, command.String()); err != nil {
+		return nil, err
+	}
+	return rc.reply()
+}
+
+// reply reads a reply: a string, an error, an integer, a bulk string as
+// []byte, an array as []any, or nil
+func (rc *redisConn) reply() (any, error) {
+	line, err := rc.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	kind, content := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return content, nil
+	case '-':
+		return nil, redisError(content)
+	case ':':
+		return strconv.ParseInt(content, 10, 64)
+	case '$':
+		length, err := strconv.Atoi(content)
+		if err != nil || length < 0 {
+			return nil, err
+		}
+		value := make([]byte, length+2)
+		if _, err := io.ReadFull(rc.reader, value); err != nil {
+			return nil, err
+		}
+		return value[:length], nil
+	case '*':
+		length, err := strconv.Atoi(content)
+		if err != nil || length < 0 {
+			return nil, err
+		}
+		values := make([]any, length)
+		for i := range values {
+			if values[i], err = rc.reply(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+}
@@ -0,0 +1,8 @@
+package cache
+
+import "github.com/gofiber/fiber/v2"
+
+func GetCacheRoutes(router fiber.Router, controller *CacheController) fiber.Router {
+	router.Get("/stats", controller.Stats)
+	return router
+}
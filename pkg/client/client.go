@@ -0,0 +1,238 @@
+// Package client is a Go client for the To Do REST API.
+//
+//	c := client.New("https://todo.example.com", client.WithApiKey(key))
+//	created, err := c.Todos.Create(ctx, todo.CreateTodoDto{Title: "Write the report"})
+//
+// Requests that fail on the network or with 429, 502, 503 or 504 are retried
+// with exponential backoff, honoring Retry-After. Creates send an
+// Idempotency-Key, so retrying them never creates a todo twice.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetries = 3
+	defaultBackoff = 200 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+	// consistencyHeader carries the token the server hands out with writes,
+	// which sends the reads that follow to its primary database
+	consistencyHeader = "X-Consistency-Token"
+)
+
+type Client struct {
+	Todos *TodoService
+
+	baseUrl   string
+	apiKey    string
+	org       string
+	http      *http.Client
+	retries   int
+	backoff   time.Duration
+	userAgent string
+
+	mu sync.Mutex
+	// consistency is the token of the last write, sent back so the client
+	// reads its own writes
+	consistency string
+}
+
+type Option func(*Client)
+
+// WithApiKey authenticates requests with the API key
+func WithApiKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithOrg scopes requests to an organization, by id or slug
+func WithOrg(org string) Option {
+	return func(c *Client) { c.org = org }
+}
+
+// WithHttpClient sends requests with the given HTTP client instead of one
+// with a 30 seconds timeout
+func WithHttpClient(client *http.Client) Option {
+	return func(c *Client) { c.http = client }
+}
+
+// WithRetries sets how many times a failed request is retried, zero to
+// disable retries, and the wait before the first retry, which doubles with
+// each attempt
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithUserAgent identifies the application making the requests
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// New creates a client for the server at baseUrl, such as
+// http://localhost:3000
+func New(baseUrl string, options ...Option) *Client {
+	c := &Client{
+		baseUrl:   strings.TrimSuffix(baseUrl, "/") + "/api",
+		http:      &http.Client{Timeout: 30 * time.Second},
+		retries:   defaultRetries,
+		backoff:   defaultBackoff,
+		userAgent: "fiber-todo-go",
+	}
+	for _, option := range options {
+		option(c)
+	}
+	c.Todos = &TodoService{client: c}
+	return c
+}
+
+// request is a call to the API. Only idempotent requests are retried, which
+// POSTs are when they carry an idempotency key.
+type request struct {
+	method         string
+	path           string
+	query          url.Values
+	body           any
+	idempotencyKey string
+}
+
+func (r request) retryable() bool {
+	return r.method != http.MethodPost || r.idempotencyKey != ""
+}
+
+// do sends the request, retrying it when it may succeed later, and decodes
+// the response into out. It returns the headers of the response.
+func (c *Client) do(ctx context.Context, r request, out any) (http.Header, error) {
+	var body []byte
+	if r.body != nil {
+		var err error
+		if body, err = json.Marshal(r.body); err != nil {
+			return nil, err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		res, err := c.send(ctx, r, body)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var wait time.Duration
+		if err == nil {
+			if res.StatusCode < 400 {
+				defer res.Body.Close()
+				if token := res.Header.Get(consistencyHeader); token != "" {
+					c.mu.Lock()
+					c.consistency = token
+					c.mu.Unlock()
+				}
+				if out == nil || res.StatusCode == http.StatusNoContent {
+					return res.Header, nil
+				}
+				return res.Header, json.NewDecoder(res.Body).Decode(out)
+			}
+			err = errorFrom(res)
+			wait = retryAfter(res)
+		}
+		if attempt >= c.retries || !r.retryable() || !temporary(err) {
+			return nil, err
+		}
+		if wait == 0 {
+			wait = c.backoffFor(attempt)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, r request, body []byte) (*http.Response, error) {
+	target := c.baseUrl + r.path
+	if len(r.query) > 0 {
+		target += "?" + r.query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if c.org != "" {
+		req.Header.Set("X-Org", c.org)
+	}
+	if r.idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", r.idempotencyKey)
+	}
+	c.mu.Lock()
+	if c.consistency != "" {
+		req.Header.Set(consistencyHeader, c.consistency)
+	}
+	c.mu.Unlock()
+	return c.http.Do(req)
+}
+
+func (c *Client) backoffFor(attempt int) time.Duration {
+	wait := time.Duration(float64(c.backoff) * math.Pow(2, float64(attempt)))
+	if wait > maxBackoff || wait <= 0 {
+		return maxBackoff
+	}
+	return wait
+}
+
+// temporary tells whether the request may succeed if it's sent again
+func temporary(err error) bool {
+	var apiError *Error
+	if errors.As(err, &apiError) {
+		switch apiError.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	// anything else failed before a response came back
+	return true
+}
+
+func retryAfter(res *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	if wait := time.Duration(seconds) * time.Second; wait < maxBackoff {
+		return wait
+	}
+	return maxBackoff
+}
+
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return hex.EncodeToString(key)
+}
@@ -0,0 +1,311 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/auth"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/consistency"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type mockKeyRepository struct {
+	auth.IApiKeyRepository
+}
+
+func (mr *mockKeyRepository) FindByHash(hash string) (*auth.ApiKey, error) {
+	if hash != auth.HashKey("secret") {
+		return nil, sql.ErrNoRows
+	}
+	return &auth.ApiKey{Id: 1, Scopes: auth.Scopes}, nil
+}
+
+func (mr *mockKeyRepository) Touch(id int) error {
+	return nil
+}
+
+type mockTodoRepository struct {
+	todo.ITodoRepository
+	mu    sync.Mutex
+	todos []todo.Todo
+}
+
+func (mr *mockTodoRepository) Create(dto todo.CreateTodoDto) (*todo.Todo, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	for _, t := range mr.todos {
+		if t.Title == dto.Title {
+			return nil, errors.New("duplicate title")
+		}
+	}
+	t := todo.Todo{Id: len(mr.todos) + 1, Title: dto.Title, Completed: dto.Completed, OrgId: dto.OrgId}
+	mr.todos = append(mr.todos, t)
+	return &t, nil
+}
+
+func (mr *mockTodoRepository) List(filter todo.ListFilter) ([]todo.Todo, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	todos := []todo.Todo{}
+	for _, t := range mr.todos {
+		if t.Id <= filter.AfterId || (filter.Completed != nil && t.Completed != *filter.Completed) {
+			continue
+		}
+		if filter.Limit > 0 && len(todos) == filter.Limit {
+			break
+		}
+		todos = append(todos, t)
+	}
+	return todos, nil
+}
+
+func (mr *mockTodoRepository) Retrieve(orgId int, id int) (*todo.Todo, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	for _, t := range mr.todos {
+		if t.Id == id {
+			return &t, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (mr *mockTodoRepository) Update(t todo.Todo) (*todo.Todo, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.todos[t.Id-1] = t
+	return &t, nil
+}
+
+func (mr *mockTodoRepository) Delete(orgId int, id int) (int64, error) {
+	return 1, nil
+}
+
+func (mr *mockTodoRepository) WithTx(work func(repository todo.ITodoRepository, tx *database.Database) error) error {
+	return work(mr, nil)
+}
+
+// testServer serves the todo routes in process, failing the requests it's
+// told to with 503
+type testServer struct {
+	url             string
+	repository      *mockTodoRepository
+	mu              sync.Mutex
+	failures        int
+	requests        int
+	idempotencyKeys []string
+	// consistency is the consistency token of the last request
+	consistency string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	server := &testServer{repository: new(mockTodoRepository)}
+	app := fiber.New(fiber.Config{
+		DisableStartupMessage: true,
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			code := fiber.StatusInternalServerError
+			var e *fiber.Error
+			if errors.As(err, &e) {
+				code = e.Code
+			}
+			return c.Status(code).JSON(fiber.Map{"error": err.Error(), "status_code": code})
+		},
+	})
+	app.Use(func(c *fiber.Ctx) error {
+		server.mu.Lock()
+		server.requests++
+		server.consistency = c.Get(consistency.Header)
+		if key := c.Get("Idempotency-Key"); key != "" {
+			server.idempotencyKeys = append(server.idempotencyKeys, key)
+		}
+		fail := server.failures > 0
+		if fail {
+			server.failures--
+		}
+		server.mu.Unlock()
+		if fail {
+			c.Set(fiber.HeaderRetryAfter, "0")
+			return fiber.NewError(fiber.StatusServiceUnavailable, "try again")
+		}
+		common.SetOrgId(c, common.DefaultOrgId)
+		return c.Next()
+	})
+	api := app.Group("/api", auth.Authenticate(new(mockKeyRepository), true),
+		consistency.New(consistency.Config{Window: time.Minute, Secret: []byte("s3cret")}))
+	todo.GetTodoRoutes(api.Group("/todos"), todo.NewTodoController(server.repository, server.repository, events.NewBus(), nil))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(listener)
+	t.Cleanup(func() { app.Shutdown() })
+	server.url = "http://" + listener.Addr().String()
+	return server
+}
+
+func (s *testServer) fail(times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = times
+	s.requests = 0
+	s.idempotencyKeys = nil
+}
+
+func TestTodos(t *testing.T) {
+	server := newTestServer(t)
+	c := New(server.url, WithApiKey("secret"), WithRetries(2, time.Millisecond))
+	ctx := context.Background()
+
+	created, err := c.Todos.Create(ctx, todo.CreateTodoDto{Title: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Id != 1 || created.Title != "first" {
+		t.Errorf("Unexpected todo %+v", created)
+	}
+
+	_, err = c.Todos.Create(ctx, todo.CreateTodoDto{Title: "first"})
+	var apiError *Error
+	if !errors.Is(err, ErrConflict) || !errors.As(err, &apiError) || apiError.Message != "todo already exists" {
+		t.Errorf("Expected a conflict, got %v", err)
+	}
+
+	updated, err := c.Todos.Update(ctx, 1, todo.UpdateTodoDto{Title: "first", Completed: true})
+	if err != nil || !updated.Completed {
+		t.Errorf("Expected the todo to be completed, got %+v, %v", updated, err)
+	}
+
+	if _, err := c.Todos.Retrieve(ctx, 99); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected not found, got %v", err)
+	}
+
+	if err := c.Todos.Delete(ctx, 1); err != nil {
+		t.Errorf("Expected the todo to be deleted, got %v", err)
+	}
+
+	anonymous := New(server.url, WithRetries(0, 0))
+	if _, err := anonymous.Todos.Retrieve(ctx, 1); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected unauthorized without a key, got %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	server := newTestServer(t)
+	for i := 0; i < 7; i++ {
+		server.repository.todos = append(server.repository.todos, todo.Todo{Id: i + 1, Title: "todo", Completed: i%2 == 0})
+	}
+	c := New(server.url, WithApiKey("secret"))
+	ctx := context.Background()
+
+	server.fail(0)
+	todos, err := c.Todos.List(ctx, ListOptions{PageSize: 3}).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 7 || todos[6].Id != 7 {
+		t.Errorf("Expected the 7 todos, got %+v", todos)
+	}
+	if server.requests != 3 {
+		t.Errorf("Expected 3 pages, got %d requests", server.requests)
+	}
+
+	completed := true
+	it := c.Todos.List(ctx, ListOptions{Completed: &completed, PageSize: 2})
+	count := 0
+	for it.Next() {
+		if !it.Todo().Completed {
+			t.Errorf("Expected only completed todos, got %+v", it.Todo())
+		}
+		count++
+	}
+	if it.Err() != nil || count != 4 {
+		t.Errorf("Expected 4 completed todos, got %d, %v", count, it.Err())
+	}
+
+	server.repository.todos = nil
+	empty := c.Todos.List(ctx, ListOptions{})
+	if empty.Next() || empty.Err() != nil {
+		t.Errorf("Expected an empty list, got %v", empty.Err())
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+	c := New(server.url, WithApiKey("secret"))
+	created, err := c.Todos.Create(ctx, todo.CreateTodoDto{Title: "written"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.consistency != "" {
+		t.Errorf("Expected no consistency token before a write, got %q", server.consistency)
+	}
+	if _, err := c.Todos.Retrieve(ctx, created.Id); err != nil {
+		t.Fatal(err)
+	}
+	if server.consistency == "" {
+		t.Error("Expected the read after a write to carry the consistency token")
+	}
+}
+
+func TestRetries(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+
+	t.Run("should retry until the server recovers", func(t *testing.T) {
+		c := New(server.url, WithApiKey("secret"), WithRetries(2, time.Millisecond))
+		server.fail(2)
+		if _, err := c.Todos.Create(ctx, todo.CreateTodoDto{Title: "retried"}); err != nil {
+			t.Fatal(err)
+		}
+		if server.requests != 3 {
+			t.Errorf("Expected 3 attempts, got %d", server.requests)
+		}
+		keys := server.idempotencyKeys
+		if len(keys) != 3 || keys[0] == "" || keys[0] != keys[1] || keys[1] != keys[2] {
+			t.Errorf("Expected every attempt to carry the same idempotency key, got %v", keys)
+		}
+	})
+
+	t.Run("should give up after the retries", func(t *testing.T) {
+		c := New(server.url, WithApiKey("secret"), WithRetries(1, time.Millisecond))
+		server.fail(5)
+		_, err := c.Todos.Retrieve(ctx, 1)
+		if !errors.Is(err, ErrServer) || server.requests != 2 {
+			t.Errorf("Expected a server error after 2 attempts, got %v after %d", err, server.requests)
+		}
+	})
+
+	t.Run("should not retry client errors", func(t *testing.T) {
+		c := New(server.url, WithApiKey("secret"), WithRetries(3, time.Millisecond))
+		server.fail(0)
+		if _, err := c.Todos.Retrieve(ctx, 99); !errors.Is(err, ErrNotFound) || server.requests != 1 {
+			t.Errorf("Expected a single attempt, got %d", server.requests)
+		}
+	})
+
+	t.Run("should stop when the context is done", func(t *testing.T) {
+		c := New(server.url, WithApiKey("secret"), WithRetries(3, time.Hour))
+		server.fail(5)
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		// Retry-After 0 falls back to the backoff, an hour here
+		if _, err := c.Todos.Retrieve(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the deadline to stop the retries, got %v", err)
+		}
+		if time.Since(start) > time.Second {
+			t.Error("Expected the retries to stop with the context")
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+const defaultPageSize = 100
+
+// TodoService calls the /todos endpoints
+type TodoService struct {
+	client *Client
+}
+
+func (s *TodoService) Create(ctx context.Context, dto todo.CreateTodoDto) (*todo.Todo, error) {
+	var created todo.Todo
+	_, err := s.client.do(ctx, request{method: http.MethodPost, path: "/todos", body: dto, idempotencyKey: newIdempotencyKey()}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *TodoService) Retrieve(ctx context.Context, id int) (*todo.Todo, error) {
+	var t todo.Todo
+	if _, err := s.client.do(ctx, request{method: http.MethodGet, path: todoPath(id)}, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Update replaces every field of the todo
+func (s *TodoService) Update(ctx context.Context, id int, dto todo.UpdateTodoDto) (*todo.Todo, error) {
+	var updated todo.Todo
+	if _, err := s.client.do(ctx, request{method: http.MethodPut, path: todoPath(id), body: dto}, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *TodoService) Delete(ctx context.Context, id int) error {
+	_, err := s.client.do(ctx, request{method: http.MethodDelete, path: todoPath(id)}, nil)
+	return err
+}
+
+// Archive archives the todo, or unarchives it when archived is false
+func (s *TodoService) Archive(ctx context.Context, id int, archived bool) (*todo.Todo, error) {
+	path := todoPath(id) + "/archive"
+	if !archived {
+		path = todoPath(id) + "/unarchive"
+	}
+	var t todo.Todo
+	if _, err := s.client.do(ctx, request{method: http.MethodPost, path: path}, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+type ListOptions struct {
+	// Completed only lists completed (true) or open (false) todos
+	Completed *bool
+	// ListId only lists the todos of a list
+	ListId int
+	// IncludeArchived lists archived todos too
+	IncludeArchived bool
+	// Assignee only lists the todos assigned to "me", to "none" or to a
+	// user id
+	Assignee string
+	// PageSize is how many todos each request fetches, 100 by default
+	PageSize int
+}
+
+// List returns an iterator over the todos, fetching them a page at a time as
+// it advances
+func (s *TodoService) List(ctx context.Context, options ListOptions) *TodoIterator {
+	if options.PageSize <= 0 {
+		options.PageSize = defaultPageSize
+	}
+	return &TodoIterator{service: s, ctx: ctx, options: options}
+}
+
+// TodoIterator goes through the pages of a list:
+//
+//	it := c.Todos.List(ctx, client.ListOptions{})
+//	for it.Next() {
+//		fmt.Println(it.Todo().Title)
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type TodoIterator struct {
+	service *TodoService
+	ctx     context.Context
+	options ListOptions
+	page    []todo.Todo
+	index   int
+	cursor  string
+	last    bool
+	err     error
+}
+
+// Next advances to the next todo, fetching the next page when needed. It
+// returns false at the end of the list or on an error, see Err.
+func (it *TodoIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.index++
+	for it.index >= len(it.page) {
+		if it.last {
+			return false
+		}
+		if it.err = it.fetch(); it.err != nil {
+			return false
+		}
+		it.index = 0
+	}
+	return true
+}
+
+// Todo is the todo Next advanced to
+func (it *TodoIterator) Todo() todo.Todo {
+	return it.page[it.index]
+}
+
+func (it *TodoIterator) Err() error {
+	return it.err
+}
+
+// All collects the remaining todos
+func (it *TodoIterator) All() ([]todo.Todo, error) {
+	todos := []todo.Todo{}
+	for it.Next() {
+		todos = append(todos, it.Todo())
+	}
+	return todos, it.Err()
+}
+
+func (it *TodoIterator) fetch() error {
+	query := url.Values{"limit": {strconv.Itoa(it.options.PageSize)}}
+	if it.cursor != "" {
+		query.Set("cursor", it.cursor)
+	}
+	if it.options.Completed != nil {
+		query.Set("completed", strconv.FormatBool(*it.options.Completed))
+	}
+	if it.options.ListId != 0 {
+		query.Set("list_id", strconv.Itoa(it.options.ListId))
+	}
+	if it.options.IncludeArchived {
+		query.Set("include", "archived")
+	}
+	if it.options.Assignee != "" {
+		query.Set("assignee", it.options.Assignee)
+	}
+	page := []todo.Todo{}
+	header, err := it.service.client.do(it.ctx, request{method: http.MethodGet, path: "/todos", query: query}, &page)
+	if err != nil {
+		return err
+	}
+	it.page = page
+	it.cursor = header.Get(todo.HeaderNextCursor)
+	it.last = it.cursor == ""
+	return nil
+}
+
+func todoPath(id int) string {
+	return fmt.Sprintf("/todos/%d", id)
+}
@@ -0,0 +1,25 @@
+package collab
+
+import (
+	"github.com/raphael-foliveira/fiber-todo/pkg/list"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/stream"
+)
+
+type CollabModule struct {
+	Hub        *Hub
+	Forwarder  *Forwarder
+	Controller *CollabController
+}
+
+// New wires the collaboration module on top of the stream module's events, so
+// websocket clients see the same changes, from every instance, as SSE clients.
+// Presence is only shared between clients connected to the same instance.
+func New(events *stream.Hub, listRepository list.IListRepository, authorizer *sharing.Authorizer, config Config) *CollabModule {
+	hub := NewHub()
+	return &CollabModule{
+		Hub:        hub,
+		Forwarder:  NewForwarder(events, hub, authorizer),
+		Controller: NewCollabController(hub, listRepository, authorizer, config),
+	}
+}
@@ -0,0 +1,206 @@
+package collab
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/auth"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/stream"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+// mockSharingRepository leaves list 1 open to everyone and gives list 2 to
+// user 9; todos are judged by the list they are in
+type mockSharingRepository struct {
+	sharing.ISharingRepository
+}
+
+func (mr *mockSharingRepository) TodoAccess(id int, userId *int) (*sharing.Access, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (mr *mockSharingRepository) ListAccess(id int, userId *int) (*sharing.Access, error) {
+	if id == 2 {
+		return &sharing.Access{Owners: []int{9}}, nil
+	}
+	return &sharing.Access{}, nil
+}
+
+func drain(s *session) []ServerMessage {
+	messages := []ServerMessage{}
+	for {
+		select {
+		case message := <-s.send:
+			messages = append(messages, message)
+		default:
+			return messages
+		}
+	}
+}
+
+func TestHub(t *testing.T) {
+	t.Run("should share presence within a list", func(t *testing.T) {
+		hub := NewHub()
+		alice := newSession("a", "alice", nil, common.DefaultOrgId, func() {})
+		bob := newSession("b", "bob", nil, common.DefaultOrgId, func() {})
+		hub.join(alice, 1)
+		hub.join(bob, 1)
+		todoId := 7
+		hub.setPresence(bob, &todoId, StateEditing)
+		messages := drain(alice)
+		last := messages[len(messages)-1]
+		if last.Type != MessagePresence || len(last.Presence) != 2 {
+			t.Fatalf("Expected presence of 2 sessions, got %+v", last)
+		}
+		if p := last.Presence[1]; p.Name != "bob" || p.State != StateEditing || *p.TodoId != 7 {
+			t.Errorf("Expected bob to be editing todo 7, got %+v", p)
+		}
+		hub.leave(bob)
+		messages = drain(alice)
+		if len(messages[len(messages)-1].Presence) != 1 {
+			t.Errorf("Expected bob to have left, got %+v", messages)
+		}
+	})
+
+	t.Run("should only broadcast to the subscribed list", func(t *testing.T) {
+		hub := NewHub()
+		first := newSession("a", "first", nil, common.DefaultOrgId, func() {})
+		second := newSession("b", "second", nil, common.DefaultOrgId, func() {})
+		hub.join(first, 1)
+		hub.join(second, 2)
+		drain(first)
+		drain(second)
+		hub.Broadcast(1, ServerMessage{Type: todo.EventCreated, ListId: 1})
+		if len(drain(first)) != 1 || len(drain(second)) != 0 {
+			t.Errorf("Expected only the first list to receive the event")
+		}
+	})
+
+	t.Run("should drop sessions that fall behind", func(t *testing.T) {
+		hub := NewHub()
+		dropped := false
+		slow := newSession("a", "slow", nil, common.DefaultOrgId, func() { dropped = true })
+		hub.join(slow, 1)
+		for i := 0; i < sendBuffer; i++ {
+			hub.Broadcast(1, ServerMessage{Type: todo.EventUpdated})
+		}
+		if !dropped {
+			t.Errorf("Expected slow session to be dropped")
+		}
+	})
+
+	t.Run("should refuse presence outside of a list", func(t *testing.T) {
+		hub := NewHub()
+		if hub.setPresence(newSession("a", "a", nil, common.DefaultOrgId, func() {}), nil, StateViewing) {
+			t.Errorf("Expected presence to be refused")
+		}
+	})
+}
+
+func TestForwarder(t *testing.T) {
+	t.Run("should tell the previous list a todo left it", func(t *testing.T) {
+		hub := NewHub()
+		ownerId := 9
+		owner := &common.Principal{UserId: &ownerId}
+		from := newSession("a", "from", owner, common.DefaultOrgId, func() {})
+		to := newSession("b", "to", owner, common.DefaultOrgId, func() {})
+		hub.join(from, 1)
+		hub.join(to, 2)
+		drain(from)
+		drain(to)
+		forwarder := NewForwarder(nil, hub, sharing.NewAuthorizer(&mockSharingRepository{}))
+		forwarder.route(stream.StoredEvent{Id: 5, Type: todo.EventUpdated, Data: json.RawMessage(`{"id":3,"list_id":2,"previous_list_id":1}`)})
+		removed := drain(from)
+		if len(removed) != 1 || removed[0].Type != MessageRemoved || removed[0].ListId != 1 || removed[0].Todo.Id != 3 {
+			t.Errorf("Expected the first list to hear todo 3 was removed, got %+v", removed)
+		}
+		updated := drain(to)
+		if len(updated) != 1 || updated[0].Type != todo.EventUpdated || updated[0].ListId != 2 {
+			t.Errorf("Expected the second list to receive the update, got %+v", updated)
+		}
+	})
+
+	t.Run("should tell the list a todo was taken out of", func(t *testing.T) {
+		hub := NewHub()
+		s := newSession("a", "a", nil, common.DefaultOrgId, func() {})
+		hub.join(s, 1)
+		drain(s)
+		NewForwarder(nil, hub, sharing.NewAuthorizer(&mockSharingRepository{})).route(stream.StoredEvent{Id: 6, Type: todo.EventUpdated, Data: json.RawMessage(`{"id":3,"list_id":null,"previous_list_id":1}`)})
+		if messages := drain(s); len(messages) != 1 || messages[0].Type != MessageRemoved {
+			t.Errorf("Expected a removal, got %+v", messages)
+		}
+	})
+
+	t.Run("should only send todos the session may see", func(t *testing.T) {
+		hub := NewHub()
+		stranger := 1
+		from := newSession("a", "from", &common.Principal{UserId: &stranger}, common.DefaultOrgId, func() {})
+		to := newSession("b", "to", &common.Principal{UserId: &stranger}, common.DefaultOrgId, func() {})
+		elsewhere := newSession("c", "elsewhere", &common.Principal{}, 2, func() {})
+		hub.join(from, 1)
+		hub.join(to, 2)
+		hub.join(elsewhere, 2)
+		drain(from)
+		drain(to)
+		drain(elsewhere)
+		NewForwarder(nil, hub, sharing.NewAuthorizer(&mockSharingRepository{})).route(stream.StoredEvent{Id: 7, Type: todo.EventUpdated, Data: json.RawMessage(`{"id":3,"title":"secret","list_id":2,"previous_list_id":1}`)})
+		removed := drain(from)
+		if len(removed) != 1 || removed[0].Type != MessageRemoved || removed[0].TodoId != 3 || removed[0].Todo != nil {
+			t.Errorf("Expected the first list to only hear the id of the todo that left it, got %+v", removed)
+		}
+		if messages := drain(to); len(messages) != 0 {
+			t.Errorf("Expected no event about a todo the session can't see, got %+v", messages)
+		}
+		if messages := drain(elsewhere); len(messages) != 0 {
+			t.Errorf("Expected no event from another organization, got %+v", messages)
+		}
+	})
+}
+
+func TestUpgrade(t *testing.T) {
+	tests := []struct {
+		name         string
+		origin       string
+		scopes       []string
+		allowed      []string
+		expectStatus int
+	}{
+		{"test same origin", "http://example.com", []string{auth.ScopeRead}, nil, 200},
+		{"test no origin", "", []string{auth.ScopeRead}, nil, 200},
+		{"test foreign origin", "https://evil.test", []string{auth.ScopeRead}, nil, 403},
+		{"test allowed origin", "https://app.test", []string{auth.ScopeRead}, []string{"https://app.test"}, 200},
+		{"test any origin", "https://app.test", []string{auth.ScopeRead}, []string{"*"}, 200},
+		{"test key without read scope", "http://example.com", []string{auth.ScopeWrite}, nil, 403},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			controller := NewCollabController(NewHub(), nil, nil, Config{AllowedOrigins: test.allowed})
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				common.SetPrincipal(c, &common.Principal{Scopes: test.scopes})
+				return c.Next()
+			})
+			app.Get("/collab", controller.Upgrade, func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+			req, _ := http.NewRequest("GET", "http://example.com/collab", nil)
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", "websocket")
+			if test.origin != "" {
+				req.Header.Set("Origin", test.origin)
+			}
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Errorf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+		})
+	}
+}
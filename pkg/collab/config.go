@@ -0,0 +1,25 @@
+package collab
+
+import (
+	"os"
+	"strings"
+)
+
+// Config decides which web pages may open collaboration sessions
+type Config struct {
+	// AllowedOrigins are the origins, such as https://app.example.com, whose
+	// pages may connect besides the API's own. "*" allows every origin.
+	AllowedOrigins []string
+}
+
+// ConfigFromEnv reads COLLAB_ALLOWED_ORIGINS, a comma-separated list of
+// origins
+func ConfigFromEnv() Config {
+	config := Config{}
+	for _, origin := range strings.Split(os.Getenv("COLLAB_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			config.AllowedOrigins = append(config.AllowedOrigins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	return config
+}
@@ -0,0 +1,164 @@
+package collab
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/auth"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/list"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+)
+
+const (
+	pingInterval = 30 * time.Second
+	writeTimeout = 10 * time.Second
+)
+
+type CollabController struct {
+	hub            *Hub
+	listRepository list.IListRepository
+	authorizer     *sharing.Authorizer
+	config         Config
+}
+
+func NewCollabController(hub *Hub, listRepository list.IListRepository, authorizer *sharing.Authorizer, config Config) *CollabController {
+	return &CollabController{hub: hub, listRepository: listRepository, authorizer: authorizer, config: config}
+}
+
+// Upgrade rejects requests that aren't websocket handshakes, made with a key
+// lacking the read scope or from a page of an origin that isn't allowed.
+// Browsers don't apply CORS to websockets, so without the origin check any
+// site could open a session with the cookies or credentials of its visitor.
+func (cc *CollabController) Upgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+	if principal := common.GetPrincipal(c); principal != nil && !principal.HasScope(auth.ScopeRead) {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("API key lacks the %s scope", auth.ScopeRead))
+	}
+	if !cc.allowedOrigin(c) {
+		return fiber.NewError(fiber.StatusForbidden, "origin not allowed")
+	}
+	// the connection only sees locals that were set, not GetOrgId's default
+	common.SetOrgId(c, common.GetOrgId(c))
+	return c.Next()
+}
+
+// Connect serves one websocket connection. Clients send subscribe, unsubscribe
+// and presence messages; they receive a snapshot when they subscribe, then the
+// todo events and presence changes of that list, with todo.removed when a
+// todo moves out of it. Only lists the caller may view can be subscribed to.
+func (cc *CollabController) Connect(conn *websocket.Conn) {
+	principal, _ := conn.Locals(common.PrincipalLocal).(*common.Principal)
+	orgId, _ := conn.Locals(common.OrgLocal).(int)
+	name := conn.Query("name", "anonymous")
+	s := newSession(newSessionId(), name, principal, orgId, func() { conn.Close() })
+	done := make(chan struct{})
+	go cc.write(conn, s, done)
+	defer func() {
+		cc.hub.leave(s)
+		close(done)
+	}()
+	for {
+		var message ClientMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			return
+		}
+		cc.handle(s, principal, orgId, message)
+	}
+}
+
+func (cc *CollabController) handle(s *session, principal *common.Principal, orgId int, message ClientMessage) {
+	switch message.Type {
+	case MessageSubscribe:
+		if _, err := cc.listRepository.Retrieve(orgId, message.ListId); err != nil {
+			s.deliver(errorMessage("list %d not found", message.ListId))
+			return
+		}
+		role, err := cc.authorizer.ListRole(principal, message.ListId)
+		if err != nil {
+			s.deliver(errorMessage("list %d not found", message.ListId))
+			return
+		}
+		if role == sharing.RoleNone {
+			s.deliver(errorMessage("not allowed to view list %d", message.ListId))
+			return
+		}
+		todos, err := cc.listRepository.Todos(orgId, message.ListId, common.AudienceOf(principal), false)
+		if err != nil {
+			s.deliver(errorMessage("could not load list %d", message.ListId))
+			return
+		}
+		// the snapshot is queued before joining so it reaches the client ahead
+		// of any event or presence update for the list
+		s.deliver(ServerMessage{Type: MessageSnapshot, ListId: message.ListId, Todos: todos})
+		cc.hub.join(s, message.ListId)
+	case MessageUnsubscribe:
+		cc.hub.leave(s)
+	case MessagePresence:
+		if !common.Contains([]string{StateViewing, StateEditing}, message.State) {
+			s.deliver(errorMessage("unknown presence state %q", message.State))
+			return
+		}
+		if !cc.hub.setPresence(s, message.TodoId, message.State) {
+			s.deliver(errorMessage("subscribe to a list first"))
+		}
+	default:
+		s.deliver(errorMessage("unknown message type %q", message.Type))
+	}
+}
+
+func (cc *CollabController) write(conn *websocket.Conn, s *session, done <-chan struct{}) {
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case <-done:
+			return
+		case message := <-s.send:
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			err = conn.WriteJSON(message)
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+		}
+		if err != nil {
+			conn.Close()
+			return
+		}
+	}
+}
+
+// allowedOrigin tells whether the handshake comes from the API's own host, an
+// allowed origin or a client that isn't a browser and sends no Origin
+func (cc *CollabController) allowedOrigin(c *fiber.Ctx) bool {
+	origin := c.Get(fiber.HeaderOrigin)
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if u.Host == string(c.Request().Host()) {
+		return true
+	}
+	return common.Contains(cc.config.AllowedOrigins, "*") || common.Contains(cc.config.AllowedOrigins, strings.TrimSuffix(origin, "/"))
+}
+
+func errorMessage(format string, args ...any) ServerMessage {
+	return ServerMessage{Type: MessageError, Error: fmt.Sprintf(format, args...)}
+}
+
+func newSessionId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
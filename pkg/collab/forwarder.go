@@ -0,0 +1,100 @@
+package collab
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/stream"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+// Forwarder routes the change events relayed by the stream module to the
+// sessions watching the list each todo belongs to, like the SSE stream only
+// sending each session the todos its caller may see
+type Forwarder struct {
+	events     *stream.Hub
+	hub        *Hub
+	authorizer *sharing.Authorizer
+	stop       chan struct{}
+	done       sync.WaitGroup
+}
+
+func NewForwarder(events *stream.Hub, hub *Hub, authorizer *sharing.Authorizer) *Forwarder {
+	return &Forwarder{events: events, hub: hub, authorizer: authorizer}
+}
+
+func (f *Forwarder) Start() error {
+	f.stop = make(chan struct{})
+	f.done.Add(1)
+	go f.run()
+	return nil
+}
+
+func (f *Forwarder) Stop() {
+	close(f.stop)
+	f.done.Wait()
+}
+
+func (f *Forwarder) run() {
+	defer f.done.Done()
+	for {
+		events, unsubscribe := f.events.Subscribe()
+		closed := f.forward(events)
+		unsubscribe()
+		// the stream hub closes subscriptions that fall behind, in which case
+		// we simply pick up again from the next event
+		if !closed {
+			return
+		}
+	}
+}
+
+// forward returns true when the subscription was closed and false when the
+// forwarder is being stopped
+func (f *Forwarder) forward(events <-chan stream.StoredEvent) bool {
+	for {
+		select {
+		case <-f.stop:
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return true
+			}
+			f.route(event)
+		}
+	}
+}
+
+// route sends an event to the list of its todo and, when an update moved the
+// todo, tells the list it left that it was removed
+func (f *Forwarder) route(event stream.StoredEvent) {
+	var t todo.Todo
+	if err := json.Unmarshal(event.Data, &t); err != nil {
+		return
+	}
+	// events from before organizations existed belong to the default one
+	if t.OrgId == 0 {
+		t.OrgId = common.DefaultOrgId
+	}
+	if t.PreviousListId != nil {
+		for _, s := range f.hub.sessions(*t.PreviousListId) {
+			if s.orgId != t.OrgId {
+				continue
+			}
+			message := ServerMessage{Type: MessageRemoved, ListId: *t.PreviousListId, EventId: event.Id, TodoId: t.Id}
+			if f.authorizer.CanSee(s.principal, t) {
+				message.Todo = &t
+			}
+			s.deliver(message)
+		}
+	}
+	if t.ListId != nil {
+		for _, s := range f.hub.sessions(*t.ListId) {
+			if s.orgId == t.OrgId && f.authorizer.CanSee(s.principal, t) {
+				s.deliver(ServerMessage{Type: event.Type, ListId: *t.ListId, EventId: event.Id, Todo: &t})
+			}
+		}
+	}
+}
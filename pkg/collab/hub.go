@@ -0,0 +1,145 @@
+package collab
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+const sendBuffer = 64
+
+// session is one websocket connection. Everything but send, drop and the
+// caller it was opened by is guarded by the hub lock.
+type session struct {
+	id        string
+	name      string
+	principal *common.Principal
+	orgId     int
+	send      chan ServerMessage
+	drop      func()
+	listId    int
+	presence  Presence
+}
+
+func newSession(id string, name string, principal *common.Principal, orgId int, drop func()) *session {
+	return &session{
+		id:        id,
+		name:      name,
+		principal: principal,
+		orgId:     orgId,
+		send:      make(chan ServerMessage, sendBuffer),
+		drop:      drop,
+		presence:  Presence{SessionId: id, Name: name, State: StateViewing},
+	}
+}
+
+// deliver queues a message without blocking; a client that can't keep up is
+// disconnected rather than slowing the whole list down
+func (s *session) deliver(message ServerMessage) {
+	select {
+	case s.send <- message:
+	default:
+		s.drop()
+	}
+}
+
+// Hub keeps track of which sessions are in which list on this instance
+type Hub struct {
+	mu    sync.Mutex
+	rooms map[int]map[*session]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{rooms: map[int]map[*session]struct{}{}}
+}
+
+// join moves the session into a list, leaving the previous one
+func (h *Hub) join(s *session, listId int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leaveLocked(s)
+	if h.rooms[listId] == nil {
+		h.rooms[listId] = map[*session]struct{}{}
+	}
+	h.rooms[listId][s] = struct{}{}
+	s.listId = listId
+	s.presence.TodoId = nil
+	s.presence.State = StateViewing
+	h.announceLocked(listId)
+}
+
+func (h *Hub) leave(s *session) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leaveLocked(s)
+}
+
+func (h *Hub) leaveLocked(s *session) {
+	listId := s.listId
+	if listId == 0 {
+		return
+	}
+	delete(h.rooms[listId], s)
+	if len(h.rooms[listId]) == 0 {
+		delete(h.rooms, listId)
+	}
+	s.listId = 0
+	h.announceLocked(listId)
+}
+
+// setPresence records what the session is doing and tells the rest of its list
+func (h *Hub) setPresence(s *session, todoId *int, state string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s.listId == 0 {
+		return false
+	}
+	s.presence.TodoId = todoId
+	s.presence.State = state
+	h.announceLocked(s.listId)
+	return true
+}
+
+func (h *Hub) presence(listId int) []Presence {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.presenceLocked(listId)
+}
+
+func (h *Hub) presenceLocked(listId int) []Presence {
+	presence := []Presence{}
+	for s := range h.rooms[listId] {
+		presence = append(presence, s.presence)
+	}
+	sort.Slice(presence, func(i, j int) bool { return presence[i].SessionId < presence[j].SessionId })
+	return presence
+}
+
+func (h *Hub) announceLocked(listId int) {
+	message := ServerMessage{Type: MessagePresence, ListId: listId, Presence: h.presenceLocked(listId)}
+	for s := range h.rooms[listId] {
+		s.deliver(message)
+	}
+}
+
+// sessions returns the sessions in the list, for senders that decide per
+// session what to send without holding the lock
+func (h *Hub) sessions(listId int) []*session {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sessions := make([]*session, 0, len(h.rooms[listId]))
+	for s := range h.rooms[listId] {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// Broadcast sends a message to every session in the list
+func (h *Hub) Broadcast(listId int, message ServerMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.rooms[listId] {
+		s.deliver(message)
+	}
+}
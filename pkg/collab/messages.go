@@ -0,0 +1,53 @@
+package collab
+
+import "github.com/raphael-foliveira/fiber-todo/pkg/todo"
+
+// Message types sent by clients
+const (
+	MessageSubscribe   = "subscribe"
+	MessageUnsubscribe = "unsubscribe"
+	MessagePresence    = "presence"
+)
+
+// Message types sent by the server, besides the todo event types
+const (
+	MessageSnapshot = "snapshot"
+	MessageError    = "error"
+	// MessageRemoved tells a list that one of its todos was moved to another
+	// list or out of any list. Sessions that can't see the todo where it went
+	// only get its id.
+	MessageRemoved = "todo.removed"
+)
+
+// Presence states
+const (
+	StateViewing = "viewing"
+	StateEditing = "editing"
+)
+
+type ClientMessage struct {
+	Type   string `json:"type"`
+	ListId int    `json:"list_id"`
+	TodoId *int   `json:"todo_id"`
+	State  string `json:"state"`
+}
+
+type ServerMessage struct {
+	Type     string      `json:"type"`
+	ListId   int         `json:"list_id,omitempty"`
+	EventId  int64       `json:"event_id,omitempty"`
+	TodoId   int         `json:"todo_id,omitempty"`
+	Todo     *todo.Todo  `json:"todo,omitempty"`
+	Todos    []todo.Todo `json:"todos,omitempty"`
+	Presence []Presence  `json:"presence,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// Presence is what one connected client is doing in a list. TodoId is nil
+// while the client is looking at the list itself.
+type Presence struct {
+	SessionId string `json:"session_id"`
+	Name      string `json:"name"`
+	TodoId    *int   `json:"todo_id"`
+	State     string `json:"state"`
+}
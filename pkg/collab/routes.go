@@ -0,0 +1,11 @@
+package collab
+
+import (
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+func GetCollabRoutes(router fiber.Router, controller *CollabController) fiber.Router {
+	router.Get("/", controller.Upgrade, websocket.New(controller.Connect))
+	return router
+}
@@ -0,0 +1,22 @@
+package comment
+
+import (
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"github.com/raphael-foliveira/fiber-todo/pkg/user"
+)
+
+type CommentModule struct {
+	Repository ICommentRepository
+	Controller *CommentController
+}
+
+func New(db *database.Database, todos todo.ITodoRepository, users user.IUserRepository, authorizer *sharing.Authorizer, notifier Notifier) *CommentModule {
+	repository := NewCommentRepository(db)
+	controller := NewCommentController(repository, todos, users, authorizer, notifier)
+	return &CommentModule{
+		Repository: repository,
+		Controller: controller,
+	}
+}
@@ -0,0 +1,315 @@
+package comment
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"github.com/raphael-foliveira/fiber-todo/pkg/user"
+)
+
+type mockRepository struct {
+	comments []Comment
+}
+
+func (mr *mockRepository) Create(comment CreateCommentDto) (*Comment, error) {
+	created := Comment{Id: len(mr.comments) + 1, TodoId: comment.TodoId, AuthorId: &comment.AuthorId, Body: comment.Body, Mentions: mentionsOf(comment.MentionIds)}
+	mr.comments = append(mr.comments, created)
+	return &created, nil
+}
+
+func (mr *mockRepository) List(todoId int) ([]Comment, error) {
+	comments := []Comment{}
+	for _, comment := range mr.comments {
+		if comment.TodoId == todoId {
+			comments = append(comments, comment)
+		}
+	}
+	return comments, nil
+}
+
+func (mr *mockRepository) Retrieve(todoId int, id int) (*Comment, error) {
+	for _, comment := range mr.comments {
+		if comment.TodoId == todoId && comment.Id == id {
+			return &comment, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (mr *mockRepository) Update(todoId int, id int, update UpdateCommentDto) (*Comment, error) {
+	for i, comment := range mr.comments {
+		if comment.TodoId == todoId && comment.Id == id {
+			mr.comments[i].Body = update.Body
+			mr.comments[i].Mentions = mentionsOf(update.MentionIds)
+			return &mr.comments[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (mr *mockRepository) Delete(todoId int, id int) (int64, error) {
+	for i, comment := range mr.comments {
+		if comment.TodoId == todoId && comment.Id == id {
+			mr.comments = append(mr.comments[:i], mr.comments[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// WithTx undoes the changes of work when it fails, as a rollback would
+func (mr *mockRepository) WithTx(work func(repository ICommentRepository, tx *database.Database) error) error {
+	comments := append([]Comment{}, mr.comments...)
+	if err := work(mr, nil); err != nil {
+		mr.comments = comments
+		return err
+	}
+	return nil
+}
+
+type mockNotifier struct {
+	err error
+}
+
+func (mn *mockNotifier) Commented(tx *database.Database, orgId int, comment Comment, previous *Comment) error {
+	return mn.err
+}
+
+func mentionsOf(userIds []int) []Mention {
+	mentions := []Mention{}
+	for _, id := range userIds {
+		mentions = append(mentions, Mention{UserId: id})
+	}
+	return mentions
+}
+
+type mockTodoRepository struct {
+	todo.ITodoRepository
+}
+
+func (mr *mockTodoRepository) Retrieve(orgId int, id int) (*todo.Todo, error) {
+	if id > 2 {
+		return nil, sql.ErrNoRows
+	}
+	return &todo.Todo{Id: id, OrgId: orgId}, nil
+}
+
+type mockUserRepository struct {
+	user.IUserRepository
+}
+
+var userEmails = map[string]int{"ana@example.com": 1, "bob@example.com": 2, "eve@example.com": 3}
+
+func (mr *mockUserRepository) FindByEmail(email string) (*user.User, error) {
+	id, ok := userEmails[email]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &user.User{Id: id, Email: email}, nil
+}
+
+// mockSharingRepository has todo 1 owned by user 1 and shared with user 2,
+// and todo 2 unowned
+type mockSharingRepository struct {
+	sharing.ISharingRepository
+}
+
+func (mr *mockSharingRepository) TodoAccess(id int, userId *int) (*sharing.Access, error) {
+	if id == 2 {
+		return &sharing.Access{}, nil
+	}
+	access := &sharing.Access{Owners: []int{1}}
+	if userId != nil && *userId == 2 {
+		access.Grants = []sharing.Role{sharing.RoleViewer}
+	}
+	return access, nil
+}
+
+func userPrincipal(id int) *common.Principal {
+	return &common.Principal{KeyId: 1, UserId: &id}
+}
+
+func commentTestsSetup(principal *common.Principal, comments ...Comment) (*fiber.App, *mockRepository) {
+	mr := &mockRepository{comments: comments}
+	controller := NewCommentController(mr, &mockTodoRepository{}, &mockUserRepository{}, sharing.NewAuthorizer(&mockSharingRepository{}), nil)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		common.SetPrincipal(c, principal)
+		return c.Next()
+	})
+	GetCommentRoutes(app.Group("/todos"), controller)
+	return app, mr
+}
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		expect []string
+	}{
+		{"none", "no mentions here", []string{}},
+		{"start of body", "@Ana@Example.com look", []string{"ana@example.com"}},
+		{"after punctuation", "cc (@bob@example.com), @ana@example.com.", []string{"bob@example.com", "ana@example.com"}},
+		{"repeated", "@ana@example.com and @ana@example.com", []string{"ana@example.com"}},
+		{"plain email", "write to ana@example.com", []string{}},
+		{"handle without domain", "@ana", []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if mentions := parseMentions(test.body); !reflect.DeepEqual(mentions, test.expect) {
+				t.Errorf("Expected mentions %v, got %v", test.expect, mentions)
+			}
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name           string
+		principal      *common.Principal
+		url            string
+		body           string
+		expectStatus   int
+		expectMentions []Mention
+	}{
+		{"comment", userPrincipal(1), "/todos/1/comments", `{"body": "**done** soon"}`, 201, []Mention{}},
+		{"mentions users that can see the todo", userPrincipal(1), "/todos/1/comments",
+			`{"body": "@bob@example.com @eve@example.com @nobody@example.com"}`, 201, []Mention{{UserId: 2}}},
+		{"mentions anyone on unowned todos", userPrincipal(1), "/todos/2/comments", `{"body": "@eve@example.com"}`, 201, []Mention{{UserId: 3}}},
+		{"empty body", userPrincipal(1), "/todos/1/comments", `{"body": "  "}`, 400, nil},
+		{"body too long", userPrincipal(1), "/todos/1/comments", `{"body": "` + strings.Repeat("a", maxBodyLength+1) + `"}`, 400, nil},
+		{"service key", &common.Principal{KeyId: 1}, "/todos/1/comments", `{"body": "hi"}`, 403, nil},
+		{"unknown todo", userPrincipal(1), "/todos/9/comments", `{"body": "hi"}`, 404, nil},
+		{"invalid todo id", userPrincipal(1), "/todos/x/comments", `{"body": "hi"}`, 422, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app, _ := commentTestsSetup(test.principal)
+			response, err := app.Test(newRequest("POST", test.url, test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != test.expectStatus {
+				t.Fatalf("Expected status %d, got %d", test.expectStatus, response.StatusCode)
+			}
+			if test.expectMentions == nil {
+				return
+			}
+			var created Comment
+			json.NewDecoder(response.Body).Decode(&created)
+			if created.AuthorId == nil || *created.AuthorId != *test.principal.UserId {
+				t.Errorf("Expected author %d, got %v", *test.principal.UserId, created.AuthorId)
+			}
+			if !reflect.DeepEqual(created.Mentions, test.expectMentions) {
+				t.Errorf("Expected mentions %v, got %v", test.expectMentions, created.Mentions)
+			}
+		})
+	}
+}
+
+func TestNotifyInTx(t *testing.T) {
+	author := 1
+	mr := &mockRepository{comments: []Comment{{Id: 1, TodoId: 1, AuthorId: &author, Body: "hi"}}}
+	controller := NewCommentController(mr, &mockTodoRepository{}, &mockUserRepository{}, sharing.NewAuthorizer(&mockSharingRepository{}),
+		&mockNotifier{err: errors.New("error notifying")})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		common.SetPrincipal(c, userPrincipal(1))
+		return c.Next()
+	})
+	GetCommentRoutes(app.Group("/todos"), controller)
+	for _, request := range []*http.Request{
+		newRequest("POST", "/todos/1/comments", `{"body": "new"}`),
+		newRequest("PUT", "/todos/1/comments/1", `{"body": "edited"}`),
+	} {
+		response, err := app.Test(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != 500 {
+			t.Errorf("Expected a failure to notify to fail %s %s, got %d", request.Method, request.URL, response.StatusCode)
+		}
+	}
+	if len(mr.comments) != 1 || mr.comments[0].Body != "hi" {
+		t.Errorf("Expected the comments to be rolled back, got %+v", mr.comments)
+	}
+}
+
+func TestList(t *testing.T) {
+	author := 1
+	app, _ := commentTestsSetup(userPrincipal(2),
+		Comment{Id: 1, TodoId: 1, AuthorId: &author, Body: "first"},
+		Comment{Id: 2, TodoId: 2, AuthorId: &author, Body: "other todo"},
+	)
+	response, err := app.Test(newRequest("GET", "/todos/1/comments", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var comments []Comment
+	json.NewDecoder(response.Body).Decode(&comments)
+	if len(comments) != 1 || comments[0].Body != "first" {
+		t.Errorf("Expected the comment on todo 1, got %v", comments)
+	}
+	response, _ = app.Test(newRequest("GET", "/todos/9/comments", ""))
+	if response.StatusCode != 404 {
+		t.Errorf("Expected status 404 for an unknown todo, got %d", response.StatusCode)
+	}
+}
+
+func TestAuthorOnly(t *testing.T) {
+	tests := []struct {
+		name         string
+		principal    *common.Principal
+		method       string
+		url          string
+		body         string
+		expectStatus int
+	}{
+		{"author edits", userPrincipal(1), "PUT", "/todos/1/comments/1", `{"body": "edited @bob@example.com"}`, 200},
+		{"author deletes", userPrincipal(1), "DELETE", "/todos/1/comments/1", "", 204},
+		{"other user edits", userPrincipal(2), "PUT", "/todos/1/comments/1", `{"body": "edited"}`, 403},
+		{"other user deletes", userPrincipal(2), "DELETE", "/todos/1/comments/1", "", 403},
+		{"service key deletes", &common.Principal{KeyId: 1}, "DELETE", "/todos/1/comments/1", "", 403},
+		{"comment of another todo", userPrincipal(1), "DELETE", "/todos/2/comments/1", "", 404},
+		{"unknown comment", userPrincipal(1), "DELETE", "/todos/1/comments/9", "", 404},
+		{"invalid comment id", userPrincipal(1), "DELETE", "/todos/1/comments/x", "", 422},
+		{"empty body", userPrincipal(1), "PUT", "/todos/1/comments/1", `{"body": ""}`, 400},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			author := 1
+			app, mr := commentTestsSetup(test.principal, Comment{Id: 1, TodoId: 1, AuthorId: &author, Body: "first"})
+			response, err := app.Test(newRequest(test.method, test.url, test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != test.expectStatus {
+				t.Fatalf("Expected status %d, got %d", test.expectStatus, response.StatusCode)
+			}
+			if test.method == "PUT" && test.expectStatus == 200 {
+				if comment := mr.comments[0]; comment.Body != "edited @bob@example.com" || len(comment.Mentions) != 1 {
+					t.Errorf("Expected the comment to be edited with its mention, got %v", comment)
+				}
+			}
+			if test.method == "DELETE" && test.expectStatus == 204 && len(mr.comments) != 0 {
+				t.Errorf("Expected the comment to be deleted")
+			}
+		})
+	}
+}
+
+func newRequest(method string, url string, body string) *http.Request {
+	request, _ := http.NewRequest(method, url, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	return request
+}
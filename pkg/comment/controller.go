@@ -0,0 +1,251 @@
+package comment
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"github.com/raphael-foliveira/fiber-todo/pkg/user"
+)
+
+// maxBodyLength is the longest comment body accepted, in characters
+const maxBodyLength = 10000
+
+// Notifier tells users about comments that concern them
+type Notifier interface {
+	// Commented is called in the transaction that writes a comment, with the
+	// comment as it was before when it was edited. An error rolls the
+	// comment back.
+	Commented(tx *database.Database, orgId int, comment Comment, previous *Comment) error
+}
+
+type CommentController struct {
+	repository ICommentRepository
+	todos      todo.ITodoRepository
+	users      user.IUserRepository
+	authorizer *sharing.Authorizer
+	// notifier is told about comments, nobody is when it is nil
+	notifier Notifier
+}
+
+func NewCommentController(repository ICommentRepository, todos todo.ITodoRepository, users user.IUserRepository, authorizer *sharing.Authorizer, notifier Notifier) *CommentController {
+	return &CommentController{repository: repository, todos: todos, users: users, authorizer: authorizer, notifier: notifier}
+}
+
+// @List godoc
+// @Summary List the comments on a To Do
+// @Description List the comments on a To Do, oldest first
+// @Tags Comments
+// @Produce json
+// @Param id path int true "To Do ID"
+// @Success 200 {array} Comment
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /todos/{id}/comments [get]
+func (cc *CommentController) List(c *fiber.Ctx) error {
+	todoId, err := cc.todoId(c)
+	if err != nil {
+		return err
+	}
+	comments, err := cc.repository.List(todoId)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(comments)
+}
+
+// @Create godoc
+// @Summary Comment on a To Do
+// @Description Comment on a To Do as the calling user. The body is markdown; users mentioned in it as @email who can see the To Do are listed as its mentions.
+// @Tags Comments
+// @Accept json
+// @Produce json
+// @Param id path int true "To Do ID"
+// @Param comment body CreateCommentDto true "Comment Create"
+// @Success 201 {object} Comment
+// @Failure 400 {object} string "Bad Request"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /todos/{id}/comments [post]
+func (cc *CommentController) Create(c *fiber.Ctx) error {
+	var dto CreateCommentDto
+	if err := c.BodyParser(&dto); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "bad request body")
+	}
+	if err := validateBody(dto.Body); err != nil {
+		return err
+	}
+	authorId := common.UserIdOf(common.GetPrincipal(c))
+	if authorId == nil {
+		return fiber.NewError(fiber.StatusForbidden, "only users can comment")
+	}
+	todoId, err := cc.todoId(c)
+	if err != nil {
+		return err
+	}
+	dto.TodoId = todoId
+	dto.AuthorId = *authorId
+	dto.MentionIds = cc.mentions(todoId, dto.Body)
+	var created *Comment
+	err = cc.repository.WithTx(func(repository ICommentRepository, tx *database.Database) error {
+		var err error
+		created, err = repository.Create(dto)
+		if err != nil || cc.notifier == nil {
+			return err
+		}
+		return cc.notifier.Commented(tx, common.GetOrgId(c), *created, nil)
+	})
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// @Update godoc
+// @Summary Edit a comment
+// @Description Edit a comment. Only its author can.
+// @Tags Comments
+// @Accept json
+// @Produce json
+// @Param id path int true "To Do ID"
+// @Param commentId path int true "Comment ID"
+// @Param comment body UpdateCommentDto true "Comment Update"
+// @Success 200 {object} Comment
+// @Failure 400 {object} string "Bad Request"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /todos/{id}/comments/{commentId} [put]
+func (cc *CommentController) Update(c *fiber.Ctx) error {
+	var dto UpdateCommentDto
+	if err := c.BodyParser(&dto); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "bad request body")
+	}
+	if err := validateBody(dto.Body); err != nil {
+		return err
+	}
+	comment, err := cc.authored(c)
+	if err != nil {
+		return err
+	}
+	dto.MentionIds = cc.mentions(comment.TodoId, dto.Body)
+	var updated *Comment
+	err = cc.repository.WithTx(func(repository ICommentRepository, tx *database.Database) error {
+		var err error
+		updated, err = repository.Update(comment.TodoId, comment.Id, dto)
+		if err != nil || cc.notifier == nil {
+			return err
+		}
+		return cc.notifier.Commented(tx, common.GetOrgId(c), *updated, comment)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(updated)
+}
+
+// @Delete godoc
+// @Summary Delete a comment
+// @Description Delete a comment. Only its author can.
+// @Tags Comments
+// @Param id path int true "To Do ID"
+// @Param commentId path int true "Comment ID"
+// @Success 204 "No Content"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /todos/{id}/comments/{commentId} [delete]
+func (cc *CommentController) Delete(c *fiber.Ctx) error {
+	comment, err := cc.authored(c)
+	if err != nil {
+		return err
+	}
+	affected, err := cc.repository.Delete(comment.TodoId, comment.Id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	if affected == 0 {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// todoId returns the id of the todo of the route, after checking it exists
+// in the organization of the request
+func (cc *CommentController) todoId(c *fiber.Ctx) (int, error) {
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return 0, fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	if _, err := cc.todos.Retrieve(common.GetOrgId(c), id); err != nil {
+		return 0, fiber.NewError(fiber.StatusNotFound)
+	}
+	return id, nil
+}
+
+// authored returns the comment of the route when the caller wrote it
+func (cc *CommentController) authored(c *fiber.Ctx) (*Comment, error) {
+	id, err := strconv.Atoi(c.Params("commentId"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	todoId, err := cc.todoId(c)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := cc.repository.Retrieve(todoId, id)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound)
+	}
+	userId := common.UserIdOf(common.GetPrincipal(c))
+	if userId == nil || comment.AuthorId == nil || *userId != *comment.AuthorId {
+		return nil, fiber.NewError(fiber.StatusForbidden, "only the author can change a comment")
+	}
+	return comment, nil
+}
+
+// mentions resolves the emails mentioned in the body to the users that can
+// see the todo. Other mentions are left as plain text, so comments don't
+// tell who has an account.
+func (cc *CommentController) mentions(todoId int, body string) []int {
+	ids := []int{}
+	for _, email := range parseMentions(body) {
+		mentioned, err := cc.users.FindByEmail(email)
+		if err != nil {
+			continue
+		}
+		role, err := cc.authorizer.TodoRole(&common.Principal{UserId: &mentioned.Id}, todoId)
+		if err != nil || !role.AtLeast(sharing.RoleViewer) {
+			continue
+		}
+		ids = append(ids, mentioned.Id)
+	}
+	return ids
+}
+
+func validateBody(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "comment body is required")
+	}
+	if len([]rune(body)) > maxBodyLength {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("comment body is longer than %d characters", maxBodyLength))
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package comment
+
+type CreateCommentDto struct {
+	Body string `json:"body"`
+	// TodoId is the todo of the route, never from the request body
+	TodoId int `json:"-"`
+	// AuthorId is set from the caller, never from the request body
+	AuthorId int `json:"-"`
+	// MentionIds are the users resolved from the mentions in the body
+	MentionIds []int `json:"-"`
+}
+
+type UpdateCommentDto struct {
+	Body string `json:"body"`
+	// MentionIds are the users resolved from the mentions in the body
+	MentionIds []int `json:"-"`
+}
@@ -0,0 +1,31 @@
+package comment
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+// maxMentions bounds the users looked up for a comment
+const maxMentions = 20
+
+// mentionPattern matches @email at the start of the body or after a
+// character that can't be part of an email, so addresses aren't mentions
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w.+-])@([\w.+-]+@[\w-]+(?:\.[\w-]+)+)`)
+
+// parseMentions returns the lower-cased emails mentioned in the body, each
+// once and in order, up to maxMentions
+func parseMentions(body string) []string {
+	emails := []string{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		email := strings.ToLower(match[1])
+		if !common.Contains(emails, email) {
+			emails = append(emails, email)
+		}
+		if len(emails) == maxMentions {
+			break
+		}
+	}
+	return emails
+}
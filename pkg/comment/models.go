@@ -0,0 +1,23 @@
+package comment
+
+import "time"
+
+type Comment struct {
+	Id     int `json:"id"`
+	TodoId int `json:"todo_id"`
+	// AuthorId is nil once the author is deleted
+	AuthorId *int `json:"author_id"`
+	// Body is markdown, stored as written and rendered by clients
+	Body string `json:"body"`
+	// Mentions are the users mentioned in the body that can see the todo
+	Mentions  []Mention `json:"mentions"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Mention is a user mentioned in a comment as @email
+type Mention struct {
+	UserId int    `json:"user_id"`
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+}
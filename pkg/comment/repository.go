@@ -0,0 +1,174 @@
+package comment
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type ICommentRepository interface {
+	Create(comment CreateCommentDto) (*Comment, error)
+	List(todoId int) ([]Comment, error)
+	Retrieve(todoId int, id int) (*Comment, error)
+	Update(todoId int, id int, comment UpdateCommentDto) (*Comment, error)
+	Delete(todoId int, id int) (int64, error)
+	// WithTx runs work in a transaction, with the repository running its
+	// queries in it
+	WithTx(work func(repository ICommentRepository, tx *database.Database) error) error
+}
+
+type CommentRepository struct {
+	Db *database.Database
+}
+
+func NewCommentRepository(db *database.Database) *CommentRepository {
+	return &CommentRepository{Db: db}
+}
+
+func (cr *CommentRepository) WithTx(work func(repository ICommentRepository, tx *database.Database) error) error {
+	return cr.Db.WithTx(context.Background(), func(tx *database.Database) error {
+		return work(&CommentRepository{Db: tx}, tx)
+	})
+}
+
+const commentColumns = "id, todo_id, author_id, body, created_at, updated_at"
+
+func scanComment(row todo.Scanner) (Comment, error) {
+	comment := Comment{Mentions: []Mention{}}
+	err := row.Scan(&comment.Id, &comment.TodoId, &comment.AuthorId, &comment.Body, &comment.CreatedAt, &comment.UpdatedAt)
+	return comment, err
+}
+
+func (cr *CommentRepository) Create(comment CreateCommentDto) (*Comment, error) {
+	var created Comment
+	err := cr.Db.WithTx(context.Background(), func(tx *database.Database) error {
+		var err error
+		created, err = scanComment(tx.QueryRow("INSERT INTO todo_comment (todo_id, author_id, body) VALUES ($1, $2, $3) RETURNING "+commentColumns,
+			comment.TodoId, comment.AuthorId, comment.Body))
+		if err != nil {
+			return err
+		}
+		return setMentions(tx, &created, comment.MentionIds)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (cr *CommentRepository) List(todoId int) ([]Comment, error) {
+	rows, err := cr.Db.Query("SELECT "+commentColumns+" FROM todo_comment WHERE todo_id = $1 ORDER BY id", todoId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	comments := []Comment{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return comments, loadMentions(cr.Db, comments)
+}
+
+func (cr *CommentRepository) Retrieve(todoId int, id int) (*Comment, error) {
+	comment, err := scanComment(cr.Db.QueryRow("SELECT "+commentColumns+" FROM todo_comment WHERE id = $1 AND todo_id = $2", id, todoId))
+	if err != nil {
+		return nil, err
+	}
+	comments := []Comment{comment}
+	if err := loadMentions(cr.Db, comments); err != nil {
+		return nil, err
+	}
+	return &comments[0], nil
+}
+
+// Update replaces the body of the comment and its mentions
+func (cr *CommentRepository) Update(todoId int, id int, comment UpdateCommentDto) (*Comment, error) {
+	var updated Comment
+	err := cr.Db.WithTx(context.Background(), func(tx *database.Database) error {
+		var err error
+		updated, err = scanComment(tx.QueryRow(`
+		UPDATE todo_comment SET body = $3, updated_at = NOW()
+		WHERE id = $1 AND todo_id = $2
+		RETURNING `+commentColumns, id, todoId, comment.Body))
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM todo_comment_mention WHERE comment_id = $1", id); err != nil {
+			return err
+		}
+		return setMentions(tx, &updated, comment.MentionIds)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (cr *CommentRepository) Delete(todoId int, id int) (int64, error) {
+	result, err := cr.Db.Exec("DELETE FROM todo_comment WHERE id = $1 AND todo_id = $2", id, todoId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// setMentions stores the mentions of the comment and loads them into it
+func setMentions(db *database.Database, comment *Comment, userIds []int) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+	_, err := db.Exec(`
+	INSERT INTO todo_comment_mention (comment_id, user_id)
+	SELECT $1, unnest($2::int[])
+	ON CONFLICT DO NOTHING`, comment.Id, pq.Array(userIds))
+	if err != nil {
+		return err
+	}
+	comments := []Comment{*comment}
+	if err := loadMentions(db, comments); err != nil {
+		return err
+	}
+	*comment = comments[0]
+	return nil
+}
+
+// loadMentions fills in the mentions of the comments with a single query
+func loadMentions(db *database.Database, comments []Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	index := map[int]int{}
+	ids := make([]int, len(comments))
+	for i, comment := range comments {
+		index[comment.Id] = i
+		ids[i] = comment.Id
+	}
+	rows, err := db.Query(`
+	SELECT todo_comment_mention.comment_id, users.id, users.email, users.name
+	FROM todo_comment_mention JOIN users ON users.id = todo_comment_mention.user_id
+	WHERE todo_comment_mention.comment_id = ANY($1)
+	ORDER BY users.id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var commentId int
+		var mention Mention
+		if err := rows.Scan(&commentId, &mention.UserId, &mention.Email, &mention.Name); err != nil {
+			return err
+		}
+		comment := &comments[index[commentId]]
+		comment.Mentions = append(comment.Mentions, mention)
+	}
+	return rows.Err()
+}
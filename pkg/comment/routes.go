@@ -0,0 +1,12 @@
+package comment
+
+import "github.com/gofiber/fiber/v2"
+
+// GetCommentRoutes adds the comment routes to the todo router
+func GetCommentRoutes(router fiber.Router, controller *CommentController) fiber.Router {
+	router.Get("/:id/comments", controller.List)
+	router.Post("/:id/comments", controller.Create)
+	router.Put("/:id/comments/:commentId", controller.Update)
+	router.Delete("/:id/comments/:commentId", controller.Delete)
+	return router
+}
@@ -0,0 +1,22 @@
+package common
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClientKey identifies the client making a request, for features that keep
+// per-client state such as rate limits and idempotency keys. Requests are
+// keyed by user when the API key belongs to one, then by API key, and
+// anonymous ones by IP.
+func ClientKey(c *fiber.Ctx) string {
+	principal := GetPrincipal(c)
+	if principal == nil {
+		return "ip:" + c.IP()
+	}
+	if principal.UserId != nil {
+		return "user:" + strconv.Itoa(*principal.UserId)
+	}
+	return "key:" + strconv.Itoa(principal.KeyId)
+}
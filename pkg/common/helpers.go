@@ -1,6 +1,7 @@
 package common
 
 import (
+	"fmt"
 	"reflect"
 	"strconv"
 
@@ -23,3 +24,16 @@ func ParseIdFromParams(c *fiber.Ctx) (int, error) {
 	}
 	return intId, nil
 }
+
+// IncludeArchived reads the include query param, which is empty or archived
+// to include archived resources in a listing
+func IncludeArchived(c *fiber.Ctx) (bool, error) {
+	switch include := c.Query("include"); include {
+	case "":
+		return false, nil
+	case "archived":
+		return true, nil
+	default:
+		return false, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid include %q", include))
+	}
+}
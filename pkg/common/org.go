@@ -0,0 +1,22 @@
+package common
+
+import "github.com/gofiber/fiber/v2"
+
+// DefaultOrgId is the organization of requests that don't pick one. It holds
+// everything created before organizations existed and is open to everyone.
+const DefaultOrgId = 1
+
+// OrgLocal is the Locals key the organization of a request is stored under
+const OrgLocal = "org"
+
+func SetOrgId(c *fiber.Ctx, id int) {
+	c.Locals(OrgLocal, id)
+}
+
+// GetOrgId returns the organization the request is scoped to
+func GetOrgId(c *fiber.Ctx) int {
+	if id, ok := c.Locals(OrgLocal).(int); ok {
+		return id
+	}
+	return DefaultOrgId
+}
@@ -0,0 +1,56 @@
+package common
+
+import "github.com/gofiber/fiber/v2"
+
+// PrincipalLocal is the Locals key the principal is stored under
+const PrincipalLocal = "principal"
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	KeyId  int
+	Scopes []string
+	// UserId is the user the API key belongs to, nil for service keys
+	UserId *int
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return Contains(p.Scopes, scope)
+}
+
+// Service reports whether the principal is a key that doesn't belong to a
+// user. Service keys act for the deployment itself and bypass sharing.
+func (p *Principal) Service() bool {
+	return p != nil && p.UserId == nil
+}
+
+func SetPrincipal(c *fiber.Ctx, principal *Principal) {
+	c.Locals(PrincipalLocal, principal)
+}
+
+// GetPrincipal returns the caller of the request, or nil for anonymous requests
+func GetPrincipal(c *fiber.Ctx) *Principal {
+	principal, _ := c.Locals(PrincipalLocal).(*Principal)
+	return principal
+}
+
+// UserIdOf returns the user behind the principal, nil for service keys and
+// anonymous requests
+func UserIdOf(principal *Principal) *int {
+	if principal == nil {
+		return nil
+	}
+	return principal.UserId
+}
+
+// Audience is who a read is made for, so repositories only return what they
+// may see
+type Audience struct {
+	// All skips visibility checks, for service keys
+	All bool
+	// UserId is the reading user, nil for anonymous requests
+	UserId *int
+}
+
+func AudienceOf(principal *Principal) Audience {
+	return Audience{All: principal.Service(), UserId: UserIdOf(principal)}
+}
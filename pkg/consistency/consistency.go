@@ -0,0 +1,136 @@
+// Package consistency gives clients read-your-writes on top of replica reads:
+// for a short window after a client writes, its reads go to the primary,
+// which has the write, rather than to a replica that may not yet.
+//
+// The window is carried by the client, as a signed token handed out with
+// every write, so any instance sharing the secret honors it.
+package consistency
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+const (
+	// PrimaryLocal is the Locals key set on requests whose reads must go to
+	// the primary
+	PrimaryLocal = "reads_primary"
+	// Header is set on the responses to writes, and sent back by clients on
+	// the requests that follow
+	Header = "X-Consistency-Token"
+	// Cookie holds the same token for browsers
+	Cookie = "consistency_token"
+)
+
+// DefaultWindow is comfortably longer than the replica lag tolerated by
+// default
+const DefaultWindow = 5 * time.Second
+
+type Config struct {
+	// Window is how long reads go to the primary after a write, 0 when they
+	// may always go to replicas
+	Window time.Duration
+	// Secret signs the tokens. Instances honor each other's tokens only when
+	// they share it.
+	Secret []byte
+}
+
+// ConfigFromEnv reads READ_YOUR_WRITES_WINDOW, a duration such as 5s, with 0
+// turning read-your-writes off, and READ_YOUR_WRITES_SECRET. Without a
+// secret, a random one is made, so only this instance honors its tokens.
+func ConfigFromEnv() (Config, error) {
+	config := Config{Window: DefaultWindow, Secret: []byte(os.Getenv("READ_YOUR_WRITES_SECRET"))}
+	if value := os.Getenv("READ_YOUR_WRITES_WINDOW"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil || window < 0 {
+			return Config{}, fmt.Errorf("invalid READ_YOUR_WRITES_WINDOW %q", value)
+		}
+		config.Window = window
+	}
+	if len(config.Secret) == 0 {
+		config.Secret = make([]byte, 32)
+		if _, err := rand.Read(config.Secret); err != nil {
+			return Config{}, err
+		}
+	}
+	return config, nil
+}
+
+// New returns a middleware that pins the reads of a client to the primary for
+// the window following each of its successful writes. Tokens are bound to
+// common.ClientKey, so it goes after authentication.
+func New(config Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		client := common.ClientKey(c)
+		token := c.Get(Header)
+		if token == "" {
+			token = c.Cookies(Cookie)
+		}
+		if until, ok := verify(config.Secret, client, token); ok && time.Now().Before(until) {
+			c.Locals(PrimaryLocal, true)
+		}
+		err := c.Next()
+		if err == nil && !isRead(c.Method()) && c.Response().StatusCode() < fiber.StatusBadRequest {
+			until := time.Now().Add(config.Window)
+			token := sign(config.Secret, client, until)
+			c.Set(Header, token)
+			c.Cookie(&fiber.Cookie{
+				Name:     Cookie,
+				Value:    token,
+				Path:     "/",
+				Expires:  until,
+				Secure:   c.Protocol() == "https",
+				HTTPOnly: true,
+				SameSite: fiber.CookieSameSiteLaxMode,
+			})
+		}
+		return err
+	}
+}
+
+// ReadsPrimary tells whether the reads of the request must go to the primary
+func ReadsPrimary(c *fiber.Ctx) bool {
+	primary, _ := c.Locals(PrimaryLocal).(bool)
+	return primary
+}
+
+func isRead(method string) bool {
+	return method == fiber.MethodGet || method == fiber.MethodHead || method == fiber.MethodOptions
+}
+
+// sign returns a token pinning the reads of the client until the given time,
+// as the time in milliseconds and its signature
+func sign(secret []byte, client string, until time.Time) string {
+	millis := strconv.FormatInt(until.UnixMilli(), 10)
+	return millis + "." + signature(secret, client, millis)
+}
+
+// verify returns until when the token pins the reads of the client, and
+// false when it isn't one signed for the client
+func verify(secret []byte, client string, token string) (time.Time, bool) {
+	millis, mac, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(signature(secret, client, millis))) {
+		return time.Time{}, false
+	}
+	until, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(until), true
+}
+
+func signature(secret []byte, client string, millis string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(client + "\n" + millis))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,124 @@
+package consistency
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+func consistencyTestsSetup(window time.Duration) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		keyId, _ := strconv.Atoi(c.Get("X-Key"))
+		common.SetPrincipal(c, &common.Principal{KeyId: keyId})
+		return c.Next()
+	})
+	app.Use(New(Config{Window: window, Secret: []byte("s3cret")}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(strconv.FormatBool(ReadsPrimary(c)))
+	})
+	app.Post("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusCreated)
+	})
+	app.Post("/fail", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusBadRequest)
+	})
+	return app
+}
+
+func readsPrimary(t *testing.T, app *fiber.App, key string, token string, cookie bool) bool {
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Key", key)
+	if cookie {
+		request.Header.Set("Cookie", Cookie+"="+token)
+	} else if token != "" {
+		request.Header.Set(Header, token)
+	}
+	response, err := app.Test(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, 5)
+	n, _ := response.Body.Read(body)
+	return string(body[:n]) == "true"
+}
+
+// write returns the token handed out by the write
+func write(t *testing.T, app *fiber.App, path string, key string) string {
+	request := httptest.NewRequest("POST", path, nil)
+	request.Header.Set("X-Key", key)
+	response, err := app.Test(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.Header.Get(Header)
+}
+
+func TestReadYourWrites(t *testing.T) {
+	app := consistencyTestsSetup(50 * time.Millisecond)
+	if readsPrimary(t, app, "1", "", false) {
+		t.Error("expected reads to go to replicas before any write")
+	}
+	if token := write(t, app, "/fail", "1"); token != "" {
+		t.Error("expected a failed write not to pin reads")
+	}
+	token := write(t, app, "/", "1")
+	if !readsPrimary(t, app, "1", token, false) {
+		t.Error("expected reads carrying the token to go to the primary after a write")
+	}
+	if !readsPrimary(t, app, "1", token, true) {
+		t.Error("expected reads carrying the cookie to go to the primary after a write")
+	}
+	if readsPrimary(t, app, "1", "", false) {
+		t.Error("expected reads without the token not to be pinned")
+	}
+	if readsPrimary(t, app, "2", token, false) {
+		t.Error("expected the token of another client not to pin reads")
+	}
+	forged := strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10) + token[len(token)-44:]
+	if readsPrimary(t, app, "1", forged, false) {
+		t.Error("expected a token with another time not to pin reads")
+	}
+	if other := sign([]byte("other"), "key:1", time.Now().Add(time.Hour)); readsPrimary(t, app, "1", other, false) {
+		t.Error("expected a token signed with another secret not to pin reads")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if readsPrimary(t, app, "1", token, false) {
+		t.Error("expected the pin to expire after the window")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		window   time.Duration
+		hasError bool
+	}{
+		{"test default", "", DefaultWindow, false},
+		{"test disabled", "0", 0, false},
+		{"test duration", "2s", 2 * time.Second, false},
+		{"test invalid", "soon", 0, true},
+		{"test negative", "-1s", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("READ_YOUR_WRITES_WINDOW", test.value)
+			t.Setenv("READ_YOUR_WRITES_SECRET", "")
+			config, err := ConfigFromEnv()
+			if (err != nil) != test.hasError {
+				t.Fatalf("expected error: %v, got %v", test.hasError, err)
+			}
+			if config.Window != test.window {
+				t.Errorf("expected %s, got %s", test.window, config.Window)
+			}
+			if !test.hasError && len(config.Secret) == 0 {
+				t.Error("expected a secret to be made when none is set")
+			}
+		})
+	}
+}
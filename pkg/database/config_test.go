@@ -0,0 +1,125 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	urlFile := filepath.Join(dir, "url")
+	os.WriteFile(urlFile, []byte("postgres://app:old@db:5432/todo?sslmode=disable\n"), 0o600)
+	passwordFile := filepath.Join(dir, "password")
+	os.WriteFile(passwordFile, []byte("s3cret/@?\n"), 0o600)
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		url      string
+		hasError bool
+	}{
+		{"test url", map[string]string{"DATABASE_URL": "postgres://app:pw@db/todo"}, "postgres://app:pw@db/todo", false},
+		{"test key value pairs", map[string]string{"DATABASE_URL": "host=db dbname=todo", "DATABASE_PASSWORD": "it's"},
+			`host=db dbname=todo password='it\'s'`, false},
+		{"test secret files", map[string]string{"DATABASE_URL_FILE": urlFile, "DATABASE_PASSWORD_FILE": passwordFile},
+			"postgres://app:s3cret%2F%40%3F@db:5432/todo?sslmode=disable", false},
+		{"test missing url", map[string]string{}, "", true},
+		{"test url and file", map[string]string{"DATABASE_URL": "postgres://db/todo", "DATABASE_URL_FILE": urlFile}, "", true},
+		{"test missing file", map[string]string{"DATABASE_URL_FILE": filepath.Join(dir, "nope")}, "", true},
+		{"test wrong scheme", map[string]string{"DATABASE_URL": "mysql://db/todo"}, "", true},
+		{"test missing host", map[string]string{"DATABASE_URL": "postgres:///todo"}, "", true},
+		{"test invalid port", map[string]string{"DATABASE_URL": "postgres://app:pw@db:99999/todo"}, "", true},
+		{"test password without user", map[string]string{"DATABASE_URL": "postgres://db/todo", "DATABASE_PASSWORD": "pw"}, "", true},
+		{"test invalid pool size", map[string]string{"DATABASE_URL": "postgres://db/todo", "DATABASE_MAX_OPEN_CONNS": "many"}, "", true},
+		{"test invalid duration", map[string]string{"DATABASE_URL": "postgres://db/todo", "DATABASE_CONNECT_TIMEOUT": "10"}, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{"DATABASE_URL", "DATABASE_URL_FILE", "DATABASE_PASSWORD", "DATABASE_PASSWORD_FILE",
+				"DATABASE_MAX_OPEN_CONNS", "DATABASE_CONNECT_TIMEOUT"} {
+				t.Setenv(name, test.env[name])
+			}
+			config, err := ConfigFromEnv()
+			if (err != nil) != test.hasError {
+				t.Fatalf("Expected error: %v, got %v", test.hasError, err)
+			}
+			if err != nil && strings.Contains(err.Error(), "pw") {
+				t.Errorf("Expected the error not to include the password, got %v", err)
+			}
+			if config.Url != test.url {
+				t.Errorf("Expected url %s, got %s", test.url, config.Url)
+			}
+		})
+	}
+
+	t.Run("should read the pool settings", func(t *testing.T) {
+		t.Setenv("DATABASE_URL", "postgres://db/todo")
+		t.Setenv("DATABASE_MAX_OPEN_CONNS", "50")
+		t.Setenv("DATABASE_CONN_MAX_LIFETIME", "1h")
+		config, err := ConfigFromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.MaxOpenConns != 50 || config.ConnMaxLifetime != time.Hour || config.MaxIdleConns != DefaultConfig.MaxIdleConns {
+			t.Errorf("Unexpected config %+v", config)
+		}
+	})
+
+	t.Run("should read the replicas", func(t *testing.T) {
+		t.Setenv("DATABASE_URL", "postgres://app@primary/todo")
+		t.Setenv("DATABASE_PASSWORD", "pw")
+		t.Setenv("DATABASE_REPLICA_URLS", "postgres://app@replica1/todo, postgres://app@replica2/todo")
+		t.Setenv("DATABASE_REPLICA_MAX_LAG", "5s")
+		config, err := ConfigFromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"postgres://app:pw@replica1/todo", "postgres://app:pw@replica2/todo"}
+		if strings.Join(config.ReplicaUrls, " ") != strings.Join(expected, " ") {
+			t.Errorf("Expected replicas %v, got %v", expected, config.ReplicaUrls)
+		}
+		if config.ReplicaMaxLag != 5*time.Second || config.ReplicaCheckInterval != DefaultConfig.ReplicaCheckInterval {
+			t.Errorf("Unexpected config %+v", config)
+		}
+	})
+}
+
+func TestRedacted(t *testing.T) {
+	tests := map[string]string{
+		"postgres://app:s3cret@db/todo":             "postgres://app:xxxxx@db/todo",
+		"host=db password='it\\'s secret' user=app": "host=db password=xxxxx user=app",
+		"host=db password=s3cret":                   "host=db password=xxxxx",
+	}
+	for dsn, expected := range tests {
+		if redacted := Redacted(dsn); redacted != expected {
+			t.Errorf("Expected %s, got %s", expected, redacted)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	config := DefaultConfig
+	// nothing listens on port 1
+	config.Url = "postgres://app:pw@127.0.0.1:1/todo?sslmode=disable&connect_timeout=1"
+	config.ConnectTimeout = 300 * time.Millisecond
+	start := time.Now()
+	_, err := Open(config)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if !strings.Contains(err.Error(), "attempts") || strings.Contains(err.Error(), ":pw@") {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("Expected to retry for about the timeout, took %v", elapsed)
+	}
+
+	config.Url = "mysql://db/todo"
+	if _, err := Open(config); err == nil || !strings.Contains(err.Error(), "scheme") {
+		t.Errorf("Expected the url to be rejected before connecting, got %v", err)
+	}
+}
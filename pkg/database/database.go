@@ -1,21 +1,24 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
-	_ "github.com/lib/pq"
-	"github.com/raphael-foliveira/fiber-todo/pkg/database/queries"
+	"github.com/lib/pq"
 )
 
+// GetDatabase opens the database at the URL with the default configuration
 func GetDatabase(url string) (*Database, error) {
-	db, err := sql.Open("postgres", url)
-	if err != nil {
-		return nil, err
-	}
-	return &Database{DB: db}, nil
+	config := DefaultConfig
+	config.Url = url
+	return Open(config)
 }
 
+// MustGetDatabase is GetDatabase for tests and tools that can't go on
+// without a database
 func MustGetDatabase(url string) *Database {
 	db, err := GetDatabase(url)
 	if err != nil {
@@ -25,12 +28,133 @@ func MustGetDatabase(url string) *Database {
 	return db
 }
 
+// Open validates the configuration, sizes the pool and waits for Postgres to
+// accept connections, retrying with exponential backoff for up to
+// ConnectTimeout
+func Open(config Config) (*Database, error) {
+	if err := validate(config.Url); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("postgres", config.Url)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+	if err := waitUntilReady(db, config.ConnectTimeout); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to %s: %w", Redacted(config.Url), err)
+	}
+	database := &Database{DB: db, Url: config.Url}
+	if len(config.ReplicaUrls) > 0 {
+		if database.Replicas, err = openReplicas(config); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return database, nil
+}
+
+const (
+	minConnectBackoff = 100 * time.Millisecond
+	maxConnectBackoff = 5 * time.Second
+	pingTimeout       = 5 * time.Second
+)
+
+func waitUntilReady(db *sql.DB, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := minConnectBackoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+		err := db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		remaining := time.Until(deadline)
+		if permanent(err) || remaining <= 0 {
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		}
+		fmt.Printf("waiting for the database: %s\n", err)
+		if backoff > remaining {
+			backoff = remaining
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
+}
+
+// permanent tells whether Postgres refused the connection for a reason that
+// waiting won't fix, such as a wrong password or a missing database
+func permanent(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	switch pqErr.Code.Class() {
+	case "28", "3D":
+		return true
+	}
+	return false
+}
+
 type Database struct {
 	*sql.DB
+	// Url is kept for connections that can't come from the pool, such as
+	// LISTEN/NOTIFY listeners
+	Url string
+	// tx is the transaction queries run in, set on the *Database WithTx
+	// hands to its work; depth counts the savepoints nested in it
+	tx    *sql.Tx
+	depth int
+	// committed are the functions to run once the transaction commits, see
+	// AfterCommit
+	committed *[]func()
+	// Replicas take the reads of repositories that use Reader, nil without
+	// replicas. They're shared by every *Database derived from this one.
+	Replicas *Replicas
+	// primary keeps reads on the primary, see Primary
+	primary bool
+}
+
+// Reader returns where reads that tolerate replication lag should go: the
+// next healthy replica, or the primary when there is none, in a transaction,
+// or when reads were pinned to it with Primary
+func (db *Database) Reader() *Database {
+	if db.tx != nil || db.primary || db.Replicas == nil {
+		return db
+	}
+	replica := db.Replicas.pick()
+	if replica == nil {
+		return db
+	}
+	return &Database{DB: replica.db, Url: replica.url, primary: true}
+}
+
+// Primary returns the database with reads pinned to the primary, for
+// repositories that read what was just written
+func (db *Database) Primary() *Database {
+	pinned := *db
+	pinned.primary = true
+	return &pinned
+}
+
+// Close closes the primary and the replicas
+func (db *Database) Close() error {
+	if db.Replicas != nil {
+		db.Replicas.close()
+	}
+	return db.DB.Close()
 }
 
+// CreateSchema applies the pending migrations
 func (db *Database) CreateSchema() {
-	_, err := db.Exec(queries.Schema)
+	_, err := db.Migrate()
 	if err != nil {
 		fmt.Println("error creating schema")
 		panic(err)
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/database/queries"
+)
+
+// migrationLock is the advisory lock that keeps instances starting together
+// from migrating at the same time
+const migrationLock = 4242001
+
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// Migrate applies the pending migrations in order, each in its own
+// transaction, and returns the ones it applied
+func (db *Database) Migrate() ([]queries.Migration, error) {
+	applied := []queries.Migration{}
+	for _, migration := range queries.Migrations {
+		done, err := db.inMigration(func(tx *Database, versions map[int]bool) (bool, error) {
+			if versions[migration.Version] {
+				return false, nil
+			}
+			if _, err := tx.Exec(migration.Up); err != nil {
+				return false, err
+			}
+			_, err := tx.Exec("INSERT INTO schema_migration (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+			return err == nil, err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+		if done {
+			applied = append(applied, migration)
+		}
+	}
+	return applied, nil
+}
+
+// Rollback reverts the last steps applied migrations and returns them
+func (db *Database) Rollback(steps int) ([]queries.Migration, error) {
+	reverted := []queries.Migration{}
+	for i := len(queries.Migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := queries.Migrations[i]
+		done, err := db.inMigration(func(tx *Database, versions map[int]bool) (bool, error) {
+			if !versions[migration.Version] {
+				return false, nil
+			}
+			if _, err := tx.Exec(migration.Down); err != nil {
+				return false, err
+			}
+			_, err := tx.Exec("DELETE FROM schema_migration WHERE version = $1", migration.Version)
+			return err == nil, err
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("reverting migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+		if done {
+			reverted = append(reverted, migration)
+		}
+	}
+	return reverted, nil
+}
+
+// MigrationStatus lists every known migration with when it was applied, nil
+// for the pending ones
+func (db *Database) MigrationStatus() ([]MigrationStatus, error) {
+	if _, err := db.Exec(queries.CreateMigrationTable); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migration")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	appliedAt := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	status := []MigrationStatus{}
+	for _, migration := range queries.Migrations {
+		s := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if at, ok := appliedAt[migration.Version]; ok {
+			s.AppliedAt = &at
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// inMigration runs step in a transaction holding the migration lock, with the
+// versions applied so far
+func (db *Database) inMigration(step func(tx *Database, versions map[int]bool) (bool, error)) (bool, error) {
+	done := false
+	err := db.WithTx(context.Background(), func(tx *Database) error {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLock); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(queries.CreateMigrationTable); err != nil {
+			return err
+		}
+		rows, err := tx.Query("SELECT version FROM schema_migration")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		versions := map[int]bool{}
+		for rows.Next() {
+			var version int
+			if err := rows.Scan(&version); err != nil {
+				return err
+			}
+			versions[version] = true
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		done, err = step(tx, versions)
+		return err
+	})
+	return done, err
+}
@@ -0,0 +1,193 @@
+package queries
+
+// Migration is a versioned change to the schema. Released migrations are never
+// edited; later changes go in a new migration at the end of Migrations.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+var Migrations = []Migration{
+	{Version: 1, Name: "initial schema", Up: Schema, Down: DropSchema},
+	{Version: 2, Name: "archive", Up: `
+		ALTER TABLE todo ADD COLUMN archived_at TIMESTAMPTZ;
+		ALTER TABLE todo_list ADD COLUMN archived_at TIMESTAMPTZ;
+		ALTER TABLE organization ADD COLUMN archive_after_days INTEGER;
+		CREATE INDEX todo_unarchived_idx ON todo (org_id, id) WHERE archived_at IS NULL;
+	`, Down: `
+		DROP INDEX todo_unarchived_idx;
+		ALTER TABLE organization DROP COLUMN archive_after_days;
+		ALTER TABLE todo_list DROP COLUMN archived_at;
+		ALTER TABLE todo DROP COLUMN archived_at;
+	`},
+	{Version: 3, Name: "comments", Up: `
+		CREATE TABLE todo_comment (
+			id SERIAL PRIMARY KEY,
+			todo_id INTEGER NOT NULL REFERENCES todo(id) ON DELETE CASCADE,
+			author_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			body TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX todo_comment_todo_idx ON todo_comment (todo_id, id);
+		CREATE TABLE todo_comment_mention (
+			comment_id INTEGER NOT NULL REFERENCES todo_comment(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			PRIMARY KEY (comment_id, user_id)
+		);
+	`, Down: `
+		DROP TABLE todo_comment_mention;
+		DROP TABLE todo_comment;
+	`},
+	{Version: 4, Name: "attachments", Up: `
+		CREATE TABLE attachment_blob (
+			checksum VARCHAR(64) PRIMARY KEY,
+			size BIGINT NOT NULL,
+			referenced_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE TABLE attachment (
+			id SERIAL PRIMARY KEY,
+			todo_id INTEGER NOT NULL REFERENCES todo(id) ON DELETE CASCADE,
+			checksum VARCHAR(64) NOT NULL REFERENCES attachment_blob(checksum),
+			name VARCHAR NOT NULL,
+			content_type VARCHAR NOT NULL,
+			uploaded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX attachment_todo_idx ON attachment (todo_id, id);
+		CREATE INDEX attachment_checksum_idx ON attachment (checksum);
+	`, Down: `
+		DROP TABLE attachment;
+		DROP TABLE attachment_blob;
+	`},
+	{Version: 5, Name: "assignees", Up: `
+		ALTER TABLE todo ADD COLUMN assignee_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+		CREATE INDEX todo_assignee_idx ON todo (org_id, assignee_id);
+	`, Down: `
+		DROP INDEX todo_assignee_idx;
+		ALTER TABLE todo DROP COLUMN assignee_id;
+	`},
+	{Version: 6, Name: "notifications", Up: `
+		CREATE TABLE notification (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			kind VARCHAR NOT NULL,
+			todo_id INTEGER REFERENCES todo(id) ON DELETE CASCADE,
+			actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			message TEXT NOT NULL,
+			in_app BOOLEAN NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			read_at TIMESTAMPTZ
+		);
+		CREATE INDEX notification_inbox_idx ON notification (user_id, id) WHERE in_app;
+		CREATE TABLE notification_outbox (
+			id SERIAL PRIMARY KEY,
+			notification_id INTEGER NOT NULL REFERENCES notification(id) ON DELETE CASCADE,
+			channel VARCHAR NOT NULL,
+			status VARCHAR NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			last_error VARCHAR NOT NULL DEFAULT '',
+			sent_at TIMESTAMPTZ
+		);
+		CREATE INDEX notification_outbox_due_idx ON notification_outbox (next_attempt_at) WHERE status = 'pending';
+		CREATE TABLE notification_preference (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			in_app BOOLEAN NOT NULL DEFAULT TRUE,
+			email VARCHAR NOT NULL DEFAULT 'instant',
+			muted VARCHAR[] NOT NULL DEFAULT '{}'
+		);
+		CREATE TABLE todo_reminder (
+			todo_id INTEGER PRIMARY KEY REFERENCES todo(id) ON DELETE CASCADE,
+			due_date TIMESTAMPTZ NOT NULL
+		);
+	`, Down: `
+		DROP TABLE todo_reminder;
+		DROP TABLE notification_preference;
+		DROP TABLE notification_outbox;
+		DROP TABLE notification;
+	`},
+	{Version: 7, Name: "jobs", Up: `
+		CREATE TABLE job (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR NOT NULL,
+			payload JSONB NOT NULL DEFAULT '{}',
+			status VARCHAR NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL,
+			run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			last_error VARCHAR NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			started_at TIMESTAMPTZ,
+			finished_at TIMESTAMPTZ
+		);
+		CREATE INDEX job_due_idx ON job (run_at) WHERE status IN ('pending', 'running');
+		CREATE INDEX job_name_idx ON job (name, status);
+		CREATE TABLE job_schedule (
+			name VARCHAR PRIMARY KEY,
+			next_run_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE TABLE job_lease (
+			name VARCHAR PRIMARY KEY,
+			holder VARCHAR NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL
+		);
+	`, Down: `
+		DROP TABLE job_lease;
+		DROP TABLE job_schedule;
+		DROP TABLE job;
+	`},
+	// todos created before this migration are left without a creation time
+	// rather than given the time it ran
+	{Version: 8, Name: "todo created_at", Up: `
+		ALTER TABLE todo ADD COLUMN created_at TIMESTAMPTZ;
+		ALTER TABLE todo ALTER COLUMN created_at SET DEFAULT NOW();
+		CREATE INDEX todo_created_at_idx ON todo (org_id, created_at);
+	`, Down: `
+		DROP INDEX todo_created_at_idx;
+		ALTER TABLE todo DROP COLUMN created_at;
+	`},
+	// claims left behind by a crashed request are taken over once their
+	// lease runs out, and only the Content-Type of a response is replayed
+	{Version: 9, Name: "idempotency lease", Up: `
+		ALTER TABLE idempotency_key ADD COLUMN locked_until TIMESTAMPTZ;
+		ALTER TABLE idempotency_key ADD COLUMN content_type VARCHAR NOT NULL DEFAULT '';
+		UPDATE idempotency_key SET content_type = COALESCE(headers->'Content-Type'->>0, '');
+		ALTER TABLE idempotency_key DROP COLUMN headers;
+	`, Down: `
+		ALTER TABLE idempotency_key ADD COLUMN headers JSONB NOT NULL DEFAULT '{}';
+		UPDATE idempotency_key SET headers = jsonb_build_object('Content-Type', jsonb_build_array(content_type))
+			WHERE content_type <> '';
+		ALTER TABLE idempotency_key DROP COLUMN content_type;
+		ALTER TABLE idempotency_key DROP COLUMN locked_until;
+	`},
+	// webhooks registered before this migration belong to the default
+	// organization and, having no owner, receive all of its events
+	{Version: 10, Name: "webhook tenancy", Up: `
+		ALTER TABLE webhook ADD COLUMN org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organization(id) ON DELETE CASCADE;
+		ALTER TABLE webhook ADD COLUMN owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+		CREATE INDEX webhook_org_idx ON webhook (org_id) WHERE active;
+	`, Down: `
+		DROP INDEX webhook_org_idx;
+		ALTER TABLE webhook DROP COLUMN owner_id;
+		ALTER TABLE webhook DROP COLUMN org_id;
+	`},
+}
+
+// CreateMigrationTable records which migrations were applied
+const CreateMigrationTable = `
+    CREATE TABLE IF NOT EXISTS schema_migration (
+        version INTEGER PRIMARY KEY,
+        name VARCHAR NOT NULL,
+        applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+`
+
+// DropSchema reverts Schema
+const DropSchema = `
+    DROP TABLE IF EXISTS org_member, todo_invitation, todo_share, api_key, rate_limit_bucket,
+        idempotency_key, todo_event, webhook_delivery, webhook, todo_ical, todo, todo_list,
+        organization, users CASCADE;
+`
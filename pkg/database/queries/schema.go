@@ -7,4 +7,151 @@ var Schema = `
         description VARCHAR,
         completed BOOLEAN
     );
+
+    ALTER TABLE todo ADD COLUMN IF NOT EXISTS due_date TIMESTAMPTZ;
+    ALTER TABLE todo ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;
+
+    CREATE TABLE IF NOT EXISTS todo_list (
+        id SERIAL PRIMARY KEY,
+        name VARCHAR NOT NULL UNIQUE
+    );
+
+    ALTER TABLE todo ADD COLUMN IF NOT EXISTS list_id INTEGER REFERENCES todo_list(id) ON DELETE SET NULL;
+
+    CREATE TABLE IF NOT EXISTS todo_ical (
+        uid VARCHAR PRIMARY KEY,
+        todo_id INTEGER NOT NULL REFERENCES todo(id) ON DELETE CASCADE
+    );
+
+    CREATE TABLE IF NOT EXISTS webhook (
+        id SERIAL PRIMARY KEY,
+        url VARCHAR NOT NULL,
+        secret VARCHAR NOT NULL,
+        events VARCHAR[] NOT NULL DEFAULT '{}',
+        active BOOLEAN NOT NULL DEFAULT TRUE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+
+    CREATE TABLE IF NOT EXISTS webhook_delivery (
+        id SERIAL PRIMARY KEY,
+        webhook_id INTEGER NOT NULL REFERENCES webhook(id) ON DELETE CASCADE,
+        event VARCHAR NOT NULL,
+        payload JSONB NOT NULL,
+        status VARCHAR NOT NULL DEFAULT 'pending',
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        response_code INTEGER NOT NULL DEFAULT 0,
+        last_error VARCHAR NOT NULL DEFAULT '',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        delivered_at TIMESTAMPTZ
+    );
+
+    CREATE INDEX IF NOT EXISTS webhook_delivery_pending_idx
+        ON webhook_delivery (next_attempt_at) WHERE status = 'pending';
+
+    CREATE TABLE IF NOT EXISTS todo_event (
+        id BIGSERIAL PRIMARY KEY,
+        type VARCHAR NOT NULL,
+        data JSONB NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+
+    CREATE TABLE IF NOT EXISTS idempotency_key (
+        client VARCHAR NOT NULL,
+        key VARCHAR NOT NULL,
+        fingerprint VARCHAR NOT NULL,
+        completed BOOLEAN NOT NULL DEFAULT FALSE,
+        status_code INTEGER NOT NULL DEFAULT 0,
+        headers JSONB NOT NULL DEFAULT '{}',
+        body BYTEA,
+        expires_at TIMESTAMPTZ NOT NULL,
+        PRIMARY KEY (client, key)
+    );
+
+    CREATE TABLE IF NOT EXISTS rate_limit_bucket (
+        key VARCHAR PRIMARY KEY,
+        tokens DOUBLE PRECISION NOT NULL,
+        updated_at TIMESTAMPTZ NOT NULL
+    );
+
+    CREATE TABLE IF NOT EXISTS users (
+        id SERIAL PRIMARY KEY,
+        email VARCHAR NOT NULL UNIQUE,
+        name VARCHAR NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+
+    CREATE TABLE IF NOT EXISTS api_key (
+        id SERIAL PRIMARY KEY,
+        name VARCHAR NOT NULL,
+        prefix VARCHAR NOT NULL,
+        hash VARCHAR NOT NULL UNIQUE,
+        scopes VARCHAR[] NOT NULL,
+        expires_at TIMESTAMPTZ,
+        revoked_at TIMESTAMPTZ,
+        last_used_at TIMESTAMPTZ,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+
+    ALTER TABLE api_key ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+    ALTER TABLE todo ADD COLUMN IF NOT EXISTS owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+    ALTER TABLE todo_list ADD COLUMN IF NOT EXISTS owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+    CREATE TABLE IF NOT EXISTS todo_share (
+        id SERIAL PRIMARY KEY,
+        todo_id INTEGER REFERENCES todo(id) ON DELETE CASCADE,
+        list_id INTEGER REFERENCES todo_list(id) ON DELETE CASCADE,
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        role VARCHAR NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        CHECK ((todo_id IS NULL) <> (list_id IS NULL))
+    );
+
+    CREATE UNIQUE INDEX IF NOT EXISTS todo_share_todo_user_idx ON todo_share (todo_id, user_id) WHERE todo_id IS NOT NULL;
+    CREATE UNIQUE INDEX IF NOT EXISTS todo_share_list_user_idx ON todo_share (list_id, user_id) WHERE list_id IS NOT NULL;
+
+    CREATE TABLE IF NOT EXISTS todo_invitation (
+        id SERIAL PRIMARY KEY,
+        todo_id INTEGER REFERENCES todo(id) ON DELETE CASCADE,
+        list_id INTEGER REFERENCES todo_list(id) ON DELETE CASCADE,
+        email VARCHAR NOT NULL,
+        role VARCHAR NOT NULL,
+        token_hash VARCHAR NOT NULL UNIQUE,
+        invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+        expires_at TIMESTAMPTZ NOT NULL,
+        accepted_at TIMESTAMPTZ,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        CHECK ((todo_id IS NULL) <> (list_id IS NULL))
+    );
+
+    CREATE TABLE IF NOT EXISTS organization (
+        id SERIAL PRIMARY KEY,
+        slug VARCHAR NOT NULL UNIQUE,
+        name VARCHAR NOT NULL,
+        retention_days INTEGER,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+
+    INSERT INTO organization (id, slug, name) VALUES (1, 'default', 'Default') ON CONFLICT (id) DO NOTHING;
+    SELECT setval(pg_get_serial_sequence('organization', 'id'), (SELECT MAX(id) FROM organization));
+
+    CREATE TABLE IF NOT EXISTS org_member (
+        org_id INTEGER NOT NULL REFERENCES organization(id) ON DELETE CASCADE,
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        role VARCHAR NOT NULL DEFAULT 'member',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (org_id, user_id)
+    );
+
+    ALTER TABLE todo ADD COLUMN IF NOT EXISTS org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organization(id) ON DELETE CASCADE;
+    ALTER TABLE todo ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ;
+    ALTER TABLE todo DROP CONSTRAINT IF EXISTS todo_title_key;
+    CREATE UNIQUE INDEX IF NOT EXISTS todo_org_title_idx ON todo (org_id, title);
+
+    ALTER TABLE todo_list ADD COLUMN IF NOT EXISTS org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organization(id) ON DELETE CASCADE;
+    ALTER TABLE todo_list DROP CONSTRAINT IF EXISTS todo_list_name_key;
+    CREATE UNIQUE INDEX IF NOT EXISTS todo_list_org_name_idx ON todo_list (org_id, name);
+
+    ALTER TABLE todo_ical DROP CONSTRAINT IF EXISTS todo_ical_pkey;
+    CREATE UNIQUE INDEX IF NOT EXISTS todo_ical_uid_todo_idx ON todo_ical (uid, todo_id);
 `
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// lagQuery is how far behind the primary a replica is, in seconds. A replica
+// that replayed everything it received isn't lagging even if the primary has
+// been idle; on a primary both LSNs are NULL and the lag is 0.
+const lagQuery = `
+	SELECT CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()), 0) END
+`
+
+type replica struct {
+	db      *sql.DB
+	url     string
+	healthy atomic.Bool
+}
+
+// Replicas are read replicas of the primary, handed out round-robin to reads
+// while they're healthy. They're checked periodically once started: a replica
+// that doesn't answer, or lags by more than maxLag, gets no reads until it
+// recovers.
+type Replicas struct {
+	replicas []*replica
+	next     atomic.Uint64
+	interval time.Duration
+	maxLag   time.Duration
+	stop     chan struct{}
+	done     sync.WaitGroup
+}
+
+func openReplicas(config Config) (*Replicas, error) {
+	r := &Replicas{interval: config.ReplicaCheckInterval, maxLag: config.ReplicaMaxLag}
+	for _, url := range config.ReplicaUrls {
+		if err := validate(url); err != nil {
+			r.close()
+			return nil, fmt.Errorf("replica %s: %w", Redacted(url), err)
+		}
+		db, err := sql.Open("postgres", url)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		db.SetMaxOpenConns(config.MaxOpenConns)
+		db.SetMaxIdleConns(config.MaxIdleConns)
+		db.SetConnMaxLifetime(config.ConnMaxLifetime)
+		db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+		r.replicas = append(r.replicas, &replica{db: db, url: url})
+	}
+	// replicas that are down at startup only mean more reads for the primary
+	r.Check()
+	return r, nil
+}
+
+// pick returns the next healthy replica, or nil when none is
+func (r *Replicas) pick() *replica {
+	healthy := make([]*replica, 0, len(r.replicas))
+	for _, candidate := range r.replicas {
+		if candidate.healthy.Load() {
+			healthy = append(healthy, candidate)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	return healthy[r.next.Add(1)%uint64(len(healthy))]
+}
+
+// Healthy counts the replicas that get reads
+func (r *Replicas) Healthy() int {
+	healthy := 0
+	for _, candidate := range r.replicas {
+		if candidate.healthy.Load() {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// Check pings every replica and measures its lag, updating whether it gets
+// reads
+func (r *Replicas) Check() {
+	var wg sync.WaitGroup
+	for _, candidate := range r.replicas {
+		wg.Add(1)
+		go func(candidate *replica) {
+			defer wg.Done()
+			err := r.check(candidate)
+			if err != nil && candidate.healthy.Load() {
+				fmt.Printf("replica %s is unhealthy: %s\n", Redacted(candidate.url), err)
+			}
+			if err == nil && !candidate.healthy.Load() {
+				fmt.Printf("replica %s is healthy\n", Redacted(candidate.url))
+			}
+			candidate.healthy.Store(err == nil)
+		}(candidate)
+	}
+	wg.Wait()
+}
+
+func (r *Replicas) check(candidate *replica) error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	var lag float64
+	if err := candidate.db.QueryRowContext(ctx, lagQuery).Scan(&lag); err != nil {
+		return err
+	}
+	if r.maxLag > 0 && time.Duration(lag*float64(time.Second)) > r.maxLag {
+		return fmt.Errorf("lagging by %.1fs", lag)
+	}
+	return nil
+}
+
+func (r *Replicas) Start() error {
+	r.stop = make(chan struct{})
+	r.done.Add(1)
+	go func() {
+		defer r.done.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.Check()
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *Replicas) Stop() {
+	close(r.stop)
+	r.done.Wait()
+}
+
+func (r *Replicas) close() {
+	for _, candidate := range r.replicas {
+		candidate.db.Close()
+	}
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+func replicasTestsSetup(t *testing.T, healthy ...bool) *Database {
+	// sql.Open doesn't connect, so these are never used for queries
+	primary, _ := sql.Open("postgres", "postgres://primary/todo")
+	db := &Database{DB: primary, Url: "postgres://primary/todo", Replicas: &Replicas{}}
+	for i, h := range healthy {
+		url := "postgres://replica" + string(rune('1'+i)) + "/todo"
+		replicaDb, _ := sql.Open("postgres", url)
+		r := &replica{db: replicaDb, url: url}
+		r.healthy.Store(h)
+		db.Replicas.replicas = append(db.Replicas.replicas, r)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestReader(t *testing.T) {
+	t.Run("should spread reads over the healthy replicas", func(t *testing.T) {
+		db := replicasTestsSetup(t, true, false, true)
+		seen := map[string]int{}
+		for i := 0; i < 10; i++ {
+			seen[db.Reader().Url]++
+		}
+		if len(seen) != 2 || seen["postgres://replica1/todo"] != 5 || seen["postgres://replica3/todo"] != 5 {
+			t.Errorf("Expected reads to alternate between replicas 1 and 3, got %v", seen)
+		}
+		if db.Replicas.Healthy() != 2 {
+			t.Errorf("Expected 2 healthy replicas, got %d", db.Replicas.Healthy())
+		}
+	})
+
+	t.Run("should fall back to the primary", func(t *testing.T) {
+		db := replicasTestsSetup(t, false)
+		if db.Reader() != db {
+			t.Error("Expected reads to go to the primary without a healthy replica")
+		}
+	})
+
+	t.Run("should keep pinned reads on the primary", func(t *testing.T) {
+		db := replicasTestsSetup(t, true)
+		primary := db.Primary()
+		if primary.Reader() != primary {
+			t.Error("Expected the reads of Primary to go to the primary")
+		}
+		if db.Reader() == db {
+			t.Error("Expected Primary not to pin the database it was derived from")
+		}
+		if reader := db.Reader(); reader.Reader() != reader {
+			t.Error("Expected a replica not to hand reads on to another one")
+		}
+	})
+
+	t.Run("should read from the primary without replicas", func(t *testing.T) {
+		db := &Database{Url: "postgres://primary/todo"}
+		if db.Reader() != db {
+			t.Error("Expected reads to go to the primary")
+		}
+	})
+}
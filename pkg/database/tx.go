@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// UnitOfWork runs work atomically. *Database implements it: repositories
+// created from the *Database handed to the work run in its transaction.
+type UnitOfWork interface {
+	WithTx(ctx context.Context, work func(tx *Database) error) error
+}
+
+var _ UnitOfWork = (*Database)(nil)
+
+// txAttempts is how many times a transaction is tried when Postgres aborts it
+// with a serialization failure or a deadlock
+const txAttempts = 3
+
+// WithTx runs work in a transaction, committed when work returns nil and
+// rolled back when it returns an error or panics. Called on a *Database that
+// is already in a transaction, it runs work in a savepoint instead, so only
+// the work is undone on error.
+//
+// Transactions that Postgres aborts because of concurrent ones are retried,
+// so work must not have effects outside the database.
+func (db *Database) WithTx(ctx context.Context, work func(tx *Database) error) error {
+	return db.WithTxOptions(ctx, nil, work)
+}
+
+// WithTxOptions is WithTx with options such as the isolation level, which
+// savepoints inherit from their transaction
+func (db *Database) WithTxOptions(ctx context.Context, options *sql.TxOptions, work func(tx *Database) error) error {
+	if db.tx != nil {
+		return db.savepoint(ctx, work)
+	}
+	var err error
+	for attempt := 1; attempt <= txAttempts; attempt++ {
+		err = db.transaction(ctx, options, work)
+		if !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		time.Sleep(time.Duration(attempt*attempt) * 10 * time.Millisecond)
+	}
+	return err
+}
+
+func (db *Database) transaction(ctx context.Context, options *sql.TxOptions, work func(tx *Database) error) (err error) {
+	tx, err := db.DB.BeginTx(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	committed := []func(){}
+	if err := work(&Database{DB: db.DB, Url: db.Url, tx: tx, committed: &committed, Replicas: db.Replicas}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, fn := range committed {
+		fn()
+	}
+	return nil
+}
+
+func (db *Database) savepoint(ctx context.Context, work func(tx *Database) error) (err error) {
+	nested := &Database{DB: db.DB, Url: db.Url, tx: db.tx, depth: db.depth + 1, committed: db.committed, Replicas: db.Replicas}
+	name := fmt.Sprintf("savepoint_%d", nested.depth)
+	if _, err := db.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	// what the work asked to run after commit is dropped with its changes
+	registered := len(*db.committed)
+	defer func() {
+		if p := recover(); p != nil {
+			db.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+			*db.committed = (*db.committed)[:registered]
+			panic(p)
+		}
+	}()
+	if err := work(nested); err != nil {
+		*db.committed = (*db.committed)[:registered]
+		if _, rollbackErr := db.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+	_, err = db.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
+
+// retryable tells whether Postgres aborted the transaction because of
+// concurrent ones, so trying again may succeed
+func retryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
+
+// InTx tells whether queries run in a transaction
+func (db *Database) InTx() bool {
+	return db.tx != nil
+}
+
+// AfterCommit runs fn once the transaction commits, or right away outside of
+// a transaction. It isn't run when the transaction, or the savepoint it was
+// registered in, is rolled back, nor more than once when it is retried.
+func (db *Database) AfterCommit(fn func()) {
+	if db.tx == nil {
+		fn()
+		return
+	}
+	*db.committed = append(*db.committed, fn)
+}
+
+// The query methods run in the transaction when there is one, and on the pool
+// otherwise
+
+func (db *Database) Exec(query string, args ...any) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+func (db *Database) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if db.tx != nil {
+		return db.tx.ExecContext(ctx, query, args...)
+	}
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+func (db *Database) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+func (db *Database) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if db.tx != nil {
+		return db.tx.QueryContext(ctx, query, args...)
+	}
+	return db.DB.QueryContext(ctx, query, args...)
+}
+
+func (db *Database) QueryRow(query string, args ...any) *sql.Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+func (db *Database) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if db.tx != nil {
+		return db.tx.QueryRowContext(ctx, query, args...)
+	}
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (db *Database) Prepare(query string) (*sql.Stmt, error) {
+	return db.PrepareContext(context.Background(), query)
+}
+
+func (db *Database) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if db.tx != nil {
+		return db.tx.PrepareContext(ctx, query)
+	}
+	return db.DB.PrepareContext(ctx, query)
+}
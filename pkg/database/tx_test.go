@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"serialization failure", &pq.Error{Code: "40001"}, true},
+		{"deadlock", fmt.Errorf("creating todo: %w", &pq.Error{Code: "40P01"}), true},
+		{"unique violation", &pq.Error{Code: "23505"}, false},
+		{"other error", errors.New("connection refused"), false},
+		{"no error", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if retryable(test.err) != test.retryable {
+				t.Errorf("Expected retryable to be %v", test.retryable)
+			}
+		})
+	}
+}
+
+func txTestsSetup(t *testing.T) *Database {
+	db := MustGetDatabase(common.ReadTestCfg().Database.Url)
+	// temporary tables belong to a connection
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("CREATE TEMPORARY TABLE tx_test (value INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func values(t *testing.T, db *Database) int {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM tx_test").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestRepositoryWithTx(t *testing.T) {
+	db := txTestsSetup(t)
+	ctx := context.Background()
+
+	err := db.WithTx(ctx, func(tx *Database) error {
+		_, err := tx.Exec("INSERT INTO tx_test VALUES (1)")
+		return err
+	})
+	if err != nil || values(t, db) != 1 {
+		t.Fatalf("Expected the insert to be committed, got %v", err)
+	}
+
+	failure := errors.New("failure")
+	err = db.WithTx(ctx, func(tx *Database) error {
+		tx.Exec("INSERT INTO tx_test VALUES (2)")
+		return failure
+	})
+	if !errors.Is(err, failure) || values(t, db) != 1 {
+		t.Errorf("Expected the insert to be rolled back, got %v", err)
+	}
+
+	err = db.WithTx(ctx, func(tx *Database) error {
+		tx.Exec("INSERT INTO tx_test VALUES (3)")
+		nestedErr := tx.WithTx(ctx, func(nested *Database) error {
+			nested.Exec("INSERT INTO tx_test VALUES (4)")
+			return failure
+		})
+		if !errors.Is(nestedErr, failure) {
+			t.Errorf("Expected the nested error, got %v", nestedErr)
+		}
+		return tx.WithTx(ctx, func(nested *Database) error {
+			_, err := nested.Exec("INSERT INTO tx_test VALUES (5)")
+			return err
+		})
+	})
+	if err != nil || values(t, db) != 3 {
+		t.Errorf("Expected only the failed savepoint to be rolled back, got %d rows, %v", values(t, db), err)
+	}
+
+	func() {
+		defer func() { recover() }()
+		db.WithTx(ctx, func(tx *Database) error {
+			tx.Exec("INSERT INTO tx_test VALUES (6)")
+			panic("boom")
+		})
+	}()
+	if values(t, db) != 3 {
+		t.Error("Expected a panic to roll back")
+	}
+}
+
+func TestRepositoryWithTxRetry(t *testing.T) {
+	db := txTestsSetup(t)
+	attempts := 0
+	err := db.WithTx(context.Background(), func(tx *Database) error {
+		attempts++
+		if attempts < txAttempts {
+			return &pq.Error{Code: "40001"}
+		}
+		_, err := tx.Exec("INSERT INTO tx_test VALUES (1)")
+		return err
+	})
+	if err != nil || attempts != txAttempts || values(t, db) != 1 {
+		t.Errorf("Expected the transaction to succeed on attempt %d, got %d: %v", txAttempts, attempts, err)
+	}
+}
+
+func TestRepositoryAfterCommit(t *testing.T) {
+	db := txTestsSetup(t)
+	ctx := context.Background()
+	ran := []string{}
+	after := func(name string) func() {
+		return func() { ran = append(ran, name) }
+	}
+	db.AfterCommit(after("outside"))
+	err := db.WithTx(ctx, func(tx *Database) error {
+		tx.AfterCommit(after("committed"))
+		tx.WithTx(ctx, func(nested *Database) error {
+			nested.AfterCommit(after("rolled back savepoint"))
+			return errors.New("failure")
+		})
+		if len(ran) != 1 {
+			t.Errorf("Expected nothing to run before the commit, got %v", ran)
+		}
+		return nil
+	})
+	db.WithTx(ctx, func(tx *Database) error {
+		tx.AfterCommit(after("rolled back"))
+		return errors.New("failure")
+	})
+	if err != nil || fmt.Sprint(ran) != "[outside committed]" {
+		t.Errorf("Expected only what was committed to run, got %v: %v", ran, err)
+	}
+}
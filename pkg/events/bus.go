@@ -0,0 +1,112 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+)
+
+type Event struct {
+	Type string    `json:"type"`
+	Data any       `json:"data"`
+	Time time.Time `json:"time"`
+}
+
+type Handler func(Event)
+
+// TxHandler handles an event in the transaction of the change it tells
+// about, so what it writes is committed or rolled back with the change. An
+// error rolls the change back.
+type TxHandler func(tx *database.Database, event Event) error
+
+// Bus fans events out to every subscribed handler. Handlers run synchronously
+// on the publishing goroutine, so they should hand slow work off elsewhere.
+// A nil Bus discards everything published to it.
+type Bus struct {
+	mu         sync.RWMutex
+	nextId     int
+	handlers   map[int]Handler
+	txHandlers map[int]TxHandler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: map[int]Handler{}, txHandlers: map[int]TxHandler{}}
+}
+
+// Subscribe registers a handler and returns a function that removes it
+func (b *Bus) Subscribe(handler Handler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextId
+	b.nextId++
+	b.handlers[id] = handler
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+// SubscribeTx registers a handler that runs in the transaction of the
+// changes published with PublishTx, and returns a function that removes it.
+// Events published with Publish don't reach it.
+func (b *Bus) SubscribeTx(handler TxHandler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextId
+	b.nextId++
+	b.txHandlers[id] = handler
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.txHandlers, id)
+	}
+}
+
+// PublishTx publishes an event about a change made in tx. The transactional
+// handlers run right away in tx, and the first error they return is returned
+// so the change can be rolled back; the other handlers run once tx commits.
+func (b *Bus) PublishTx(tx *database.Database, eventType string, data any) error {
+	if b == nil {
+		return nil
+	}
+	event := Event{Type: eventType, Data: data, Time: time.Now().UTC()}
+	b.mu.RLock()
+	handlers := make([]TxHandler, 0, len(b.txHandlers))
+	for _, handler := range b.txHandlers {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+	for _, handler := range handlers {
+		if err := handler(tx, event); err != nil {
+			return err
+		}
+	}
+	if tx == nil {
+		b.publish(event)
+	} else {
+		tx.AfterCommit(func() { b.publish(event) })
+	}
+	return nil
+}
+
+// Publish publishes an event to the handlers that don't need a transaction
+func (b *Bus) Publish(eventType string, data any) {
+	if b == nil {
+		return
+	}
+	b.publish(Event{Type: eventType, Data: data, Time: time.Now().UTC()})
+}
+
+func (b *Bus) publish(event Event) {
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.handlers))
+	for _, handler := range b.handlers {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
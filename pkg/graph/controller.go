@@ -0,0 +1,189 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+// Subprotocol is the websocket protocol subscriptions are served with, as
+// spoken by graphql-ws and most GraphQL clients
+const Subprotocol = "graphql-transport-ws"
+
+const (
+	writeTimeout = 10 * time.Second
+	initTimeout  = 10 * time.Second
+)
+
+type GraphController struct {
+	schema   *graphql.Schema
+	resolver *Resolver
+}
+
+func NewGraphController(schema *graphql.Schema, resolver *Resolver) *GraphController {
+	return &GraphController{schema: schema, resolver: resolver}
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Query executes queries and mutations sent as JSON in the body of a POST,
+// or queries sent in the query string of a GET. Like any GraphQL server it
+// answers 200 with the errors in the body once the request could be read.
+func (gc *GraphController) Query(c *fiber.Ctx) error {
+	var req request
+	if c.Method() == fiber.MethodGet {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if variables := c.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "invalid variables")
+			}
+		}
+	} else if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "bad request body")
+	}
+	if req.Query == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "query is required")
+	}
+	ctx := gc.resolver.withOperation(c.UserContext(), common.GetPrincipal(c), common.GetOrgId(c))
+	// GET requests must be safe to repeat
+	operationOf(ctx).readOnly = c.Method() == fiber.MethodGet
+	return c.Status(fiber.StatusOK).JSON(gc.schema.Exec(ctx, req.Query, req.OperationName, req.Variables))
+}
+
+// Upgrade hands websocket handshakes on to Connect and serves other GET
+// requests as queries
+func (gc *GraphController) Upgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return gc.Query(c)
+	}
+	// the connection only sees locals that were set, not GetOrgId's default
+	common.SetOrgId(c, common.GetOrgId(c))
+	return c.Next()
+}
+
+// message is a graphql-transport-ws message
+type message struct {
+	Id      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Connect serves one graphql-transport-ws connection: after connection_init
+// the client may start any number of operations with subscribe messages and
+// stop them with complete
+func (gc *GraphController) Connect(conn *websocket.Conn) {
+	principal, _ := conn.Locals(common.PrincipalLocal).(*common.Principal)
+	orgId, _ := conn.Locals(common.OrgLocal).(int)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan message, 16)
+	go write(ctx, conn, out)
+	send := func(m message) {
+		select {
+		case out <- m:
+		case <-ctx.Done():
+		}
+	}
+	var mu sync.Mutex
+	operations := map[string]context.CancelFunc{}
+	acknowledged := false
+	conn.SetReadDeadline(time.Now().Add(initTimeout))
+	for {
+		var m message
+		if err := conn.ReadJSON(&m); err != nil {
+			return
+		}
+		switch m.Type {
+		case "connection_init":
+			if acknowledged {
+				closeWith(conn, 4429, "Too many initialisation requests")
+				return
+			}
+			acknowledged = true
+			conn.SetReadDeadline(time.Time{})
+			send(message{Type: "connection_ack"})
+		case "ping":
+			send(message{Type: "pong"})
+		case "pong":
+		case "subscribe":
+			if !acknowledged {
+				closeWith(conn, 4401, "Unauthorized")
+				return
+			}
+			var req request
+			if err := json.Unmarshal(m.Payload, &req); err != nil || m.Id == "" {
+				closeWith(conn, 4400, "Invalid subscribe message")
+				return
+			}
+			mu.Lock()
+			if _, exists := operations[m.Id]; exists {
+				mu.Unlock()
+				closeWith(conn, 4409, "Subscriber for "+m.Id+" already exists")
+				return
+			}
+			opCtx, stop := context.WithCancel(gc.resolver.withOperation(ctx, principal, orgId))
+			operations[m.Id] = stop
+			mu.Unlock()
+			go func(id string) {
+				defer func() {
+					mu.Lock()
+					delete(operations, id)
+					mu.Unlock()
+					stop()
+				}()
+				responses, err := gc.schema.Subscribe(opCtx, req.Query, req.OperationName, req.Variables)
+				if err != nil {
+					payload, _ := json.Marshal([]map[string]string{{"message": err.Error()}})
+					send(message{Id: id, Type: "error", Payload: payload})
+					return
+				}
+				for response := range responses {
+					payload, _ := json.Marshal(response)
+					send(message{Id: id, Type: "next", Payload: payload})
+				}
+				if opCtx.Err() == nil {
+					send(message{Id: id, Type: "complete"})
+				}
+			}(m.Id)
+		case "complete":
+			mu.Lock()
+			if stop, ok := operations[m.Id]; ok {
+				stop()
+			}
+			mu.Unlock()
+		default:
+			closeWith(conn, 4400, "Unknown message type "+m.Type)
+			return
+		}
+	}
+}
+
+func write(ctx context.Context, conn *websocket.Conn, out <-chan message) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-out:
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteJSON(m); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func closeWith(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeTimeout))
+}
@@ -0,0 +1,38 @@
+package graph
+
+import (
+	_ "embed"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/list"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/stream"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"github.com/raphael-foliveira/fiber-todo/pkg/user"
+)
+
+//go:embed schema.graphql
+var Schema string
+
+// maxDepth stops queries from nesting lists and todos without end
+const maxDepth = 8
+
+type GraphModule struct {
+	Schema     *graphql.Schema
+	Controller *GraphController
+}
+
+// New wires the GraphQL endpoint on the repositories, permissions and events
+// the REST API uses. Subscriptions are fed by the stream module's hub, so they
+// see changes from every instance.
+func New(todos todo.ITodoRepository, lists list.IListRepository, users user.IUserRepository, authorizer *sharing.Authorizer, bus *events.Bus, hub *stream.Hub) *GraphModule {
+	resolver := NewResolver(todos, lists, users, authorizer, bus, hub)
+	// the loaders batch what the items of a page load concurrently, so a
+	// page is resolved with up to maxPageSize fields in flight
+	schema := graphql.MustParseSchema(Schema, resolver, graphql.MaxDepth(maxDepth), graphql.MaxParallelism(maxPageSize))
+	return &GraphModule{
+		Schema:     schema,
+		Controller: NewGraphController(schema, resolver),
+	}
+}
@@ -0,0 +1,288 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/auth"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/list"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/stream"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"github.com/raphael-foliveira/fiber-todo/pkg/user"
+)
+
+// the mocks embed the interfaces they stand in for and only implement what
+// the resolvers call
+type mockTodoRepository struct {
+	todo.ITodoRepository
+	todos []todo.Todo
+}
+
+func (mr *mockTodoRepository) List(filter todo.ListFilter) ([]todo.Todo, error) {
+	todos := []todo.Todo{}
+	for _, t := range mr.todos {
+		if t.Id <= filter.AfterId || (filter.Limit > 0 && len(todos) == filter.Limit) {
+			continue
+		}
+		if filter.Completed != nil && t.Completed != *filter.Completed {
+			continue
+		}
+		if filter.ListIds != nil && (t.ListId == nil || !common.Contains(filter.ListIds, *t.ListId)) {
+			continue
+		}
+		todos = append(todos, t)
+	}
+	return todos, nil
+}
+
+func (mr *mockTodoRepository) Create(dto todo.CreateTodoDto) (*todo.Todo, error) {
+	created := todo.Todo{Id: len(mr.todos) + 1, Title: dto.Title, OwnerId: dto.OwnerId, OrgId: dto.OrgId}
+	mr.todos = append(mr.todos, created)
+	return &created, nil
+}
+
+func (mr *mockTodoRepository) WithTx(work func(repository todo.ITodoRepository, tx *database.Database) error) error {
+	return work(mr, nil)
+}
+
+type mockListRepository struct {
+	list.IListRepository
+	mu      sync.Mutex
+	lists   []list.List
+	fetches int
+}
+
+func (mr *mockListRepository) RetrieveMany(orgId int, ids []int, audience common.Audience) ([]list.List, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.fetches++
+	lists := []list.List{}
+	for _, l := range mr.lists {
+		if common.Contains(ids, l.Id) {
+			lists = append(lists, l)
+		}
+	}
+	return lists, nil
+}
+
+type mockUserRepository struct {
+	user.IUserRepository
+}
+
+func (mr *mockUserRepository) RetrieveMany(ids []int) ([]user.User, error) {
+	users := []user.User{}
+	for _, id := range ids {
+		users = append(users, user.User{Id: id, Name: "user"})
+	}
+	return users, nil
+}
+
+type mockSharingRepository struct {
+	sharing.ISharingRepository
+}
+
+func (mr *mockSharingRepository) TodoAccess(id int, userId *int) (*sharing.Access, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (mr *mockSharingRepository) ListAccess(id int, userId *int) (*sharing.Access, error) {
+	return nil, sql.ErrNoRows
+}
+
+type fixture struct {
+	app    *fiber.App
+	todos  *mockTodoRepository
+	lists  *mockListRepository
+	hub    *stream.Hub
+	module *GraphModule
+}
+
+func setUp() *fixture {
+	f := &fixture{
+		todos: &mockTodoRepository{},
+		lists: &mockListRepository{},
+		hub:   stream.NewHub(),
+	}
+	f.module = New(f.todos, f.lists, &mockUserRepository{}, sharing.NewAuthorizer(&mockSharingRepository{}), events.NewBus(), f.hub)
+	f.app = fiber.New()
+	f.app.Use(func(c *fiber.Ctx) error {
+		if scope := c.Get("X-Test-Scope"); scope != "" {
+			common.SetPrincipal(c, &common.Principal{KeyId: 1, Scopes: []string{scope}})
+		}
+		return c.Next()
+	})
+	GetGraphRoutes(f.app.Group("/graphql"), f.module.Controller)
+	return f
+}
+
+type response struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string            `json:"message"`
+		Extensions map[string]string `json:"extensions"`
+	} `json:"errors"`
+}
+
+func (f *fixture) post(t *testing.T, scope string, query string, variables map[string]any) response {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": variables})
+	req, _ := http.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if scope != "" {
+		req.Header.Set("X-Test-Scope", scope)
+	}
+	return f.do(t, req)
+}
+
+func (f *fixture) do(t *testing.T, req *http.Request) response {
+	t.Helper()
+	res, err := f.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", res.StatusCode)
+	}
+	var decoded response
+	if err := json.NewDecoder(res.Body).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestQuery(t *testing.T) {
+	f := setUp()
+	owner := 3
+	for i := 1; i <= 5; i++ {
+		listId := i%2 + 1
+		f.todos.todos = append(f.todos.todos, todo.Todo{Id: i, Title: "todo", ListId: &listId, OwnerId: &owner, OrgId: 1})
+	}
+	f.lists.lists = []list.List{{Id: 1, Name: "odd"}, {Id: 2, Name: "even"}}
+
+	t.Run("should resolve nested lists in one batch", func(t *testing.T) {
+		res := f.post(t, "", `{ todos { edges { node { id list { name todos { id } } owner { id } } } } }`, nil)
+		if len(res.Errors) > 0 {
+			t.Fatalf("Expected no errors, got %+v", res.Errors)
+		}
+		var todos struct {
+			Edges []struct {
+				Node struct {
+					Id   string
+					List struct {
+						Name  string
+						Todos []struct{ Id string }
+					}
+					Owner struct{ Id string }
+				}
+			}
+		}
+		json.Unmarshal(res.Data["todos"], &todos)
+		if len(todos.Edges) != 5 || todos.Edges[0].Node.List.Name != "even" || todos.Edges[0].Node.Owner.Id != "3" {
+			t.Errorf("Expected 5 todos with their list and owner, got %+v", todos)
+		}
+		if len(todos.Edges[1].Node.List.Todos) != 2 {
+			t.Errorf("Expected the odd list to hold 2 todos, got %+v", todos.Edges[1].Node.List)
+		}
+		if f.lists.fetches != 1 {
+			t.Errorf("Expected lists to be fetched once, got %d", f.lists.fetches)
+		}
+	})
+
+	t.Run("should page with cursors", func(t *testing.T) {
+		query := `query($after: String) { todos(first: 2, after: $after, filter: {listId: 2}) { edges { node { id } } pageInfo { hasNextPage endCursor } } }`
+		ids := []string{}
+		variables := map[string]any{}
+		for {
+			var page struct {
+				Edges    []struct{ Node struct{ Id string } }
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				}
+			}
+			res := f.post(t, "", query, variables)
+			json.Unmarshal(res.Data["todos"], &page)
+			for _, edge := range page.Edges {
+				ids = append(ids, edge.Node.Id)
+			}
+			if !page.PageInfo.HasNextPage {
+				break
+			}
+			variables["after"] = page.PageInfo.EndCursor
+		}
+		if len(ids) != 3 || ids[0] != "1" || ids[2] != "5" {
+			t.Errorf("Expected todos 1, 3 and 5, got %v", ids)
+		}
+	})
+
+	t.Run("should refuse mutations without the write scope", func(t *testing.T) {
+		res := f.post(t, auth.ScopeRead, `mutation { createTodo(input: {title: "new"}) { id } }`, nil)
+		if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != "FORBIDDEN" {
+			t.Errorf("Expected a FORBIDDEN error, got %+v", res.Errors)
+		}
+		res = f.post(t, auth.ScopeWrite, `mutation { createTodo(input: {title: "new"}) { id title } }`, nil)
+		if len(res.Errors) != 0 {
+			t.Errorf("Expected the todo to be created, got %+v", res.Errors)
+		}
+	})
+
+	t.Run("should refuse mutations sent with GET", func(t *testing.T) {
+		query := url.Values{"query": {`mutation { deleteTodo(id: 1) }`}}
+		req, _ := http.NewRequest(http.MethodGet, "/graphql?"+query.Encode(), nil)
+		res := f.do(t, req)
+		if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != "BAD_REQUEST" {
+			t.Errorf("Expected a BAD_REQUEST error, got %+v", res.Errors)
+		}
+	})
+}
+
+func TestSubscription(t *testing.T) {
+	f := setUp()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = f.module.Controller.resolver.withOperation(ctx, nil, common.DefaultOrgId)
+	responses, err := f.module.Schema.Subscribe(ctx, `subscription { todoChanged(listId: 2) { id type todo { title } } }`, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listId := 2
+	publish := func(id int64, t todo.Todo) {
+		data, _ := json.Marshal(t)
+		f.hub.Broadcast(stream.StoredEvent{Id: id, Type: todo.EventCreated, Data: data, CreatedAt: time.Now()})
+	}
+	// the resolver subscribes to the hub asynchronously; keep publishing
+	// until the subscription is live
+	go func() {
+		for i := int64(1); ctx.Err() == nil; i += 3 {
+			publish(i, todo.Todo{Id: 1, Title: "other org", ListId: &listId, OrgId: 2})
+			publish(i+1, todo.Todo{Id: 2, Title: "no list", OrgId: 1})
+			publish(i+2, todo.Todo{Id: 3, Title: "match", ListId: &listId, OrgId: 1})
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	var res struct {
+		Data struct {
+			TodoChanged struct {
+				Type string
+				Todo struct{ Title string }
+			}
+		}
+	}
+	data, _ := json.Marshal(<-responses)
+	json.Unmarshal(data, &res)
+	if res.Data.TodoChanged.Todo.Title != "match" || res.Data.TodoChanged.Type != todo.EventCreated {
+		t.Errorf("Expected only the matching todo, got %s", data)
+	}
+}
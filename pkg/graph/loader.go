@@ -0,0 +1,115 @@
+package graph
+
+import (
+	"sync"
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/list"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"github.com/raphael-foliveira/fiber-todo/pkg/user"
+)
+
+// batchWindow is how long a loader waits for more keys before fetching. The
+// executor resolves the fields of a list's items concurrently, so the keys of
+// a whole page arrive within it.
+const batchWindow = 2 * time.Millisecond
+
+// loader batches the keys loaded while an operation resolves into one fetch,
+// so resolving a field of every todo in a page costs one query instead of one
+// per todo. Results are kept for the life of the loader.
+type loader[K comparable, V any] struct {
+	fetch   func(keys []K) (map[K]V, error)
+	mu      sync.Mutex
+	pending *batch[K, V]
+	batches map[K]*batch[K, V]
+}
+
+type batch[K comparable, V any] struct {
+	keys   []K
+	done   chan struct{}
+	values map[K]V
+	err    error
+}
+
+func newLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{fetch: fetch, batches: map[K]*batch[K, V]{}}
+}
+
+// Load returns the value for the key, and whether there is one
+func (l *loader[K, V]) Load(key K) (V, bool, error) {
+	l.mu.Lock()
+	b, ok := l.batches[key]
+	if !ok {
+		if l.pending == nil {
+			l.pending = &batch[K, V]{done: make(chan struct{})}
+			time.AfterFunc(batchWindow, l.dispatch)
+		}
+		b = l.pending
+		b.keys = append(b.keys, key)
+		l.batches[key] = b
+	}
+	l.mu.Unlock()
+	<-b.done
+	value, found := b.values[key]
+	return value, found, b.err
+}
+
+func (l *loader[K, V]) dispatch() {
+	l.mu.Lock()
+	b := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+	b.values, b.err = l.fetch(b.keys)
+	close(b.done)
+}
+
+// loaders are the loaders of one operation, reading as the caller in the
+// organization of the request
+type loaders struct {
+	lists     *loader[int, list.List]
+	users     *loader[int, user.User]
+	listTodos *loader[int, []todo.Todo]
+}
+
+func (r *Resolver) newLoaders(principal *common.Principal, orgId int) *loaders {
+	audience := common.AudienceOf(principal)
+	return &loaders{
+		lists: newLoader(func(ids []int) (map[int]list.List, error) {
+			lists, err := r.lists.RetrieveMany(orgId, ids, audience)
+			if err != nil {
+				return nil, err
+			}
+			byId := map[int]list.List{}
+			for _, l := range lists {
+				byId[l.Id] = l
+			}
+			return byId, nil
+		}),
+		users: newLoader(func(ids []int) (map[int]user.User, error) {
+			users, err := r.users.RetrieveMany(ids)
+			if err != nil {
+				return nil, err
+			}
+			byId := map[int]user.User{}
+			for _, u := range users {
+				byId[u.Id] = u
+			}
+			return byId, nil
+		}),
+		listTodos: newLoader(func(ids []int) (map[int][]todo.Todo, error) {
+			todos, err := r.todos.List(todo.ListFilter{OrgId: orgId, Audience: audience, ListIds: ids})
+			if err != nil {
+				return nil, err
+			}
+			byList := map[int][]todo.Todo{}
+			for _, id := range ids {
+				byList[id] = []todo.Todo{}
+			}
+			for _, t := range todos {
+				byList[*t.ListId] = append(byList[*t.ListId], t)
+			}
+			return byList, nil
+		}),
+	}
+}
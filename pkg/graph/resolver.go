@@ -0,0 +1,429 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/raphael-foliveira/fiber-todo/pkg/auth"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/list"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/stream"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"github.com/raphael-foliveira/fiber-todo/pkg/user"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// Resolver is the root resolver of the schema. Its operations mirror the REST
+// handlers: same repositories, permission checks and events.
+type Resolver struct {
+	todos      todo.ITodoRepository
+	lists      list.IListRepository
+	users      user.IUserRepository
+	authorizer *sharing.Authorizer
+	bus        *events.Bus
+	hub        *stream.Hub
+}
+
+// NewResolver creates the root resolver. The todo repository enforces the
+// todo quota, like it does for POST /api/todos.
+func NewResolver(todos todo.ITodoRepository, lists list.IListRepository, users user.IUserRepository, authorizer *sharing.Authorizer, bus *events.Bus, hub *stream.Hub) *Resolver {
+	return &Resolver{
+		todos:      todos,
+		lists:      lists,
+		users:      users,
+		authorizer: authorizer,
+		bus:        bus,
+		hub:        hub,
+	}
+}
+
+// Error is a resolver error with a machine readable code, sent to clients in
+// the extensions of the error
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.Code}
+}
+
+func errorf(code string, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+var errInternal = &Error{Code: "INTERNAL", Message: "internal error"}
+
+type operationKey struct{}
+
+// operation is what the resolvers know about the caller of an operation
+type operation struct {
+	principal *common.Principal
+	orgId     int
+	loaders   *loaders
+	// readOnly refuses mutations, for queries sent with GET
+	readOnly bool
+}
+
+func (r *Resolver) withOperation(ctx context.Context, principal *common.Principal, orgId int) context.Context {
+	return context.WithValue(ctx, operationKey{}, &operation{
+		principal: principal,
+		orgId:     orgId,
+		loaders:   r.newLoaders(principal, orgId),
+	})
+}
+
+func operationOf(ctx context.Context) *operation {
+	if op, ok := ctx.Value(operationKey{}).(*operation); ok {
+		return op
+	}
+	return &operation{orgId: common.DefaultOrgId}
+}
+
+// requireWrite refuses mutations from keys without the write scope, which
+// the HTTP middleware can't tell from the method of a GraphQL request
+func requireWrite(op *operation) error {
+	if op.readOnly {
+		return errorf("BAD_REQUEST", "mutations must be sent with POST")
+	}
+	if op.principal != nil && !op.principal.HasScope(auth.ScopeWrite) {
+		return errorf("FORBIDDEN", "API key lacks the %s scope", auth.ScopeWrite)
+	}
+	return nil
+}
+
+func (r *Resolver) require(op *operation, role sharing.Role, resource sharing.Resource) error {
+	err := r.authorizer.Require(op.principal, role, resource)
+	var forbidden *sharing.ForbiddenError
+	if errors.As(err, &forbidden) {
+		return errorf("FORBIDDEN", "%s", forbidden.Error())
+	}
+	if err != nil {
+		fmt.Println("graphql access check:", err)
+		return errInternal
+	}
+	return nil
+}
+
+func parseId(id graphql.ID) (int, error) {
+	intId, err := strconv.Atoi(string(id))
+	if err != nil {
+		return 0, errorf("BAD_USER_INPUT", "invalid id %q", id)
+	}
+	return intId, nil
+}
+
+func parseOptionalId(id *graphql.ID) (*int, error) {
+	if id == nil {
+		return nil, nil
+	}
+	intId, err := parseId(*id)
+	return &intId, err
+}
+
+func toId(id int) graphql.ID {
+	return graphql.ID(strconv.Itoa(id))
+}
+
+type todosArgs struct {
+	First  *int32
+	After  *string
+	Filter *struct {
+		Completed       *bool
+		ListId          *graphql.ID
+		IncludeArchived *bool
+	}
+}
+
+func (r *Resolver) Todos(ctx context.Context, args todosArgs) (*connectionResolver, error) {
+	op := operationOf(ctx)
+	afterId := 0
+	if args.After != nil {
+		var err error
+		if afterId, err = todo.DecodeCursor(*args.After); err != nil {
+			return nil, errorf("BAD_USER_INPUT", "invalid cursor")
+		}
+	}
+	pageSize := defaultPageSize
+	if args.First != nil {
+		pageSize = int(*args.First)
+	}
+	if pageSize <= 0 || pageSize > maxPageSize {
+		return nil, errorf("BAD_USER_INPUT", "first must be between 1 and %d", maxPageSize)
+	}
+	filter := todo.ListFilter{
+		OrgId:    op.orgId,
+		Audience: common.AudienceOf(op.principal),
+		AfterId:  afterId,
+		// one more than the page size tells whether there is a next page
+		Limit: pageSize + 1,
+	}
+	if args.Filter != nil {
+		filter.Completed = args.Filter.Completed
+		filter.IncludeArchived = args.Filter.IncludeArchived != nil && *args.Filter.IncludeArchived
+		listId, err := parseOptionalId(args.Filter.ListId)
+		if err != nil {
+			return nil, err
+		}
+		if listId != nil {
+			filter.ListIds = []int{*listId}
+		}
+	}
+	todos, err := r.todos.List(filter)
+	if err != nil {
+		fmt.Println("graphql todos:", err)
+		return nil, errInternal
+	}
+	connection := &connectionResolver{}
+	if len(todos) > pageSize {
+		todos = todos[:pageSize]
+		connection.hasNextPage = true
+	}
+	for _, t := range todos {
+		connection.edges = append(connection.edges, &edgeResolver{node: r.todo(op.loaders, t)})
+	}
+	return connection, nil
+}
+
+func (r *Resolver) Todo(ctx context.Context, args struct{ Id graphql.ID }) (*todoResolver, error) {
+	op := operationOf(ctx)
+	id, err := parseId(args.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.require(op, sharing.RoleViewer, sharing.Resource{TodoId: &id}); err != nil {
+		return nil, err
+	}
+	t, err := r.todos.Retrieve(op.orgId, id)
+	if err != nil {
+		return nil, nil
+	}
+	return r.todo(op.loaders, *t), nil
+}
+
+func (r *Resolver) Lists(ctx context.Context) ([]*listResolver, error) {
+	op := operationOf(ctx)
+	lists, err := r.lists.List(op.orgId, common.AudienceOf(op.principal), false)
+	if err != nil {
+		fmt.Println("graphql lists:", err)
+		return nil, errInternal
+	}
+	resolvers := []*listResolver{}
+	for _, l := range lists {
+		resolvers = append(resolvers, r.list(op.loaders, l))
+	}
+	return resolvers, nil
+}
+
+func (r *Resolver) List(ctx context.Context, args struct{ Id graphql.ID }) (*listResolver, error) {
+	op := operationOf(ctx)
+	id, err := parseId(args.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.require(op, sharing.RoleViewer, sharing.Resource{ListId: &id}); err != nil {
+		return nil, err
+	}
+	l, err := r.lists.Retrieve(op.orgId, id)
+	if err != nil {
+		return nil, nil
+	}
+	return r.list(op.loaders, *l), nil
+}
+
+type todoInput struct {
+	Title       string
+	Description *string
+	Completed   *bool
+	DueDate     *graphql.Time
+	Priority    *int32
+	ListId      *graphql.ID
+}
+
+func (input todoInput) dto() (todo.CreateTodoDto, error) {
+	dto := todo.CreateTodoDto{Title: input.Title}
+	if input.Description != nil {
+		dto.Description = *input.Description
+	}
+	if input.Completed != nil {
+		dto.Completed = *input.Completed
+	}
+	if input.DueDate != nil {
+		dto.DueDate = &input.DueDate.Time
+	}
+	if input.Priority != nil {
+		dto.Priority = int(*input.Priority)
+	}
+	listId, err := parseOptionalId(input.ListId)
+	dto.ListId = listId
+	return dto, err
+}
+
+func (r *Resolver) CreateTodo(ctx context.Context, args struct{ Input todoInput }) (*todoResolver, error) {
+	op := operationOf(ctx)
+	if err := requireWrite(op); err != nil {
+		return nil, err
+	}
+	dto, err := args.Input.dto()
+	if err != nil {
+		return nil, err
+	}
+	dto.OwnerId = common.UserIdOf(op.principal)
+	dto.OrgId = op.orgId
+	if dto.ListId != nil {
+		if err := r.require(op, sharing.RoleEditor, sharing.Resource{ListId: dto.ListId}); err != nil {
+			return nil, err
+		}
+	}
+	created, err := todo.Create(r.todos, r.bus, dto)
+	if errors.Is(err, todo.ErrQuotaExceeded) {
+		return nil, errorf("QUOTA_EXCEEDED", "quota exceeded")
+	}
+	if errors.Is(err, todo.ErrPublish) {
+		fmt.Println("graphql createTodo:", err)
+		return nil, errInternal
+	}
+	if err != nil {
+		fmt.Println("graphql createTodo:", err)
+		return nil, errorf("CONFLICT", "todo already exists")
+	}
+	return r.todo(op.loaders, *created), nil
+}
+
+func (r *Resolver) UpdateTodo(ctx context.Context, args struct {
+	Id    graphql.ID
+	Input todoInput
+}) (*todoResolver, error) {
+	op := operationOf(ctx)
+	if err := requireWrite(op); err != nil {
+		return nil, err
+	}
+	id, err := parseId(args.Id)
+	if err != nil {
+		return nil, err
+	}
+	dto, err := args.Input.dto()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.require(op, sharing.RoleEditor, sharing.Resource{TodoId: &id}); err != nil {
+		return nil, err
+	}
+	if dto.ListId != nil {
+		if err := r.require(op, sharing.RoleEditor, sharing.Resource{ListId: dto.ListId}); err != nil {
+			return nil, err
+		}
+	}
+	previous, err := r.todos.Retrieve(op.orgId, id)
+	if err != nil {
+		return nil, errorf("NOT_FOUND", "todo %d not found", id)
+	}
+	updated, err := todo.Update(r.todos, r.bus, *previous, todo.Todo{
+		Id:          id,
+		Title:       dto.Title,
+		Description: dto.Description,
+		Completed:   dto.Completed,
+		DueDate:     dto.DueDate,
+		Priority:    dto.Priority,
+		ListId:      dto.ListId,
+		OwnerId:     previous.OwnerId,
+		OrgId:       previous.OrgId,
+		AssigneeId:  previous.AssigneeId,
+	})
+	if err != nil {
+		fmt.Println("graphql updateTodo:", err)
+		return nil, errInternal
+	}
+	return r.todo(op.loaders, *updated), nil
+}
+
+func (r *Resolver) DeleteTodo(ctx context.Context, args struct{ Id graphql.ID }) (graphql.ID, error) {
+	op := operationOf(ctx)
+	if err := requireWrite(op); err != nil {
+		return "", err
+	}
+	id, err := parseId(args.Id)
+	if err != nil {
+		return "", err
+	}
+	if err := r.require(op, sharing.RoleOwner, sharing.Resource{TodoId: &id}); err != nil {
+		return "", err
+	}
+	t, err := r.todos.Retrieve(op.orgId, id)
+	if err != nil {
+		return "", errorf("NOT_FOUND", "todo %d not found", id)
+	}
+	if _, err := todo.Delete(r.todos, r.bus, t); err != nil {
+		fmt.Println("graphql deleteTodo:", err)
+		return "", errInternal
+	}
+	return args.Id, nil
+}
+
+// TodoChanged subscribes to the stream module's events, which come from every
+// instance, and keeps those of the organization about todos the caller can see
+func (r *Resolver) TodoChanged(ctx context.Context, args struct{ ListId *graphql.ID }) (<-chan *eventResolver, error) {
+	op := operationOf(ctx)
+	listId, err := parseOptionalId(args.ListId)
+	if err != nil {
+		return nil, err
+	}
+	live, unsubscribe := r.hub.Subscribe()
+	events := make(chan *eventResolver)
+	go func() {
+		defer close(events)
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-live:
+				if !ok {
+					return
+				}
+				t, ok := r.visible(op, event, listId)
+				if !ok {
+					continue
+				}
+				// each event gets its own loaders so it doesn't see what
+				// earlier ones cached
+				resolver := &eventResolver{event: event, todo: r.todo(r.newLoaders(op.principal, op.orgId), t)}
+				select {
+				case events <- resolver:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+func (r *Resolver) visible(op *operation, event stream.StoredEvent, listId *int) (todo.Todo, bool) {
+	var t todo.Todo
+	if err := json.Unmarshal(event.Data, &t); err != nil {
+		return t, false
+	}
+	// events from before organizations existed belong to the default one
+	if t.OrgId == 0 {
+		t.OrgId = common.DefaultOrgId
+	}
+	if t.OrgId != op.orgId || (listId != nil && (t.ListId == nil || *t.ListId != *listId)) {
+		return t, false
+	}
+	return t, r.authorizer.CanSee(op.principal, t)
+}
@@ -0,0 +1,14 @@
+package graph
+
+import (
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+func GetGraphRoutes(router fiber.Router, controller *GraphController) fiber.Router {
+	router.Post("/", controller.Query)
+	router.Get("/", controller.Upgrade, websocket.New(controller.Connect, websocket.Config{
+		Subprotocols: []string{Subprotocol},
+	}))
+	return router
+}
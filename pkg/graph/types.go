@@ -0,0 +1,232 @@
+package graph
+
+import (
+	"fmt"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/raphael-foliveira/fiber-todo/pkg/list"
+	"github.com/raphael-foliveira/fiber-todo/pkg/stream"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"github.com/raphael-foliveira/fiber-todo/pkg/user"
+)
+
+type todoResolver struct {
+	root    *Resolver
+	loaders *loaders
+	t       todo.Todo
+}
+
+func (r *Resolver) todo(loaders *loaders, t todo.Todo) *todoResolver {
+	return &todoResolver{root: r, loaders: loaders, t: t}
+}
+
+func (tr *todoResolver) Id() graphql.ID {
+	return toId(tr.t.Id)
+}
+
+func (tr *todoResolver) Title() string {
+	return tr.t.Title
+}
+
+func (tr *todoResolver) Description() string {
+	return tr.t.Description
+}
+
+func (tr *todoResolver) Completed() bool {
+	return tr.t.Completed
+}
+
+func (tr *todoResolver) DueDate() *graphql.Time {
+	if tr.t.DueDate == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *tr.t.DueDate}
+}
+
+func (tr *todoResolver) Priority() int32 {
+	return int32(tr.t.Priority)
+}
+
+func (tr *todoResolver) CompletedAt() *graphql.Time {
+	if tr.t.CompletedAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *tr.t.CompletedAt}
+}
+
+func (tr *todoResolver) Archived() bool {
+	return tr.t.Archived
+}
+
+func (tr *todoResolver) ArchivedAt() *graphql.Time {
+	if tr.t.ArchivedAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *tr.t.ArchivedAt}
+}
+
+func (tr *todoResolver) CommentCount() int32 {
+	return int32(tr.t.CommentCount)
+}
+
+// List is null for todos in a list the caller can't see
+func (tr *todoResolver) List() (*listResolver, error) {
+	if tr.t.ListId == nil {
+		return nil, nil
+	}
+	l, found, err := tr.loaders.lists.Load(*tr.t.ListId)
+	if err != nil {
+		fmt.Println("graphql Todo.list:", err)
+		return nil, errInternal
+	}
+	if !found {
+		return nil, nil
+	}
+	return tr.root.list(tr.loaders, l), nil
+}
+
+func (tr *todoResolver) Owner() (*userResolver, error) {
+	return loadUser(tr.loaders, tr.t.OwnerId)
+}
+
+func (tr *todoResolver) Assignee() (*userResolver, error) {
+	return loadUser(tr.loaders, tr.t.AssigneeId)
+}
+
+type listResolver struct {
+	root    *Resolver
+	loaders *loaders
+	l       list.List
+}
+
+func (r *Resolver) list(loaders *loaders, l list.List) *listResolver {
+	return &listResolver{root: r, loaders: loaders, l: l}
+}
+
+func (lr *listResolver) Id() graphql.ID {
+	return toId(lr.l.Id)
+}
+
+func (lr *listResolver) Name() string {
+	return lr.l.Name
+}
+
+func (lr *listResolver) Archived() bool {
+	return lr.l.Archived
+}
+
+func (lr *listResolver) Owner() (*userResolver, error) {
+	return loadUser(lr.loaders, lr.l.OwnerId)
+}
+
+// Todos are the todos of the list the caller can see
+func (lr *listResolver) Todos() ([]*todoResolver, error) {
+	todos, _, err := lr.loaders.listTodos.Load(lr.l.Id)
+	if err != nil {
+		fmt.Println("graphql List.todos:", err)
+		return nil, errInternal
+	}
+	resolvers := []*todoResolver{}
+	for _, t := range todos {
+		resolvers = append(resolvers, lr.root.todo(lr.loaders, t))
+	}
+	return resolvers, nil
+}
+
+type userResolver struct {
+	u user.User
+}
+
+func loadUser(loaders *loaders, id *int) (*userResolver, error) {
+	if id == nil {
+		return nil, nil
+	}
+	u, found, err := loaders.users.Load(*id)
+	if err != nil {
+		fmt.Println("graphql user:", err)
+		return nil, errInternal
+	}
+	if !found {
+		return nil, nil
+	}
+	return &userResolver{u: u}, nil
+}
+
+func (ur *userResolver) Id() graphql.ID {
+	return toId(ur.u.Id)
+}
+
+func (ur *userResolver) Name() string {
+	return ur.u.Name
+}
+
+func (ur *userResolver) Email() string {
+	return ur.u.Email
+}
+
+type connectionResolver struct {
+	edges       []*edgeResolver
+	hasNextPage bool
+}
+
+func (cr *connectionResolver) Edges() []*edgeResolver {
+	if cr.edges == nil {
+		return []*edgeResolver{}
+	}
+	return cr.edges
+}
+
+func (cr *connectionResolver) PageInfo() *pageInfoResolver {
+	info := &pageInfoResolver{hasNextPage: cr.hasNextPage}
+	if len(cr.edges) > 0 {
+		cursor := cr.edges[len(cr.edges)-1].Cursor()
+		info.endCursor = &cursor
+	}
+	return info
+}
+
+type edgeResolver struct {
+	node *todoResolver
+}
+
+func (er *edgeResolver) Cursor() string {
+	return todo.EncodeCursor(er.node.t.Id)
+}
+
+func (er *edgeResolver) Node() *todoResolver {
+	return er.node
+}
+
+type pageInfoResolver struct {
+	hasNextPage bool
+	endCursor   *string
+}
+
+func (pr *pageInfoResolver) HasNextPage() bool {
+	return pr.hasNextPage
+}
+
+func (pr *pageInfoResolver) EndCursor() *string {
+	return pr.endCursor
+}
+
+type eventResolver struct {
+	event stream.StoredEvent
+	todo  *todoResolver
+}
+
+func (er *eventResolver) Id() graphql.ID {
+	return graphql.ID(fmt.Sprint(er.event.Id))
+}
+
+func (er *eventResolver) Type() string {
+	return er.event.Type
+}
+
+func (er *eventResolver) Todo() *todoResolver {
+	return er.todo
+}
+
+func (er *eventResolver) Time() graphql.Time {
+	return graphql.Time{Time: er.event.CreatedAt}
+}
@@ -0,0 +1,261 @@
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/list"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+const contentType = "text/calendar; charset=utf-8"
+
+type IcalController struct {
+	repository     IIcalRepository
+	todoRepository todo.ITodoRepository
+	listRepository list.IListRepository
+	authorizer     *sharing.Authorizer
+	bus            *events.Bus
+}
+
+func NewIcalController(repository IIcalRepository, todoRepository todo.ITodoRepository, listRepository list.IListRepository, authorizer *sharing.Authorizer, bus *events.Bus) *IcalController {
+	return &IcalController{repository: repository, todoRepository: todoRepository, listRepository: listRepository, authorizer: authorizer, bus: bus}
+}
+
+// @Feed godoc
+// @Summary To Do iCalendar feed
+// @Description Read-only feed of the To Dos visible to the caller as RFC 5545 VTODO components. The list of a To Do is its category, and due dates at midnight UTC are dates without a time.
+// @Tags iCalendar
+// @Produce text/calendar
+// @Success 200 {string} string "VCALENDAR object"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /todos.ics [get]
+func (ic *IcalController) Feed(c *fiber.Ctx) error {
+	orgId := common.GetOrgId(c)
+	audience := common.AudienceOf(common.GetPrincipal(c))
+	todos, err := ic.todoRepository.List(todo.ListFilter{
+		OrgId:    orgId,
+		Audience: audience,
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	lists, err := ic.listRepository.List(orgId, audience, true)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	listNames := map[int]string{}
+	for _, l := range lists {
+		listNames[l.Id] = l.Name
+	}
+	ids := make([]int, len(todos))
+	for i, t := range todos {
+		ids[i] = t.Id
+	}
+	uids, err := ic.repository.Uids(orgId, ids)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	now := time.Now()
+	components := make([]VTodo, 0, len(todos))
+	for _, t := range todos {
+		components = append(components, toVTodo(t, uids[t.Id], listNames, now))
+	}
+	body := new(bytes.Buffer)
+	if err := Encode(body, components); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.Status(fiber.StatusOK).Send(body.Bytes())
+}
+
+// @Import godoc
+// @Summary Import To Dos from iCalendar
+// @Description Create a To Do for every VTODO in the calendar, skipping UIDs that were already imported or exported. The first category naming a list the caller can add To Dos to puts the To Do in it; the other categories are left out and reported in warnings. Components that can't be created are reported in failed.
+// @Tags iCalendar
+// @Accept text/calendar
+// @Produce json
+// @Param calendar body string true "VCALENDAR object"
+// @Success 200 {object} ImportResponse
+// @Failure 400 {object} string "Bad Request"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /todos.ics [post]
+func (ic *IcalController) Import(c *fiber.Ctx) error {
+	components, err := Parse(bytes.NewReader(c.Body()))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	principal := common.GetPrincipal(c)
+	orgId := common.GetOrgId(c)
+	lists, err := ic.listRepository.List(orgId, common.AudienceOf(principal), false)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	response := ImportResponse{Created: []todo.Todo{}, Skipped: []string{}, Failed: []ImportIssue{}, Warnings: []ImportIssue{}}
+	for _, component := range components {
+		duplicate, err := ic.isDuplicate(orgId, component.Uid)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError)
+		}
+		if duplicate || component.Summary == "" {
+			response.Skipped = append(response.Skipped, component.Uid)
+			continue
+		}
+		dto := toCreateTodoDto(component)
+		dto.OwnerId = common.UserIdOf(principal)
+		dto.OrgId = orgId
+		listId, ignored, err := ic.targetList(principal, lists, component.Categories)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError)
+		}
+		dto.ListId = listId
+		created, err := ic.create(dto, component.Uid)
+		if err != nil {
+			response.Failed = append(response.Failed, ImportIssue{Uid: component.Uid, Message: importError(err)})
+			continue
+		}
+		response.Created = append(response.Created, *created)
+		if len(ignored) > 0 {
+			response.Warnings = append(response.Warnings, ImportIssue{
+				Uid:     component.Uid,
+				Message: "categories not imported: " + strings.Join(ignored, ", "),
+			})
+		}
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// create creates the todo, publishing its events, and links the UID to it in
+// one transaction, so a todo is never left without the UID that keeps it from
+// being imported again
+func (ic *IcalController) create(dto todo.CreateTodoDto, uid string) (*todo.Todo, error) {
+	var created *todo.Todo
+	err := ic.todoRepository.WithTx(func(todos todo.ITodoRepository, tx *database.Database) error {
+		var err error
+		created, err = todo.Create(todos, ic.bus, dto)
+		if err != nil || uid == "" {
+			return err
+		}
+		return ic.repository.WithDb(tx).Link(uid, created.Id)
+	})
+	return created, err
+}
+
+// targetList returns the list named by the first category that names a list
+// the caller can add todos to, and the categories left out
+func (ic *IcalController) targetList(principal *common.Principal, lists []list.List, categories []string) (*int, []string, error) {
+	var target *int
+	ignored := []string{}
+	for _, category := range categories {
+		if target == nil {
+			for _, l := range lists {
+				if !strings.EqualFold(l.Name, category) {
+					continue
+				}
+				role, err := ic.authorizer.ListRole(principal, l.Id)
+				if err != nil {
+					return nil, nil, err
+				}
+				if role.AtLeast(sharing.RoleEditor) {
+					id := l.Id
+					target = &id
+					break
+				}
+			}
+			if target != nil {
+				continue
+			}
+		}
+		ignored = append(ignored, category)
+	}
+	return target, ignored, nil
+}
+
+// importError tells why a todo couldn't be created, without the details of
+// unexpected errors
+func importError(err error) string {
+	if errors.Is(err, todo.ErrQuotaExceeded) || errors.Is(err, todo.ErrAssigneeNotFound) {
+		return err.Error()
+	}
+	fmt.Println("error importing todo:", err)
+	return "could not create the todo"
+}
+
+// isDuplicate reports whether the UID belongs to a To Do that already exists,
+// either because it was imported before or because this API exported it
+func (ic *IcalController) isDuplicate(orgId int, uid string) (bool, error) {
+	if uid == "" {
+		return false, nil
+	}
+	if id, ok := parseTodoUid(uid); ok {
+		if _, err := ic.todoRepository.Retrieve(orgId, id); err == nil {
+			return true, nil
+		}
+	}
+	exists, err := ic.repository.Exists(orgId, uid)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+func toVTodo(t todo.Todo, uid string, listNames map[int]string, stamp time.Time) VTodo {
+	if uid == "" {
+		uid = todoUid(t.Id)
+	}
+	status := StatusNeedsAction
+	if t.Completed {
+		status = StatusCompleted
+	}
+	v := VTodo{
+		Uid:         uid,
+		Summary:     t.Title,
+		Description: t.Description,
+		Status:      status,
+		Priority:    t.Priority,
+		Stamp:       stamp,
+	}
+	// dates are imported as midnight UTC, so that is taken for a date
+	if t.DueDate != nil {
+		due := t.DueDate.UTC()
+		v.Due = &due
+		v.DueIsDate = due.Equal(due.Truncate(24 * time.Hour))
+	}
+	if t.ListId != nil && listNames[*t.ListId] != "" {
+		v.Categories = []string{listNames[*t.ListId]}
+	}
+	return v
+}
+
+func toCreateTodoDto(v VTodo) todo.CreateTodoDto {
+	return todo.CreateTodoDto{
+		Title:       v.Summary,
+		Description: v.Description,
+		Completed:   v.Status == StatusCompleted,
+		DueDate:     v.Due,
+		Priority:    v.Priority,
+	}
+}
+
+const uidSuffix = "@fiber-todo"
+
+func todoUid(id int) string {
+	return "todo-" + strconv.Itoa(id) + uidSuffix
+}
+
+func parseTodoUid(uid string) (int, bool) {
+	if !strings.HasPrefix(uid, "todo-") || !strings.HasSuffix(uid, uidSuffix) {
+		return 0, false
+	}
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(uid, "todo-"), uidSuffix))
+	return id, err == nil
+}
@@ -0,0 +1,19 @@
+package ical
+
+import "github.com/raphael-foliveira/fiber-todo/pkg/todo"
+
+type ImportResponse struct {
+	Created []todo.Todo `json:"created"`
+	Skipped []string    `json:"skipped"`
+	// Failed are the components that couldn't be imported
+	Failed []ImportIssue `json:"failed"`
+	// Warnings tell what was left out of components that were imported, such
+	// as categories that don't name a list the caller can add todos to
+	Warnings []ImportIssue `json:"warnings"`
+}
+
+// ImportIssue is what went wrong with the component of the UID
+type ImportIssue struct {
+	Uid     string `json:"uid"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,23 @@
+package ical
+
+import (
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/list"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type IcalModule struct {
+	Repository IIcalRepository
+	Controller *IcalController
+}
+
+func New(db *database.Database, todoRepository todo.ITodoRepository, listRepository list.IListRepository, authorizer *sharing.Authorizer, bus *events.Bus) *IcalModule {
+	repository := NewIcalRepository(db)
+	controller := NewIcalController(repository, todoRepository, listRepository, authorizer, bus)
+	return &IcalModule{
+		Repository: repository,
+		Controller: controller,
+	}
+}
@@ -0,0 +1,216 @@
+package ical
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/list"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type mockTodoRepository struct {
+	todos []todo.Todo
+	// published are the types of the events published about the todos
+	published []string
+}
+
+func (mr *mockTodoRepository) Create(dto todo.CreateTodoDto) (*todo.Todo, error) {
+	for _, t := range mr.todos {
+		if t.Title == dto.Title {
+			return nil, errors.New("todo already exists in mock repository")
+		}
+	}
+	created := todo.Todo{Id: len(mr.todos) + 1, Title: dto.Title, Description: dto.Description, Completed: dto.Completed, DueDate: dto.DueDate, ListId: dto.ListId}
+	mr.todos = append(mr.todos, created)
+	return &created, nil
+}
+
+func (mr *mockTodoRepository) List(filter todo.ListFilter) ([]todo.Todo, error) {
+	return mr.todos, nil
+}
+
+func (mr *mockTodoRepository) Retrieve(orgId int, id int) (*todo.Todo, error) {
+	for _, t := range mr.todos {
+		if t.Id == id {
+			return &t, nil
+		}
+	}
+	return nil, errors.New("todo not found in mock repository")
+}
+
+func (mr *mockTodoRepository) Update(t todo.Todo) (*todo.Todo, error) {
+	return &t, nil
+}
+
+func (mr *mockTodoRepository) Delete(orgId int, id int) (int64, error) {
+	return 0, nil
+}
+
+func (mr *mockTodoRepository) Count(orgId int, ownerId *int) (int, error) {
+	return len(mr.todos), nil
+}
+
+func (mr *mockTodoRepository) Archive(orgId int, id int, archived bool) (*todo.Todo, error) {
+	return nil, nil
+}
+
+func (mr *mockTodoRepository) WithTx(work func(repository todo.ITodoRepository, tx *database.Database) error) error {
+	return work(mr, nil)
+}
+
+type mockIcalRepository struct {
+	uids map[string]int
+}
+
+func (mr *mockIcalRepository) Uids(orgId int, todoIds []int) (map[int]string, error) {
+	uids := map[int]string{}
+	for uid, id := range mr.uids {
+		if common.Contains(todoIds, id) {
+			uids[id] = uid
+		}
+	}
+	return uids, nil
+}
+
+func (mr *mockIcalRepository) Exists(orgId int, uid string) (bool, error) {
+	_, ok := mr.uids[uid]
+	return ok, nil
+}
+
+func (mr *mockIcalRepository) Link(uid string, todoId int) error {
+	mr.uids[uid] = todoId
+	return nil
+}
+
+func (mr *mockIcalRepository) WithDb(db *database.Database) IIcalRepository {
+	return mr
+}
+
+type mockListRepository struct {
+	list.IListRepository
+}
+
+func (mr *mockListRepository) List(orgId int, audience common.Audience, includeArchived bool) ([]list.List, error) {
+	return []list.List{{Id: 1, Name: "Work"}, {Id: 2, Name: "Private"}}, nil
+}
+
+// mockSharingRepository leaves list 1 open to everyone and gives list 2 an
+// owner
+type mockSharingRepository struct {
+	sharing.ISharingRepository
+}
+
+func (mr *mockSharingRepository) ListAccess(id int, userId *int) (*sharing.Access, error) {
+	if id == 2 {
+		return &sharing.Access{Owners: []int{9}}, nil
+	}
+	return &sharing.Access{}, nil
+}
+
+func icalTestsSetup() (*fiber.App, *mockTodoRepository, *mockIcalRepository) {
+	app := fiber.New()
+	due := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	listId := 1
+	todos := &mockTodoRepository{todos: []todo.Todo{{Id: 1, Title: "existing", DueDate: &due, ListId: &listId}}}
+	uids := &mockIcalRepository{uids: map[string]int{"imported@example.com": 1}}
+	bus := events.NewBus()
+	bus.Subscribe(func(event events.Event) {
+		todos.published = append(todos.published, event.Type)
+	})
+	GetIcalRoutes(app, NewIcalController(uids, todos, &mockListRepository{}, sharing.NewAuthorizer(&mockSharingRepository{}), bus))
+	return app, todos, uids
+}
+
+func TestFeed(t *testing.T) {
+	app, _, _ := icalTestsSetup()
+	req, _ := http.NewRequest("GET", "/todos.ics", nil)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 {
+		t.Errorf("Expected status code 200, got %v", res.StatusCode)
+	}
+	body, _ := io.ReadAll(res.Body)
+	if !strings.Contains(string(body), "UID:imported@example.com") {
+		t.Errorf("Expected feed to keep the imported UID, got %s", body)
+	}
+	if !strings.Contains(string(body), "CATEGORIES:Work\r\n") {
+		t.Errorf("Expected the list as category, got %s", body)
+	}
+	if !strings.Contains(string(body), "DUE;VALUE=DATE:20240301\r\n") {
+		t.Errorf("Expected the due date without a time, got %s", body)
+	}
+}
+
+func TestImport(t *testing.T) {
+	calendar := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VTODO\r\nUID:new@example.com\r\nSUMMARY:new\r\nCATEGORIES:work,Private\r\nCATEGORIES:Home\r\nEND:VTODO\r\n" +
+		"BEGIN:VTODO\r\nUID:failing@example.com\r\nSUMMARY:existing\r\nEND:VTODO\r\n" +
+		"BEGIN:VTODO\r\nUID:imported@example.com\r\nSUMMARY:again\r\nEND:VTODO\r\n" +
+		"BEGIN:VTODO\r\nUID:todo-1@fiber-todo\r\nSUMMARY:exported\r\nEND:VTODO\r\n" +
+		"END:VCALENDAR\r\n"
+	tests := []struct {
+		name          string
+		body          string
+		expectStatus  int
+		expectCreated int
+		expectSkipped int
+	}{
+		{"import deduplicates by uid", calendar, 200, 1, 2},
+		{"import invalid calendar", "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\n", 400, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app, todos, uids := icalTestsSetup()
+			req, _ := http.NewRequest("POST", "/todos.ics", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "text/calendar")
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Fatalf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+			if test.expectStatus != 200 {
+				return
+			}
+			var response ImportResponse
+			if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Created) != test.expectCreated || len(response.Skipped) != test.expectSkipped {
+				t.Errorf("Expected %d created and %d skipped, got %+v", test.expectCreated, test.expectSkipped, response)
+			}
+			if _, ok := uids.uids["new@example.com"]; !ok {
+				t.Errorf("Expected imported uid to be linked")
+			}
+			if len(todos.published) != 1 || todos.published[0] != todo.EventCreated {
+				t.Errorf("Expected todo.created to be published for the imported todo, got %v", todos.published)
+			}
+			if _, ok := uids.uids["failing@example.com"]; ok {
+				t.Errorf("Expected the uid of the failed todo not to be linked")
+			}
+			if len(response.Failed) != 1 || response.Failed[0].Uid != "failing@example.com" || response.Failed[0].Message != "could not create the todo" {
+				t.Errorf("Expected the failed todo to be reported, got %+v", response.Failed)
+			}
+			if listId := response.Created[0].ListId; listId == nil || *listId != 1 {
+				t.Errorf("Expected the todo to be put in the list of its category, got %v", listId)
+			}
+			expectedWarning := ImportIssue{Uid: "new@example.com", Message: "categories not imported: Private, Home"}
+			if len(response.Warnings) != 1 || response.Warnings[0] != expectedWarning {
+				t.Errorf("Expected %+v, got %+v", expectedWarning, response.Warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package ical
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+)
+
+type IIcalRepository interface {
+	Uids(orgId int, todoIds []int) (map[int]string, error)
+	Exists(orgId int, uid string) (bool, error)
+	Link(uid string, todoId int) error
+	// WithDb returns the repository running its queries on db, such as a
+	// transaction
+	WithDb(db *database.Database) IIcalRepository
+}
+
+type IcalRepository struct {
+	Db *database.Database
+}
+
+func NewIcalRepository(db *database.Database) *IcalRepository {
+	return &IcalRepository{Db: db}
+}
+
+// Uids returns the UIDs the todos of the organization were imported with,
+// keyed by todo id
+func (ir *IcalRepository) Uids(orgId int, todoIds []int) (map[int]string, error) {
+	rows, err := ir.Db.Query(`
+	SELECT todo_ical.uid, todo_ical.todo_id FROM todo_ical JOIN todo ON todo.id = todo_ical.todo_id
+	WHERE todo.org_id = $1 AND todo_ical.todo_id = ANY($2)
+	`, orgId, pq.Array(todoIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	uids := map[int]string{}
+	for rows.Next() {
+		var uid string
+		var todoId int
+		if err := rows.Scan(&uid, &todoId); err != nil {
+			return nil, err
+		}
+		uids[todoId] = uid
+	}
+	return uids, rows.Err()
+}
+
+// Exists reports whether the UID was imported into the organization
+func (ir *IcalRepository) Exists(orgId int, uid string) (bool, error) {
+	var todoId int
+	err := ir.Db.QueryRow(`
+	SELECT todo_ical.todo_id FROM todo_ical JOIN todo ON todo.id = todo_ical.todo_id
+	WHERE todo_ical.uid = $1 AND todo.org_id = $2
+	`, uid, orgId).Scan(&todoId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (ir *IcalRepository) WithDb(db *database.Database) IIcalRepository {
+	return &IcalRepository{Db: db}
+}
+
+func (ir *IcalRepository) Link(uid string, todoId int) error {
+	_, err := ir.Db.Exec("INSERT INTO todo_ical (uid, todo_id) VALUES ($1, $2)", uid, todoId)
+	return err
+}
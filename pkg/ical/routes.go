@@ -0,0 +1,9 @@
+package ical
+
+import "github.com/gofiber/fiber/v2"
+
+func GetIcalRoutes(router fiber.Router, controller *IcalController) fiber.Router {
+	router.Get("/todos.ics", controller.Feed)
+	router.Post("/todos.ics", controller.Import)
+	return router
+}
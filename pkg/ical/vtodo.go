@@ -0,0 +1,270 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StatusNeedsAction = "NEEDS-ACTION"
+	StatusCompleted   = "COMPLETED"
+	StatusInProcess   = "IN-PROCESS"
+	StatusCancelled   = "CANCELLED"
+)
+
+const (
+	prodId        = "-//raphael-foliveira//fiber-todo//EN"
+	dateTimeUtc   = "20060102T150405Z"
+	dateTimeLocal = "20060102T150405"
+	dateOnly      = "20060102"
+	maxLineOctets = 75
+)
+
+var ErrInvalidCalendar = errors.New("invalid calendar")
+
+// VTodo is the subset of an RFC 5545 VTODO component the API reads and writes
+type VTodo struct {
+	Uid         string
+	Summary     string
+	Description string
+	Status      string
+	Due         *time.Time
+	// DueIsDate is set when Due is a date, without a time of day
+	DueIsDate  bool
+	Priority   int
+	Categories []string
+	Stamp      time.Time
+}
+
+// Encode writes the given components as a VCALENDAR object
+func Encode(w io.Writer, todos []VTodo) error {
+	bw := bufio.NewWriter(w)
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:"+prodId)
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	for _, todo := range todos {
+		writeLine(bw, "BEGIN:VTODO")
+		writeLine(bw, "UID:"+escapeText(todo.Uid))
+		writeLine(bw, "DTSTAMP:"+todo.Stamp.UTC().Format(dateTimeUtc))
+		writeLine(bw, "SUMMARY:"+escapeText(todo.Summary))
+		if todo.Description != "" {
+			writeLine(bw, "DESCRIPTION:"+escapeText(todo.Description))
+		}
+		if todo.Status != "" {
+			writeLine(bw, "STATUS:"+todo.Status)
+		}
+		if todo.Due != nil && todo.DueIsDate {
+			writeLine(bw, "DUE;VALUE=DATE:"+todo.Due.Format(dateOnly))
+		} else if todo.Due != nil {
+			writeLine(bw, "DUE:"+todo.Due.UTC().Format(dateTimeUtc))
+		}
+		if todo.Priority > 0 {
+			writeLine(bw, "PRIORITY:"+strconv.Itoa(todo.Priority))
+		}
+		if len(todo.Categories) > 0 {
+			escaped := make([]string, len(todo.Categories))
+			for i, category := range todo.Categories {
+				escaped[i] = escapeText(category)
+			}
+			writeLine(bw, "CATEGORIES:"+strings.Join(escaped, ","))
+		}
+		writeLine(bw, "END:VTODO")
+	}
+	writeLine(bw, "END:VCALENDAR")
+	return bw.Flush()
+}
+
+// Parse reads every VTODO component found in a VCALENDAR object
+func Parse(r io.Reader) ([]VTodo, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	todos := []VTodo{}
+	var current *VTodo
+	inCalendar := false
+	for _, line := range lines {
+		name, params, value, err := splitProperty(line)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case name == "BEGIN" && value == "VCALENDAR":
+			inCalendar = true
+		case name == "END" && value == "VCALENDAR":
+			inCalendar = false
+		case name == "BEGIN" && value == "VTODO":
+			if !inCalendar || current != nil {
+				return nil, fmt.Errorf("%w: unexpected BEGIN:VTODO", ErrInvalidCalendar)
+			}
+			current = &VTodo{}
+		case name == "END" && value == "VTODO":
+			if current == nil {
+				return nil, fmt.Errorf("%w: unexpected END:VTODO", ErrInvalidCalendar)
+			}
+			todos = append(todos, *current)
+			current = nil
+		case current != nil:
+			if err := current.setProperty(name, params, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if current != nil || inCalendar {
+		return nil, fmt.Errorf("%w: unterminated component", ErrInvalidCalendar)
+	}
+	return todos, nil
+}
+
+func (v *VTodo) setProperty(name string, params map[string]string, value string) error {
+	var err error
+	switch name {
+	case "UID":
+		v.Uid = unescapeText(value)
+	case "SUMMARY":
+		v.Summary = unescapeText(value)
+	case "DESCRIPTION":
+		v.Description = unescapeText(value)
+	case "STATUS":
+		v.Status = strings.ToUpper(value)
+	case "PRIORITY":
+		v.Priority, err = strconv.Atoi(value)
+		if err != nil || v.Priority < 0 || v.Priority > 9 {
+			return fmt.Errorf("%w: bad PRIORITY %q", ErrInvalidCalendar, value)
+		}
+	case "DUE":
+		due, err := parseDateTime(params, value)
+		if err != nil {
+			return err
+		}
+		v.Due = &due
+		v.DueIsDate = params["VALUE"] == "DATE" || len(value) == len(dateOnly)
+	case "CATEGORIES":
+		// the property may be repeated, each time with a list of categories
+		for _, category := range splitText(value) {
+			if category = strings.TrimSpace(category); category != "" {
+				v.Categories = append(v.Categories, category)
+			}
+		}
+	case "DTSTAMP":
+		v.Stamp, err = parseDateTime(params, value)
+	}
+	return err
+}
+
+func parseDateTime(params map[string]string, value string) (time.Time, error) {
+	location := time.UTC
+	if tzid, ok := params["TZID"]; ok {
+		loaded, err := time.LoadLocation(tzid)
+		if err == nil {
+			location = loaded
+		}
+	}
+	layouts := []string{dateTimeUtc, dateTimeLocal, dateOnly}
+	if params["VALUE"] == "DATE" {
+		layouts = []string{dateOnly}
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: bad date-time %q", ErrInvalidCalendar, value)
+}
+
+// unfold joins content lines that were folded onto several physical lines
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	lines := []string{}
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitProperty splits a content line into its name, parameters and value
+func splitProperty(line string) (string, map[string]string, string, error) {
+	params := map[string]string{}
+	colon := -1
+	quoted := false
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		}
+		if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", fmt.Errorf("%w: malformed line %q", ErrInvalidCalendar, line)
+	}
+	parts := strings.Split(line[:colon], ";")
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:], nil
+}
+
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// continuation lines spend one octet on the leading space
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(line + "\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+var textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func unescapeText(s string) string {
+	return textUnescaper.Replace(s)
+}
+
+// splitText splits a list of text values on the commas that aren't escaped
+// and unescapes each value
+func splitText(s string) []string {
+	values := []string{}
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			values = append(values, unescapeText(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(values, unescapeText(s[start:]))
+}
@@ -0,0 +1,118 @@
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeParseRoundTrip(t *testing.T) {
+	due := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	original := VTodo{
+		Uid:         "todo-1@fiber-todo",
+		Summary:     "Buy milk, eggs; bread",
+		Description: "line one\nline two \\ backslash",
+		Status:      StatusCompleted,
+		Due:         &due,
+		Priority:    3,
+		Categories:  []string{"Work, home", "Errands"},
+		Stamp:       due,
+	}
+	b := new(bytes.Buffer)
+	if err := Encode(b, []VTodo{original}); err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	parsed, err := Parse(b)
+	if err != nil {
+		t.Fatalf("Error parsing: %s", err)
+	}
+	if len(parsed) != 1 {
+		t.Fatalf("Expected 1 component, got %d", len(parsed))
+	}
+	got := parsed[0]
+	if got.Uid != original.Uid || got.Summary != original.Summary || got.Description != original.Description {
+		t.Errorf("Expected %+v, got %+v", original, got)
+	}
+	if got.Status != StatusCompleted || got.Priority != 3 {
+		t.Errorf("Expected status %s and priority 3, got %s and %d", StatusCompleted, got.Status, got.Priority)
+	}
+	if got.Due == nil || !got.Due.Equal(due) || got.DueIsDate {
+		t.Errorf("Expected due %v, got %v", due, got.Due)
+	}
+	if fmt.Sprintf("%q", got.Categories) != `["Work, home" "Errands"]` {
+		t.Errorf("Expected categories %q, got %q", original.Categories, got.Categories)
+	}
+}
+
+func TestEncodeDate(t *testing.T) {
+	due := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	b := new(bytes.Buffer)
+	if err := Encode(b, []VTodo{{Uid: "1", Summary: "a", Due: &due, DueIsDate: true}}); err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	if !strings.Contains(b.String(), "\r\nDUE;VALUE=DATE:20240301\r\n") {
+		t.Errorf("Expected a date due, got %q", b.String())
+	}
+	parsed, err := Parse(b)
+	if err != nil {
+		t.Fatalf("Error parsing: %s", err)
+	}
+	if !parsed[0].DueIsDate || !parsed[0].Due.Equal(due) {
+		t.Errorf("Expected the date to be read back, got %v", parsed[0].Due)
+	}
+}
+
+func TestEncodeFoldsLongLines(t *testing.T) {
+	b := new(bytes.Buffer)
+	err := Encode(b, []VTodo{{Uid: "1", Summary: strings.Repeat("á", 100)}})
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	for _, line := range strings.Split(b.String(), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("Expected lines of at most %d octets, got %d", maxLineOctets, len(line))
+		}
+	}
+	parsed, err := Parse(b)
+	if err != nil {
+		t.Fatalf("Error parsing: %s", err)
+	}
+	if parsed[0].Summary != strings.Repeat("á", 100) {
+		t.Errorf("Expected folded summary to be restored, got %q", parsed[0].Summary)
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Run("should read date values and time zones", func(t *testing.T) {
+		calendar := "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nUID:a\r\nSUMMARY:a\r\n" +
+			"DUE;VALUE=DATE:20240301\r\nEND:VTODO\r\nBEGIN:VTODO\r\nUID:b\r\nSUMMARY:b\r\n" +
+			"DUE;TZID=America/Sao_Paulo:20240301T090000\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+		parsed, err := Parse(strings.NewReader(calendar))
+		if err != nil {
+			t.Fatalf("Error parsing: %s", err)
+		}
+		if !parsed[0].Due.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("Expected date due, got %v", parsed[0].Due)
+		}
+		if !parsed[1].Due.Equal(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)) {
+			t.Errorf("Expected zoned due, got %v", parsed[1].Due)
+		}
+	})
+
+	t.Run("should reject malformed calendars", func(t *testing.T) {
+		calendars := []string{
+			"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nUID:a\r\nEND:VCALENDAR\r\n",
+			"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nPRIORITY:12\r\nEND:VTODO\r\nEND:VCALENDAR\r\n",
+			"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nnot a property\r\nEND:VTODO\r\nEND:VCALENDAR\r\n",
+		}
+		for _, calendar := range calendars {
+			_, err := Parse(strings.NewReader(calendar))
+			if !errors.Is(err, ErrInvalidCalendar) {
+				t.Errorf("Expected ErrInvalidCalendar, got %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+)
+
+type entry struct {
+	fingerprint string
+	response    *Response
+	lockedUntil time.Time
+}
+
+type mockStore struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+func (ms *mockStore) Claim(client string, key string, fingerprint string, lifetime time.Duration, lease time.Duration) (*Response, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	e, ok := ms.entries[client+key]
+	if !ok {
+		ms.entries[client+key] = &entry{fingerprint: fingerprint, lockedUntil: time.Now().Add(lease)}
+		return nil, true, nil
+	}
+	if e.fingerprint != fingerprint {
+		return nil, false, ErrFingerprintMismatch
+	}
+	if e.response == nil && e.lockedUntil.Before(time.Now()) {
+		e.lockedUntil = time.Now().Add(lease)
+		return nil, true, nil
+	}
+	return e.response, false, nil
+}
+
+func (ms *mockStore) Save(client string, key string, response Response) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.entries[client+key].response = &response
+	return nil
+}
+
+func (ms *mockStore) Release(client string, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.entries, client+key)
+	return nil
+}
+
+func (ms *mockStore) Purge() (int64, error) {
+	return 0, nil
+}
+
+func idempotencyTestsSetup(handler fiber.Handler) *fiber.App {
+	app, _ := idempotencyTestsSetupWithStore(handler, DefaultConfig)
+	return app
+}
+
+func idempotencyTestsSetupWithStore(handler fiber.Handler, config Config) (*fiber.App, *mockStore) {
+	app := fiber.New()
+	app.Use(recover.New())
+	config.PollInterval = time.Millisecond
+	store := &mockStore{entries: map[string]*entry{}}
+	app.Use(New(store, config))
+	app.Post("/todos", handler)
+	return app, store
+}
+
+func post(t *testing.T, app *fiber.App, key string, body string) (*http.Response, string) {
+	req, _ := http.NewRequest("POST", "/todos", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	return res, string(b)
+}
+
+func TestIdempotency(t *testing.T) {
+	t.Run("should replay the first response", func(t *testing.T) {
+		var calls int32
+		app := idempotencyTestsSetup(func(c *fiber.Ctx) error {
+			n := atomic.AddInt32(&calls, 1)
+			return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": n})
+		})
+		first, firstBody := post(t, app, "abc", "{}")
+		second, secondBody := post(t, app, "abc", "{}")
+		if calls != 1 {
+			t.Errorf("Expected handler to run once, ran %d times", calls)
+		}
+		if second.StatusCode != first.StatusCode || secondBody != firstBody {
+			t.Errorf("Expected %d %s, got %d %s", first.StatusCode, firstBody, second.StatusCode, secondBody)
+		}
+		if second.Header.Get(ReplayedHeader) != "true" || second.Header.Get("Content-Type") != fiber.MIMEApplicationJSON {
+			t.Errorf("Unexpected replay headers %v", second.Header)
+		}
+	})
+
+	t.Run("should replay client errors but not server errors", func(t *testing.T) {
+		var calls int32
+		app := idempotencyTestsSetup(func(c *fiber.Ctx) error {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return fiber.NewError(fiber.StatusInternalServerError)
+			}
+			return fiber.NewError(fiber.StatusConflict)
+		})
+		for _, expected := range []int{500, 409, 409} {
+			res, _ := post(t, app, "abc", "{}")
+			if res.StatusCode != expected {
+				t.Errorf("Expected status code %d, got %d", expected, res.StatusCode)
+			}
+		}
+		if calls != 2 {
+			t.Errorf("Expected handler to run twice, ran %d times", calls)
+		}
+	})
+
+	t.Run("should only replay the status, body and content type", func(t *testing.T) {
+		app := idempotencyTestsSetup(func(c *fiber.Ctx) error {
+			c.Set("RateLimit-Remaining", "9")
+			return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": 1})
+		})
+		post(t, app, "abc", "{}")
+		res, body := post(t, app, "abc", "{}")
+		if res.StatusCode != 201 || body != `{"id":1}` || res.Header.Get("Content-Type") != fiber.MIMEApplicationJSON {
+			t.Errorf("Unexpected replay %d %s %v", res.StatusCode, body, res.Header)
+		}
+		if res.Header.Get("RateLimit-Remaining") != "" {
+			t.Errorf("Expected the headers of the first request not to be replayed, got %v", res.Header)
+		}
+	})
+
+	t.Run("should release the key when the handler panics", func(t *testing.T) {
+		var calls int32
+		app := idempotencyTestsSetup(func(c *fiber.Ctx) error {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				panic("boom")
+			}
+			return c.SendStatus(fiber.StatusCreated)
+		})
+		for _, expected := range []int{500, 201, 201} {
+			res, _ := post(t, app, "abc", "{}")
+			if res.StatusCode != expected {
+				t.Errorf("Expected status code %d, got %d", expected, res.StatusCode)
+			}
+		}
+		if calls != 2 {
+			t.Errorf("Expected handler to run twice, ran %d times", calls)
+		}
+	})
+
+	t.Run("should take over a claim whose lease ran out", func(t *testing.T) {
+		config := DefaultConfig
+		config.ClientKey = func(c *fiber.Ctx) string { return "client" }
+		var calls int32
+		app, store := idempotencyTestsSetupWithStore(func(c *fiber.Ctx) error {
+			atomic.AddInt32(&calls, 1)
+			return c.SendStatus(fiber.StatusCreated)
+		}, config)
+		// left by a request that crashed before saving its response
+		fingerprint := sha256.Sum256([]byte("POST /todos\n{}"))
+		store.entries["clientabc"] = &entry{fingerprint: hex.EncodeToString(fingerprint[:]), lockedUntil: time.Now().Add(-time.Second)}
+		res, _ := post(t, app, "abc", "{}")
+		if res.StatusCode != 201 || calls != 1 {
+			t.Errorf("Expected the request to run and get 201, got %d after %d runs", res.StatusCode, calls)
+		}
+	})
+
+	t.Run("should refuse a key reused for a different request", func(t *testing.T) {
+		app := idempotencyTestsSetup(func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusCreated)
+		})
+		post(t, app, "abc", `{"title": "a"}`)
+		res, _ := post(t, app, "abc", `{"title": "b"}`)
+		if res.StatusCode != 422 {
+			t.Errorf("Expected status code 422, got %d", res.StatusCode)
+		}
+	})
+
+	t.Run("should serialize concurrent requests with the same key", func(t *testing.T) {
+		var calls int32
+		release := make(chan struct{})
+		app := idempotencyTestsSetup(func(c *fiber.Ctx) error {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return c.SendStatus(fiber.StatusCreated)
+		})
+		var wg sync.WaitGroup
+		statuses := make([]int, 3)
+		for i := range statuses {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				res, _ := post(t, app, "abc", "{}")
+				statuses[i] = res.StatusCode
+			}(i)
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		if calls != 1 {
+			t.Errorf("Expected handler to run once, ran %d times", calls)
+		}
+		for _, status := range statuses {
+			if status != 201 {
+				t.Errorf("Expected every request to get 201, got %v", statuses)
+			}
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+const ReplayedHeader = "Idempotent-Replayed"
+
+const maxKeyLength = 255
+
+type Config struct {
+	KeyHeader string
+	// Methods the middleware applies to, POST only by default
+	Methods []string
+	// Lifetime is how long a response is replayed for
+	Lifetime time.Duration
+	// Lease is how long a request holds its key before another request with
+	// the same key can take it over, should the first one have crashed. It
+	// must outlast the slowest request, or a request can run twice.
+	Lease time.Duration
+	// WaitTimeout bounds how long a request waits on another one holding the
+	// same key before giving up with 409
+	WaitTimeout  time.Duration
+	PollInterval time.Duration
+	// ClientKey scopes keys, so two clients can't see each other's responses
+	ClientKey func(c *fiber.Ctx) string
+}
+
+var DefaultConfig = Config{
+	KeyHeader:    "Idempotency-Key",
+	Methods:      []string{fiber.MethodPost},
+	Lifetime:     24 * time.Hour,
+	Lease:        time.Minute,
+	WaitTimeout:  10 * time.Second,
+	PollInterval: 100 * time.Millisecond,
+	ClientKey:    common.ClientKey,
+}
+
+// New returns a middleware that stores the first response to each
+// Idempotency-Key and replays it for repeated requests. Requests racing on
+// the same key are serialized: the first runs, the others wait for its
+// response. Server errors aren't stored so that they can be retried.
+func New(store Store, config Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := utils.CopyString(c.Get(config.KeyHeader))
+		if key == "" || !common.Contains(config.Methods, c.Method()) {
+			return c.Next()
+		}
+		if len(key) > maxKeyLength {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("%s must be at most %d characters", config.KeyHeader, maxKeyLength))
+		}
+		client := config.ClientKey(c)
+		fingerprint := fingerprintRequest(c)
+
+		deadline := time.Now().Add(config.WaitTimeout)
+		for {
+			response, claimed, err := store.Claim(client, key, fingerprint, config.Lifetime, config.Lease)
+			if errors.Is(err, ErrFingerprintMismatch) {
+				return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+			}
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError)
+			}
+			if response != nil {
+				return replay(c, response)
+			}
+			if claimed {
+				return handle(c, store, client, key)
+			}
+			if time.Now().After(deadline) {
+				return fiber.NewError(fiber.StatusConflict, "a request with this idempotency key is still being processed")
+			}
+			time.Sleep(config.PollInterval)
+		}
+	}
+}
+
+func handle(c *fiber.Ctx, store Store, client string, key string) error {
+	// a panicking handler is recovered further up, without a response to
+	// store, so the key is released for the request to be retried
+	defer func() {
+		if r := recover(); r != nil {
+			if err := store.Release(client, key); err != nil {
+				fmt.Println("error releasing idempotency key:", err)
+			}
+			panic(r)
+		}
+	}()
+	// errors are rendered here rather than by the app so that error responses
+	// are stored and replayed like any other
+	if err := c.Next(); err != nil {
+		if err := c.App().ErrorHandler(c, err); err != nil {
+			store.Release(client, key)
+			return err
+		}
+	}
+	status := c.Response().StatusCode()
+	if status >= fiber.StatusInternalServerError {
+		return store.Release(client, key)
+	}
+	return store.Save(client, key, Response{
+		StatusCode:  status,
+		ContentType: string(c.Response().Header.ContentType()),
+		Body:        utils.CopyBytes(c.Response().Body()),
+	})
+}
+
+func replay(c *fiber.Ctx, response *Response) error {
+	if response.ContentType != "" {
+		c.Set(fiber.HeaderContentType, response.ContentType)
+	}
+	c.Set(ReplayedHeader, "true")
+	return c.Status(response.StatusCode).Send(response.Body)
+}
+
+// fingerprintRequest identifies the request a key was first used with, so
+// that reusing a key for a different request is refused
+func fingerprintRequest(c *fiber.Ctx) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Method() + " " + c.OriginalURL() + "\n"))
+	hash.Write(c.Body())
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,110 @@
+package idempotency
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+)
+
+var ErrFingerprintMismatch = errors.New("idempotency key reused with a different request")
+
+// Response is a stored response replayed for repeated keys. Other headers
+// belong to the request they were sent with, such as RateLimit-*, and
+// aren't replayed.
+type Response struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+type Store interface {
+	// Claim reserves a key for a request for the lease. It returns the
+	// stored response when the key was already used, and claimed=false with
+	// no response while another request holding the key is still running.
+	// A claim whose lease ran out without a response, left by a request that
+	// crashed, is taken over.
+	Claim(client string, key string, fingerprint string, lifetime time.Duration, lease time.Duration) (response *Response, claimed bool, err error)
+	Save(client string, key string, response Response) error
+	// Release frees a claimed key without storing a response, so the request
+	// can be retried
+	Release(client string, key string) error
+	Purge() (int64, error)
+}
+
+type PostgresStore struct {
+	Db *database.Database
+}
+
+func NewPostgresStore(db *database.Database) *PostgresStore {
+	return &PostgresStore{Db: db}
+}
+
+func (ps *PostgresStore) Claim(client string, key string, fingerprint string, lifetime time.Duration, lease time.Duration) (*Response, bool, error) {
+	_, err := ps.Db.Exec("DELETE FROM idempotency_key WHERE client = $1 AND key = $2 AND expires_at < NOW()", client, key)
+	if err != nil {
+		return nil, false, err
+	}
+	result, err := ps.Db.Exec(`
+	INSERT INTO idempotency_key
+		(client, key, fingerprint, expires_at, locked_until)
+	VALUES
+		($1, $2, $3, $4, NOW() + $5 * INTERVAL '1 millisecond')
+	ON CONFLICT (client, key) DO UPDATE SET locked_until = EXCLUDED.locked_until
+	WHERE NOT idempotency_key.completed AND idempotency_key.fingerprint = EXCLUDED.fingerprint
+		AND (idempotency_key.locked_until IS NULL OR idempotency_key.locked_until < NOW())
+	`, client, key, fingerprint, time.Now().Add(lifetime), lease.Milliseconds())
+	if err != nil {
+		return nil, false, err
+	}
+	if claimed, err := result.RowsAffected(); err != nil || claimed == 1 {
+		return nil, claimed == 1, err
+	}
+
+	var storedFingerprint string
+	var completed bool
+	var response Response
+	err = ps.Db.QueryRow(`
+	SELECT fingerprint, completed, status_code, content_type, body
+	FROM idempotency_key WHERE client = $1 AND key = $2
+	`, client, key).Scan(&storedFingerprint, &completed, &response.StatusCode, &response.ContentType, &response.Body)
+	if errors.Is(err, sql.ErrNoRows) {
+		// released or expired in between, let the caller try again
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if storedFingerprint != fingerprint {
+		return nil, false, ErrFingerprintMismatch
+	}
+	if !completed {
+		return nil, false, nil
+	}
+	return &response, false, nil
+}
+
+// Save stores the response of a claimed key. When a request outlived its
+// lease and another took the key over, the first response saved is kept.
+func (ps *PostgresStore) Save(client string, key string, response Response) error {
+	_, err := ps.Db.Exec(`
+	UPDATE idempotency_key
+	SET completed = TRUE, status_code = $3, content_type = $4, body = $5, locked_until = NULL
+	WHERE client = $1 AND key = $2 AND NOT completed
+	`, client, key, response.StatusCode, response.ContentType, response.Body)
+	return err
+}
+
+func (ps *PostgresStore) Release(client string, key string) error {
+	_, err := ps.Db.Exec("DELETE FROM idempotency_key WHERE client = $1 AND key = $2 AND NOT completed", client, key)
+	return err
+}
+
+func (ps *PostgresStore) Purge() (int64, error) {
+	result, err := ps.Db.Exec("DELETE FROM idempotency_key WHERE expires_at < NOW()")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,123 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type JobController struct {
+	repository IJobRepository
+	scheduler  *Scheduler
+}
+
+func NewJobController(repository IJobRepository, scheduler *Scheduler) *JobController {
+	return &JobController{repository: repository, scheduler: scheduler}
+}
+
+// @List godoc
+// @Summary List jobs
+// @Description List the runs of jobs in the queue, most recent first. Finished runs are kept for a week.
+// @Tags Jobs
+// @Produce json
+// @Param name query string false "Only runs of this job"
+// @Param status query string false "Only runs with this status: pending, running, succeeded or failed"
+// @Param limit query int false "Page size, 50 by default and at most 500"
+// @Success 200 {array} QueuedJob
+// @Failure 400 {object} string "Bad Request"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /jobs [get]
+func (jc *JobController) List(c *fiber.Ctx) error {
+	filter := ListFilter{Name: c.Query("name"), Status: c.Query("status"), Limit: defaultPageSize}
+	if filter.Status != "" && !common.Contains(Statuses, filter.Status) {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("status must be one of %v", Statuses))
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+		}
+		filter.Limit = limit
+	}
+	jobs, err := jc.repository.List(filter)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(jobs)
+}
+
+// @Scheduled godoc
+// @Summary List scheduled jobs
+// @Description List the jobs that run on a schedule, with when they next run
+// @Tags Jobs
+// @Produce json
+// @Success 200 {array} ScheduledJob
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /jobs/scheduled [get]
+func (jc *JobController) Scheduled(c *fiber.Ctx) error {
+	scheduled, err := jc.scheduler.Scheduled()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(scheduled)
+}
+
+// @Run godoc
+// @Summary Run a job
+// @Description Queue a run of a job now, such as a scheduled job ahead of its schedule
+// @Tags Jobs
+// @Accept json
+// @Produce json
+// @Param name path string true "Job name"
+// @Param job body EnqueueJobDto false "Job payload"
+// @Success 202 {object} QueuedJob
+// @Failure 400 {object} string "Bad Request"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /jobs/{name}/run [post]
+func (jc *JobController) Run(c *fiber.Ctx) error {
+	var dto EnqueueJobDto
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&dto); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "bad request body")
+		}
+	}
+	queued, err := jc.scheduler.Enqueue(c.Params("name"), dto.Payload, time.Now())
+	if errors.Is(err, ErrUnknownJob) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusAccepted).JSON(queued)
+}
+
+// ServiceOnly keeps users and anonymous callers out of the job routes: jobs
+// act on the whole deployment, so only service keys manage them
+func ServiceOnly(c *fiber.Ctx) error {
+	principal := common.GetPrincipal(c)
+	if principal == nil {
+		c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+		return fiber.NewError(fiber.StatusUnauthorized, "missing API key")
+	}
+	if !principal.Service() {
+		return fiber.NewError(fiber.StatusForbidden, "jobs are managed with service keys")
+	}
+	return c.Next()
+}
@@ -0,0 +1,15 @@
+package job
+
+import "encoding/json"
+
+type EnqueueJobDto struct {
+	Payload json.RawMessage `json:"payload" swaggertype:"object"`
+}
+
+// ListFilter narrows the queue down to jobs with the name and status, when
+// set
+type ListFilter struct {
+	Name   string
+	Status string
+	Limit  int
+}
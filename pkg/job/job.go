@@ -0,0 +1,40 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+)
+
+// keepFinished is how long finished runs stay in the queue
+const keepFinished = 7 * 24 * time.Hour
+
+type JobModule struct {
+	Repository IJobRepository
+	Controller *JobController
+	// Scheduler runs the jobs registered with it
+	Scheduler *Scheduler
+}
+
+// New wires the job module, with a job pruning finished runs from the queue
+// registered
+func New(db *database.Database) *JobModule {
+	repository := NewJobRepository(db)
+	scheduler := NewScheduler(repository, DefaultSchedulerConfig)
+	scheduler.Register(Job{
+		Name:      "job.prune",
+		Schedule:  "30 3 * * *",
+		Singleton: true,
+		Handler: func(ctx context.Context, payload json.RawMessage) error {
+			_, err := repository.Prune(keepFinished)
+			return err
+		},
+	})
+	return &JobModule{
+		Repository: repository,
+		Controller: NewJobController(repository, scheduler),
+		Scheduler:  scheduler,
+	}
+}
@@ -0,0 +1,226 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+type mockRepository struct {
+	IJobRepository
+	queue     []QueuedJob
+	leader    bool
+	enqueued  []string
+	succeeded []int
+	failed    map[int]*time.Time
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{failed: map[int]*time.Time{}}
+}
+
+func (mr *mockRepository) Enqueue(name string, payload json.RawMessage, runAt time.Time, maxAttempts int) (*QueuedJob, error) {
+	queued := QueuedJob{Id: len(mr.queue) + 1, Name: name, Payload: payload, Status: StatusPending, MaxAttempts: maxAttempts, RunAt: runAt}
+	mr.queue = append(mr.queue, queued)
+	return &queued, nil
+}
+
+func (mr *mockRepository) EnqueueDue(name string, maxAttempts int, next func(now time.Time) time.Time) (bool, error) {
+	mr.enqueued = append(mr.enqueued, name)
+	return true, nil
+}
+
+func (mr *mockRepository) Claim(leases map[string]time.Duration) (*QueuedJob, error) {
+	for i, queued := range mr.queue {
+		if _, ok := leases[queued.Name]; ok && queued.Status == StatusPending {
+			mr.queue[i].Status = StatusRunning
+			mr.queue[i].Attempts++
+			claimed := mr.queue[i]
+			return &claimed, nil
+		}
+	}
+	return nil, nil
+}
+
+func (mr *mockRepository) Succeed(id int, attempt int) error {
+	mr.succeeded = append(mr.succeeded, id)
+	return nil
+}
+
+func (mr *mockRepository) Fail(id int, attempt int, lastError string, retryAt *time.Time) error {
+	mr.failed[id] = retryAt
+	return nil
+}
+
+func (mr *mockRepository) List(filter ListFilter) ([]QueuedJob, error) {
+	return mr.queue, nil
+}
+
+func (mr *mockRepository) Lead(holder string, ttl time.Duration) (bool, error) {
+	return mr.leader, nil
+}
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2024, 1, 31, 10, 7, 30, 0, time.UTC) // a Wednesday
+	tests := []struct {
+		spec   string
+		expect time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 15, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * mon-fri", time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1,15 * *", time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// with both day fields set, either day matches
+		{"0 8 15 * sat", time.Date(2024, 2, 3, 8, 0, 0, 0, time.UTC)},
+		{"5/20 10 * * *", time.Date(2024, 1, 31, 10, 25, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			schedule, err := ParseSchedule(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next := schedule.Next(from); !next.Equal(test.expect) {
+				t.Errorf("Expected %v, got %v", test.expect, next)
+			}
+		})
+	}
+}
+
+func TestParseInvalidSchedule(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "* * * foo *", "0 0 30 2 *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("Expected %q to be invalid", spec)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	scheduler := NewScheduler(newMockRepository(), DefaultSchedulerConfig)
+	handler := func(ctx context.Context, payload json.RawMessage) error { return nil }
+	if err := scheduler.Register(Job{Name: "cleanup", Schedule: "@daily", Handler: handler}); err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.Register(Job{Name: "cleanup", Handler: handler}); err == nil {
+		t.Errorf("Expected registering a job twice to fail")
+	}
+	if err := scheduler.Register(Job{Name: "broken", Schedule: "every day", Handler: handler}); err == nil {
+		t.Errorf("Expected an invalid schedule to fail")
+	}
+	if _, err := scheduler.Enqueue("unknown", nil, time.Now()); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Expected ErrUnknownJob, got %v", err)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	config := SchedulerConfig{BaseBackoff: time.Minute, LeaderTTL: time.Minute}
+
+	t.Run("should run due jobs and retry failures with backoff", func(t *testing.T) {
+		mr := newMockRepository()
+		scheduler := NewScheduler(mr, config)
+		runs := 0
+		scheduler.Register(Job{Name: "ok", Handler: func(ctx context.Context, payload json.RawMessage) error {
+			runs++
+			return nil
+		}})
+		scheduler.Register(Job{Name: "flaky", MaxAttempts: 2, Handler: func(ctx context.Context, payload json.RawMessage) error {
+			return errors.New("try again")
+		}})
+		scheduler.Register(Job{Name: "panics", MaxAttempts: 1, Handler: func(ctx context.Context, payload json.RawMessage) error {
+			panic("oops")
+		}})
+		scheduler.Enqueue("ok", nil, time.Now())
+		scheduler.Enqueue("flaky", nil, time.Now())
+		scheduler.Enqueue("panics", nil, time.Now())
+		before := time.Now()
+		for scheduler.runNext(context.Background()) {
+		}
+		if runs != 1 || len(mr.succeeded) != 1 || mr.succeeded[0] != 1 {
+			t.Errorf("Expected the ok job to succeed once, got %d runs", runs)
+		}
+		if retry := mr.failed[2]; retry == nil || retry.Before(before.Add(time.Minute)) {
+			t.Errorf("Expected the flaky job to be retried in a minute, got %v", retry)
+		}
+		if retry, ok := mr.failed[3]; !ok || retry != nil {
+			t.Errorf("Expected the panicking job to be given up on, got %v", retry)
+		}
+	})
+
+	t.Run("should only schedule and run singleton jobs when leading", func(t *testing.T) {
+		mr := newMockRepository()
+		scheduler := NewScheduler(mr, config)
+		runs := 0
+		scheduler.Register(Job{Name: "purge", Schedule: "@hourly", Singleton: true, Handler: func(ctx context.Context, payload json.RawMessage) error {
+			runs++
+			return nil
+		}})
+		scheduler.Enqueue("purge", nil, time.Now())
+		scheduler.lead()
+		if scheduler.runNext(context.Background()) || len(mr.enqueued) != 0 {
+			t.Fatalf("Expected a follower to leave the singleton job alone")
+		}
+		mr.leader = true
+		scheduler.lead()
+		if !scheduler.runNext(context.Background()) || runs != 1 {
+			t.Errorf("Expected the leader to run the singleton job")
+		}
+		if len(mr.enqueued) != 1 || mr.enqueued[0] != "purge" {
+			t.Errorf("Expected the leader to schedule the job, got %v", mr.enqueued)
+		}
+	})
+}
+
+func TestController(t *testing.T) {
+	user := 1
+	tests := []struct {
+		name         string
+		principal    *common.Principal
+		method       string
+		url          string
+		body         string
+		expectStatus int
+	}{
+		{"test list", &common.Principal{}, "GET", "/jobs?status=failed", "", 200},
+		{"test list invalid status", &common.Principal{}, "GET", "/jobs?status=lost", "", 400},
+		{"test list as user", &common.Principal{UserId: &user}, "GET", "/jobs", "", 403},
+		{"test list anonymously", nil, "GET", "/jobs", "", 401},
+		{"test run", &common.Principal{}, "POST", "/jobs/cleanup/run", `{"payload": {"dry_run": true}}`, 202},
+		{"test run without payload", &common.Principal{}, "POST", "/jobs/cleanup/run", "", 202},
+		{"test run unknown", &common.Principal{}, "POST", "/jobs/unknown/run", "", 404},
+		{"test run as user", &common.Principal{UserId: &user}, "POST", "/jobs/cleanup/run", "", 403},
+		{"test run anonymously", nil, "POST", "/jobs/cleanup/run", "", 401},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mr := newMockRepository()
+			scheduler := NewScheduler(mr, DefaultSchedulerConfig)
+			scheduler.Register(Job{Name: "cleanup", Handler: func(ctx context.Context, payload json.RawMessage) error { return nil }})
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				common.SetPrincipal(c, test.principal)
+				return c.Next()
+			})
+			GetJobRoutes(app.Group("/jobs"), NewJobController(mr, scheduler))
+			req, _ := http.NewRequest(test.method, test.url, bytes.NewBufferString(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Errorf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+var Statuses = []string{StatusPending, StatusRunning, StatusSucceeded, StatusFailed}
+
+// Handler does the work of a job. It should stop when ctx is done, which
+// happens when the job times out or the scheduler stops.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Job is a kind of work the scheduler runs, on its schedule or when enqueued
+type Job struct {
+	Name string
+	// Schedule is a cron expression, see ParseSchedule. Jobs without one
+	// only run when enqueued.
+	Schedule string
+	// Singleton jobs only run on the leader, so they never run on two
+	// instances at once
+	Singleton bool
+	// MaxAttempts is how many times a failing run is tried, 3 when unset
+	MaxAttempts int
+	// Timeout is how long a run may take, 10 minutes when unset
+	Timeout time.Duration
+	Handler Handler
+}
+
+// QueuedJob is a run of a job in the queue
+type QueuedJob struct {
+	Id          int             `json:"id"`
+	Name        string          `json:"name"`
+	Payload     json.RawMessage `json:"payload" swaggertype:"object"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	// RunAt is when the job is due, or when the lease of a running job
+	// expires
+	RunAt      time.Time  `json:"run_at"`
+	LastError  string     `json:"last_error"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// ScheduledJob is a job that runs on a schedule, and when it next does
+type ScheduledJob struct {
+	Name      string    `json:"name"`
+	Schedule  string    `json:"schedule"`
+	Singleton bool      `json:"singleton"`
+	NextRunAt time.Time `json:"next_run_at"`
+}
@@ -0,0 +1,257 @@
+package job
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type IJobRepository interface {
+	Enqueue(name string, payload json.RawMessage, runAt time.Time, maxAttempts int) (*QueuedJob, error)
+	// EnqueueDue enqueues a run of the scheduled job when it is due, unless
+	// one is already pending or running, and moves its next run to next(now).
+	// It tells whether it enqueued one.
+	EnqueueDue(name string, maxAttempts int, next func(now time.Time) time.Time) (bool, error)
+	NextRuns() (map[string]time.Time, error)
+	// Claim starts the due job with one of the names that has waited the
+	// longest, leasing it for the time leases gives its name. It returns nil
+	// when none is due.
+	Claim(leases map[string]time.Duration) (*QueuedJob, error)
+	Succeed(id int, attempt int) error
+	// Fail records a failed attempt. A nil retryAt means no attempts are left.
+	Fail(id int, attempt int, lastError string, retryAt *time.Time) error
+	List(filter ListFilter) ([]QueuedJob, error)
+	// Prune deletes the jobs that finished longer ago than the given time
+	Prune(olderThan time.Duration) (int64, error)
+	// Lead makes holder the leader for ttl, unless another holder's lease
+	// hasn't expired yet, and tells whether holder leads
+	Lead(holder string, ttl time.Duration) (bool, error)
+	Resign(holder string) error
+}
+
+type JobRepository struct {
+	Db *database.Database
+}
+
+func NewJobRepository(db *database.Database) *JobRepository {
+	return &JobRepository{Db: db}
+}
+
+const jobColumns = "id, name, payload, status, attempts, max_attempts, run_at, last_error, created_at, started_at, finished_at"
+
+// leaderLease is the name of the lease held by the leader
+const leaderLease = "scheduler"
+
+func scanJob(row todo.Scanner) (QueuedJob, error) {
+	var j QueuedJob
+	err := row.Scan(&j.Id, &j.Name, &j.Payload, &j.Status, &j.Attempts, &j.MaxAttempts, &j.RunAt,
+		&j.LastError, &j.CreatedAt, &j.StartedAt, &j.FinishedAt)
+	return j, err
+}
+
+func (jr *JobRepository) Enqueue(name string, payload json.RawMessage, runAt time.Time, maxAttempts int) (*QueuedJob, error) {
+	if payload == nil {
+		payload = json.RawMessage("{}")
+	}
+	queued, err := scanJob(jr.Db.QueryRow(`
+	INSERT INTO job (name, payload, run_at, max_attempts)
+	VALUES ($1, $2, $3, $4)
+	RETURNING `+jobColumns, name, []byte(payload), runAt, maxAttempts))
+	if err != nil {
+		return nil, err
+	}
+	return &queued, nil
+}
+
+// EnqueueDue locks the schedule row of the job, so instances that both see
+// it due enqueue one run between them. Times come from the database clock.
+func (jr *JobRepository) EnqueueDue(name string, maxAttempts int, next func(now time.Time) time.Time) (bool, error) {
+	enqueued := false
+	err := jr.Db.WithTx(context.Background(), func(tx *database.Database) error {
+		enqueued = false
+		var now, nextRunAt time.Time
+		if err := tx.QueryRow("SELECT NOW()").Scan(&now); err != nil {
+			return err
+		}
+		following := next(now)
+		err := tx.QueryRow("SELECT next_run_at FROM job_schedule WHERE name = $1 FOR UPDATE", name).Scan(&nextRunAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			_, err := tx.Exec("INSERT INTO job_schedule (name, next_run_at) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING", name, following)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if nextRunAt.After(now) {
+			// a schedule made more frequent applies at once
+			if nextRunAt.After(following) {
+				_, err = tx.Exec("UPDATE job_schedule SET next_run_at = $2 WHERE name = $1", name, following)
+			}
+			return err
+		}
+		result, err := tx.Exec(`
+		INSERT INTO job (name, max_attempts)
+		SELECT $1, $2
+		WHERE NOT EXISTS (SELECT 1 FROM job WHERE name = $1 AND status IN ('pending', 'running'))
+		`, name, maxAttempts)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		enqueued = affected > 0
+		_, err = tx.Exec("UPDATE job_schedule SET next_run_at = $2 WHERE name = $1", name, following)
+		return err
+	})
+	return enqueued, err
+}
+
+func (jr *JobRepository) NextRuns() (map[string]time.Time, error) {
+	rows, err := jr.Db.Query("SELECT name, next_run_at FROM job_schedule")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	nextRuns := map[string]time.Time{}
+	for rows.Next() {
+		var name string
+		var nextRunAt time.Time
+		if err := rows.Scan(&name, &nextRunAt); err != nil {
+			return nil, err
+		}
+		nextRuns[name] = nextRunAt
+	}
+	return nextRuns, rows.Err()
+}
+
+// Claim also picks running jobs whose lease has expired, which were left
+// behind by an instance that stopped while running them, as long as they
+// have attempts left. Those that don't are failed, so a job that keeps
+// crashing its instance isn't retried forever nor holds its schedule back.
+func (jr *JobRepository) Claim(leases map[string]time.Duration) (*QueuedJob, error) {
+	names := make([]string, 0, len(leases))
+	durations := make([]int64, 0, len(leases))
+	for name, lease := range leases {
+		names = append(names, name)
+		durations = append(durations, lease.Milliseconds())
+	}
+	_, err := jr.Db.Exec(`
+	UPDATE job SET status = 'failed', last_error = 'lease expired on the last attempt', finished_at = NOW()
+	WHERE status = 'running' AND run_at <= NOW() AND attempts >= max_attempts AND name = ANY($1)
+	`, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := scanJob(jr.Db.QueryRow(`
+	UPDATE job
+	SET status = 'running', attempts = attempts + 1, started_at = NOW(),
+		run_at = NOW() + lease.ms * INTERVAL '1 millisecond'
+	FROM unnest($1::varchar[], $2::bigint[]) AS lease(name, ms)
+	WHERE lease.name = job.name AND job.id = (
+		SELECT id FROM job
+		WHERE status IN ('pending', 'running') AND run_at <= NOW() AND name = ANY($1)
+			AND (status = 'pending' OR attempts < max_attempts)
+		ORDER BY run_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING job.id, job.name, job.payload, job.status, job.attempts, job.max_attempts, job.run_at,
+		job.last_error, job.created_at, job.started_at, job.finished_at
+	`, pq.Array(names), pq.Array(durations)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &claimed, nil
+}
+
+// Succeed only records the attempt it is given, so a run that outlived its
+// lease doesn't overwrite the one that took over
+func (jr *JobRepository) Succeed(id int, attempt int) error {
+	_, err := jr.Db.Exec(`
+	UPDATE job SET status = 'succeeded', last_error = '', finished_at = NOW()
+	WHERE id = $1 AND attempts = $2 AND status = 'running'
+	`, id, attempt)
+	return err
+}
+
+func (jr *JobRepository) Fail(id int, attempt int, lastError string, retryAt *time.Time) error {
+	var err error
+	if retryAt == nil {
+		_, err = jr.Db.Exec(`
+		UPDATE job SET status = 'failed', last_error = $3, finished_at = NOW()
+		WHERE id = $1 AND attempts = $2 AND status = 'running'
+		`, id, attempt, lastError)
+	} else {
+		_, err = jr.Db.Exec(`
+		UPDATE job SET status = 'pending', last_error = $3, run_at = $4
+		WHERE id = $1 AND attempts = $2 AND status = 'running'
+		`, id, attempt, lastError, *retryAt)
+	}
+	return err
+}
+
+// List returns the most recent jobs first
+func (jr *JobRepository) List(filter ListFilter) ([]QueuedJob, error) {
+	rows, err := jr.Db.Query(`
+	SELECT `+jobColumns+` FROM job
+	WHERE ($1 = '' OR name = $1) AND ($2 = '' OR status = $2)
+	ORDER BY id DESC
+	LIMIT $3`, filter.Name, filter.Status, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []QueuedJob{}
+	for rows.Next() {
+		queued, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, queued)
+	}
+	return jobs, rows.Err()
+}
+
+func (jr *JobRepository) Prune(olderThan time.Duration) (int64, error) {
+	result, err := jr.Db.Exec(`
+	DELETE FROM job
+	WHERE status IN ('succeeded', 'failed') AND finished_at < NOW() - $1 * INTERVAL '1 millisecond'
+	`, olderThan.Milliseconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (jr *JobRepository) Lead(holder string, ttl time.Duration) (bool, error) {
+	var leader string
+	err := jr.Db.QueryRow(`
+	INSERT INTO job_lease (name, holder, expires_at)
+	VALUES ($1, $2, NOW() + $3 * INTERVAL '1 millisecond')
+	ON CONFLICT (name) DO UPDATE SET holder = $2, expires_at = EXCLUDED.expires_at
+	WHERE job_lease.holder = $2 OR job_lease.expires_at < NOW()
+	RETURNING holder
+	`, leaderLease, holder, ttl.Milliseconds()).Scan(&leader)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Resign gives the lease up, so another instance can lead without waiting
+// for it to expire
+func (jr *JobRepository) Resign(holder string) error {
+	_, err := jr.Db.Exec("DELETE FROM job_lease WHERE name = $1 AND holder = $2", leaderLease, holder)
+	return err
+}
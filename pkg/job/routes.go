@@ -0,0 +1,11 @@
+package job
+
+import "github.com/gofiber/fiber/v2"
+
+func GetJobRoutes(router fiber.Router, controller *JobController) fiber.Router {
+	router.Use(ServiceOnly)
+	router.Get("/", controller.List)
+	router.Get("/scheduled", controller.Scheduled)
+	router.Post("/:name/run", controller.Run)
+	return router
+}
@@ -0,0 +1,275 @@
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMaxAttempts = 3
+	defaultTimeout     = 10 * time.Minute
+	// leaseMargin is how much longer than its timeout a run is leased for,
+	// so a run that times out is recorded before another instance takes it
+	leaseMargin = time.Minute
+)
+
+var ErrUnknownJob = errors.New("unknown job")
+
+type SchedulerConfig struct {
+	// PollInterval is how often the queue is checked for due jobs and the
+	// leader checks the schedules
+	PollInterval time.Duration
+	// Workers is how many jobs an instance runs at once
+	Workers int
+	// LeaderTTL is how long the leader leads without renewing its lease
+	LeaderTTL   time.Duration
+	BaseBackoff time.Duration
+}
+
+var DefaultSchedulerConfig = SchedulerConfig{
+	PollInterval: 2 * time.Second,
+	Workers:      4,
+	LeaderTTL:    30 * time.Second,
+	BaseBackoff:  30 * time.Second,
+}
+
+type registeredJob struct {
+	Job
+	schedule *Schedule
+}
+
+// Scheduler runs jobs from a queue in Postgres shared by every instance.
+// One instance leads at a time: it enqueues the runs of scheduled jobs when
+// they are due and is the only one to run singleton jobs. Failed runs are
+// retried with exponential backoff until their job's MaxAttempts.
+type Scheduler struct {
+	repository IJobRepository
+	config     SchedulerConfig
+	// holder tells this instance apart in the leader lease
+	holder string
+	mu     sync.RWMutex
+	jobs   map[string]registeredJob
+	leader atomic.Bool
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+func NewScheduler(repository IJobRepository, config SchedulerConfig) *Scheduler {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return &Scheduler{
+		repository: repository,
+		config:     config,
+		holder:     fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix)),
+		jobs:       map[string]registeredJob{},
+	}
+}
+
+// Register adds a job the scheduler can run. Jobs are registered before
+// the scheduler starts.
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Handler == nil {
+		return errors.New("jobs need a name and a handler")
+	}
+	if job.MaxAttempts < 1 {
+		job.MaxAttempts = defaultMaxAttempts
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultTimeout
+	}
+	registered := registeredJob{Job: job}
+	if job.Schedule != "" {
+		schedule, err := ParseSchedule(job.Schedule)
+		if err != nil {
+			return fmt.Errorf("job %s: %w", job.Name, err)
+		}
+		registered.schedule = schedule
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+	s.jobs[job.Name] = registered
+	return nil
+}
+
+// Enqueue queues a run of the job with the payload at runAt
+func (s *Scheduler) Enqueue(name string, payload json.RawMessage, runAt time.Time) (*QueuedJob, error) {
+	s.mu.RLock()
+	job, ok := s.jobs[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+	return s.repository.Enqueue(name, payload, runAt, job.MaxAttempts)
+}
+
+// Scheduled returns the scheduled jobs by name, with when they next run
+func (s *Scheduler) Scheduled() ([]ScheduledJob, error) {
+	nextRuns, err := s.repository.NextRuns()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	scheduled := []ScheduledJob{}
+	for _, job := range s.jobs {
+		if job.schedule == nil {
+			continue
+		}
+		nextRunAt, ok := nextRuns[job.Name]
+		if !ok {
+			nextRunAt = job.schedule.Next(time.Now())
+		}
+		scheduled = append(scheduled, ScheduledJob{Name: job.Name, Schedule: job.Schedule, Singleton: job.Singleton, NextRunAt: nextRunAt})
+	}
+	sort.Slice(scheduled, func(i, j int) bool { return scheduled[i].Name < scheduled[j].Name })
+	return scheduled, nil
+}
+
+// Leader tells whether this instance leads
+func (s *Scheduler) Leader() bool {
+	return s.leader.Load()
+}
+
+func (s *Scheduler) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done.Add(1 + s.config.Workers)
+	go func() {
+		defer s.done.Done()
+		s.every(ctx, s.lead)
+	}()
+	for i := 0; i < s.config.Workers; i++ {
+		go func() {
+			defer s.done.Done()
+			s.every(ctx, func() {
+				for ctx.Err() == nil && s.runNext(ctx) {
+				}
+			})
+		}()
+	}
+	return nil
+}
+
+// Stop waits for the runs in progress, which are told to stop, and gives
+// the lead up
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.done.Wait()
+	if s.leader.Load() {
+		if err := s.repository.Resign(s.holder); err != nil {
+			fmt.Println("error resigning the lead:", err)
+		}
+		s.leader.Store(false)
+	}
+}
+
+func (s *Scheduler) every(ctx context.Context, work func()) {
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		work()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead renews the lead, or takes it when it is free, and enqueues the due
+// scheduled jobs while leading
+func (s *Scheduler) lead() {
+	leader, err := s.repository.Lead(s.holder, s.config.LeaderTTL)
+	if err != nil {
+		fmt.Println("error taking the lead:", err)
+		leader = false
+	}
+	s.leader.Store(leader)
+	if !leader {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, job := range s.jobs {
+		if job.schedule == nil {
+			continue
+		}
+		if _, err := s.repository.EnqueueDue(job.Name, job.MaxAttempts, job.schedule.Next); err != nil {
+			fmt.Printf("error scheduling job %s: %s\n", job.Name, err)
+		}
+	}
+}
+
+// runNext claims a due job this instance may run and runs it, and tells
+// whether there was one
+func (s *Scheduler) runNext(ctx context.Context) bool {
+	leader := s.leader.Load()
+	leases := map[string]time.Duration{}
+	s.mu.RLock()
+	for name, job := range s.jobs {
+		if !job.Singleton || leader {
+			leases[name] = job.Timeout + leaseMargin
+		}
+	}
+	s.mu.RUnlock()
+	if len(leases) == 0 {
+		return false
+	}
+	queued, err := s.repository.Claim(leases)
+	if err != nil {
+		fmt.Println("error claiming job:", err)
+		return false
+	}
+	if queued == nil {
+		return false
+	}
+	s.mu.RLock()
+	job := s.jobs[queued.Name]
+	s.mu.RUnlock()
+	err = s.run(ctx, job, queued.Payload)
+	if err == nil {
+		err = s.repository.Succeed(queued.Id, queued.Attempts)
+	} else {
+		fmt.Printf("job %s failed: %s\n", job.Name, err)
+		err = s.repository.Fail(queued.Id, queued.Attempts, err.Error(), s.retryAt(queued.Attempts, job.MaxAttempts))
+	}
+	if err != nil {
+		fmt.Println("error recording job run:", err)
+	}
+	return true
+}
+
+// run runs the handler within the job's timeout, turning panics into errors
+func (s *Scheduler) run(ctx context.Context, job registeredJob, payload json.RawMessage) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Handler(ctx, payload)
+}
+
+// retryAt returns when to retry after the given number of attempts, or nil
+// once the job has run out of attempts
+func (s *Scheduler) retryAt(attempts int, maxAttempts int) *time.Time {
+	if attempts >= maxAttempts {
+		return nil
+	}
+	next := time.Now().Add(s.config.BaseBackoff << (attempts - 1))
+	return &next
+}
@@ -0,0 +1,213 @@
+package list
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+type ListController struct {
+	repository IListRepository
+}
+
+func NewListController(repository IListRepository) *ListController {
+	return &ListController{repository: repository}
+}
+
+// @Create godoc
+// @Summary Create a new list
+// @Description Create a new list to group To Dos
+// @Tags Lists
+// @Accept json
+// @Produce json
+// @Param list body CreateListDto true "List Create"
+// @Success 201 {object} List
+// @Failure 400 {object} string "Bad Request"
+// @Failure 409 {object} string "Conflict"
+// @Router /lists [post]
+func (lc *ListController) Create(c *fiber.Ctx) error {
+	var list CreateListDto
+	if err := c.BodyParser(&list); err != nil || list.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "bad request body")
+	}
+	list.OwnerId = common.UserIdOf(common.GetPrincipal(c))
+	list.OrgId = common.GetOrgId(c)
+	created, err := lc.repository.Create(list)
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusConflict, "list already exists")
+	}
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// @List godoc
+// @Summary List lists
+// @Description List the lists visible to the caller
+// @Tags Lists
+// @Produce json
+// @Param include query string false "archived to include archived lists" Enums(archived)
+// @Success 200 {array} List
+// @Failure 400 {object} string "Bad Request"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /lists [get]
+func (lc *ListController) List(c *fiber.Ctx) error {
+	includeArchived, err := common.IncludeArchived(c)
+	if err != nil {
+		return err
+	}
+	lists, err := lc.repository.List(common.GetOrgId(c), common.AudienceOf(common.GetPrincipal(c)), includeArchived)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(lists)
+}
+
+// @Retrieve godoc
+// @Summary Retrieve a list
+// @Description Retrieve a list
+// @Tags Lists
+// @Produce json
+// @Param id path int true "List ID"
+// @Success 200 {object} List
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Router /lists/{id} [get]
+func (lc *ListController) Retrieve(c *fiber.Ctx) error {
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	list, err := lc.repository.Retrieve(common.GetOrgId(c), id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.Status(fiber.StatusOK).JSON(list)
+}
+
+// @Update godoc
+// @Summary Rename a list
+// @Description Rename a list
+// @Tags Lists
+// @Accept json
+// @Produce json
+// @Param id path int true "List ID"
+// @Param list body UpdateListDto true "List Update"
+// @Success 200 {object} List
+// @Failure 400 {object} string "Bad Request"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Router /lists/{id} [put]
+func (lc *ListController) Update(c *fiber.Ctx) error {
+	var dto UpdateListDto
+	if err := c.BodyParser(&dto); err != nil || dto.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest)
+	}
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	updated, err := lc.repository.Update(List{Id: id, Name: dto.Name, OrgId: common.GetOrgId(c)})
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.Status(fiber.StatusOK).JSON(updated)
+}
+
+// @Delete godoc
+// @Summary Delete a list
+// @Description Delete a list. Its To Dos are kept without a list.
+// @Tags Lists
+// @Param id path int true "List ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /lists/{id} [delete]
+func (lc *ListController) Delete(c *fiber.Ctx) error {
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	affected, err := lc.repository.Delete(common.GetOrgId(c), id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	if affected == 0 {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// @Todos godoc
+// @Summary List the To Dos in a list
+// @Description List the To Dos in a list that are visible to the caller
+// @Tags Lists
+// @Produce json
+// @Param id path int true "List ID"
+// @Param include query string false "archived to include archived To Dos" Enums(archived)
+// @Success 200 {array} todo.Todo
+// @Failure 400 {object} string "Bad Request"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /lists/{id}/todos [get]
+func (lc *ListController) Todos(c *fiber.Ctx) error {
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	includeArchived, err := common.IncludeArchived(c)
+	if err != nil {
+		return err
+	}
+	orgId := common.GetOrgId(c)
+	if _, err := lc.repository.Retrieve(orgId, id); err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	todos, err := lc.repository.Todos(orgId, id, common.AudienceOf(common.GetPrincipal(c)), includeArchived)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(todos)
+}
+
+// @Archive godoc
+// @Summary Archive a list
+// @Description Archive a list, which leaves it out of listings unless they include archived lists. Its To Dos are left as they are.
+// @Tags Lists
+// @Produce json
+// @Param id path int true "List ID"
+// @Success 200 {object} List
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Router /lists/{id}/archive [post]
+func (lc *ListController) Archive(c *fiber.Ctx) error {
+	return lc.setArchived(c, true)
+}
+
+// @Unarchive godoc
+// @Summary Unarchive a list
+// @Description Bring an archived list back into listings
+// @Tags Lists
+// @Produce json
+// @Param id path int true "List ID"
+// @Success 200 {object} List
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Router /lists/{id}/unarchive [post]
+func (lc *ListController) Unarchive(c *fiber.Ctx) error {
+	return lc.setArchived(c, false)
+}
+
+func (lc *ListController) setArchived(c *fiber.Ctx, archived bool) error {
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	list, err := lc.repository.Archive(common.GetOrgId(c), id, archived)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.Status(fiber.StatusOK).JSON(list)
+}
@@ -0,0 +1,13 @@
+package list
+
+type CreateListDto struct {
+	Name string `json:"name"`
+	// OwnerId is set from the caller, never from the request body
+	OwnerId *int `json:"-"`
+	// OrgId is the organization of the request, never from the request body
+	OrgId int `json:"-"`
+}
+
+type UpdateListDto struct {
+	Name string `json:"name"`
+}
@@ -0,0 +1,17 @@
+package list
+
+import "github.com/raphael-foliveira/fiber-todo/pkg/database"
+
+type ListModule struct {
+	Repository IListRepository
+	Controller *ListController
+}
+
+func New(db *database.Database) *ListModule {
+	repository := NewListRepository(db)
+	controller := NewListController(repository)
+	return &ListModule{
+		Repository: repository,
+		Controller: controller,
+	}
+}
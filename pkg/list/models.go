@@ -0,0 +1,14 @@
+package list
+
+import "time"
+
+type List struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	OwnerId *int   `json:"owner_id"`
+	OrgId   int    `json:"org_id"`
+	// Archived lists are left out of listings unless asked for; their todos
+	// are listed as before
+	Archived   bool       `json:"archived"`
+	ArchivedAt *time.Time `json:"archived_at"`
+}
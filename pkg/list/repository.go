@@ -0,0 +1,155 @@
+package list
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type IListRepository interface {
+	Create(list CreateListDto) (*List, error)
+	List(orgId int, audience common.Audience, includeArchived bool) ([]List, error)
+	Retrieve(orgId int, id int) (*List, error)
+	RetrieveMany(orgId int, ids []int, audience common.Audience) ([]List, error)
+	Update(list List) (*List, error)
+	Delete(orgId int, id int) (int64, error)
+	Todos(orgId int, id int, audience common.Audience, includeArchived bool) ([]todo.Todo, error)
+	Archive(orgId int, id int, archived bool) (*List, error)
+}
+
+type ListRepository struct {
+	Db *database.Database
+}
+
+func NewListRepository(db *database.Database) *ListRepository {
+	return &ListRepository{Db: db}
+}
+
+const listColumns = "id, name, owner_id, org_id, archived_at"
+
+// visible is the condition for a list to be visible to an audience, given as
+// $1 (see everything) and $2 (user id): unowned lists are public, the others
+// are visible to their owner and the users they are shared with
+const visible = `($1 OR owner_id IS NULL OR owner_id = $2
+	OR EXISTS (SELECT 1 FROM todo_share WHERE todo_share.user_id = $2 AND todo_share.list_id = todo_list.id))`
+
+func scanList(row todo.Scanner) (List, error) {
+	var list List
+	err := row.Scan(&list.Id, &list.Name, &list.OwnerId, &list.OrgId, &list.ArchivedAt)
+	list.Archived = list.ArchivedAt != nil
+	return list, err
+}
+
+func (lr *ListRepository) Create(list CreateListDto) (*List, error) {
+	row := lr.Db.QueryRow("INSERT INTO todo_list (name, owner_id, org_id) VALUES ($1, $2, $3) RETURNING "+listColumns,
+		list.Name, list.OwnerId, list.OrgId)
+	created, err := scanList(row)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (lr *ListRepository) List(orgId int, audience common.Audience, includeArchived bool) ([]List, error) {
+	rows, err := lr.Db.Query("SELECT "+listColumns+" FROM todo_list WHERE org_id = $3 AND ($4 OR archived_at IS NULL) AND "+visible+" ORDER BY id",
+		audience.All, audience.UserId, orgId, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	lists := []List{}
+	for rows.Next() {
+		list, err := scanList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+func (lr *ListRepository) Retrieve(orgId int, id int) (*List, error) {
+	list, err := scanList(lr.Db.QueryRow("SELECT "+listColumns+" FROM todo_list WHERE id = $1 AND org_id = $2", id, orgId))
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// RetrieveMany returns the lists with the ids that are visible to the
+// audience, in no particular order
+func (lr *ListRepository) RetrieveMany(orgId int, ids []int, audience common.Audience) ([]List, error) {
+	rows, err := lr.Db.Query("SELECT "+listColumns+" FROM todo_list WHERE org_id = $3 AND id = ANY($4) AND "+visible,
+		audience.All, audience.UserId, orgId, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	lists := []List{}
+	for rows.Next() {
+		list, err := scanList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+func (lr *ListRepository) Update(list List) (*List, error) {
+	row := lr.Db.QueryRow("UPDATE todo_list SET name = $1 WHERE id = $2 AND org_id = $3 RETURNING "+listColumns,
+		list.Name, list.Id, list.OrgId)
+	updated, err := scanList(row)
+	if err != nil {
+		return nil, errors.New("list not found")
+	}
+	return &updated, nil
+}
+
+// Delete removes the list; its todos are kept and fall back to no list
+func (lr *ListRepository) Delete(orgId int, id int) (int64, error) {
+	result, err := lr.Db.Exec("DELETE FROM todo_list WHERE id = $1 AND org_id = $2", id, orgId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Todos lists the todos of the list that are visible to the audience
+func (lr *ListRepository) Todos(orgId int, id int, audience common.Audience, includeArchived bool) ([]todo.Todo, error) {
+	rows, err := lr.Db.Query(`
+	SELECT `+todo.Columns+` FROM todo
+	WHERE org_id = $3 AND list_id = $4 AND ($5 OR archived_at IS NULL) AND `+todo.Visible+`
+	ORDER BY id`,
+		audience.All, audience.UserId, orgId, id, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	todos := []todo.Todo{}
+	for rows.Next() {
+		t, err := todo.ScanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, t)
+	}
+	return todos, rows.Err()
+}
+
+// Archive archives or unarchives the list, keeping the time it was first
+// archived
+func (lr *ListRepository) Archive(orgId int, id int, archived bool) (*List, error) {
+	row := lr.Db.QueryRow(`
+	UPDATE todo_list SET archived_at = CASE WHEN $3 THEN COALESCE(archived_at, NOW()) END
+	WHERE id = $1 AND org_id = $2
+	RETURNING `+listColumns, id, orgId, archived)
+	list, err := scanList(row)
+	if err != nil {
+		return nil, errors.New("list not found")
+	}
+	return &list, nil
+}
@@ -0,0 +1,15 @@
+package list
+
+import "github.com/gofiber/fiber/v2"
+
+func GetListRoutes(router fiber.Router, controller *ListController) fiber.Router {
+	router.Post("/", controller.Create)
+	router.Get("/", controller.List)
+	router.Get("/:id", controller.Retrieve)
+	router.Put("/:id", controller.Update)
+	router.Delete("/:id", controller.Delete)
+	router.Get("/:id/todos", controller.Todos)
+	router.Post("/:id/archive", controller.Archive)
+	router.Post("/:id/unarchive", controller.Unarchive)
+	return router
+}
@@ -0,0 +1,11 @@
+package notification
+
+// ChannelEmail is the name of the email channel
+const ChannelEmail = "email"
+
+// Channel sends notifications outside the app. The dispatcher hands it all
+// the notifications of a recipient due at once, such as those of a digest.
+type Channel interface {
+	Name() string
+	Send(to Recipient, notifications []Notification) error
+}
@@ -0,0 +1,47 @@
+package notification
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config is which channels notifications are sent on and when todos are
+// reminded of
+type Config struct {
+	// Channels are the channels besides the inbox, none when no SMTP server
+	// is set up
+	Channels []Channel
+	// DueWithin is how long before todos are due they are reminded of
+	DueWithin time.Duration
+}
+
+// ConfigFromEnv reads NOTIFICATION_SMTP_ADDR, the host:port of the SMTP
+// server to email notifications through, NOTIFICATION_SMTP_FROM, their
+// sender, and NOTIFICATION_SMTP_USERNAME and NOTIFICATION_SMTP_PASSWORD to
+// sign in with. Notifications aren't emailed without an address.
+// NOTIFICATION_DUE_WITHIN is how long before todos are due they are
+// reminded of, such as 1h.
+func ConfigFromEnv() (Config, error) {
+	config := Config{Channels: []Channel{}, DueWithin: DefaultDueWithin}
+	if value := os.Getenv("NOTIFICATION_DUE_WITHIN"); value != "" {
+		within, err := time.ParseDuration(value)
+		if err != nil || within < 0 {
+			return Config{}, fmt.Errorf("invalid NOTIFICATION_DUE_WITHIN %q", value)
+		}
+		config.DueWithin = within
+	}
+	if addr := os.Getenv("NOTIFICATION_SMTP_ADDR"); addr != "" {
+		email, err := NewEmailChannel(SMTPConfig{
+			Addr:     addr,
+			From:     os.Getenv("NOTIFICATION_SMTP_FROM"),
+			Username: os.Getenv("NOTIFICATION_SMTP_USERNAME"),
+			Password: os.Getenv("NOTIFICATION_SMTP_PASSWORD"),
+		})
+		if err != nil {
+			return Config{}, fmt.Errorf("NOTIFICATION_SMTP: %w", err)
+		}
+		config.Channels = append(config.Channels, email)
+	}
+	return config, nil
+}
@@ -0,0 +1,235 @@
+package notification
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type NotificationController struct {
+	repository INotificationRepository
+}
+
+func NewNotificationController(repository INotificationRepository) *NotificationController {
+	return &NotificationController{repository: repository}
+}
+
+// @List godoc
+// @Summary List my notifications
+// @Description List the notifications in the inbox of the calling user, newest first
+// @Tags Notifications
+// @Produce json
+// @Param unread query bool false "Only unread notifications"
+// @Param before query int false "Only notifications older than this one, for the next page"
+// @Param limit query int false "Page size, 50 by default and at most 200"
+// @Success 200 {array} Notification
+// @Failure 400 {object} string "Bad Request"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /notifications [get]
+func (nc *NotificationController) List(c *fiber.Ctx) error {
+	userId, err := caller(c)
+	if err != nil {
+		return err
+	}
+	filter := ListFilter{UserId: userId, Limit: defaultPageSize}
+	if value := c.Query("unread"); value != "" {
+		filter.UnreadOnly, err = strconv.ParseBool(value)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid unread filter")
+		}
+	}
+	if value := c.Query("before"); value != "" {
+		filter.BeforeId, err = strconv.Atoi(value)
+		if err != nil || filter.BeforeId < 1 {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid before")
+		}
+	}
+	if value := c.Query("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxPageSize {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+		}
+	}
+	notifications, err := nc.repository.List(filter)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(notifications)
+}
+
+// @CountUnread godoc
+// @Summary Count my unread notifications
+// @Description Count the unread notifications in the inbox of the calling user
+// @Tags Notifications
+// @Produce json
+// @Success 200 {object} UnreadCount
+// @Failure 403 {object} string "Forbidden"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /notifications/unread [get]
+func (nc *NotificationController) CountUnread(c *fiber.Ctx) error {
+	userId, err := caller(c)
+	if err != nil {
+		return err
+	}
+	count, err := nc.repository.CountUnread(userId)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(UnreadCount{Unread: count})
+}
+
+// @MarkRead godoc
+// @Summary Mark a notification read
+// @Description Mark a notification of the calling user read
+// @Tags Notifications
+// @Produce json
+// @Param id path int true "Notification ID"
+// @Success 200 {object} Notification
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Router /notifications/{id}/read [post]
+func (nc *NotificationController) MarkRead(c *fiber.Ctx) error {
+	return nc.mark(c, true)
+}
+
+// @MarkUnread godoc
+// @Summary Mark a notification unread
+// @Description Mark a notification of the calling user unread
+// @Tags Notifications
+// @Produce json
+// @Param id path int true "Notification ID"
+// @Success 200 {object} Notification
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Router /notifications/{id}/unread [post]
+func (nc *NotificationController) MarkUnread(c *fiber.Ctx) error {
+	return nc.mark(c, false)
+}
+
+// @MarkAllRead godoc
+// @Summary Mark all my notifications read
+// @Description Mark every notification of the calling user read
+// @Tags Notifications
+// @Success 204 "No Content"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /notifications/read [post]
+func (nc *NotificationController) MarkAllRead(c *fiber.Ctx) error {
+	userId, err := caller(c)
+	if err != nil {
+		return err
+	}
+	if _, err := nc.repository.MarkAllRead(userId); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// @Preferences godoc
+// @Summary Retrieve my notification preferences
+// @Description Retrieve how the calling user is notified
+// @Tags Notifications
+// @Produce json
+// @Success 200 {object} Preferences
+// @Failure 403 {object} string "Forbidden"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /notifications/preferences [get]
+func (nc *NotificationController) Preferences(c *fiber.Ctx) error {
+	userId, err := caller(c)
+	if err != nil {
+		return err
+	}
+	preferences, err := nc.repository.Preferences(userId)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(preferences)
+}
+
+// @UpdatePreferences godoc
+// @Summary Update my notification preferences
+// @Description Update how the calling user is notified. Fields left out keep their value. Email is off, instant, or hourly or daily for digests sent at the end of the hour or day (UTC). Muted kinds of notifications (assigned, commented, mentioned or due) aren't sent at all.
+// @Tags Notifications
+// @Accept json
+// @Produce json
+// @Param preferences body Preferences true "Notification Preferences"
+// @Success 200 {object} Preferences
+// @Failure 400 {object} string "Bad Request"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /notifications/preferences [put]
+func (nc *NotificationController) UpdatePreferences(c *fiber.Ctx) error {
+	userId, err := caller(c)
+	if err != nil {
+		return err
+	}
+	preferences, err := nc.repository.Preferences(userId)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	// the body is decoded over the current preferences, so fields left out
+	// keep their value
+	if err := c.BodyParser(&preferences); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "bad request body")
+	}
+	if err := validatePreferences(&preferences); err != nil {
+		return err
+	}
+	saved, err := nc.repository.SavePreferences(userId, preferences)
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(saved)
+}
+
+func (nc *NotificationController) mark(c *fiber.Ctx, read bool) error {
+	userId, err := caller(c)
+	if err != nil {
+		return err
+	}
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	notification, err := nc.repository.MarkRead(userId, id, read)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.Status(fiber.StatusOK).JSON(notification)
+}
+
+// caller returns the calling user. Notifications belong to users, so keys
+// that don't belong to one have none.
+func caller(c *fiber.Ctx) (int, error) {
+	userId := common.UserIdOf(common.GetPrincipal(c))
+	if userId == nil {
+		return 0, fiber.NewError(fiber.StatusForbidden, "only users have notifications")
+	}
+	return *userId, nil
+}
+
+func validatePreferences(preferences *Preferences) error {
+	if !common.Contains(EmailModes, preferences.Email) {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("email must be one of %v", EmailModes))
+	}
+	if preferences.Muted == nil {
+		preferences.Muted = []string{}
+	}
+	for _, kind := range preferences.Muted {
+		if !common.Contains(Kinds, kind) {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("unknown kind of notification %q", kind))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package notification
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type DispatcherConfig struct {
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	BaseBackoff time.Duration
+}
+
+var DefaultDispatcherConfig = DispatcherConfig{
+	Interval:    5 * time.Second,
+	BatchSize:   50,
+	MaxAttempts: 6,
+	BaseBackoff: time.Minute,
+}
+
+// Dispatcher periodically sends the notifications due on its channels,
+// grouping those of a recipient into one message, and retries failures with
+// exponential backoff until MaxAttempts is reached
+type Dispatcher struct {
+	repository INotificationRepository
+	channels   map[string]Channel
+	config     DispatcherConfig
+	stop       chan struct{}
+	done       sync.WaitGroup
+}
+
+func NewDispatcher(repository INotificationRepository, channels []Channel, config DispatcherConfig) *Dispatcher {
+	byName := map[string]Channel{}
+	for _, channel := range channels {
+		byName[channel.Name()] = channel
+	}
+	return &Dispatcher{repository: repository, channels: byName, config: config}
+}
+
+func (d *Dispatcher) Start() error {
+	d.stop = make(chan struct{})
+	d.done.Add(1)
+	go func() {
+		defer d.done.Done()
+		ticker := time.NewTicker(d.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				d.RunOnce()
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *Dispatcher) Stop() {
+	close(d.stop)
+	d.done.Wait()
+}
+
+// RunOnce claims and sends one batch of due deliveries
+func (d *Dispatcher) RunOnce() {
+	if len(d.channels) == 0 {
+		return
+	}
+	names := make([]string, 0, len(d.channels))
+	for name := range d.channels {
+		names = append(names, name)
+	}
+	// the lease must outlive every send in the batch or another instance could
+	// pick the same deliveries up again
+	lease := smtpTimeout*time.Duration(d.config.BatchSize) + time.Minute
+	pending, err := d.repository.ClaimDue(names, d.config.BatchSize, lease)
+	if err != nil {
+		fmt.Println("error claiming notification deliveries:", err)
+		return
+	}
+	for _, group := range groupDeliveries(pending) {
+		d.deliver(group)
+	}
+}
+
+// deliver sends deliveries for the same recipient and channel as one message
+func (d *Dispatcher) deliver(group []pendingDelivery) {
+	ids := make([]int, len(group))
+	notifications := make([]Notification, len(group))
+	attempts := 0
+	for i, delivery := range group {
+		ids[i] = delivery.Id
+		notifications[i] = delivery.Notification
+		if delivery.Attempts > attempts {
+			attempts = delivery.Attempts
+		}
+	}
+	err := d.channels[group[0].Channel].Send(group[0].Recipient, notifications)
+	if err == nil {
+		err = d.repository.MarkSent(ids)
+	} else {
+		err = d.repository.MarkAttemptFailed(ids, err.Error(), d.nextAttempt(attempts+1))
+	}
+	if err != nil {
+		fmt.Println("error recording notification delivery:", err)
+	}
+}
+
+// nextAttempt returns when to retry after the given number of attempts, or nil
+// once the delivery has run out of attempts
+func (d *Dispatcher) nextAttempt(attempts int) *time.Time {
+	if attempts >= d.config.MaxAttempts {
+		return nil
+	}
+	next := time.Now().Add(d.config.BaseBackoff << (attempts - 1))
+	return &next
+}
+
+// groupDeliveries splits deliveries by recipient and channel, keeping the
+// notifications of each group oldest first
+func groupDeliveries(deliveries []pendingDelivery) [][]pendingDelivery {
+	sort.Slice(deliveries, func(i, j int) bool {
+		a, b := deliveries[i], deliveries[j]
+		if a.Recipient.Id != b.Recipient.Id {
+			return a.Recipient.Id < b.Recipient.Id
+		}
+		if a.Channel != b.Channel {
+			return a.Channel < b.Channel
+		}
+		return a.Notification.Id < b.Notification.Id
+	})
+	groups := [][]pendingDelivery{}
+	for i, delivery := range deliveries {
+		last := len(groups) - 1
+		if i > 0 && delivery.Recipient.Id == deliveries[i-1].Recipient.Id && delivery.Channel == deliveries[i-1].Channel {
+			groups[last] = append(groups[last], delivery)
+			continue
+		}
+		groups = append(groups, []pendingDelivery{delivery})
+	}
+	return groups
+}
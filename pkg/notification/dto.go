@@ -0,0 +1,26 @@
+package notification
+
+import "time"
+
+type CreateNotificationDto struct {
+	UserId  int
+	Kind    string
+	TodoId  *int
+	ActorId *int
+	Message string
+}
+
+// ScheduledDelivery is when to send a notification on a channel
+type ScheduledDelivery struct {
+	Channel string
+	SendAt  time.Time
+}
+
+// ListFilter narrows the inbox of a user down
+type ListFilter struct {
+	UserId     int
+	UnreadOnly bool
+	// BeforeId lists notifications older than this one, for paging
+	BeforeId int
+	Limit    int
+}
@@ -0,0 +1,160 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// SMTPConfig is the server an EmailChannel sends through
+type SMTPConfig struct {
+	// Addr is the host:port of the server
+	Addr string
+	// From is the sender address, with or without a name
+	From string
+	// Username and Password sign in to the server when set. The password is
+	// only sent over TLS, or to a server on localhost.
+	Username string
+	Password string
+}
+
+// EmailChannel emails notifications over SMTP, upgrading the connection to
+// TLS when the server supports it
+type EmailChannel struct {
+	addr string
+	host string
+	from *mail.Address
+	auth smtp.Auth
+}
+
+func NewEmailChannel(config SMTPConfig) (*EmailChannel, error) {
+	host, _, err := net.SplitHostPort(config.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP address %q", config.Addr)
+	}
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q", config.From)
+	}
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, host)
+	}
+	return &EmailChannel{addr: config.Addr, host: host, from: from, auth: auth}, nil
+}
+
+func (ec *EmailChannel) Name() string {
+	return ChannelEmail
+}
+
+func (ec *EmailChannel) Send(to Recipient, notifications []Notification) error {
+	message, err := composeEmail(ec.from, to, notifications, time.Now())
+	if err != nil {
+		return err
+	}
+	return ec.send(to.Email, message)
+}
+
+// send is smtp.SendMail with a deadline, so a stuck server can't hold the
+// dispatcher up
+func (ec *EmailChannel) send(to string, message []byte) error {
+	conn, err := net.DialTimeout("tcp", ec.addr, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+	client, err := smtp.NewClient(conn, ec.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: ec.host}); err != nil {
+			return err
+		}
+	}
+	if ec.auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("the SMTP server doesn't support authentication")
+		}
+		if err := client.Auth(ec.auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(ec.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// composeEmail writes a plain text email of the notifications, a digest
+// when there are several
+func composeEmail(from *mail.Address, to Recipient, notifications []Notification, now time.Time) ([]byte, error) {
+	if len(notifications) == 0 {
+		return nil, errors.New("no notifications to send")
+	}
+	subject := notifications[0].Message
+	var body bytes.Buffer
+	if len(notifications) == 1 {
+		body.WriteString(subject + "\r\n")
+	} else {
+		subject = fmt.Sprintf("%d new notifications", len(notifications))
+		body.WriteString("You have " + subject + ":\r\n\r\n")
+		for _, n := range notifications {
+			body.WriteString(fmt.Sprintf("- %s (%s)\r\n", oneLine(n.Message), n.CreatedAt.UTC().Format("Jan 2 15:04 MST")))
+		}
+	}
+
+	var message bytes.Buffer
+	headers := [][2]string{
+		{"From", from.String()},
+		{"To", (&mail.Address{Name: to.Name, Address: to.Email}).String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", oneLine(subject))},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+	for _, header := range headers {
+		message.WriteString(header[0] + ": " + header[1] + "\r\n")
+	}
+	message.WriteString("\r\n")
+	w := quotedprintable.NewWriter(&message)
+	if _, err := w.Write(body.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return message.Bytes(), nil
+}
+
+// oneLine keeps text that comes from users, such as todo titles, from
+// breaking out of a header or list item
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
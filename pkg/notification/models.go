@@ -0,0 +1,94 @@
+package notification
+
+import "time"
+
+// Kinds of notifications
+const (
+	KindAssigned  = "assigned"
+	KindCommented = "commented"
+	KindMentioned = "mentioned"
+	KindDue       = "due"
+)
+
+var Kinds = []string{KindAssigned, KindCommented, KindMentioned, KindDue}
+
+// How often notifications are emailed
+const (
+	EmailOff     = "off"
+	EmailInstant = "instant"
+	EmailHourly  = "hourly"
+	EmailDaily   = "daily"
+)
+
+var EmailModes = []string{EmailOff, EmailInstant, EmailHourly, EmailDaily}
+
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+)
+
+type Notification struct {
+	Id     int    `json:"id"`
+	UserId int    `json:"user_id"`
+	Kind   string `json:"kind"`
+	// TodoId is the todo the notification is about, if any
+	TodoId *int `json:"todo_id"`
+	// ActorId is the user whose action caused the notification, if any
+	ActorId   *int       `json:"actor_id"`
+	Message   string     `json:"message"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+// Preferences are how a user wants to be notified
+type Preferences struct {
+	// InApp keeps notifications in the inbox under /notifications
+	InApp bool `json:"in_app"`
+	// Email is off, instant, or hourly or daily for a digest of the
+	// notifications of the hour or day
+	Email string `json:"email"`
+	// Muted are the kinds of notifications the user doesn't want at all
+	Muted []string `json:"muted"`
+}
+
+// DefaultPreferences apply to users who haven't set theirs
+var DefaultPreferences = Preferences{InApp: true, Email: EmailInstant, Muted: []string{}}
+
+// Schedule returns how often notifications are sent on the channel, off
+// for channels the preferences don't know about
+func (p Preferences) Schedule(channel string) string {
+	if channel == ChannelEmail {
+		return p.Email
+	}
+	return EmailOff
+}
+
+type UnreadCount struct {
+	Unread int `json:"unread"`
+}
+
+// Recipient is who a channel sends notifications to
+type Recipient struct {
+	Id    int
+	Email string
+	Name  string
+}
+
+// pendingDelivery is an outbox entry claimed by the dispatcher along with
+// its notification and recipient
+type pendingDelivery struct {
+	Id           int
+	Channel      string
+	Attempts     int
+	Recipient    Recipient
+	Notification Notification
+}
+
+// reminder is a todo falling due, to remind its assignee or owner of
+type reminder struct {
+	TodoId  int
+	UserId  int
+	Title   string
+	DueDate time.Time
+}
@@ -0,0 +1,32 @@
+package notification
+
+import (
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type NotificationModule struct {
+	Repository INotificationRepository
+	Controller *NotificationController
+	Notifier   *Notifier
+	// Dispatcher sends notifications on the configured channels
+	Dispatcher *Dispatcher
+	// Reminder notifies about todos falling due
+	Reminder *Reminder
+}
+
+// New wires the notification module and subscribes it to the event bus, so
+// assignees are notified of their assignments
+func New(db *database.Database, bus *events.Bus, todos todo.ITodoRepository, config Config) *NotificationModule {
+	repository := NewNotificationRepository(db)
+	notifier := NewNotifier(repository, todos, config.Channels)
+	notifier.Subscribe(bus)
+	return &NotificationModule{
+		Repository: repository,
+		Controller: NewNotificationController(repository),
+		Notifier:   notifier,
+		Dispatcher: NewDispatcher(repository, config.Channels, DefaultDispatcherConfig),
+		Reminder:   NewReminder(repository, notifier, config.DueWithin),
+	}
+}
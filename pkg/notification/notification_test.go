@@ -0,0 +1,424 @@
+package notification
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/comment"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type mockRepository struct {
+	INotificationRepository
+	preferences map[int]Preferences
+	created     []Notification
+	deliveries  map[int][]ScheduledDelivery
+	pending     []pendingDelivery
+	sent        []int
+	failed      map[int]*time.Time
+	shouldFail  bool
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{preferences: map[int]Preferences{}, deliveries: map[int][]ScheduledDelivery{}, failed: map[int]*time.Time{}}
+}
+
+func (mr *mockRepository) Create(dto CreateNotificationDto, inApp bool, deliveries []ScheduledDelivery) (*Notification, error) {
+	if mr.shouldFail {
+		return nil, errors.New("error creating notification")
+	}
+	notification := Notification{Id: len(mr.created) + 1, UserId: dto.UserId, Kind: dto.Kind, TodoId: dto.TodoId, ActorId: dto.ActorId, Message: dto.Message}
+	mr.created = append(mr.created, notification)
+	mr.deliveries[notification.Id] = deliveries
+	return &notification, nil
+}
+
+func (mr *mockRepository) WithDb(db *database.Database) INotificationRepository {
+	return mr
+}
+
+func (mr *mockRepository) List(filter ListFilter) ([]Notification, error) {
+	return mr.created, nil
+}
+
+func (mr *mockRepository) MarkRead(userId int, id int, read bool) (*Notification, error) {
+	for _, notification := range mr.created {
+		if notification.Id == id && notification.UserId == userId {
+			return &notification, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (mr *mockRepository) Preferences(userId int) (Preferences, error) {
+	if preferences, ok := mr.preferences[userId]; ok {
+		return preferences, nil
+	}
+	return DefaultPreferences, nil
+}
+
+func (mr *mockRepository) SavePreferences(userId int, preferences Preferences) (*Preferences, error) {
+	mr.preferences[userId] = preferences
+	return &preferences, nil
+}
+
+func (mr *mockRepository) ClaimDue(channels []string, limit int, lease time.Duration) ([]pendingDelivery, error) {
+	claimed := mr.pending
+	mr.pending = nil
+	return claimed, nil
+}
+
+func (mr *mockRepository) MarkSent(ids []int) error {
+	mr.sent = append(mr.sent, ids...)
+	return nil
+}
+
+func (mr *mockRepository) MarkAttemptFailed(ids []int, lastError string, nextAttemptAt *time.Time) error {
+	for _, id := range ids {
+		mr.failed[id] = nextAttemptAt
+	}
+	return nil
+}
+
+// mockTodoRepository has todo 1 owned by user 1 and assigned to user 2
+type mockTodoRepository struct {
+	todo.ITodoRepository
+}
+
+func (mr *mockTodoRepository) Retrieve(orgId int, id int) (*todo.Todo, error) {
+	owner, assignee := 1, 2
+	return &todo.Todo{Id: id, Title: "Ship it", OwnerId: &owner, AssigneeId: &assignee}, nil
+}
+
+type mockChannel struct {
+	sent [][]Notification
+	fail bool
+}
+
+func (mc *mockChannel) Name() string {
+	return ChannelEmail
+}
+
+func (mc *mockChannel) Send(to Recipient, notifications []Notification) error {
+	if mc.fail {
+		return errors.New("channel is down")
+	}
+	mc.sent = append(mc.sent, notifications)
+	return nil
+}
+
+func kindsFor(created []Notification) string {
+	kinds := []string{}
+	for _, n := range created {
+		kinds = append(kinds, fmt.Sprintf("%d:%s", n.UserId, n.Kind))
+	}
+	return strings.Join(kinds, " ")
+}
+
+func TestNotify(t *testing.T) {
+	tests := []struct {
+		name            string
+		preferences     Preferences
+		expectCreated   bool
+		expectDelivered bool
+	}{
+		{"test notify by default", DefaultPreferences, true, true},
+		{"test notify muted", Preferences{InApp: true, Email: EmailInstant, Muted: []string{KindDue}}, false, false},
+		{"test notify in app only", Preferences{InApp: true, Email: EmailOff}, true, false},
+		{"test notify by email only", Preferences{InApp: false, Email: EmailDaily}, true, true},
+		{"test notify nowhere", Preferences{InApp: false, Email: EmailOff}, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mr := newMockRepository()
+			mr.preferences[1] = test.preferences
+			notifier := NewNotifier(mr, &mockTodoRepository{}, []Channel{&mockChannel{}})
+			if err := notifier.Notify(CreateNotificationDto{UserId: 1, Kind: KindDue, Message: "due"}); err != nil {
+				t.Fatal(err)
+			}
+			if created := len(mr.created) == 1; created != test.expectCreated {
+				t.Fatalf("Expected created to be %v", test.expectCreated)
+			}
+			if delivered := test.expectCreated && len(mr.deliveries[1]) == 1; delivered != test.expectDelivered {
+				t.Errorf("Expected delivered to be %v, got %v", test.expectDelivered, mr.deliveries)
+			}
+		})
+	}
+}
+
+func TestSendAt(t *testing.T) {
+	now := time.Date(2024, 3, 31, 23, 20, 5, 0, time.UTC)
+	tests := []struct {
+		schedule string
+		expect   time.Time
+	}{
+		{EmailInstant, now},
+		{EmailHourly, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{EmailDaily, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		if got := sendAt(test.schedule, now); !got.Equal(test.expect) {
+			t.Errorf("Expected %s to send at %v, got %v", test.schedule, test.expect, got)
+		}
+	}
+}
+
+func TestCommented(t *testing.T) {
+	author, owner, mentioned := 1, 1, 3
+	tests := []struct {
+		name     string
+		comment  comment.Comment
+		previous *comment.Comment
+		expect   string
+	}{
+		{
+			"test new comment",
+			comment.Comment{TodoId: 1, AuthorId: &author},
+			nil,
+			"2:commented",
+		},
+		{
+			"test new comment with mention",
+			comment.Comment{TodoId: 1, AuthorId: &author, Mentions: []comment.Mention{{UserId: mentioned}, {UserId: 2}}},
+			nil,
+			"3:mentioned 2:mentioned",
+		},
+		{
+			"test new comment by another user",
+			comment.Comment{TodoId: 1, AuthorId: &mentioned},
+			nil,
+			"2:commented 1:commented",
+		},
+		{
+			"test edited comment",
+			comment.Comment{TodoId: 1, AuthorId: &owner, Mentions: []comment.Mention{{UserId: 2}, {UserId: mentioned}}},
+			&comment.Comment{TodoId: 1, AuthorId: &owner, Mentions: []comment.Mention{{UserId: 2}}},
+			"3:mentioned",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mr := newMockRepository()
+			if err := NewNotifier(mr, &mockTodoRepository{}, nil).Commented(nil, common.DefaultOrgId, test.comment, test.previous); err != nil {
+				t.Fatal(err)
+			}
+			if got := kindsFor(mr.created); got != test.expect {
+				t.Errorf("Expected %q, got %q", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestAssigned(t *testing.T) {
+	mr := newMockRepository()
+	bus := events.NewBus()
+	NewNotifier(mr, &mockTodoRepository{}, nil).Subscribe(bus)
+	assignee := 2
+	bus.PublishTx(nil, todo.EventUpdated, &todo.Todo{Id: 1, AssigneeId: &assignee})
+	bus.PublishTx(nil, todo.EventAssigned, &todo.Todo{Id: 1})
+	bus.PublishTx(nil, todo.EventAssigned, &todo.Todo{Id: 1, AssigneeId: &assignee})
+	if got := kindsFor(mr.created); got != "2:assigned" {
+		t.Errorf("Expected the assignee to be notified once, got %q", got)
+	}
+	mr.shouldFail = true
+	if err := bus.PublishTx(nil, todo.EventAssigned, &todo.Todo{Id: 1, AssigneeId: &assignee}); err == nil {
+		t.Errorf("Expected a failure to notify to roll the assignment back")
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	config := DispatcherConfig{BatchSize: 10, MaxAttempts: 3, BaseBackoff: time.Minute}
+	ada := Recipient{Id: 1, Email: "ada@example.com"}
+	bob := Recipient{Id: 2, Email: "bob@example.com"}
+
+	t.Run("should send the notifications of a recipient together", func(t *testing.T) {
+		mr := newMockRepository()
+		mr.pending = []pendingDelivery{
+			{Id: 1, Channel: ChannelEmail, Recipient: ada, Notification: Notification{Id: 1}},
+			{Id: 2, Channel: ChannelEmail, Recipient: bob, Notification: Notification{Id: 2}},
+			{Id: 3, Channel: ChannelEmail, Recipient: ada, Notification: Notification{Id: 3}},
+		}
+		channel := &mockChannel{}
+		NewDispatcher(mr, []Channel{channel}, config).RunOnce()
+		if len(channel.sent) != 2 || len(channel.sent[0]) != 2 || len(channel.sent[1]) != 1 {
+			t.Errorf("Expected a digest of 2 and a single notification, got %v", channel.sent)
+		}
+		if len(mr.sent) != 3 {
+			t.Errorf("Expected every delivery to be marked sent, got %v", mr.sent)
+		}
+	})
+
+	t.Run("should back off exponentially and give up after the last attempt", func(t *testing.T) {
+		mr := newMockRepository()
+		mr.pending = []pendingDelivery{
+			{Id: 1, Channel: ChannelEmail, Attempts: 1, Recipient: ada},
+			{Id: 2, Channel: ChannelEmail, Attempts: 2, Recipient: bob},
+		}
+		before := time.Now()
+		NewDispatcher(mr, []Channel{&mockChannel{fail: true}}, config).RunOnce()
+		next := mr.failed[1]
+		if next == nil || next.Before(before.Add(2*time.Minute)) || next.After(time.Now().Add(2*time.Minute)) {
+			t.Errorf("Expected retry in 2 minutes, got %v", next)
+		}
+		if next, ok := mr.failed[2]; !ok || next != nil {
+			t.Errorf("Expected delivery to be given up on, got %v", next)
+		}
+	})
+}
+
+// smtpSink accepts mail on a local port like an SMTP sink such as Mailpit,
+// keeping the messages it receives
+func smtpSink(t *testing.T) (string, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				text := textproto.NewConn(conn)
+				text.PrintfLine("220 sink ESMTP")
+				for {
+					line, err := text.ReadLine()
+					if err != nil {
+						return
+					}
+					switch verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); verb {
+					case "EHLO", "HELO", "MAIL", "RCPT":
+						text.PrintfLine("250 OK")
+					case "DATA":
+						text.PrintfLine("354 go ahead")
+						data, err := text.ReadDotBytes()
+						if err != nil {
+							return
+						}
+						messages <- string(data)
+						text.PrintfLine("250 queued")
+					case "QUIT":
+						text.PrintfLine("221 bye")
+						return
+					default:
+						text.PrintfLine("502 not implemented")
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), messages
+}
+
+func TestEmailChannel(t *testing.T) {
+	addr, messages := smtpSink(t)
+	channel, err := NewEmailChannel(SMTPConfig{Addr: addr, From: "Fiber Todo <notifications@example.com>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := Recipient{Id: 1, Email: "ada@example.com", Name: "Ada"}
+
+	t.Run("should send a single notification", func(t *testing.T) {
+		err := channel.Send(to, []Notification{{Message: "You were assigned \"Ship\r\nBcc: eve@example.com\""}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		message, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(<-messages)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if message.Header.Get("Bcc") != "" {
+			t.Errorf("Expected the title to stay in the subject, got headers %v", message.Header)
+		}
+		subject, _ := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+		if subject != `You were assigned "Ship Bcc: eve@example.com"` {
+			t.Errorf("Unexpected subject %q", subject)
+		}
+		if message.Header.Get("To") != `"Ada" <ada@example.com>` {
+			t.Errorf("Unexpected recipient %q", message.Header.Get("To"))
+		}
+	})
+
+	t.Run("should send a digest", func(t *testing.T) {
+		err := channel.Send(to, []Notification{{Message: "one"}, {Message: "two"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		message := <-messages
+		if !strings.Contains(message, "Subject: 2 new notifications") || !strings.Contains(message, "- one") || !strings.Contains(message, "- two") {
+			t.Errorf("Unexpected digest %q", message)
+		}
+	})
+
+	t.Run("should fail without a server", func(t *testing.T) {
+		down, _ := NewEmailChannel(SMTPConfig{Addr: "127.0.0.1:1", From: "notifications@example.com"})
+		if err := down.Send(to, []Notification{{Message: "lost"}}); err == nil {
+			t.Errorf("Expected an error")
+		}
+	})
+}
+
+func TestController(t *testing.T) {
+	user := 1
+	tests := []struct {
+		name         string
+		principal    *common.Principal
+		method       string
+		url          string
+		body         string
+		expectStatus int
+	}{
+		{"test list", &common.Principal{UserId: &user}, "GET", "/notifications?unread=true&limit=10", "", 200},
+		{"test list without user", &common.Principal{}, "GET", "/notifications", "", 403},
+		{"test list invalid limit", &common.Principal{UserId: &user}, "GET", "/notifications?limit=1000", "", 400},
+		{"test mark read", &common.Principal{UserId: &user}, "POST", "/notifications/1/read", "", 200},
+		{"test mark unread", &common.Principal{UserId: &user}, "POST", "/notifications/1/unread", "", 200},
+		{"test mark read of another user", &common.Principal{UserId: &user}, "POST", "/notifications/2/read", "", 404},
+		{"test update preferences", &common.Principal{UserId: &user}, "PUT", "/notifications/preferences", `{"email": "daily", "muted": ["due"]}`, 200},
+		{"test update invalid email", &common.Principal{UserId: &user}, "PUT", "/notifications/preferences", `{"email": "weekly"}`, 400},
+		{"test update invalid muted", &common.Principal{UserId: &user}, "PUT", "/notifications/preferences", `{"muted": ["everything"]}`, 400},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mr := newMockRepository()
+			mr.created = []Notification{{Id: 1, UserId: 1}, {Id: 2, UserId: 2}}
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				common.SetPrincipal(c, test.principal)
+				return c.Next()
+			})
+			GetNotificationRoutes(app.Group("/notifications"), NewNotificationController(mr))
+			req, _ := http.NewRequest(test.method, test.url, bytes.NewBufferString(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Errorf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+			if test.name == "test update preferences" && !mr.preferences[1].InApp {
+				t.Errorf("Expected in_app to keep its value, got %v", mr.preferences[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package notification
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/comment"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+// Notifier turns what happens to todos into notifications for the users
+// concerned, as their preferences say
+type Notifier struct {
+	repository INotificationRepository
+	todos      todo.ITodoRepository
+	// channels are the names of the channels notifications can be sent on
+	channels []string
+}
+
+var _ comment.Notifier = (*Notifier)(nil)
+
+func NewNotifier(repository INotificationRepository, todos todo.ITodoRepository, channels []Channel) *Notifier {
+	names := []string{}
+	for _, channel := range channels {
+		names = append(names, channel.Name())
+	}
+	return &Notifier{repository: repository, todos: todos, channels: names}
+}
+
+// Notify records the notification in the inbox of the user and schedules
+// it on the channels they want it on. Muted notifications are dropped.
+func (n *Notifier) Notify(notification CreateNotificationDto) error {
+	return n.notify(n.repository, notification)
+}
+
+// in returns the repository running its queries in tx, when there is one
+func (n *Notifier) in(tx *database.Database) INotificationRepository {
+	if tx == nil {
+		return n.repository
+	}
+	return n.repository.WithDb(tx)
+}
+
+func (n *Notifier) notify(repository INotificationRepository, notification CreateNotificationDto) error {
+	preferences, err := repository.Preferences(notification.UserId)
+	if err != nil {
+		return err
+	}
+	if common.Contains(preferences.Muted, notification.Kind) {
+		return nil
+	}
+	deliveries := []ScheduledDelivery{}
+	now := time.Now()
+	for _, channel := range n.channels {
+		if schedule := preferences.Schedule(channel); schedule != EmailOff {
+			deliveries = append(deliveries, ScheduledDelivery{Channel: channel, SendAt: sendAt(schedule, now)})
+		}
+	}
+	if !preferences.InApp && len(deliveries) == 0 {
+		return nil
+	}
+	_, err = repository.Create(notification, preferences.InApp, deliveries)
+	return err
+}
+
+// Subscribe notifies assignees of the todos assigned to them, in the
+// transaction of the assignment
+func (n *Notifier) Subscribe(bus *events.Bus) {
+	bus.SubscribeTx(func(tx *database.Database, event events.Event) error {
+		t, ok := event.Data.(*todo.Todo)
+		if event.Type != todo.EventAssigned || !ok || t.AssigneeId == nil {
+			return nil
+		}
+		err := n.notify(n.in(tx), CreateNotificationDto{
+			UserId:  *t.AssigneeId,
+			Kind:    KindAssigned,
+			TodoId:  &t.Id,
+			Message: fmt.Sprintf("You were assigned %q", t.Title),
+		})
+		if err != nil {
+			return fmt.Errorf("error notifying assignee: %w", err)
+		}
+		return nil
+	})
+}
+
+// Commented tells the users mentioned in the comment for the first time
+// that they were, and the owner and assignee of the todo about new comments.
+// Authors aren't told about their own comments.
+func (n *Notifier) Commented(tx *database.Database, orgId int, c comment.Comment, previous *comment.Comment) error {
+	t, err := n.todos.Retrieve(orgId, c.TodoId)
+	if err != nil {
+		return fmt.Errorf("error notifying about comment: %w", err)
+	}
+	told := map[int]bool{}
+	if c.AuthorId != nil {
+		told[*c.AuthorId] = true
+	}
+	if previous != nil {
+		for _, mention := range previous.Mentions {
+			told[mention.UserId] = true
+		}
+	}
+	notifications := []CreateNotificationDto{}
+	for _, mention := range c.Mentions {
+		if !told[mention.UserId] {
+			told[mention.UserId] = true
+			notifications = append(notifications, CreateNotificationDto{
+				UserId: mention.UserId, Kind: KindMentioned, Message: fmt.Sprintf("You were mentioned on %q", t.Title),
+			})
+		}
+	}
+	if previous == nil {
+		for _, userId := range []*int{t.AssigneeId, t.OwnerId} {
+			if userId != nil && !told[*userId] {
+				told[*userId] = true
+				notifications = append(notifications, CreateNotificationDto{
+					UserId: *userId, Kind: KindCommented, Message: fmt.Sprintf("New comment on %q", t.Title),
+				})
+			}
+		}
+	}
+	repository := n.in(tx)
+	for _, notification := range notifications {
+		notification.TodoId = &t.Id
+		notification.ActorId = c.AuthorId
+		if err := n.notify(repository, notification); err != nil {
+			return fmt.Errorf("error notifying about comment: %w", err)
+		}
+	}
+	return nil
+}
+
+// sendAt returns when to send a notification made now on a channel with the
+// schedule: at once, or at the end of the hour or day (UTC) for digests
+func sendAt(schedule string, now time.Time) time.Time {
+	now = now.UTC()
+	switch schedule {
+	case EmailHourly:
+		return now.Truncate(time.Hour).Add(time.Hour)
+	case EmailDaily:
+		return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	default:
+		return now
+	}
+}
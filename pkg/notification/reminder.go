@@ -0,0 +1,53 @@
+package notification
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultDueWithin = 24 * time.Hour
+	// remindBatch is how many todos ClaimReminders claims at a time
+	remindBatch = 100
+)
+
+// Reminder tells the assignees of todos falling due, or their owners when
+// they have no assignee
+type Reminder struct {
+	repository INotificationRepository
+	notifier   *Notifier
+	within     time.Duration
+}
+
+// NewReminder returns a Reminder telling about todos due within the given
+// time
+func NewReminder(repository INotificationRepository, notifier *Notifier, within time.Duration) *Reminder {
+	return &Reminder{repository: repository, notifier: notifier, within: within}
+}
+
+// Remind tells about every todo falling due that hasn't been yet, and
+// returns how many it told about
+func (r *Reminder) Remind() (int, error) {
+	total := 0
+	for {
+		reminders, err := r.repository.ClaimReminders(r.within, remindBatch)
+		if err != nil {
+			return total, err
+		}
+		for _, due := range reminders {
+			err := r.notifier.Notify(CreateNotificationDto{
+				UserId:  due.UserId,
+				Kind:    KindDue,
+				TodoId:  &due.TodoId,
+				Message: fmt.Sprintf("%q is due %s", due.Title, due.DueDate.UTC().Format("Mon Jan 2 15:04 MST")),
+			})
+			if err != nil {
+				fmt.Println("error reminding of todo:", err)
+			}
+		}
+		total += len(reminders)
+		if len(reminders) < remindBatch {
+			return total, nil
+		}
+	}
+}
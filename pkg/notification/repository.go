@@ -0,0 +1,265 @@
+package notification
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type INotificationRepository interface {
+	// Create records the notification, in the inbox of the user when inApp
+	// is true, and the deliveries to send it on other channels
+	Create(notification CreateNotificationDto, inApp bool, deliveries []ScheduledDelivery) (*Notification, error)
+	List(filter ListFilter) ([]Notification, error)
+	CountUnread(userId int) (int, error)
+	MarkRead(userId int, id int, read bool) (*Notification, error)
+	MarkAllRead(userId int) (int64, error)
+	Preferences(userId int) (Preferences, error)
+	SavePreferences(userId int, preferences Preferences) (*Preferences, error)
+	ClaimDue(channels []string, limit int, lease time.Duration) ([]pendingDelivery, error)
+	MarkSent(ids []int) error
+	MarkAttemptFailed(ids []int, lastError string, nextAttemptAt *time.Time) error
+	// ClaimReminders returns up to limit todos that fall due within the
+	// given time and haven't been reminded of for their due date yet,
+	// recording that they have been
+	ClaimReminders(within time.Duration, limit int) ([]reminder, error)
+	// WithDb returns the repository running its queries on db, such as a
+	// transaction
+	WithDb(db *database.Database) INotificationRepository
+}
+
+type NotificationRepository struct {
+	Db *database.Database
+}
+
+func NewNotificationRepository(db *database.Database) *NotificationRepository {
+	return &NotificationRepository{Db: db}
+}
+
+func (nr *NotificationRepository) WithDb(db *database.Database) INotificationRepository {
+	return &NotificationRepository{Db: db}
+}
+
+const notificationColumns = "id, user_id, kind, todo_id, actor_id, message, created_at, read_at"
+
+// reminderLookback is how long after todos fell due they are still
+// reminded of, for those that did while no instance was running
+const reminderLookback = 24 * time.Hour
+
+func scanNotification(row todo.Scanner, extra ...any) (Notification, error) {
+	var n Notification
+	dest := []any{&n.Id, &n.UserId, &n.Kind, &n.TodoId, &n.ActorId, &n.Message, &n.CreatedAt, &n.ReadAt}
+	err := row.Scan(append(dest, extra...)...)
+	return n, err
+}
+
+func (nr *NotificationRepository) Create(notification CreateNotificationDto, inApp bool, deliveries []ScheduledDelivery) (*Notification, error) {
+	var created Notification
+	err := nr.Db.WithTx(context.Background(), func(tx *database.Database) error {
+		var err error
+		created, err = scanNotification(tx.QueryRow(`
+		INSERT INTO notification (user_id, kind, todo_id, actor_id, message, in_app)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+notificationColumns,
+			notification.UserId, notification.Kind, notification.TodoId, notification.ActorId, notification.Message, inApp))
+		if err != nil {
+			return err
+		}
+		for _, delivery := range deliveries {
+			_, err := tx.Exec("INSERT INTO notification_outbox (notification_id, channel, next_attempt_at) VALUES ($1, $2, $3)",
+				created.Id, delivery.Channel, delivery.SendAt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// List returns the inbox of the user, newest first
+func (nr *NotificationRepository) List(filter ListFilter) ([]Notification, error) {
+	rows, err := nr.Db.Query(`
+	SELECT `+notificationColumns+` FROM notification
+	WHERE user_id = $1 AND in_app
+		AND (NOT $2 OR read_at IS NULL)
+		AND ($3 = 0 OR id < $3)
+	ORDER BY id DESC
+	LIMIT $4`, filter.UserId, filter.UnreadOnly, filter.BeforeId, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	notifications := []Notification{}
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+func (nr *NotificationRepository) CountUnread(userId int) (int, error) {
+	var count int
+	err := nr.Db.QueryRow("SELECT COUNT(*) FROM notification WHERE user_id = $1 AND in_app AND read_at IS NULL", userId).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks a notification of the user read, or unread when read is
+// false. Notifications already read keep the time they were first read at.
+func (nr *NotificationRepository) MarkRead(userId int, id int, read bool) (*Notification, error) {
+	notification, err := scanNotification(nr.Db.QueryRow(`
+	UPDATE notification
+	SET read_at = CASE WHEN $3 THEN COALESCE(read_at, NOW()) END
+	WHERE id = $1 AND user_id = $2 AND in_app
+	RETURNING `+notificationColumns, id, userId, read))
+	if err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+func (nr *NotificationRepository) MarkAllRead(userId int) (int64, error) {
+	result, err := nr.Db.Exec("UPDATE notification SET read_at = NOW() WHERE user_id = $1 AND in_app AND read_at IS NULL", userId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Preferences returns the preferences of the user, or DefaultPreferences
+// when they haven't set any
+func (nr *NotificationRepository) Preferences(userId int) (Preferences, error) {
+	var preferences Preferences
+	err := nr.Db.QueryRow("SELECT in_app, email, muted FROM notification_preference WHERE user_id = $1", userId).
+		Scan(&preferences.InApp, &preferences.Email, pq.Array(&preferences.Muted))
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultPreferences, nil
+	}
+	return preferences, err
+}
+
+func (nr *NotificationRepository) SavePreferences(userId int, preferences Preferences) (*Preferences, error) {
+	var saved Preferences
+	err := nr.Db.QueryRow(`
+	INSERT INTO notification_preference (user_id, in_app, email, muted)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (user_id) DO UPDATE SET in_app = $2, email = $3, muted = $4
+	RETURNING in_app, email, muted`, userId, preferences.InApp, preferences.Email, pq.Array(preferences.Muted)).
+		Scan(&saved.InApp, &saved.Email, pq.Array(&saved.Muted))
+	if err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// ClaimDue locks up to limit pending deliveries on the channels that are due
+// and pushes their next attempt past the lease, so other instances leave
+// them alone while they are being sent
+func (nr *NotificationRepository) ClaimDue(channels []string, limit int, lease time.Duration) ([]pendingDelivery, error) {
+	rows, err := nr.Db.Query(`
+	UPDATE notification_outbox o
+	SET next_attempt_at = NOW() + $3 * INTERVAL '1 millisecond'
+	FROM notification n JOIN users u ON u.id = n.user_id
+	WHERE n.id = o.notification_id AND o.id IN (
+		SELECT id FROM notification_outbox
+		WHERE status = 'pending' AND next_attempt_at <= NOW() AND channel = ANY($1)
+		ORDER BY next_attempt_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING n.id, n.user_id, n.kind, n.todo_id, n.actor_id, n.message, n.created_at, n.read_at,
+		o.id, o.channel, o.attempts, u.email, u.name
+	`, pq.Array(channels), limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	claimed := []pendingDelivery{}
+	for rows.Next() {
+		var pending pendingDelivery
+		pending.Notification, err = scanNotification(rows, &pending.Id, &pending.Channel, &pending.Attempts,
+			&pending.Recipient.Email, &pending.Recipient.Name)
+		if err != nil {
+			return nil, err
+		}
+		pending.Recipient.Id = pending.Notification.UserId
+		claimed = append(claimed, pending)
+	}
+	return claimed, rows.Err()
+}
+
+func (nr *NotificationRepository) MarkSent(ids []int) error {
+	_, err := nr.Db.Exec(`
+	UPDATE notification_outbox
+	SET status = 'sent', attempts = attempts + 1, last_error = '', sent_at = NOW()
+	WHERE id = ANY($1)
+	`, pq.Array(ids))
+	return err
+}
+
+// MarkAttemptFailed records a failed attempt. A nil nextAttemptAt means no
+// retries are left and the deliveries are given up on.
+func (nr *NotificationRepository) MarkAttemptFailed(ids []int, lastError string, nextAttemptAt *time.Time) error {
+	status := DeliveryPending
+	next := time.Now()
+	if nextAttemptAt == nil {
+		status = DeliveryFailed
+	} else {
+		next = *nextAttemptAt
+	}
+	_, err := nr.Db.Exec(`
+	UPDATE notification_outbox
+	SET status = $2, attempts = attempts + 1, last_error = $3, next_attempt_at = $4
+	WHERE id = ANY($1)
+	`, pq.Array(ids), status, lastError, next)
+	return err
+}
+
+// ClaimReminders locks the todos it claims, so instances running it at the
+// same time remind of each todo once. Todos are reminded of again when
+// their due date changes.
+func (nr *NotificationRepository) ClaimReminders(within time.Duration, limit int) ([]reminder, error) {
+	rows, err := nr.Db.Query(`
+	WITH due AS (
+		SELECT id, title, due_date, COALESCE(assignee_id, owner_id) AS user_id FROM todo
+		WHERE NOT completed AND archived_at IS NULL
+			AND COALESCE(assignee_id, owner_id) IS NOT NULL
+			AND due_date <= NOW() + $1 * INTERVAL '1 millisecond'
+			AND due_date > NOW() - $2 * INTERVAL '1 millisecond'
+			AND NOT EXISTS (SELECT 1 FROM todo_reminder r WHERE r.todo_id = todo.id AND r.due_date = todo.due_date)
+		ORDER BY due_date
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	), claimed AS (
+		INSERT INTO todo_reminder (todo_id, due_date)
+		SELECT id, due_date FROM due
+		ON CONFLICT (todo_id) DO UPDATE SET due_date = EXCLUDED.due_date
+		RETURNING todo_id
+	)
+	SELECT due.id, due.user_id, due.title, due.due_date FROM due JOIN claimed ON claimed.todo_id = due.id
+	`, within.Milliseconds(), reminderLookback.Milliseconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reminders := []reminder{}
+	for rows.Next() {
+		var r reminder
+		if err := rows.Scan(&r.TodoId, &r.UserId, &r.Title, &r.DueDate); err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, r)
+	}
+	return reminders, rows.Err()
+}
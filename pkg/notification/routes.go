@@ -0,0 +1,14 @@
+package notification
+
+import "github.com/gofiber/fiber/v2"
+
+func GetNotificationRoutes(router fiber.Router, controller *NotificationController) fiber.Router {
+	router.Get("/", controller.List)
+	router.Get("/unread", controller.CountUnread)
+	router.Get("/preferences", controller.Preferences)
+	router.Put("/preferences", controller.UpdatePreferences)
+	router.Post("/read", controller.MarkAllRead)
+	router.Post("/:id/read", controller.MarkRead)
+	router.Post("/:id/unread", controller.MarkUnread)
+	return router
+}
@@ -0,0 +1,236 @@
+package org
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+type OrgController struct {
+	repository IOrgRepository
+}
+
+func NewOrgController(repository IOrgRepository) *OrgController {
+	return &OrgController{repository: repository}
+}
+
+// @Create godoc
+// @Summary Create an organization
+// @Description Create an organization. The calling user becomes its admin.
+// @Tags Organizations
+// @Accept json
+// @Produce json
+// @Param org body CreateOrgDto true "Organization Create"
+// @Success 201 {object} Organization
+// @Failure 400 {object} string "Bad Request"
+// @Failure 409 {object} string "Conflict"
+// @Router /orgs [post]
+func (oc *OrgController) Create(c *fiber.Ctx) error {
+	var dto CreateOrgDto
+	if err := c.BodyParser(&dto); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "bad request body")
+	}
+	if dto.Name == "" || !slugPattern.MatchString(dto.Slug) {
+		return fiber.NewError(fiber.StatusBadRequest, "a name and a slug of lowercase letters, digits and dashes are required")
+	}
+	created, err := oc.repository.Create(dto, common.UserIdOf(common.GetPrincipal(c)))
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusConflict, "organization already exists")
+	}
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// @List godoc
+// @Summary List organizations
+// @Description List the organizations the caller belongs to
+// @Tags Organizations
+// @Produce json
+// @Success 200 {array} Organization
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /orgs [get]
+func (oc *OrgController) List(c *fiber.Ctx) error {
+	orgs, err := oc.repository.List(common.AudienceOf(common.GetPrincipal(c)))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(orgs)
+}
+
+// @Retrieve godoc
+// @Summary Retrieve an organization
+// @Description Retrieve an organization by id or slug
+// @Tags Organizations
+// @Produce json
+// @Param id path string true "Organization ID or slug"
+// @Success 200 {object} Organization
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Router /orgs/{id} [get]
+func (oc *OrgController) Retrieve(c *fiber.Ctx) error {
+	org, err := oc.authorize(c, RoleMember)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(org)
+}
+
+// @UpdateSettings godoc
+// @Summary Update the settings of an organization
+// @Description Update the settings of an organization. Only admins can change them.
+// @Tags Organizations
+// @Accept json
+// @Produce json
+// @Param id path string true "Organization ID or slug"
+// @Param settings body Settings true "Organization Settings"
+// @Success 200 {object} Organization
+// @Failure 400 {object} string "Bad Request"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /orgs/{id}/settings [put]
+func (oc *OrgController) UpdateSettings(c *fiber.Ctx) error {
+	var settings Settings
+	if err := c.BodyParser(&settings); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "bad request body")
+	}
+	if settings.RetentionDays != nil && *settings.RetentionDays < 1 {
+		return fiber.NewError(fiber.StatusBadRequest, "retention_days must be at least 1")
+	}
+	if settings.ArchiveAfterDays != nil && *settings.ArchiveAfterDays < 1 {
+		return fiber.NewError(fiber.StatusBadRequest, "archive_after_days must be at least 1")
+	}
+	org, err := oc.authorize(c, RoleAdmin)
+	if err != nil {
+		return err
+	}
+	updated, err := oc.repository.UpdateSettings(org.Id, settings)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(updated)
+}
+
+// @Members godoc
+// @Summary List the members of an organization
+// @Description List the members of an organization
+// @Tags Organizations
+// @Produce json
+// @Param id path string true "Organization ID or slug"
+// @Success 200 {array} Member
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /orgs/{id}/members [get]
+func (oc *OrgController) Members(c *fiber.Ctx) error {
+	org, err := oc.authorize(c, RoleMember)
+	if err != nil {
+		return err
+	}
+	members, err := oc.repository.Members(org.Id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(members)
+}
+
+// @SetMember godoc
+// @Summary Add a member to an organization
+// @Description Add a user to an organization or change their role. Only admins can manage members.
+// @Tags Organizations
+// @Accept json
+// @Produce json
+// @Param id path string true "Organization ID or slug"
+// @Param userId path int true "User ID"
+// @Param member body SetMemberDto true "Member Role"
+// @Success 200 {object} Member
+// @Failure 400 {object} string "Bad Request"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Router /orgs/{id}/members/{userId} [put]
+func (oc *OrgController) SetMember(c *fiber.Ctx) error {
+	userId, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	var dto SetMemberDto
+	if err := c.BodyParser(&dto); err != nil || !common.Contains(Roles, dto.Role) {
+		return fiber.NewError(fiber.StatusBadRequest, "role must be member or admin")
+	}
+	org, err := oc.authorize(c, RoleAdmin)
+	if err != nil {
+		return err
+	}
+	member, err := oc.repository.SetMember(org.Id, userId, dto.Role)
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusNotFound, "user not found")
+	}
+	return c.Status(fiber.StatusOK).JSON(member)
+}
+
+// @RemoveMember godoc
+// @Summary Remove a member from an organization
+// @Description Remove a user from an organization. Admins can remove anyone and members can leave.
+// @Tags Organizations
+// @Param id path string true "Organization ID or slug"
+// @Param userId path int true "User ID"
+// @Success 204 "No Content"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /orgs/{id}/members/{userId} [delete]
+func (oc *OrgController) RemoveMember(c *fiber.Ctx) error {
+	userId, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	required := RoleAdmin
+	if self := common.UserIdOf(common.GetPrincipal(c)); self != nil && *self == userId {
+		required = RoleMember
+	}
+	org, err := oc.authorize(c, required)
+	if err != nil {
+		return err
+	}
+	affected, err := oc.repository.RemoveMember(org.Id, userId)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	if affected == 0 {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// authorize finds the organization in the :id param and checks the caller
+// has at least the role in it
+func (oc *OrgController) authorize(c *fiber.Ctx, required Role) (*Organization, error) {
+	org, err := Find(oc.repository, c.Params("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fiber.NewError(fiber.StatusNotFound)
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError)
+	}
+	role, err := RoleOf(oc.repository, common.GetPrincipal(c), org.Id)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError)
+	}
+	if role == RoleNone {
+		return nil, fiber.NewError(fiber.StatusForbidden, "not a member of the organization")
+	}
+	if required == RoleAdmin && role != RoleAdmin {
+		return nil, fiber.NewError(fiber.StatusForbidden, "admin role required")
+	}
+	return org, nil
+}
@@ -0,0 +1,10 @@
+package org
+
+type CreateOrgDto struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+type SetMemberDto struct {
+	Role Role `json:"role" swaggertype:"string" enums:"member,admin"`
+}
@@ -0,0 +1,139 @@
+package org
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/stream"
+)
+
+// HeaderOrg picks the organization of a request, by id or slug
+const HeaderOrg = "X-Org"
+
+const pathPrefix = "/api/orgs/"
+
+// managementPaths are the routes under /api/orgs/:id that manage the
+// organization itself rather than being scoped to it
+var managementPaths = []string{"members", "settings"}
+
+// RewritePath lets clients pick the organization with a path prefix:
+// /api/orgs/:org/todos is served as /api/todos with the X-Org header set.
+// It has to run before the /api routes are matched.
+func RewritePath(c *fiber.Ctx) error {
+	if !strings.HasPrefix(c.Path(), pathPrefix) {
+		return c.Next()
+	}
+	ref, rest, found := strings.Cut(strings.TrimPrefix(c.Path(), pathPrefix), "/")
+	resource, _, _ := strings.Cut(rest, "/")
+	if !found || resource == "" || common.Contains(managementPaths, resource) {
+		return c.Next()
+	}
+	c.Request().Header.Set(HeaderOrg, ref)
+	c.Path("/api/" + rest)
+	return c.Next()
+}
+
+// Scope resolves the organization the request picked, if any, and refuses
+// callers that don't belong to it. Requests that don't pick one are scoped to
+// the default organization.
+func Scope(repository IOrgRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ref := c.Get(HeaderOrg)
+		if ref == "" {
+			common.SetOrgId(c, common.DefaultOrgId)
+			return c.Next()
+		}
+		org, err := Find(repository, ref)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fiber.NewError(fiber.StatusNotFound, "organization not found")
+		}
+		if err != nil {
+			fmt.Println(err)
+			return fiber.NewError(fiber.StatusInternalServerError)
+		}
+		role, err := RoleOf(repository, common.GetPrincipal(c), org.Id)
+		if err != nil {
+			fmt.Println(err)
+			return fiber.NewError(fiber.StatusInternalServerError)
+		}
+		if role == RoleNone {
+			return fiber.NewError(fiber.StatusForbidden, "not a member of the organization")
+		}
+		common.SetOrgId(c, org.Id)
+		return c.Next()
+	}
+}
+
+// RequireAdmin refuses anonymous callers with 401 and callers that don't
+// administer the organization the request is scoped to with 403. It has to
+// run after Scope.
+func RequireAdmin(repository IOrgRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal := common.GetPrincipal(c)
+		if principal == nil {
+			c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+			return fiber.NewError(fiber.StatusUnauthorized, "missing API key")
+		}
+		role, err := RoleOf(repository, principal, common.GetOrgId(c))
+		if err != nil {
+			fmt.Println(err)
+			return fiber.NewError(fiber.StatusInternalServerError)
+		}
+		if role != RoleAdmin {
+			return fiber.NewError(fiber.StatusForbidden, "admin role required")
+		}
+		return c.Next()
+	}
+}
+
+// Find looks an organization up by id or slug
+func Find(repository IOrgRepository, ref string) (*Organization, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		return repository.Retrieve(id)
+	}
+	return repository.FindBySlug(ref)
+}
+
+// RoleOf returns the role of the principal in the organization. Service keys
+// administer every organization and everyone is a member of the default one.
+func RoleOf(repository IOrgRepository, principal *common.Principal, orgId int) (Role, error) {
+	if principal.Service() {
+		return RoleAdmin, nil
+	}
+	role := RoleNone
+	if userId := common.UserIdOf(principal); userId != nil {
+		var err error
+		if role, err = repository.MemberRole(orgId, *userId); err != nil {
+			return RoleNone, err
+		}
+	}
+	if role == RoleNone && orgId == common.DefaultOrgId {
+		return RoleMember, nil
+	}
+	return role, nil
+}
+
+// EventFilter is a stream.Filter that only lets through events of the
+// organization the request is scoped to
+func EventFilter(c *fiber.Ctx) func(event stream.StoredEvent) bool {
+	orgId := common.GetOrgId(c)
+	return func(event stream.StoredEvent) bool {
+		var data struct {
+			OrgId int `json:"org_id"`
+		}
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return false
+		}
+		// events from before organizations existed belong to the default one
+		if data.OrgId == 0 {
+			data.OrgId = common.DefaultOrgId
+		}
+		return data.OrgId == orgId
+	}
+}
@@ -0,0 +1,38 @@
+package org
+
+import "time"
+
+type Role string
+
+const (
+	RoleNone   Role = ""
+	RoleMember Role = "member"
+	RoleAdmin  Role = "admin"
+)
+
+var Roles = []Role{RoleMember, RoleAdmin}
+
+// Settings are the per-organization options
+type Settings struct {
+	// RetentionDays is how long completed todos are kept before being
+	// deleted; nil keeps them forever
+	RetentionDays *int `json:"retention_days"`
+	// ArchiveAfterDays is how long completed todos stay in lists before
+	// being archived; nil never archives them
+	ArchiveAfterDays *int `json:"archive_after_days"`
+}
+
+type Organization struct {
+	Id        int       `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Settings  Settings  `json:"settings"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Member struct {
+	OrgId     int       `json:"org_id"`
+	UserId    int       `json:"user_id"`
+	Role      Role      `json:"role" swaggertype:"string" enums:"member,admin"`
+	CreatedAt time.Time `json:"created_at"`
+}
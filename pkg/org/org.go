@@ -0,0 +1,22 @@
+package org
+
+import (
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+)
+
+type OrgModule struct {
+	Repository IOrgRepository
+	Controller *OrgController
+	Retention  *Retention
+}
+
+func New(db *database.Database, bus *events.Bus) *OrgModule {
+	repository := NewOrgRepository(db)
+	controller := NewOrgController(repository)
+	return &OrgModule{
+		Repository: repository,
+		Controller: controller,
+		Retention:  NewRetention(repository, bus),
+	}
+}
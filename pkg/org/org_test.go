@@ -0,0 +1,251 @@
+package org
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type mockRepository struct {
+	orgs       []Organization
+	members    []Member
+	expired    []todo.Todo
+	archivable []todo.Todo
+}
+
+func (mr *mockRepository) Create(dto CreateOrgDto, adminId *int) (*Organization, error) {
+	org := Organization{Id: len(mr.orgs) + 1, Slug: dto.Slug, Name: dto.Name}
+	mr.orgs = append(mr.orgs, org)
+	if adminId != nil {
+		mr.SetMember(org.Id, *adminId, RoleAdmin)
+	}
+	return &org, nil
+}
+
+func (mr *mockRepository) List(audience common.Audience) ([]Organization, error) {
+	return mr.orgs, nil
+}
+
+func (mr *mockRepository) Retrieve(id int) (*Organization, error) {
+	for _, org := range mr.orgs {
+		if org.Id == id {
+			return &org, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (mr *mockRepository) FindBySlug(slug string) (*Organization, error) {
+	for _, org := range mr.orgs {
+		if org.Slug == slug {
+			return &org, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (mr *mockRepository) UpdateSettings(id int, settings Settings) (*Organization, error) {
+	mr.orgs[id-1].Settings = settings
+	return &mr.orgs[id-1], nil
+}
+
+func (mr *mockRepository) MemberRole(orgId int, userId int) (Role, error) {
+	for _, member := range mr.members {
+		if member.OrgId == orgId && member.UserId == userId {
+			return member.Role, nil
+		}
+	}
+	return RoleNone, nil
+}
+
+func (mr *mockRepository) Members(orgId int) ([]Member, error) {
+	return mr.members, nil
+}
+
+func (mr *mockRepository) SetMember(orgId int, userId int, role Role) (*Member, error) {
+	member := Member{OrgId: orgId, UserId: userId, Role: role}
+	mr.members = append(mr.members, member)
+	return &member, nil
+}
+
+func (mr *mockRepository) RemoveMember(orgId int, userId int) (int64, error) {
+	return 0, nil
+}
+
+func (mr *mockRepository) PurgeExpired() ([]todo.Todo, error) {
+	return mr.expired, nil
+}
+
+func (mr *mockRepository) ArchiveCompleted() ([]todo.Todo, error) {
+	return mr.archivable, nil
+}
+
+func (mr *mockRepository) WithTx(work func(repository IOrgRepository, tx *database.Database) error) error {
+	return work(mr, nil)
+}
+
+func userPrincipal(id int) *common.Principal {
+	return &common.Principal{KeyId: 1, UserId: &id}
+}
+
+// orgTestsSetup serves the org routes and an /api/todos route answering with
+// the organization the request was scoped to
+func orgTestsSetup(principal *common.Principal) (*fiber.App, *mockRepository) {
+	mr := new(mockRepository)
+	mr.Create(CreateOrgDto{Slug: "default", Name: "Default"}, nil)
+	mr.Create(CreateOrgDto{Slug: "acme", Name: "Acme"}, nil)
+	mr.SetMember(2, 1, RoleMember)
+	app := fiber.New()
+	app.Use(RewritePath)
+	api := app.Group("/api")
+	api.Use(func(c *fiber.Ctx) error {
+		common.SetPrincipal(c, principal)
+		return c.Next()
+	})
+	api.Use(Scope(mr))
+	api.Get("/todos", func(c *fiber.Ctx) error {
+		return c.SendString(c.Get(HeaderOrg) + ":" + strings.Repeat("x", common.GetOrgId(c)))
+	})
+	GetOrgRoutes(api.Group("/orgs"), NewOrgController(mr))
+	return app, mr
+}
+
+func TestScope(t *testing.T) {
+	tests := []struct {
+		name         string
+		principal    *common.Principal
+		url          string
+		header       string
+		expectStatus int
+		expectBody   string
+	}{
+		{"default organization", nil, "/api/todos", "", 200, ":x"},
+		{"member by header", userPrincipal(1), "/api/todos", "acme", 200, "acme:xx"},
+		{"member by id", userPrincipal(1), "/api/todos", "2", 200, "2:xx"},
+		{"member by path", userPrincipal(1), "/api/orgs/acme/todos", "", 200, "acme:xx"},
+		{"stranger", userPrincipal(2), "/api/orgs/acme/todos", "", 403, ""},
+		{"anonymous", nil, "/api/todos", "acme", 403, ""},
+		{"service key", &common.Principal{KeyId: 1}, "/api/todos", "acme", 200, "acme:xx"},
+		{"unknown organization", userPrincipal(1), "/api/todos", "nope", 404, ""},
+		{"management routes are not rewritten", userPrincipal(1), "/api/orgs/acme/members", "", 200, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app, _ := orgTestsSetup(test.principal)
+			req, _ := http.NewRequest("GET", test.url, nil)
+			if test.header != "" {
+				req.Header.Set(HeaderOrg, test.header)
+			}
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Errorf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+			body, _ := io.ReadAll(res.Body)
+			if test.expectBody != "" && string(body) != test.expectBody {
+				t.Errorf("Expected body %q, got %q", test.expectBody, body)
+			}
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name         string
+		principal    *common.Principal
+		header       string
+		expectStatus int
+	}{
+		{"anonymous", nil, "", 401},
+		{"member of the default organization", userPrincipal(2), "", 403},
+		{"member", userPrincipal(1), "acme", 403},
+		{"admin", userPrincipal(3), "acme", 200},
+		{"service key", &common.Principal{KeyId: 1}, "acme", 200},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app, mr := orgTestsSetup(test.principal)
+			mr.SetMember(2, 3, RoleAdmin)
+			app.Get("/api/admin", RequireAdmin(mr), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+			req, _ := http.NewRequest("GET", "/api/admin", nil)
+			if test.header != "" {
+				req.Header.Set(HeaderOrg, test.header)
+			}
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Errorf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestUpdateSettings(t *testing.T) {
+	tests := []struct {
+		name         string
+		principal    *common.Principal
+		body         string
+		expectStatus int
+	}{
+		{"member", userPrincipal(1), `{"retention_days": 30}`, 403},
+		{"admin", userPrincipal(3), `{"retention_days": 30}`, 200},
+		{"invalid retention", userPrincipal(3), `{"retention_days": 0}`, 400},
+		{"archive after", userPrincipal(3), `{"archive_after_days": 7}`, 200},
+		{"invalid archive after", userPrincipal(3), `{"archive_after_days": -1}`, 400},
+		{"admin of the default organization", userPrincipal(1), `{"retention_days": 30}`, 403},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app, mr := orgTestsSetup(test.principal)
+			mr.SetMember(2, 3, RoleAdmin)
+			url := "/api/orgs/acme/settings"
+			if strings.Contains(test.name, "default") {
+				url = "/api/orgs/default/settings"
+			}
+			req, _ := http.NewRequest("PUT", url, strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Errorf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestRetention(t *testing.T) {
+	mr := &mockRepository{expired: []todo.Todo{{Id: 1}, {Id: 2}}, archivable: []todo.Todo{{Id: 3}}}
+	bus := events.NewBus()
+	deleted, archived := []int{}, []int{}
+	bus.Subscribe(func(event events.Event) {
+		switch event.Type {
+		case todo.EventDeleted:
+			deleted = append(deleted, event.Data.(todo.Todo).Id)
+		case todo.EventArchived:
+			archived = append(archived, event.Data.(todo.Todo).Id)
+		}
+	})
+	NewRetention(mr, bus).RunOnce()
+	if len(deleted) != 2 {
+		t.Errorf("Expected a deleted event per purged todo, got %v", deleted)
+	}
+	if len(archived) != 1 {
+		t.Errorf("Expected an archived event per archived todo, got %v", archived)
+	}
+}
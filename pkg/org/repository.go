@@ -0,0 +1,199 @@
+package org
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type IOrgRepository interface {
+	Create(org CreateOrgDto, adminId *int) (*Organization, error)
+	List(audience common.Audience) ([]Organization, error)
+	Retrieve(id int) (*Organization, error)
+	FindBySlug(slug string) (*Organization, error)
+	UpdateSettings(id int, settings Settings) (*Organization, error)
+	MemberRole(orgId int, userId int) (Role, error)
+	Members(orgId int) ([]Member, error)
+	SetMember(orgId int, userId int, role Role) (*Member, error)
+	RemoveMember(orgId int, userId int) (int64, error)
+	PurgeExpired() ([]todo.Todo, error)
+	ArchiveCompleted() ([]todo.Todo, error)
+	WithTx(work func(repository IOrgRepository, tx *database.Database) error) error
+}
+
+type OrgRepository struct {
+	Db *database.Database
+}
+
+func NewOrgRepository(db *database.Database) *OrgRepository {
+	return &OrgRepository{Db: db}
+}
+
+const (
+	orgColumns    = "id, slug, name, retention_days, archive_after_days, created_at"
+	memberColumns = "org_id, user_id, role, created_at"
+)
+
+func scanOrg(row todo.Scanner) (*Organization, error) {
+	var org Organization
+	if err := row.Scan(&org.Id, &org.Slug, &org.Name, &org.Settings.RetentionDays, &org.Settings.ArchiveAfterDays, &org.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func scanMember(row todo.Scanner) (*Member, error) {
+	var member Member
+	if err := row.Scan(&member.OrgId, &member.UserId, &member.Role, &member.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// Create creates the organization, with the user as its admin when given
+func (or *OrgRepository) Create(org CreateOrgDto, adminId *int) (*Organization, error) {
+	var created *Organization
+	err := or.Db.WithTx(context.Background(), func(tx *database.Database) error {
+		var err error
+		created, err = scanOrg(tx.QueryRow("INSERT INTO organization (slug, name) VALUES ($1, $2) RETURNING "+orgColumns,
+			org.Slug, org.Name))
+		if err != nil || adminId == nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO org_member (org_id, user_id, role) VALUES ($1, $2, $3)", created.Id, *adminId, RoleAdmin)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// List returns the organizations the audience belongs to, which always
+// includes the default one
+func (or *OrgRepository) List(audience common.Audience) ([]Organization, error) {
+	rows, err := or.Db.Query(`
+	SELECT `+orgColumns+` FROM organization
+	WHERE $1 OR id = $3 OR id IN (SELECT org_id FROM org_member WHERE user_id = $2)
+	ORDER BY id
+	`, audience.All, audience.UserId, common.DefaultOrgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	orgs := []Organization{}
+	for rows.Next() {
+		org, err := scanOrg(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, *org)
+	}
+	return orgs, rows.Err()
+}
+
+func (or *OrgRepository) Retrieve(id int) (*Organization, error) {
+	return scanOrg(or.Db.QueryRow("SELECT "+orgColumns+" FROM organization WHERE id = $1", id))
+}
+
+func (or *OrgRepository) FindBySlug(slug string) (*Organization, error) {
+	return scanOrg(or.Db.QueryRow("SELECT "+orgColumns+" FROM organization WHERE slug = $1", slug))
+}
+
+func (or *OrgRepository) UpdateSettings(id int, settings Settings) (*Organization, error) {
+	return scanOrg(or.Db.QueryRow("UPDATE organization SET retention_days = $1, archive_after_days = $2 WHERE id = $3 RETURNING "+orgColumns,
+		settings.RetentionDays, settings.ArchiveAfterDays, id))
+}
+
+// MemberRole returns the role of the user in the organization, RoleNone when
+// they aren't a member
+func (or *OrgRepository) MemberRole(orgId int, userId int) (Role, error) {
+	var role Role
+	err := or.Db.QueryRow("SELECT role FROM org_member WHERE org_id = $1 AND user_id = $2", orgId, userId).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RoleNone, nil
+	}
+	return role, err
+}
+
+func (or *OrgRepository) Members(orgId int) ([]Member, error) {
+	rows, err := or.Db.Query("SELECT "+memberColumns+" FROM org_member WHERE org_id = $1 ORDER BY user_id", orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := []Member{}
+	for rows.Next() {
+		member, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *member)
+	}
+	return members, rows.Err()
+}
+
+// SetMember adds the user to the organization or changes their role
+func (or *OrgRepository) SetMember(orgId int, userId int, role Role) (*Member, error) {
+	return scanMember(or.Db.QueryRow(`
+	INSERT INTO org_member (org_id, user_id, role) VALUES ($1, $2, $3)
+	ON CONFLICT (org_id, user_id) DO UPDATE SET role = EXCLUDED.role
+	RETURNING `+memberColumns, orgId, userId, role))
+}
+
+func (or *OrgRepository) RemoveMember(orgId int, userId int) (int64, error) {
+	result, err := or.Db.Exec("DELETE FROM org_member WHERE org_id = $1 AND user_id = $2", orgId, userId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// PurgeExpired deletes the completed todos that are past the retention of
+// their organization and returns them
+func (or *OrgRepository) PurgeExpired() ([]todo.Todo, error) {
+	return or.todos(`
+	DELETE FROM todo
+	WHERE completed AND completed_at < NOW() - INTERVAL '1 day' * (
+		SELECT retention_days FROM organization WHERE organization.id = todo.org_id
+	)
+	RETURNING ` + todo.Columns)
+}
+
+// ArchiveCompleted archives the completed todos that were completed longer
+// ago than their organization archives them after, and returns them
+func (or *OrgRepository) ArchiveCompleted() ([]todo.Todo, error) {
+	return or.todos(`
+	UPDATE todo SET archived_at = NOW()
+	WHERE completed AND archived_at IS NULL AND completed_at < NOW() - INTERVAL '1 day' * (
+		SELECT archive_after_days FROM organization WHERE organization.id = todo.org_id
+	)
+	RETURNING ` + todo.Columns)
+}
+
+func (or *OrgRepository) WithTx(work func(repository IOrgRepository, tx *database.Database) error) error {
+	return or.Db.WithTx(context.Background(), func(tx *database.Database) error {
+		return work(&OrgRepository{Db: tx}, tx)
+	})
+}
+
+func (or *OrgRepository) todos(query string) ([]todo.Todo, error) {
+	rows, err := or.Db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	todos := []todo.Todo{}
+	for rows.Next() {
+		t, err := todo.ScanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, t)
+	}
+	return todos, rows.Err()
+}
@@ -0,0 +1,70 @@
+package org
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+// Retention archives and deletes the completed todos that are past the
+// policies of their organization, publishing a todo.archived or todo.deleted
+// event for each so webhooks and streams hear about it
+type Retention struct {
+	repository IOrgRepository
+	bus        *events.Bus
+}
+
+func NewRetention(repository IOrgRepository, bus *events.Bus) *Retention {
+	return &Retention{repository: repository, bus: bus}
+}
+
+// RunOnce applies the retention policies once
+func (r *Retention) RunOnce() error {
+	_, archiveErr := r.Archive()
+	if archiveErr != nil {
+		archiveErr = fmt.Errorf("archiving completed todos: %w", archiveErr)
+	}
+	_, purgeErr := r.Purge()
+	if purgeErr != nil {
+		purgeErr = fmt.Errorf("applying retention policies: %w", purgeErr)
+	}
+	return errors.Join(archiveErr, purgeErr)
+}
+
+// Archive archives the completed todos past the archiving policies and
+// returns them
+func (r *Retention) Archive() ([]todo.Todo, error) {
+	return r.apply(IOrgRepository.ArchiveCompleted, todo.EventArchived)
+}
+
+// Purge applies the retention policies and returns the todos it deleted
+func (r *Retention) Purge() ([]todo.Todo, error) {
+	return r.apply(IOrgRepository.PurgeExpired, todo.EventDeleted)
+}
+
+// apply runs the change and publishes an event of the type for each todo it
+// returns, in one transaction so the changes are undone when an event can't
+// be recorded
+func (r *Retention) apply(change func(IOrgRepository) ([]todo.Todo, error), eventType string) ([]todo.Todo, error) {
+	var todos []todo.Todo
+	err := r.repository.WithTx(func(repository IOrgRepository, tx *database.Database) error {
+		var err error
+		todos, err = change(repository)
+		if err != nil {
+			return err
+		}
+		for _, t := range todos {
+			if err := r.bus.PublishTx(tx, eventType, t); err != nil {
+				return fmt.Errorf("%w %s: %w", todo.ErrPublish, eventType, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
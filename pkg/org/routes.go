@@ -0,0 +1,14 @@
+package org
+
+import "github.com/gofiber/fiber/v2"
+
+func GetOrgRoutes(router fiber.Router, controller *OrgController) fiber.Router {
+	router.Post("/", controller.Create)
+	router.Get("/", controller.List)
+	router.Get("/:id", controller.Retrieve)
+	router.Put("/:id/settings", controller.UpdateSettings)
+	router.Get("/:id/members", controller.Members)
+	router.Put("/:id/members/:userId", controller.SetMember)
+	router.Delete("/:id/members/:userId", controller.RemoveMember)
+	return router
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+)
+
+// DefaultLimit is used for what RATE_LIMIT_RPS and RATE_LIMIT_BURST leave
+// unset. Its rate of 0 leaves rate limiting off until RATE_LIMIT_RPS turns it
+// on.
+var DefaultLimit = Limit{Rate: 0, Burst: 50}
+
+// ConfigFromEnv builds the limiter configuration from RATE_LIMIT_RPS,
+// RATE_LIMIT_BURST and RATE_LIMIT_STORE ("memory", the default, or
+// "postgres" for deployments with several instances). Rate limiting is off
+// unless RATE_LIMIT_RPS is above 0, which is reported by a nil Store.
+func ConfigFromEnv(db *database.Database) (Config, error) {
+	limit := DefaultLimit
+	if value := os.Getenv("RATE_LIMIT_RPS"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 {
+			return Config{}, fmt.Errorf("invalid RATE_LIMIT_RPS %q", value)
+		}
+		limit.Rate = rate
+	}
+	if value := os.Getenv("RATE_LIMIT_BURST"); value != "" {
+		burst, err := strconv.Atoi(value)
+		if err != nil || burst < 1 {
+			return Config{}, fmt.Errorf("invalid RATE_LIMIT_BURST %q", value)
+		}
+		limit.Burst = burst
+	}
+	if limit.Rate == 0 {
+		return Config{Limit: limit}, nil
+	}
+	switch store := os.Getenv("RATE_LIMIT_STORE"); store {
+	case "", "memory":
+		return Config{Limit: limit, Store: NewMemoryStore()}, nil
+	case "postgres":
+		return Config{Limit: limit, Store: NewPostgresStore(db)}, nil
+	default:
+		return Config{}, fmt.Errorf("invalid RATE_LIMIT_STORE %q", store)
+	}
+}
+
+// QuotaFromEnv reads TODO_QUOTA, the most todos each user may own in an
+// organization, enforced by the todo repository. 0, the default, means no
+// quota.
+func QuotaFromEnv() (int, error) {
+	value := os.Getenv("TODO_QUOTA")
+	if value == "" {
+		return 0, nil
+	}
+	quota, err := strconv.Atoi(value)
+	if err != nil || quota < 0 {
+		return 0, fmt.Errorf("invalid TODO_QUOTA %q", value)
+	}
+	return quota, nil
+}
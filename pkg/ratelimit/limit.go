@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Limit describes a token bucket: it holds up to Burst tokens, refills at Rate
+// tokens per second, and every request takes one token
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next token, when not allowed
+	RetryAfter time.Duration
+}
+
+type Store interface {
+	Take(key string, limit Limit) (Result, error)
+}
+
+// take refills a bucket that held tokens at updated and takes one token from
+// it if there is one, returning the new token count
+func (l Limit) take(tokens float64, updated time.Time, now time.Time) (float64, Result) {
+	elapsed := math.Max(0, now.Sub(updated).Seconds())
+	tokens = math.Min(float64(l.Burst), tokens+elapsed*l.Rate)
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+		Reset:     l.durationFor(float64(l.Burst) - tokens),
+	}
+	if !allowed {
+		result.RetryAfter = l.durationFor(1 - tokens)
+	}
+	return tokens, result
+}
+
+func (l Limit) durationFor(tokens float64) time.Duration {
+	return time.Duration(tokens / l.Rate * float64(time.Second))
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore keeps buckets in process, which is enough for a single instance
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, lastSweep: time.Now(), now: time.Now}
+}
+
+func (ms *MemoryStore) Take(key string, limit Limit) (Result, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	now := ms.now()
+	ms.sweep(now, limit)
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		ms.buckets[key] = b
+	}
+	tokens, result := limit.take(b.tokens, b.updated, now)
+	b.tokens, b.updated = tokens, now
+	return result, nil
+}
+
+// sweep forgets buckets that have refilled completely, since a new bucket
+// would be in the same state
+func (ms *MemoryStore) sweep(now time.Time, limit Limit) {
+	if now.Sub(ms.lastSweep) < sweepInterval {
+		return
+	}
+	ms.lastSweep = now
+	for key, b := range ms.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*limit.Rate >= float64(limit.Burst) {
+			delete(ms.buckets, key)
+		}
+	}
+}
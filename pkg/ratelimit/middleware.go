@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+const (
+	HeaderLimit     = "RateLimit-Limit"
+	HeaderRemaining = "RateLimit-Remaining"
+	HeaderReset     = "RateLimit-Reset"
+)
+
+type Config struct {
+	Limit   Limit
+	Store   Store
+	KeyFunc func(c *fiber.Ctx) string
+}
+
+// New returns a middleware that takes a token from the client's bucket for
+// every request and answers 429 once the bucket is empty. If the store fails
+// the request is let through rather than taking the API down with it.
+func New(config Config) fiber.Handler {
+	if config.KeyFunc == nil {
+		config.KeyFunc = common.ClientKey
+	}
+	return func(c *fiber.Ctx) error {
+		result, err := config.Store.Take(config.KeyFunc(c), config.Limit)
+		if err != nil {
+			fmt.Println("error checking rate limit:", err)
+			return c.Next()
+		}
+		c.Set(HeaderLimit, strconv.Itoa(config.Limit.Burst))
+		c.Set(HeaderRemaining, strconv.Itoa(result.Remaining))
+		c.Set(HeaderReset, seconds(result.Reset))
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, seconds(result.RetryAfter))
+			return fiber.NewError(fiber.StatusTooManyRequests, "rate limit exceeded")
+		}
+		return c.Next()
+	}
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
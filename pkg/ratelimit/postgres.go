@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+)
+
+// PostgresStore shares buckets between instances. Refills are computed from
+// the database clock so instances with skewed clocks agree.
+type PostgresStore struct {
+	Db        *database.Database
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresStore(db *database.Database) *PostgresStore {
+	return &PostgresStore{Db: db, lastSweep: time.Now()}
+}
+
+func (ps *PostgresStore) Take(key string, limit Limit) (Result, error) {
+	ps.sweep(limit)
+	var result Result
+	err := ps.Db.WithTx(context.Background(), func(tx *database.Database) error {
+		_, err := tx.Exec(`
+		INSERT INTO rate_limit_bucket (key, tokens, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT DO NOTHING
+		`, key, limit.Burst)
+		if err != nil {
+			return err
+		}
+		var tokens float64
+		var updated, now time.Time
+		err = tx.QueryRow("SELECT tokens, updated_at, NOW() FROM rate_limit_bucket WHERE key = $1 FOR UPDATE", key).
+			Scan(&tokens, &updated, &now)
+		if err != nil {
+			return err
+		}
+		tokens, result = limit.take(tokens, updated, now)
+		_, err = tx.Exec("UPDATE rate_limit_bucket SET tokens = $2, updated_at = $3 WHERE key = $1", key, tokens, now)
+		return err
+	})
+	return result, err
+}
+
+// sweep deletes buckets that have refilled completely, at most once per
+// sweepInterval per instance
+func (ps *PostgresStore) sweep(limit Limit) {
+	ps.mu.Lock()
+	if time.Since(ps.lastSweep) < sweepInterval {
+		ps.mu.Unlock()
+		return
+	}
+	ps.lastSweep = time.Now()
+	ps.mu.Unlock()
+	_, err := ps.Db.Exec(`
+	DELETE FROM rate_limit_bucket
+	WHERE tokens + EXTRACT(EPOCH FROM NOW() - updated_at) * $1 >= $2
+	`, limit.Rate, limit.Burst)
+	if err != nil {
+		fmt.Println("error sweeping rate limit buckets:", err)
+	}
+}
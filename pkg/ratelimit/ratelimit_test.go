@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+
+	for i, expected := range []bool{true, true, false} {
+		result, _ := store.Take("a", limit)
+		if result.Allowed != expected {
+			t.Errorf("Request %d: expected allowed to be %t", i, expected)
+		}
+	}
+	result, _ := store.Take("a", limit)
+	if result.RetryAfter != time.Second || result.Reset != 2*time.Second {
+		t.Errorf("Expected to retry in 1s and reset in 2s, got %+v", result)
+	}
+	if result, _ := store.Take("b", limit); !result.Allowed {
+		t.Errorf("Expected buckets to be separate per key")
+	}
+
+	now = now.Add(1500 * time.Millisecond)
+	result, _ = store.Take("a", limit)
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected a refilled token, got %+v", result)
+	}
+
+	now = now.Add(time.Hour)
+	store.Take("c", limit)
+	if _, ok := store.buckets["a"]; ok {
+		t.Errorf("Expected full buckets to be swept")
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(key string, limit Limit) (Result, error) {
+	return Result{}, errors.New("store is down")
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("should answer 429 with Retry-After once the bucket is empty", func(t *testing.T) {
+		app := fiber.New()
+		app.Use(New(Config{Limit: Limit{Rate: 0.5, Burst: 1}, Store: NewMemoryStore()}))
+		app.Get("/", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+		res, _ := app.Test(newRequest())
+		if res.StatusCode != 200 || res.Header.Get(HeaderLimit) != "1" || res.Header.Get(HeaderRemaining) != "0" {
+			t.Errorf("Unexpected first response %d %v", res.StatusCode, res.Header)
+		}
+		res, _ = app.Test(newRequest())
+		if res.StatusCode != 429 || res.Header.Get(fiber.HeaderRetryAfter) != "2" {
+			t.Errorf("Expected 429 with Retry-After 2, got %d %v", res.StatusCode, res.Header)
+		}
+	})
+
+	t.Run("should let requests through when the store fails", func(t *testing.T) {
+		app := fiber.New()
+		app.Use(New(Config{Limit: DefaultLimit, Store: failingStore{}}))
+		app.Get("/", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+		res, _ := app.Test(newRequest())
+		if res.StatusCode != 200 {
+			t.Errorf("Expected status code 200, got %d", res.StatusCode)
+		}
+	})
+}
+
+func newRequest() *http.Request {
+	req, _ := http.NewRequest("GET", "/", nil)
+	return req
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Run("should leave rate limiting off by default", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT_RPS", "")
+		config, err := ConfigFromEnv(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Store != nil {
+			t.Errorf("Expected no store without RATE_LIMIT_RPS")
+		}
+	})
+
+	t.Run("should turn rate limiting on with a rate", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT_RPS", "5")
+		t.Setenv("RATE_LIMIT_STORE", "")
+		config, err := ConfigFromEnv(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Store == nil || config.Limit.Rate != 5 || config.Limit.Burst != DefaultLimit.Burst {
+			t.Errorf("Expected a memory store limiting to 5 rps, got %+v", config)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/auth"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/org"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys, the gRPC counterparts of the REST headers
+const (
+	MetadataApiKey        = "x-api-key"
+	MetadataAuthorization = "authorization"
+	MetadataOrg           = "x-org"
+)
+
+// readMethods are the calls that only need the read scope, like GET requests
+var readMethods = []string{
+	"/todo.v1.TodoService/List",
+	"/todo.v1.TodoService/Retrieve",
+	"/todo.v1.TodoService/Watch",
+}
+
+type principalKey struct{}
+type orgKey struct{}
+
+// Authenticator does for gRPC calls what auth.Authenticate and org.Scope do
+// for HTTP requests: it resolves the API key and organization sent in the
+// metadata and stores them in the context of the call
+type Authenticator struct {
+	keys     auth.IApiKeyRepository
+	orgs     org.IOrgRepository
+	required bool
+}
+
+func NewAuthenticator(keys auth.IApiKeyRepository, orgs org.IOrgRepository, required bool) *Authenticator {
+	return &Authenticator{keys: keys, orgs: orgs, required: required}
+}
+
+func (a *Authenticator) Unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := a.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *Authenticator) Stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &scopedStream{ServerStream: ss, ctx: ctx})
+}
+
+func (a *Authenticator) authenticate(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var principal *common.Principal
+	if key := credentials(md); key != "" {
+		var err error
+		principal, err = auth.Resolve(a.keys, key)
+		if errors.Is(err, auth.ErrInvalidKey) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if err != nil {
+			fmt.Println(err)
+			return nil, status.Error(codes.Internal, "error resolving API key")
+		}
+		scope := auth.ScopeWrite
+		if common.Contains(readMethods, method) {
+			scope = auth.ScopeRead
+		}
+		if !principal.HasScope(scope) {
+			return nil, status.Errorf(codes.PermissionDenied, "API key lacks the %s scope", scope)
+		}
+	} else if a.required {
+		return nil, status.Error(codes.Unauthenticated, "missing API key")
+	}
+	orgId, err := a.orgId(principal, first(md, MetadataOrg))
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, principalKey{}, principal)
+	return context.WithValue(ctx, orgKey{}, orgId), nil
+}
+
+func (a *Authenticator) orgId(principal *common.Principal, ref string) (int, error) {
+	if ref == "" {
+		return common.DefaultOrgId, nil
+	}
+	found, err := org.Find(a.orgs, ref)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, status.Error(codes.NotFound, "organization not found")
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 0, status.Error(codes.Internal, "error resolving organization")
+	}
+	role, err := org.RoleOf(a.orgs, principal, found.Id)
+	if err != nil {
+		fmt.Println(err)
+		return 0, status.Error(codes.Internal, "error resolving organization")
+	}
+	if role == org.RoleNone {
+		return 0, status.Error(codes.PermissionDenied, "not a member of the organization")
+	}
+	return found.Id, nil
+}
+
+func credentials(md metadata.MD) string {
+	if key := first(md, MetadataApiKey); key != "" {
+		return key
+	}
+	scheme, token, found := strings.Cut(first(md, MetadataAuthorization), " ")
+	if found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// principalOf returns the caller of the call, or nil for anonymous calls
+func principalOf(ctx context.Context) *common.Principal {
+	principal, _ := ctx.Value(principalKey{}).(*common.Principal)
+	return principal
+}
+
+// orgIdOf returns the organization the call is scoped to
+func orgIdOf(ctx context.Context) int {
+	if orgId, ok := ctx.Value(orgKey{}).(int); ok {
+		return orgId
+	}
+	return common.DefaultOrgId
+}
+
+// scopedStream replaces the context of a stream with the authenticated one
+type scopedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *scopedStream) Context() context.Context {
+	return s.ctx
+}
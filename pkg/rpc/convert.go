@@ -0,0 +1,68 @@
+package rpc
+
+import (
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/rpc/todopb"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func toProto(t todo.Todo) *todopb.Todo {
+	return &todopb.Todo{
+		Id:          int64(t.Id),
+		Title:       t.Title,
+		Description: t.Description,
+		Completed:   t.Completed,
+		DueDate:     toTimestamp(t.DueDate),
+		Priority:    int32(t.Priority),
+		ListId:      toInt64(t.ListId),
+		OwnerId:     toInt64(t.OwnerId),
+		OrgId:       int64(t.OrgId),
+		CompletedAt: toTimestamp(t.CompletedAt),
+	}
+}
+
+// fromInput maps what the client sent to the DTO the REST handlers parse
+// from request bodies
+func fromInput(input *todopb.TodoInput) todo.CreateTodoDto {
+	return todo.CreateTodoDto{
+		Title:       input.GetTitle(),
+		Description: input.GetDescription(),
+		Completed:   input.GetCompleted(),
+		DueDate:     fromTimestamp(input.GetDueDate()),
+		Priority:    int(input.GetPriority()),
+		ListId:      fromInt64(input.ListId),
+	}
+}
+
+func toTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func fromTimestamp(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+func toInt64(value *int) *int64 {
+	if value == nil {
+		return nil
+	}
+	converted := int64(*value)
+	return &converted
+}
+
+func fromInt64(value *int64) *int {
+	if value == nil {
+		return nil
+	}
+	converted := int(*value)
+	return &converted
+}
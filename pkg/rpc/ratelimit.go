@@ -0,0 +1,77 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataRetryAfter tells throttled callers how many seconds to wait, like
+// the Retry-After header
+const MetadataRetryAfter = "retry-after"
+
+// RateLimiter does for gRPC calls what ratelimit.New does for HTTP requests.
+// It runs before authentication, like the HTTP middleware, so it keys calls
+// by client IP the way common.ClientKey keys anonymous requests, and a client
+// shares one bucket between both APIs. A Watch stream takes a single token.
+type RateLimiter struct {
+	config ratelimit.Config
+}
+
+func NewRateLimiter(config ratelimit.Config) *RateLimiter {
+	return &RateLimiter{config: config}
+}
+
+func (l *RateLimiter) Unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := l.take(ctx, func(md metadata.MD) { grpc.SetHeader(ctx, md) }); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (l *RateLimiter) Stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := l.take(ss.Context(), func(md metadata.MD) { ss.SetHeader(md) }); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// take takes a token from the bucket of the caller and refuses the call with
+// ResourceExhausted once it is empty. If the store fails the call is let
+// through rather than taking the API down with it.
+func (l *RateLimiter) take(ctx context.Context, setHeader func(metadata.MD)) error {
+	result, err := l.config.Store.Take(clientKey(ctx), l.config.Limit)
+	if err != nil {
+		fmt.Println("error checking rate limit:", err)
+		return nil
+	}
+	if !result.Allowed {
+		retryAfter := strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds())))
+		setHeader(metadata.Pairs(MetadataRetryAfter, retryAfter))
+		return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %ss", retryAfter)
+	}
+	return nil
+}
+
+// clientKey returns the key common.ClientKey gives anonymous requests from
+// the peer of the call
+func clientKey(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "ip:"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "ip:" + host
+}
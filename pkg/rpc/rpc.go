@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/auth"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/org"
+	"github.com/raphael-foliveira/fiber-todo/pkg/ratelimit"
+	"github.com/raphael-foliveira/fiber-todo/pkg/rpc/todopb"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/stream"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"google.golang.org/grpc"
+)
+
+// shutdownTimeout is how long Stop waits for calls in flight, Watch streams
+// included, before cutting them off
+const shutdownTimeout = 5 * time.Second
+
+// Config holds the settings the gRPC server shares with the REST API
+type Config struct {
+	Addr         string
+	AuthRequired bool
+	// RateLimit throttles calls when it has a Store
+	RateLimit ratelimit.Config
+}
+
+type RpcModule struct {
+	Server   *TodoServer
+	Listener *Listener
+}
+
+// New wires the gRPC TodoService on the repositories, permissions and events
+// the REST API uses, so both APIs see and cause the same changes
+func New(config Config, keys auth.IApiKeyRepository, orgs org.IOrgRepository, repository todo.ITodoRepository, authorizer *sharing.Authorizer, bus *events.Bus, streamModule *stream.StreamModule) *RpcModule {
+	server := NewTodoServer(repository, authorizer, bus, streamModule.Hub, streamModule.Repository)
+	authenticator := NewAuthenticator(keys, orgs, config.AuthRequired)
+	grpcServer := grpc.NewServer(interceptors(authenticator, config.RateLimit)...)
+	todopb.RegisterTodoServiceServer(grpcServer, server)
+	return &RpcModule{
+		Server:   server,
+		Listener: NewListener(config.Addr, grpcServer),
+	}
+}
+
+// interceptors runs the rate limiter, when there is one, ahead of
+// authentication, so calls with invalid keys are throttled too
+func interceptors(authenticator *Authenticator, rateLimit ratelimit.Config) []grpc.ServerOption {
+	unary := []grpc.UnaryServerInterceptor{}
+	streams := []grpc.StreamServerInterceptor{}
+	if rateLimit.Store != nil {
+		limiter := NewRateLimiter(rateLimit)
+		unary = append(unary, limiter.Unary)
+		streams = append(streams, limiter.Stream)
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(append(unary, authenticator.Unary)...),
+		grpc.ChainStreamInterceptor(append(streams, authenticator.Stream)...),
+	}
+}
+
+// Listener serves the gRPC server on its own port while the REST API runs
+type Listener struct {
+	addr   string
+	server *grpc.Server
+	done   sync.WaitGroup
+}
+
+func NewListener(addr string, server *grpc.Server) *Listener {
+	return &Listener{addr: addr, server: server}
+}
+
+func (l *Listener) Start() error {
+	listener, err := net.Listen("tcp", l.addr)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Serving gRPC on", listener.Addr())
+	l.done.Add(1)
+	go func() {
+		defer l.done.Done()
+		if err := l.server.Serve(listener); err != nil {
+			fmt.Println("gRPC server:", err)
+		}
+	}()
+	return nil
+}
+
+func (l *Listener) Stop() {
+	stopped := make(chan struct{})
+	go func() {
+		l.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		l.server.Stop()
+	}
+	l.done.Wait()
+}
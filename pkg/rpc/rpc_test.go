@@ -0,0 +1,468 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/auth"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/org"
+	"github.com/raphael-foliveira/fiber-todo/pkg/ratelimit"
+	"github.com/raphael-foliveira/fiber-todo/pkg/rpc/todopb"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/stream"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type mockTodoRepository struct {
+	todos []todo.Todo
+}
+
+func (mr *mockTodoRepository) Create(dto todo.CreateTodoDto) (*todo.Todo, error) {
+	for _, t := range mr.todos {
+		if t.Title == dto.Title {
+			return nil, errors.New("todo already exists in mock repository")
+		}
+	}
+	created := todo.Todo{
+		Id:          len(mr.todos) + 1,
+		Title:       dto.Title,
+		Description: dto.Description,
+		Completed:   dto.Completed,
+		ListId:      dto.ListId,
+		OwnerId:     dto.OwnerId,
+		OrgId:       dto.OrgId,
+	}
+	mr.todos = append(mr.todos, created)
+	return &created, nil
+}
+
+func (mr *mockTodoRepository) List(filter todo.ListFilter) ([]todo.Todo, error) {
+	todos := []todo.Todo{}
+	for _, t := range mr.todos {
+		if t.OrgId == filter.OrgId && t.Id > filter.AfterId && (filter.Limit == 0 || len(todos) < filter.Limit) {
+			todos = append(todos, t)
+		}
+	}
+	return todos, nil
+}
+
+func (mr *mockTodoRepository) Retrieve(orgId int, id int) (*todo.Todo, error) {
+	for _, t := range mr.todos {
+		if t.Id == id && t.OrgId == orgId {
+			return &t, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (mr *mockTodoRepository) Update(updated todo.Todo) (*todo.Todo, error) {
+	for i, t := range mr.todos {
+		if t.Id == updated.Id {
+			mr.todos[i] = updated
+			return &updated, nil
+		}
+	}
+	return &todo.Todo{}, nil
+}
+
+func (mr *mockTodoRepository) Delete(orgId int, id int) (int64, error) {
+	for i, t := range mr.todos {
+		if t.Id == id {
+			mr.todos = append(mr.todos[:i], mr.todos[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (mr *mockTodoRepository) Count(orgId int, ownerId *int) (int, error) {
+	return len(mr.todos), nil
+}
+
+func (mr *mockTodoRepository) Archive(orgId int, id int, archived bool) (*todo.Todo, error) {
+	return nil, nil
+}
+
+func (mr *mockTodoRepository) WithTx(work func(repository todo.ITodoRepository, tx *database.Database) error) error {
+	return work(mr, nil)
+}
+
+// the mocks below embed the interfaces they stand in for and only implement
+// what the server calls
+type mockKeyRepository struct {
+	auth.IApiKeyRepository
+	keys map[string]auth.ApiKey
+}
+
+func (mr *mockKeyRepository) FindByHash(hash string) (*auth.ApiKey, error) {
+	for key, apiKey := range mr.keys {
+		if auth.HashKey(key) == hash {
+			return &apiKey, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (mr *mockKeyRepository) Touch(id int) error {
+	return nil
+}
+
+type mockOrgRepository struct {
+	org.IOrgRepository
+}
+
+func (mr *mockOrgRepository) FindBySlug(slug string) (*org.Organization, error) {
+	if slug == "other" {
+		return &org.Organization{Id: 2, Slug: slug}, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (mr *mockOrgRepository) MemberRole(orgId int, userId int) (org.Role, error) {
+	return org.RoleNone, nil
+}
+
+type mockSharingRepository struct {
+	sharing.ISharingRepository
+	todos map[int]sharing.Access
+}
+
+func (mr *mockSharingRepository) TodoAccess(id int, userId *int) (*sharing.Access, error) {
+	access, ok := mr.todos[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &access, nil
+}
+
+func (mr *mockSharingRepository) ListAccess(id int, userId *int) (*sharing.Access, error) {
+	return nil, sql.ErrNoRows
+}
+
+type mockStreamRepository struct {
+	stream.IStreamRepository
+	events []stream.StoredEvent
+}
+
+func (mr *mockStreamRepository) Since(id int64, limit int) ([]stream.StoredEvent, error) {
+	events := []stream.StoredEvent{}
+	for _, event := range mr.events {
+		if event.Id > id && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+type fixture struct {
+	client   todopb.TodoServiceClient
+	todos    *mockTodoRepository
+	shares   *mockSharingRepository
+	events   *mockStreamRepository
+	hub      *stream.Hub
+	bus      *events.Bus
+	received []string
+}
+
+var userId = 7
+
+func setUp(t *testing.T, required bool) *fixture {
+	return setUpWithLimit(t, required, ratelimit.Config{})
+}
+
+func setUpWithLimit(t *testing.T, required bool, rateLimit ratelimit.Config) *fixture {
+	f := &fixture{
+		todos:  &mockTodoRepository{},
+		shares: &mockSharingRepository{todos: map[int]sharing.Access{}},
+		events: &mockStreamRepository{},
+		hub:    stream.NewHub(),
+		bus:    events.NewBus(),
+	}
+	f.bus.Subscribe(func(event events.Event) {
+		f.received = append(f.received, event.Type)
+	})
+	keys := &mockKeyRepository{keys: map[string]auth.ApiKey{
+		"service":  {Id: 1, Scopes: auth.Scopes},
+		"readonly": {Id: 2, Scopes: []string{auth.ScopeRead}},
+		"user":     {Id: 3, Scopes: auth.Scopes, UserId: &userId},
+	}}
+	server := NewTodoServer(f.todos, sharing.NewAuthorizer(f.shares), f.bus, f.hub, f.events)
+	authenticator := NewAuthenticator(keys, &mockOrgRepository{}, required)
+	grpcServer := grpc.NewServer(interceptors(authenticator, rateLimit)...)
+	todopb.RegisterTodoServiceServer(grpcServer, server)
+	listener := bufconn.Listen(1 << 20)
+	go grpcServer.Serve(listener)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		grpcServer.Stop()
+	})
+	f.client = todopb.NewTodoServiceClient(conn)
+	return f
+}
+
+func withKey(key string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), MetadataAuthorization, "Bearer "+key)
+}
+
+func expectCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if status.Code(err) != code {
+		t.Errorf("Expected %s, got %v", code, err)
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	f := setUp(t, true)
+	ctx := context.Background()
+
+	t.Run("should refuse calls without a key when required", func(t *testing.T) {
+		_, err := f.client.List(ctx, &todopb.ListRequest{})
+		expectCode(t, err, codes.Unauthenticated)
+	})
+
+	t.Run("should refuse unknown keys", func(t *testing.T) {
+		_, err := f.client.List(withKey("unknown"), &todopb.ListRequest{})
+		expectCode(t, err, codes.Unauthenticated)
+	})
+
+	t.Run("should accept keys sent as x-api-key", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(ctx, MetadataApiKey, "readonly")
+		_, err := f.client.List(ctx, &todopb.ListRequest{})
+		expectCode(t, err, codes.OK)
+	})
+
+	t.Run("should require the write scope to mutate", func(t *testing.T) {
+		_, err := f.client.Create(withKey("readonly"), &todopb.CreateRequest{Todo: &todopb.TodoInput{Title: "a"}})
+		expectCode(t, err, codes.PermissionDenied)
+	})
+
+	t.Run("should refuse organizations the caller isn't a member of", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(withKey("user"), MetadataOrg, "other")
+		_, err := f.client.List(ctx, &todopb.ListRequest{})
+		expectCode(t, err, codes.PermissionDenied)
+	})
+
+	t.Run("should answer not found for unknown organizations", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(withKey("service"), MetadataOrg, "missing")
+		_, err := f.client.List(ctx, &todopb.ListRequest{})
+		expectCode(t, err, codes.NotFound)
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	f := setUpWithLimit(t, true, ratelimit.Config{Limit: ratelimit.Limit{Rate: 0.001, Burst: 2}, Store: ratelimit.NewMemoryStore()})
+	_, err := f.client.List(withKey("unknown"), &todopb.ListRequest{})
+	expectCode(t, err, codes.Unauthenticated)
+	_, err = f.client.List(withKey("service"), &todopb.ListRequest{})
+	expectCode(t, err, codes.OK)
+	// the call with an unknown key took a token too
+	var header metadata.MD
+	_, err = f.client.List(withKey("service"), &todopb.ListRequest{}, grpc.Header(&header))
+	expectCode(t, err, codes.ResourceExhausted)
+	if len(header.Get(MetadataRetryAfter)) != 1 {
+		t.Errorf("Expected the throttled call to be told when to retry, got %v", header)
+	}
+	watch, err := f.client.Watch(withKey("service"), &todopb.WatchRequest{})
+	if err == nil {
+		_, err = watch.Recv()
+	}
+	expectCode(t, err, codes.ResourceExhausted)
+}
+
+func TestTodoServer(t *testing.T) {
+	f := setUp(t, false)
+	ctx := withKey("user")
+
+	t.Run("should create todos owned by the caller", func(t *testing.T) {
+		created, err := f.client.Create(ctx, &todopb.CreateRequest{Todo: &todopb.TodoInput{Title: "first"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created.GetOwnerId() != int64(userId) || created.GetOrgId() != 1 {
+			t.Errorf("Expected todo owned by %d in org 1, got %+v", userId, created)
+		}
+		if len(f.received) != 1 || f.received[0] != todo.EventCreated {
+			t.Errorf("Expected a todo.created event, got %v", f.received)
+		}
+	})
+
+	t.Run("should refuse duplicate titles", func(t *testing.T) {
+		_, err := f.client.Create(ctx, &todopb.CreateRequest{Todo: &todopb.TodoInput{Title: "first"}})
+		expectCode(t, err, codes.AlreadyExists)
+	})
+
+	t.Run("should require a todo", func(t *testing.T) {
+		_, err := f.client.Create(ctx, &todopb.CreateRequest{})
+		expectCode(t, err, codes.InvalidArgument)
+	})
+
+	t.Run("should publish completion on update", func(t *testing.T) {
+		f.received = nil
+		updated, err := f.client.Update(ctx, &todopb.UpdateRequest{Id: 1, Todo: &todopb.TodoInput{Title: "first", Completed: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !updated.GetCompleted() || updated.GetOwnerId() != int64(userId) {
+			t.Errorf("Expected completed todo keeping its owner, got %+v", updated)
+		}
+		if len(f.received) != 2 || f.received[1] != todo.EventCompleted {
+			t.Errorf("Expected todo.updated and todo.completed, got %v", f.received)
+		}
+	})
+
+	t.Run("should refuse updates from viewers", func(t *testing.T) {
+		f.shares.todos[1] = sharing.Access{Owners: []int{1}, Grants: []sharing.Role{sharing.RoleViewer}}
+		defer delete(f.shares.todos, 1)
+		_, err := f.client.Update(ctx, &todopb.UpdateRequest{Id: 1, Todo: &todopb.TodoInput{Title: "changed"}})
+		expectCode(t, err, codes.PermissionDenied)
+		if _, err := f.client.Retrieve(ctx, &todopb.RetrieveRequest{Id: 1}); err != nil {
+			t.Errorf("Expected viewer to retrieve the todo, got %v", err)
+		}
+	})
+
+	t.Run("should answer not found for unknown todos", func(t *testing.T) {
+		_, err := f.client.Retrieve(ctx, &todopb.RetrieveRequest{Id: 99})
+		expectCode(t, err, codes.NotFound)
+		_, err = f.client.Delete(ctx, &todopb.DeleteRequest{Id: 99})
+		expectCode(t, err, codes.NotFound)
+	})
+
+	t.Run("should delete todos", func(t *testing.T) {
+		if _, err := f.client.Delete(ctx, &todopb.DeleteRequest{Id: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if len(f.todos.todos) != 0 {
+			t.Errorf("Expected todo to be deleted, got %+v", f.todos.todos)
+		}
+	})
+}
+
+func TestList(t *testing.T) {
+	f := setUp(t, false)
+	for i := 1; i <= 5; i++ {
+		f.todos.todos = append(f.todos.todos, todo.Todo{Id: i, OrgId: 1})
+	}
+	f.todos.todos = append(f.todos.todos, todo.Todo{Id: 6, OrgId: 2})
+	ctx := context.Background()
+
+	t.Run("should page through the todos of the organization", func(t *testing.T) {
+		ids := []int64{}
+		pages := 0
+		request := &todopb.ListRequest{PageSize: 2}
+		for {
+			response, err := f.client.List(ctx, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages++
+			for _, item := range response.GetTodos() {
+				ids = append(ids, item.GetId())
+			}
+			if response.GetNextPageToken() == "" {
+				break
+			}
+			request.PageToken = response.GetNextPageToken()
+		}
+		if pages != 3 || len(ids) != 5 || ids[4] != 5 {
+			t.Errorf("Expected todos 1 to 5 in 3 pages, got %v in %d", ids, pages)
+		}
+	})
+
+	t.Run("should not announce a page after an exact fit", func(t *testing.T) {
+		response, err := f.client.List(ctx, &todopb.ListRequest{PageSize: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(response.GetTodos()) != 5 || response.GetNextPageToken() != "" {
+			t.Errorf("Expected a single full page, got %+v", response)
+		}
+	})
+
+	t.Run("should refuse invalid page tokens", func(t *testing.T) {
+		_, err := f.client.List(ctx, &todopb.ListRequest{PageToken: "not a token"})
+		expectCode(t, err, codes.InvalidArgument)
+	})
+}
+
+func storedEvent(id int64, eventType string, t todo.Todo) stream.StoredEvent {
+	data, _ := json.Marshal(t)
+	return stream.StoredEvent{Id: id, Type: eventType, Data: data, CreatedAt: time.Now()}
+}
+
+func TestWatch(t *testing.T) {
+	f := setUp(t, false)
+	f.events.events = []stream.StoredEvent{
+		storedEvent(1, todo.EventCreated, todo.Todo{Id: 1, Title: "old"}),
+		storedEvent(2, todo.EventCreated, todo.Todo{Id: 2, Title: "elsewhere", OrgId: 2}),
+		storedEvent(3, todo.EventUpdated, todo.Todo{Id: 1, Title: "replayed", OrgId: 1}),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	watch, err := f.client.Watch(ctx, &todopb.WatchRequest{AfterEventId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := watch.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.GetId() != 3 || replayed.GetTodo().GetTitle() != "replayed" {
+		t.Errorf("Expected event 3 to be replayed, got %+v", replayed)
+	}
+	// the server subscribes before replaying, so once the replay arrived live
+	// events reach it; repeats of replayed events are skipped
+	f.hub.Broadcast(storedEvent(3, todo.EventUpdated, todo.Todo{Id: 1, OrgId: 1}))
+	f.hub.Broadcast(storedEvent(4, todo.EventDeleted, todo.Todo{Id: 3, OrgId: 2}))
+	f.hub.Broadcast(storedEvent(5, todo.EventDeleted, todo.Todo{Id: 1, Title: "live", OrgId: 1}))
+	live, err := watch.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live.GetId() != 5 || live.GetType() != todo.EventDeleted || live.GetTodo().GetTitle() != "live" {
+		t.Errorf("Expected live event 5, got %+v", live)
+	}
+}
+
+func TestWatchReplayPages(t *testing.T) {
+	f := setUp(t, false)
+	for id := int64(1); id <= 2*replayLimit+1; id++ {
+		f.events.events = append(f.events.events, storedEvent(id, todo.EventCreated, todo.Todo{Id: 1, OrgId: 1}))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	watch, err := f.client.Watch(ctx, &todopb.WatchRequest{AfterEventId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want := int64(2); want <= 2*replayLimit+1; want++ {
+		event, err := watch.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.GetId() != want {
+			t.Fatalf("Expected event %d to be replayed, got %d", want, event.GetId())
+		}
+	}
+}
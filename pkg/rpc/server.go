@@ -0,0 +1,265 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/rpc/todopb"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/stream"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+	replayLimit     = 1000
+)
+
+// TodoServer implements todopb.TodoServiceServer on the same repository,
+// permission checks and events as the REST handlers
+type TodoServer struct {
+	todopb.UnimplementedTodoServiceServer
+	repository todo.ITodoRepository
+	authorizer *sharing.Authorizer
+	bus        *events.Bus
+	hub        *stream.Hub
+	events     stream.IStreamRepository
+}
+
+// NewTodoServer creates the server. The todo repository enforces the todo
+// quota, like it does for POST /api/todos.
+func NewTodoServer(repository todo.ITodoRepository, authorizer *sharing.Authorizer, bus *events.Bus, hub *stream.Hub, events stream.IStreamRepository) *TodoServer {
+	return &TodoServer{
+		repository: repository,
+		authorizer: authorizer,
+		bus:        bus,
+		hub:        hub,
+		events:     events,
+	}
+}
+
+func (s *TodoServer) Create(ctx context.Context, req *todopb.CreateRequest) (*todopb.Todo, error) {
+	if req.GetTodo() == nil {
+		return nil, status.Error(codes.InvalidArgument, "todo is required")
+	}
+	dto := fromInput(req.GetTodo())
+	dto.OwnerId = common.UserIdOf(principalOf(ctx))
+	dto.OrgId = orgIdOf(ctx)
+	if err := s.requireTargetList(ctx, dto.ListId); err != nil {
+		return nil, err
+	}
+	created, err := todo.Create(s.repository, s.bus, dto)
+	if errors.Is(err, todo.ErrQuotaExceeded) {
+		return nil, status.Error(codes.ResourceExhausted, "quota exceeded")
+	}
+	if errors.Is(err, todo.ErrPublish) {
+		fmt.Println(err)
+		return nil, status.Error(codes.Internal, "error creating todo")
+	}
+	if err != nil {
+		fmt.Println(err)
+		return nil, status.Error(codes.AlreadyExists, "todo already exists")
+	}
+	return toProto(*created), nil
+}
+
+func (s *TodoServer) List(ctx context.Context, req *todopb.ListRequest) (*todopb.ListResponse, error) {
+	// page tokens are todo cursors
+	afterId, err := todo.DecodeCursor(req.GetPageToken())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid page token")
+	}
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	// one more than the page size tells whether there is a next page
+	todos, err := s.repository.List(todo.ListFilter{
+		OrgId:    orgIdOf(ctx),
+		Audience: common.AudienceOf(principalOf(ctx)),
+		AfterId:  afterId,
+		Limit:    pageSize + 1,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return nil, status.Error(codes.Internal, "error listing todos")
+	}
+	response := &todopb.ListResponse{Todos: []*todopb.Todo{}}
+	if len(todos) > pageSize {
+		todos = todos[:pageSize]
+		response.NextPageToken = todo.EncodeCursor(todos[pageSize-1].Id)
+	}
+	for _, t := range todos {
+		response.Todos = append(response.Todos, toProto(t))
+	}
+	return response, nil
+}
+
+func (s *TodoServer) Retrieve(ctx context.Context, req *todopb.RetrieveRequest) (*todopb.Todo, error) {
+	if err := s.requireTodo(ctx, sharing.RoleViewer, int(req.GetId())); err != nil {
+		return nil, err
+	}
+	t, err := s.repository.Retrieve(orgIdOf(ctx), int(req.GetId()))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "todo not found")
+	}
+	return toProto(*t), nil
+}
+
+func (s *TodoServer) Update(ctx context.Context, req *todopb.UpdateRequest) (*todopb.Todo, error) {
+	if req.GetTodo() == nil {
+		return nil, status.Error(codes.InvalidArgument, "todo is required")
+	}
+	id := int(req.GetId())
+	dto := fromInput(req.GetTodo())
+	if err := s.requireTodo(ctx, sharing.RoleEditor, id); err != nil {
+		return nil, err
+	}
+	if err := s.requireTargetList(ctx, dto.ListId); err != nil {
+		return nil, err
+	}
+	previous, err := s.repository.Retrieve(orgIdOf(ctx), id)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "todo not found")
+	}
+	updated, err := todo.Update(s.repository, s.bus, *previous, todo.Todo{
+		Id:          id,
+		Title:       dto.Title,
+		Description: dto.Description,
+		Completed:   dto.Completed,
+		DueDate:     dto.DueDate,
+		Priority:    dto.Priority,
+		ListId:      dto.ListId,
+		OwnerId:     previous.OwnerId,
+		OrgId:       previous.OrgId,
+		AssigneeId:  previous.AssigneeId,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return nil, status.Error(codes.Internal, "error updating todo")
+	}
+	if updated.Id == 0 {
+		return nil, status.Error(codes.NotFound, "todo not found")
+	}
+	return toProto(*updated), nil
+}
+
+func (s *TodoServer) Delete(ctx context.Context, req *todopb.DeleteRequest) (*emptypb.Empty, error) {
+	id := int(req.GetId())
+	if err := s.requireTodo(ctx, sharing.RoleOwner, id); err != nil {
+		return nil, err
+	}
+	t, err := s.repository.Retrieve(orgIdOf(ctx), id)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "todo not found")
+	}
+	affected, err := todo.Delete(s.repository, s.bus, t)
+	if err != nil {
+		fmt.Println(err)
+		return nil, status.Error(codes.Internal, "error deleting todo")
+	}
+	if affected == 0 {
+		return nil, status.Error(codes.NotFound, "todo not found")
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// Watch sends the events the SSE stream would: those of the organization of
+// the call about todos the caller can see, replaying from after_event_id
+func (s *TodoServer) Watch(req *todopb.WatchRequest, srv todopb.TodoService_WatchServer) error {
+	ctx := srv.Context()
+	principal, orgId := principalOf(ctx), orgIdOf(ctx)
+	// subscribe before reading the backlog so nothing falls in between; the
+	// overlap is skipped by id below
+	live, unsubscribe := s.hub.Subscribe()
+	defer unsubscribe()
+	sent := req.GetAfterEventId()
+	// the backlog is read a page at a time until it has caught up
+	for replaying := sent > 0; replaying; {
+		backlog, err := s.events.Since(sent, replayLimit)
+		if err != nil {
+			fmt.Println(err)
+			return status.Error(codes.Internal, "error reading events")
+		}
+		for _, event := range backlog {
+			if err := s.send(srv, principal, orgId, event); err != nil {
+				return err
+			}
+			sent = event.Id
+		}
+		replaying = len(backlog) == replayLimit
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-live:
+			if !ok {
+				return status.Error(codes.Unavailable, "stream fell behind, resume with after_event_id")
+			}
+			if event.Id <= sent {
+				continue
+			}
+			if err := s.send(srv, principal, orgId, event); err != nil {
+				return err
+			}
+			sent = event.Id
+		}
+	}
+}
+
+func (s *TodoServer) send(srv todopb.TodoService_WatchServer, principal *common.Principal, orgId int, event stream.StoredEvent) error {
+	var t todo.Todo
+	if err := json.Unmarshal(event.Data, &t); err != nil {
+		return nil
+	}
+	// events from before organizations existed belong to the default one
+	if t.OrgId == 0 {
+		t.OrgId = common.DefaultOrgId
+	}
+	if t.OrgId != orgId || !s.authorizer.CanSee(principal, t) {
+		return nil
+	}
+	return srv.Send(&todopb.TodoEvent{
+		Id:   event.Id,
+		Type: event.Type,
+		Todo: toProto(t),
+		Time: timestamppb.New(event.CreatedAt),
+	})
+}
+
+func (s *TodoServer) requireTodo(ctx context.Context, role sharing.Role, id int) error {
+	return s.require(ctx, role, sharing.Resource{TodoId: &id})
+}
+
+func (s *TodoServer) requireTargetList(ctx context.Context, listId *int) error {
+	if listId == nil {
+		return nil
+	}
+	return s.require(ctx, sharing.RoleEditor, sharing.Resource{ListId: listId})
+}
+
+func (s *TodoServer) require(ctx context.Context, role sharing.Role, resource sharing.Resource) error {
+	err := s.authorizer.Require(principalOf(ctx), role, resource)
+	var forbidden *sharing.ForbiddenError
+	if errors.As(err, &forbidden) {
+		return status.Error(codes.PermissionDenied, forbidden.Error())
+	}
+	if err != nil {
+		fmt.Println(err)
+		return status.Error(codes.Internal, "error checking permissions")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"io"
+	"regexp"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// uploadPath is the path attachments are uploaded to
+var uploadPath = regexp.MustCompile(`^/api/todos/[^/]+/attachments/?$`)
+
+// uploadLimit is the largest attachment upload accepted, with room for the
+// rest of the multipart body. It is never below the default limit.
+func uploadLimit(maxAttachmentSize int64) int {
+	limit := int(maxAttachmentSize) + 64<<10
+	if limit < fiber.DefaultBodyLimit {
+		return fiber.DefaultBodyLimit
+	}
+	return limit
+}
+
+// limitBody reads the streamed request bodies, answering 413 to those over
+// the default limit, or over the upload limit for attachment uploads. It goes
+// before anything that reads bodies, after paths are rewritten.
+func limitBody(maxAttachmentSize int64) fiber.Handler {
+	upload := uploadLimit(maxAttachmentSize)
+	return func(c *fiber.Ctx) error {
+		request := c.Request()
+		if !request.IsBodyStream() {
+			return c.Next()
+		}
+		limit := fiber.DefaultBodyLimit
+		if c.Method() == fiber.MethodPost && uploadPath.MatchString(c.Path()) {
+			limit = upload
+		}
+		if request.Header.ContentLength() > limit {
+			c.Context().SetConnectionClose()
+			return fiber.ErrRequestEntityTooLarge
+		}
+		body, err := io.ReadAll(io.LimitReader(request.BodyStream(), int64(limit)+1))
+		if err != nil {
+			c.Context().SetConnectionClose()
+			return fiber.NewError(fiber.StatusBadRequest, "the request body can't be read")
+		}
+		if len(body) > limit {
+			c.Context().SetConnectionClose()
+			return fiber.ErrRequestEntityTooLarge
+		}
+		request.SetBody(body)
+		return c.Next()
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLimitBody(t *testing.T) {
+	const maxAttachmentSize = 6 << 20
+	app := fiber.New(fiber.Config{StreamRequestBody: true, DisablePreParseMultipartForm: true, DisableStartupMessage: true})
+	app.Use(limitBody(maxAttachmentSize))
+	app.Post("/api/todos", func(c *fiber.Ctx) error {
+		return c.SendString(strconv.Itoa(len(c.Body())))
+	})
+	app.Post("/api/todos/:id/attachments", func(c *fiber.Ctx) error {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		return c.SendString(strconv.FormatInt(header.Size, 10))
+	})
+	app.Post("/api/todos/:id/attachments/:attachmentId", func(c *fiber.Ctx) error {
+		return c.SendString(strconv.Itoa(len(c.Body())))
+	})
+	// app.Test can't send chunked bodies, so the app listens for real
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(listener)
+	defer app.Shutdown()
+	addr := listener.Addr().String()
+
+	t.Run("should read bodies under the limits", func(t *testing.T) {
+		body := new(bytes.Buffer)
+		form := multipart.NewWriter(body)
+		file, _ := form.CreateFormFile("file", "notes.txt")
+		file.Write(bytes.Repeat([]byte("a"), fiber.DefaultBodyLimit+1))
+		form.Close()
+		tests := []struct {
+			url         string
+			contentType string
+			body        []byte
+			expect      int
+		}{
+			{"/api/todos", fiber.MIMEApplicationJSON, []byte(`{"title":"hi"}`), 14},
+			{"/api/todos/1/attachments", form.FormDataContentType(), body.Bytes(), fiber.DefaultBodyLimit + 1},
+		}
+		for _, test := range tests {
+			res, err := http.Post("http://"+addr+test.url, test.contentType, bytes.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			read, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			if res.StatusCode != 200 || string(read) != strconv.Itoa(test.expect) {
+				t.Errorf("Expected %s to read %d bytes, got status code %d and %s", test.url, test.expect, res.StatusCode, read)
+			}
+		}
+	})
+
+	t.Run("should refuse bodies over the limits from their length", func(t *testing.T) {
+		tests := []struct {
+			url    string
+			length int
+		}{
+			{"/api/todos", fiber.DefaultBodyLimit + 1},
+			{"/api/todos/1/attachments/2", fiber.DefaultBodyLimit + 1},
+			{"/api/todos/1/attachments", maxAttachmentSize + 64<<10 + 1},
+		}
+		for _, test := range tests {
+			// only the start of the body is sent, as the rest is refused
+			// without being read
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			fmt.Fprintf(conn, "POST %s HTTP/1.1\r\nHost: %s\r\nContent-Length: %d\r\n\r\n", test.url, addr, test.length)
+			conn.Write(bytes.Repeat([]byte("a"), 16<<10))
+			res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			conn.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != 413 {
+				t.Errorf("Expected %s to refuse %d bytes, got status code %d", test.url, test.length, res.StatusCode)
+			}
+		}
+	})
+
+	t.Run("should refuse chunked bodies over the limit", func(t *testing.T) {
+		// a reader of unknown size is sent chunked
+		body := io.MultiReader(bytes.NewReader(bytes.Repeat([]byte("a"), fiber.DefaultBodyLimit+1)))
+		res, err := http.Post("http://"+addr+"/api/todos", fiber.MIMEApplicationJSON, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 413 {
+			t.Errorf("Expected status code 413, got %d", res.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/attachment"
+	"github.com/raphael-foliveira/fiber-todo/pkg/cache"
+	"github.com/raphael-foliveira/fiber-todo/pkg/collab"
+	"github.com/raphael-foliveira/fiber-todo/pkg/consistency"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/notification"
+	"github.com/raphael-foliveira/fiber-todo/pkg/ratelimit"
+)
+
+// serverConfig holds the settings read from the environment at startup
+type serverConfig struct {
+	rateLimit       ratelimit.Config
+	todoQuota       int
+	authRequired    bool
+	bootstrapApiKey string
+	grpcAddr        string
+	readYourWrites  consistency.Config
+	// cache caches todo reads, nil when caching is off
+	cache         *cache.Cache
+	attachments   attachment.Config
+	notifications notification.Config
+	collab        collab.Config
+}
+
+func loadConfig(db *database.Database) (serverConfig, error) {
+	rateLimit, err := ratelimit.ConfigFromEnv(db)
+	if err != nil {
+		return serverConfig{}, err
+	}
+	todoQuota, err := ratelimit.QuotaFromEnv()
+	if err != nil {
+		return serverConfig{}, err
+	}
+	authRequired := false
+	if value := os.Getenv("AUTH_REQUIRED"); value != "" {
+		authRequired, err = strconv.ParseBool(value)
+		if err != nil {
+			return serverConfig{}, fmt.Errorf("invalid AUTH_REQUIRED %q", value)
+		}
+	}
+	readYourWrites, err := consistency.ConfigFromEnv()
+	if err != nil {
+		return serverConfig{}, err
+	}
+	todoCache, err := cache.FromEnv()
+	if err != nil {
+		return serverConfig{}, err
+	}
+	attachments, err := attachment.ConfigFromEnv()
+	if err != nil {
+		return serverConfig{}, err
+	}
+	notifications, err := notification.ConfigFromEnv()
+	if err != nil {
+		return serverConfig{}, err
+	}
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":50051"
+	}
+	return serverConfig{
+		rateLimit:       rateLimit,
+		todoQuota:       todoQuota,
+		authRequired:    authRequired,
+		bootstrapApiKey: os.Getenv("BOOTSTRAP_API_KEY"),
+		grpcAddr:        grpcAddr,
+		readYourWrites:  readYourWrites,
+		cache:           todoCache,
+		attachments:     attachments,
+		notifications:   notifications,
+		collab:          collab.ConfigFromEnv(),
+	}, nil
+}
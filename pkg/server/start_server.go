@@ -1,42 +1,223 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/swagger"
+	"github.com/raphael-foliveira/fiber-todo/pkg/attachment"
+	"github.com/raphael-foliveira/fiber-todo/pkg/auth"
+	"github.com/raphael-foliveira/fiber-todo/pkg/cache"
+	"github.com/raphael-foliveira/fiber-todo/pkg/collab"
+	"github.com/raphael-foliveira/fiber-todo/pkg/comment"
 	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/consistency"
 	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/graph"
+	"github.com/raphael-foliveira/fiber-todo/pkg/ical"
+	"github.com/raphael-foliveira/fiber-todo/pkg/idempotency"
+	"github.com/raphael-foliveira/fiber-todo/pkg/job"
+	"github.com/raphael-foliveira/fiber-todo/pkg/list"
+	"github.com/raphael-foliveira/fiber-todo/pkg/notification"
+	"github.com/raphael-foliveira/fiber-todo/pkg/org"
+	"github.com/raphael-foliveira/fiber-todo/pkg/ratelimit"
+	"github.com/raphael-foliveira/fiber-todo/pkg/rpc"
+	"github.com/raphael-foliveira/fiber-todo/pkg/sharing"
+	"github.com/raphael-foliveira/fiber-todo/pkg/stats"
+	"github.com/raphael-foliveira/fiber-todo/pkg/stream"
 	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+	"github.com/raphael-foliveira/fiber-todo/pkg/user"
+	"github.com/raphael-foliveira/fiber-todo/pkg/webhook"
 )
 
 // StartServer starts the server and adds the routes
 func StartServer(db *database.Database) {
 	fmt.Println("Starting server...")
+	config, err := loadConfig(db)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
 	app := fiber.New(fiber.Config{
 		ErrorHandler: errorHandler,
+		// bodies are read by limitBody, which knows which routes take
+		// larger ones than the default limit
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
 	})
 	app.Use(recover.New())
 	app.Use(cors.New())
 	app.Use(logger.New())
-	startRoutes(app, db)
+	workers := startRoutes(app, db, config)
+	// log.Fatalf skips deferred calls, so the workers are stopped explicitly
+	// before exiting
+	for i, w := range workers {
+		if err := w.Start(); err != nil {
+			stopWorkers(workers[:i])
+			log.Fatalf("error starting worker: %s", err)
+		}
+	}
+	go shutdownOnSignal(app)
 
-	err := app.Listen(":3000")
+	err = app.Listen(":3000")
+	stopWorkers(workers)
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
 }
 
-// startRoutes starts the routes for the application
-func startRoutes(app *fiber.App, db *database.Database) {
+// shutdownOnSignal stops the server on SIGINT or SIGTERM, letting the requests
+// in flight finish, so Listen returns and the workers are stopped
+func shutdownOnSignal(app *fiber.App) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	fmt.Println("Shutting down...")
+	if err := app.Shutdown(); err != nil {
+		fmt.Println("error shutting down:", err)
+	}
+}
+
+// stopWorkers stops the workers in the reverse order they were started in
+func stopWorkers(workers []worker) {
+	for i := len(workers) - 1; i >= 0; i-- {
+		workers[i].Stop()
+	}
+}
+
+// worker is a background process owned by a module
+type worker interface {
+	Start() error
+	Stop()
+}
+
+// startRoutes starts the routes for the application and returns the workers
+// the modules need running alongside them
+func startRoutes(app *fiber.App, db *database.Database, config serverConfig) []worker {
 	app.Get("/", common.StatusCheck)
 	app.Get("/docs/*", swagger.HandlerDefault)
+	app.Use(org.RewritePath)
+	app.Use(limitBody(config.attachments.MaxSize))
+	bus := events.NewBus()
 	apiRoutes := app.Group("/api")
+	authModule := auth.New(db)
+	if config.bootstrapApiKey != "" {
+		if err := auth.Bootstrap(authModule.Repository, config.bootstrapApiKey); err != nil {
+			log.Fatalf("error creating bootstrap API key: %s", err)
+		}
+	}
+	// the limiter runs before authentication so requests with invalid keys
+	// are throttled too, which keys it by client IP
+	if config.rateLimit.Store != nil {
+		apiRoutes.Use(ratelimit.New(config.rateLimit))
+	}
+	apiRoutes.Use(auth.Authenticate(authModule.Repository, config.authRequired))
+	orgModule := org.New(db, bus)
+	apiRoutes.Use(org.Scope(orgModule.Repository))
+	if db.Replicas != nil && config.readYourWrites.Window > 0 {
+		apiRoutes.Use(consistency.New(config.readYourWrites))
+	}
+	idempotencyStore := idempotency.NewPostgresStore(db)
+	apiRoutes.Use(idempotency.New(idempotencyStore, idempotency.DefaultConfig))
+	sharingModule := sharing.New(db)
 	todoRoutes := apiRoutes.Group("/todos")
-	todoModule := todo.New(db)
+	todoModule := todo.New(db, bus, config.cache, sharingModule.Authorizer, config.todoQuota)
+	if config.cache != nil {
+		invalidateTodos := cache.Invalidate(config.cache, func(c *fiber.Ctx) string {
+			return todo.CacheScope(common.GetOrgId(c))
+		})
+		// lists and shares decide which todos are visible, and comments are
+		// counted in todos, so changing them changes cached todos
+		apiRoutes.Use([]string{"/lists", "/invitations", "/shares"}, invalidateTodos)
+		todoRoutes.Post("/:id/comments", invalidateTodos)
+		todoRoutes.Put("/:id/comments/:commentId", invalidateTodos)
+		todoRoutes.Delete("/:id/comments/:commentId", invalidateTodos)
+		cache.GetCacheRoutes(apiRoutes.Group("/cache"), cache.NewCacheController(config.cache))
+	}
+	streamModule := stream.New(db, bus, org.EventFilter, sharingModule.Authorizer.EventFilter)
+	stream.GetStreamRoutes(todoRoutes, streamModule.Controller)
+	sharing.GuardTodoRoutes(todoRoutes, sharingModule.Authorizer)
 	todo.GetTodoRoutes(todoRoutes, todoModule.Controller)
+	webhookModule := webhook.New(db, bus)
+	webhook.GetWebhookRoutes(apiRoutes.Group("/webhooks", org.RequireAdmin(orgModule.Repository)), webhookModule.Controller)
+	auth.GetApiKeyRoutes(apiRoutes.Group("/keys"), authModule.Controller)
+	org.GetOrgRoutes(apiRoutes.Group("/orgs"), orgModule.Controller)
+	userModule := user.New(db)
+	user.GetUserRoutes(apiRoutes.Group("/users"), userModule.Controller)
+	notificationModule := notification.New(db, bus, todoModule.Repository, config.notifications)
+	notification.GetNotificationRoutes(apiRoutes.Group("/notifications"), notificationModule.Controller)
+	commentModule := comment.New(db, todoModule.Repository, userModule.Repository, sharingModule.Authorizer, notificationModule.Notifier)
+	comment.GetCommentRoutes(todoRoutes, commentModule.Controller)
+	attachmentModule := attachment.New(db, todoModule.Repository, config.attachments)
+	attachment.GetAttachmentRoutes(todoRoutes, attachmentModule.Controller)
+	listRoutes := apiRoutes.Group("/lists")
+	listModule := list.New(db)
+	sharing.GuardListRoutes(listRoutes, sharingModule.Authorizer)
+	list.GetListRoutes(listRoutes, listModule.Controller)
+	icalModule := ical.New(db, todoModule.Repository, listModule.Repository, sharingModule.Authorizer, bus)
+	ical.GetIcalRoutes(apiRoutes, icalModule.Controller)
+	sharing.GetSharingRoutes(apiRoutes, sharingModule.Controller)
+	statsModule := stats.New(db)
+	stats.GetStatsRoutes(apiRoutes.Group("/stats"), statsModule.Controller)
+	collabModule := collab.New(streamModule.Hub, listModule.Repository, sharingModule.Authorizer, config.collab)
+	collab.GetCollabRoutes(apiRoutes.Group("/collab"), collabModule.Controller)
+	// /graphql sits outside /api because its operations, not its methods,
+	// decide which scope they need
+	graphRoutes := app.Group("/graphql")
+	if config.rateLimit.Store != nil {
+		graphRoutes.Use(ratelimit.New(config.rateLimit))
+	}
+	graphRoutes.Use(auth.Identify(authModule.Repository, config.authRequired), org.Scope(orgModule.Repository))
+	graphModule := graph.New(todoModule.Repository, listModule.Repository, userModule.Repository, sharingModule.Authorizer, bus, streamModule.Hub)
+	graph.GetGraphRoutes(graphRoutes, graphModule.Controller)
+	rpcModule := rpc.New(rpc.Config{
+		Addr:         config.grpcAddr,
+		AuthRequired: config.authRequired,
+		RateLimit:    config.rateLimit,
+	}, authModule.Repository, orgModule.Repository, todoModule.Repository, sharingModule.Authorizer, bus, streamModule)
+	jobModule := job.New(db)
+	job.GetJobRoutes(apiRoutes.Group("/jobs"), jobModule.Controller)
+	jobs := []job.Job{
+		{Name: "notification.remind", Schedule: "* * * * *", Singleton: true, Handler: func(ctx context.Context, payload json.RawMessage) error {
+			_, err := notificationModule.Reminder.Remind()
+			return err
+		}},
+		{Name: "org.retention", Schedule: "@hourly", Singleton: true, Handler: func(ctx context.Context, payload json.RawMessage) error {
+			return orgModule.Retention.RunOnce()
+		}},
+		{Name: "idempotency.purge", Schedule: "@hourly", Handler: func(ctx context.Context, payload json.RawMessage) error {
+			_, err := idempotencyStore.Purge()
+			return err
+		}},
+		{Name: "attachment.collect", Schedule: "@hourly", Handler: func(ctx context.Context, payload json.RawMessage) error {
+			_, err := attachmentModule.Collector.Collect()
+			return err
+		}},
+	}
+	for _, j := range jobs {
+		if err := jobModule.Scheduler.Register(j); err != nil {
+			log.Fatalf("error registering job: %s", err)
+		}
+	}
+	workers := []worker{
+		webhookModule.Dispatcher,
+		streamModule.Relay,
+		collabModule.Forwarder,
+		rpcModule.Listener,
+		notificationModule.Dispatcher,
+		jobModule.Scheduler,
+	}
+	if db.Replicas != nil {
+		workers = append(workers, db.Replicas)
+	}
+	return workers
 }
@@ -0,0 +1,191 @@
+package sharing
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/stream"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+// Authorizer decides what callers may do with todos and lists. Its guards are
+// registered in front of the todo and list routes, so the controllers behind
+// them only run for callers with enough rights.
+type Authorizer struct {
+	repository ISharingRepository
+}
+
+func NewAuthorizer(repository ISharingRepository) *Authorizer {
+	return &Authorizer{repository: repository}
+}
+
+// TodoRole returns the role of the principal on the todo, or sql.ErrNoRows
+// when it doesn't exist
+func (a *Authorizer) TodoRole(principal *common.Principal, id int) (Role, error) {
+	access, err := a.repository.TodoAccess(id, common.UserIdOf(principal))
+	if err != nil {
+		return RoleNone, err
+	}
+	return access.RoleOf(principal), nil
+}
+
+// ListRole returns the role of the principal on the list, or sql.ErrNoRows
+// when it doesn't exist
+func (a *Authorizer) ListRole(principal *common.Principal, id int) (Role, error) {
+	access, err := a.repository.ListAccess(id, common.UserIdOf(principal))
+	if err != nil {
+		return RoleNone, err
+	}
+	return access.RoleOf(principal), nil
+}
+
+// ResourceRole returns the role of the principal on the todo or list
+func (a *Authorizer) ResourceRole(principal *common.Principal, resource Resource) (Role, error) {
+	if resource.TodoId != nil {
+		return a.TodoRole(principal, *resource.TodoId)
+	}
+	return a.ListRole(principal, *resource.ListId)
+}
+
+// ForbiddenError is returned by Require when the principal has less than the
+// role needed on the resource
+type ForbiddenError struct {
+	Role Role
+	Name string
+	Id   int
+}
+
+func (e *ForbiddenError) Error() string {
+	return fmt.Sprintf("%s role required on %s %d", e.Role, e.Name, e.Id)
+}
+
+// Require returns a *ForbiddenError when the principal has less than the role
+// on the todo or list. Resources that don't exist pass, leaving the caller to
+// answer for them as it would without the check.
+func (a *Authorizer) Require(principal *common.Principal, role Role, resource Resource) error {
+	name, id := "list", resource.ListId
+	if resource.TodoId != nil {
+		name, id = "todo", resource.TodoId
+	}
+	actual, err := a.ResourceRole(principal, resource)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !actual.AtLeast(role) {
+		return &ForbiddenError{Role: role, Name: name, Id: *id}
+	}
+	return nil
+}
+
+// CanSee reports whether the principal may see the todo. It also works for
+// todos that were just deleted, going by the owner and list they had.
+func (a *Authorizer) CanSee(principal *common.Principal, t todo.Todo) bool {
+	if principal.Service() || (t.OwnerId == nil && t.ListId == nil) {
+		return true
+	}
+	role, err := a.TodoRole(principal, t.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		role, err = a.ownerAndListRole(principal, t)
+	}
+	if err != nil {
+		fmt.Println("error checking todo access:", err)
+		return false
+	}
+	return role != RoleNone
+}
+
+// CanAssign tells whether the user can be assigned the todo, that is whether
+// they will see it as it is about to be saved. It goes by the owner and list
+// of the todo, like CanSee does for deleted todos.
+func (a *Authorizer) CanAssign(userId int, t todo.Todo) (bool, error) {
+	role, err := a.ownerAndListRole(&common.Principal{UserId: &userId}, t)
+	return role.AtLeast(RoleViewer), err
+}
+
+// ownerAndListRole works out the role of the principal on the todo from its
+// owner and list alone, for todos that aren't stored as they are
+func (a *Authorizer) ownerAndListRole(principal *common.Principal, t todo.Todo) (Role, error) {
+	access := &Access{Owners: []int{}}
+	if t.ListId != nil {
+		listAccess, err := a.repository.ListAccess(*t.ListId, common.UserIdOf(principal))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return RoleNone, err
+		}
+		if err == nil {
+			access = listAccess
+		}
+	}
+	if t.OwnerId != nil {
+		access.Owners = append(access.Owners, *t.OwnerId)
+	}
+	return access.RoleOf(principal), nil
+}
+
+// EventFilter is a stream.Filter that only lets through events about todos
+// the caller may see
+func (a *Authorizer) EventFilter(c *fiber.Ctx) func(event stream.StoredEvent) bool {
+	principal := common.GetPrincipal(c)
+	return func(event stream.StoredEvent) bool {
+		var t todo.Todo
+		if err := json.Unmarshal(event.Data, &t); err != nil {
+			return principal.Service()
+		}
+		return a.CanSee(principal, t)
+	}
+}
+
+// RequireTodo refuses with 403 callers that have less than the role on the
+// todo in the :id param. Requests it can't judge, for malformed or unknown
+// ids, are passed on for the handler to answer.
+func (a *Authorizer) RequireTodo(role Role) fiber.Handler {
+	return a.require(role, func(id int) Resource { return Resource{TodoId: &id} })
+}
+
+// RequireList is RequireTodo for the list in the :id param
+func (a *Authorizer) RequireList(role Role) fiber.Handler {
+	return a.require(role, func(id int) Resource { return Resource{ListId: &id} })
+}
+
+func (a *Authorizer) require(role Role, resource func(id int) Resource) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := common.ParseIdFromParams(c)
+		if err != nil {
+			return c.Next()
+		}
+		return a.check(c, role, resource(id))
+	}
+}
+
+// RequireTargetList refuses with 403 callers that have less than the role on
+// the list a todo body puts the todo in
+func (a *Authorizer) RequireTargetList(role Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body struct {
+			ListId *int `json:"list_id"`
+		}
+		if err := c.BodyParser(&body); err != nil || body.ListId == nil {
+			return c.Next()
+		}
+		return a.check(c, role, Resource{ListId: body.ListId})
+	}
+}
+
+func (a *Authorizer) check(c *fiber.Ctx, role Role, resource Resource) error {
+	err := a.Require(common.GetPrincipal(c), role, resource)
+	var forbidden *ForbiddenError
+	if errors.As(err, &forbidden) {
+		return fiber.NewError(fiber.StatusForbidden, forbidden.Error())
+	}
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Next()
+}
@@ -0,0 +1,238 @@
+package sharing
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+const invitationTtl = 7 * 24 * time.Hour
+
+type SharingController struct {
+	repository ISharingRepository
+	authorizer *Authorizer
+}
+
+func NewSharingController(repository ISharingRepository, authorizer *Authorizer) *SharingController {
+	return &SharingController{repository: repository, authorizer: authorizer}
+}
+
+// @Invite godoc
+// @Summary Invite someone to a To Do or list
+// @Description Create an invitation to share a To Do or a list, given by exactly one of todo_id and list_id, with whoever owns the email. Only owners can invite. The token is only ever returned by this call and expires after a week.
+// @Tags Sharing
+// @Accept json
+// @Produce json
+// @Param invitation body CreateInvitationDto true "Invitation Create"
+// @Success 201 {object} CreateInvitationResponse
+// @Failure 400 {object} string "Bad Request"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /invitations [post]
+func (sc *SharingController) Invite(c *fiber.Ctx) error {
+	var dto CreateInvitationDto
+	if err := c.BodyParser(&dto); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "bad request body")
+	}
+	if err := validateInvitation(dto); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	principal := common.GetPrincipal(c)
+	if err := sc.requireOwner(principal, dto.Resource); err != nil {
+		return err
+	}
+	token, hash, err := newToken()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	invitation, err := sc.repository.CreateInvitation(dto, hash, common.UserIdOf(principal), time.Now().Add(invitationTtl))
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusCreated).JSON(CreateInvitationResponse{Invitation: *invitation, Token: token})
+}
+
+// @AcceptInvitation godoc
+// @Summary Accept an invitation
+// @Description Accept an invitation sent to the email of the calling user, sharing its To Do or list with them
+// @Tags Sharing
+// @Accept json
+// @Produce json
+// @Param invitation body AcceptInvitationDto true "Invitation Accept"
+// @Success 200 {object} Share
+// @Failure 400 {object} string "Bad Request"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /invitations/accept [post]
+func (sc *SharingController) AcceptInvitation(c *fiber.Ctx) error {
+	var dto AcceptInvitationDto
+	if err := c.BodyParser(&dto); err != nil || dto.Token == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "bad request body")
+	}
+	userId := common.UserIdOf(common.GetPrincipal(c))
+	if userId == nil {
+		return fiber.NewError(fiber.StatusForbidden, "only users can accept invitations")
+	}
+	share, err := sc.repository.AcceptInvitation(hashToken(dto.Token), *userId)
+	switch {
+	case errors.Is(err, ErrInvitationNotFound):
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, ErrWrongRecipient):
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	case err != nil:
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(share)
+}
+
+// @Shares godoc
+// @Summary List who a To Do or list is shared with
+// @Description List the shares of a To Do or a list, given by exactly one of todo_id and list_id. Only owners can see them.
+// @Tags Sharing
+// @Produce json
+// @Param todo_id query int false "To Do ID"
+// @Param list_id query int false "List ID"
+// @Success 200 {array} Share
+// @Failure 400 {object} string "Bad Request"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /shares [get]
+func (sc *SharingController) Shares(c *fiber.Ctx) error {
+	resource, err := parseResourceFromQuery(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err := sc.requireOwner(common.GetPrincipal(c), resource); err != nil {
+		return err
+	}
+	shares, err := sc.repository.Shares(resource)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(shares)
+}
+
+// @Unshare godoc
+// @Summary Remove a share
+// @Description Stop sharing a To Do or list with a user. Owners can remove any share of their resources, and users can remove their own.
+// @Tags Sharing
+// @Param id path int true "Share ID"
+// @Success 204 "No Content"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /shares/{id} [delete]
+func (sc *SharingController) Unshare(c *fiber.Ctx) error {
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	share, err := sc.repository.RetrieveShare(id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	principal := common.GetPrincipal(c)
+	if userId := common.UserIdOf(principal); userId == nil || *userId != share.UserId {
+		if err := sc.requireOwner(principal, share.Resource); err != nil {
+			return err
+		}
+	}
+	if _, err := sc.repository.DeleteShare(share.Id); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// @Shared godoc
+// @Summary List what is shared with the caller
+// @Description List the To Dos and lists shared with the calling user, with their titles
+// @Tags Sharing
+// @Produce json
+// @Success 200 {array} SharedItem
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /shared [get]
+func (sc *SharingController) Shared(c *fiber.Ctx) error {
+	userId := common.UserIdOf(common.GetPrincipal(c))
+	if userId == nil {
+		return c.Status(fiber.StatusOK).JSON([]SharedItem{})
+	}
+	items, err := sc.repository.SharedWith(*userId)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(items)
+}
+
+func (sc *SharingController) requireOwner(principal *common.Principal, resource Resource) error {
+	role, err := sc.authorizer.ResourceRole(principal, resource)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	if role != RoleOwner {
+		return fiber.NewError(fiber.StatusForbidden, "owner role required")
+	}
+	return nil
+}
+
+func validateInvitation(dto CreateInvitationDto) error {
+	if !dto.Resource.Valid() {
+		return fmt.Errorf("exactly one of todo_id and list_id is required")
+	}
+	if _, err := mail.ParseAddress(dto.Email); err != nil {
+		return fmt.Errorf("a valid email is required")
+	}
+	if dto.Role.rank() == 0 {
+		return fmt.Errorf("unknown role %q", dto.Role)
+	}
+	return nil
+}
+
+func parseResourceFromQuery(c *fiber.Ctx) (Resource, error) {
+	var resource Resource
+	for name, target := range map[string]**int{"todo_id": &resource.TodoId, "list_id": &resource.ListId} {
+		if value := c.Query(name); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				return resource, fmt.Errorf("invalid %s", name)
+			}
+			*target = &id
+		}
+	}
+	if !resource.Valid() {
+		return resource, fmt.Errorf("exactly one of todo_id and list_id is required")
+	}
+	return resource, nil
+}
+
+func newToken() (token string, hash string, err error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
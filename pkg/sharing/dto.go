@@ -0,0 +1,18 @@
+package sharing
+
+type CreateInvitationDto struct {
+	Resource
+	Email string `json:"email"`
+	Role  Role   `json:"role" swaggertype:"string" enums:"viewer,editor,owner"`
+}
+
+// CreateInvitationResponse is the only response that includes the token the
+// invited user accepts the invitation with
+type CreateInvitationResponse struct {
+	Invitation
+	Token string `json:"token"`
+}
+
+type AcceptInvitationDto struct {
+	Token string `json:"token"`
+}
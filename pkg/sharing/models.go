@@ -0,0 +1,98 @@
+package sharing
+
+import (
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+type Role string
+
+const (
+	RoleNone   Role = ""
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleOwner  Role = "owner"
+)
+
+var Roles = []Role{RoleViewer, RoleEditor, RoleOwner}
+
+func (r Role) rank() int {
+	for i, role := range Roles {
+		if role == r {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// AtLeast reports whether the role grants everything other does
+func (r Role) AtLeast(other Role) bool {
+	return r.rank() >= other.rank()
+}
+
+// Resource is what a share or invitation is for: either a todo or a list
+type Resource struct {
+	TodoId *int `json:"todo_id"`
+	ListId *int `json:"list_id"`
+}
+
+func (r Resource) Valid() bool {
+	return (r.TodoId == nil) != (r.ListId == nil)
+}
+
+type Share struct {
+	Id int `json:"id"`
+	Resource
+	UserId    int       `json:"user_id"`
+	Role      Role      `json:"role" swaggertype:"string" enums:"viewer,editor,owner"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SharedItem is a share along with the title of the todo or name of the list
+type SharedItem struct {
+	Share
+	Title string `json:"title"`
+}
+
+type Invitation struct {
+	Id int `json:"id"`
+	Resource
+	Email      string     `json:"email"`
+	Role       Role       `json:"role" swaggertype:"string" enums:"viewer,editor,owner"`
+	InvitedBy  *int       `json:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Access holds what decides the role of a user on a todo or list
+type Access struct {
+	// Owners are the owners of the resource and, for a todo, of its list
+	Owners []int
+	// Grants are the roles shared with the user, directly or through the list
+	Grants []Role
+}
+
+// RoleOf works out the role of the principal. Resources nobody owns are open
+// to everyone, as they were before sharing existed, and service keys are
+// owners of everything.
+func (a *Access) RoleOf(principal *common.Principal) Role {
+	if principal.Service() || len(a.Owners) == 0 {
+		return RoleOwner
+	}
+	userId := common.UserIdOf(principal)
+	if userId == nil {
+		return RoleNone
+	}
+	if common.Contains(a.Owners, *userId) {
+		return RoleOwner
+	}
+	role := RoleNone
+	for _, grant := range a.Grants {
+		if grant.rank() > role.rank() {
+			role = grant
+		}
+	}
+	return role
+}
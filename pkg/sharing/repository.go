@@ -0,0 +1,227 @@
+package sharing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+)
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found, expired or already accepted")
+	ErrWrongRecipient     = errors.New("invitation was sent to another email")
+)
+
+type ISharingRepository interface {
+	TodoAccess(id int, userId *int) (*Access, error)
+	ListAccess(id int, userId *int) (*Access, error)
+	Shares(resource Resource) ([]Share, error)
+	RetrieveShare(id int) (*Share, error)
+	DeleteShare(id int) (int64, error)
+	SharedWith(userId int) ([]SharedItem, error)
+	CreateInvitation(invitation CreateInvitationDto, hash string, invitedBy *int, expiresAt time.Time) (*Invitation, error)
+	AcceptInvitation(hash string, userId int) (*Share, error)
+}
+
+type SharingRepository struct {
+	Db *database.Database
+}
+
+func NewSharingRepository(db *database.Database) *SharingRepository {
+	return &SharingRepository{Db: db}
+}
+
+const (
+	shareColumns      = "id, todo_id, list_id, user_id, role, created_at"
+	invitationColumns = "id, todo_id, list_id, email, role, invited_by, expires_at, accepted_at, created_at"
+)
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanShare(row scanner, extra ...any) (*Share, error) {
+	var share Share
+	dest := append([]any{&share.Id, &share.TodoId, &share.ListId, &share.UserId, &share.Role, &share.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+func scanInvitation(row scanner) (*Invitation, error) {
+	var invitation Invitation
+	err := row.Scan(&invitation.Id, &invitation.TodoId, &invitation.ListId, &invitation.Email, &invitation.Role,
+		&invitation.InvitedBy, &invitation.ExpiresAt, &invitation.AcceptedAt, &invitation.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// scanAccess reads a row of the given number of owner columns followed by
+// an array of roles
+func scanAccess(row scanner, owners int) (*Access, error) {
+	ownerIds := make([]*int, owners)
+	var roles []string
+	dest := []any{}
+	for i := range ownerIds {
+		dest = append(dest, &ownerIds[i])
+	}
+	if err := row.Scan(append(dest, pq.Array(&roles))...); err != nil {
+		return nil, err
+	}
+	access := &Access{Owners: []int{}, Grants: []Role{}}
+	for _, owner := range ownerIds {
+		if owner != nil {
+			access.Owners = append(access.Owners, *owner)
+		}
+	}
+	for _, role := range roles {
+		access.Grants = append(access.Grants, Role(role))
+	}
+	return access, nil
+}
+
+// TodoAccess returns the owners of the todo and its list, and the roles the
+// user was given on either of them
+func (sr *SharingRepository) TodoAccess(id int, userId *int) (*Access, error) {
+	row := sr.Db.QueryRow(`
+	SELECT todo.owner_id, todo_list.owner_id, ARRAY(
+		SELECT role FROM todo_share
+		WHERE todo_share.user_id = $2 AND (todo_share.todo_id = todo.id OR todo_share.list_id = todo.list_id)
+	)
+	FROM todo LEFT JOIN todo_list ON todo_list.id = todo.list_id
+	WHERE todo.id = $1
+	`, id, userId)
+	return scanAccess(row, 2)
+}
+
+func (sr *SharingRepository) ListAccess(id int, userId *int) (*Access, error) {
+	row := sr.Db.QueryRow(`
+	SELECT owner_id, ARRAY(
+		SELECT role FROM todo_share WHERE todo_share.user_id = $2 AND todo_share.list_id = todo_list.id
+	)
+	FROM todo_list WHERE id = $1
+	`, id, userId)
+	return scanAccess(row, 1)
+}
+
+func (sr *SharingRepository) Shares(resource Resource) ([]Share, error) {
+	rows, err := sr.Db.Query("SELECT "+shareColumns+" FROM todo_share WHERE todo_id = $1 OR list_id = $2 ORDER BY id",
+		resource.TodoId, resource.ListId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	shares := []Share{}
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, *share)
+	}
+	return shares, rows.Err()
+}
+
+func (sr *SharingRepository) RetrieveShare(id int) (*Share, error) {
+	return scanShare(sr.Db.QueryRow("SELECT "+shareColumns+" FROM todo_share WHERE id = $1", id))
+}
+
+func (sr *SharingRepository) DeleteShare(id int) (int64, error) {
+	result, err := sr.Db.Exec("DELETE FROM todo_share WHERE id = $1", id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SharedWith lists what was shared with the user, with the title of each todo
+// or name of each list
+func (sr *SharingRepository) SharedWith(userId int) ([]SharedItem, error) {
+	rows, err := sr.Db.Query(`
+	SELECT s.id, s.todo_id, s.list_id, s.user_id, s.role, s.created_at, COALESCE(todo.title, todo_list.name, '')
+	FROM todo_share s
+		LEFT JOIN todo ON todo.id = s.todo_id
+		LEFT JOIN todo_list ON todo_list.id = s.list_id
+	WHERE s.user_id = $1
+	ORDER BY s.id
+	`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SharedItem{}
+	for rows.Next() {
+		var title string
+		share, err := scanShare(rows, &title)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, SharedItem{Share: *share, Title: title})
+	}
+	return items, rows.Err()
+}
+
+func (sr *SharingRepository) CreateInvitation(invitation CreateInvitationDto, hash string, invitedBy *int, expiresAt time.Time) (*Invitation, error) {
+	row := sr.Db.QueryRow(`
+	INSERT INTO todo_invitation
+		(todo_id, list_id, email, role, token_hash, invited_by, expires_at)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7)
+	RETURNING `+invitationColumns, invitation.TodoId, invitation.ListId, strings.ToLower(invitation.Email),
+		invitation.Role, hash, invitedBy, expiresAt)
+	return scanInvitation(row)
+}
+
+// AcceptInvitation shares the resource of a pending invitation with the user,
+// replacing any role they had on it, provided the invitation was sent to the
+// user's email. The invitation can't be accepted again.
+func (sr *SharingRepository) AcceptInvitation(hash string, userId int) (*Share, error) {
+	var share *Share
+	err := sr.Db.WithTx(context.Background(), func(tx *database.Database) error {
+		invitation, err := scanInvitation(tx.QueryRow(`
+		SELECT `+invitationColumns+` FROM todo_invitation
+		WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > NOW()
+		FOR UPDATE
+		`, hash))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvitationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var email string
+		if err := tx.QueryRow("SELECT email FROM users WHERE id = $1", userId).Scan(&email); err != nil {
+			return err
+		}
+		if !strings.EqualFold(email, invitation.Email) {
+			return ErrWrongRecipient
+		}
+		_, err = tx.Exec("DELETE FROM todo_share WHERE user_id = $1 AND (todo_id = $2 OR list_id = $3)",
+			userId, invitation.TodoId, invitation.ListId)
+		if err != nil {
+			return err
+		}
+		share, err = scanShare(tx.QueryRow(`
+		INSERT INTO todo_share
+			(todo_id, list_id, user_id, role)
+		VALUES
+			($1, $2, $3, $4)
+		RETURNING `+shareColumns, invitation.TodoId, invitation.ListId, userId, invitation.Role))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE todo_invitation SET accepted_at = NOW() WHERE id = $1", invitation.Id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return share, nil
+}
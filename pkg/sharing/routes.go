@@ -0,0 +1,45 @@
+package sharing
+
+import "github.com/gofiber/fiber/v2"
+
+func GetSharingRoutes(router fiber.Router, controller *SharingController) fiber.Router {
+	router.Post("/invitations", controller.Invite)
+	router.Post("/invitations/accept", controller.AcceptInvitation)
+	router.Get("/shares", controller.Shares)
+	router.Delete("/shares/:id", controller.Unshare)
+	router.Get("/shared", controller.Shared)
+	return router
+}
+
+// GuardTodoRoutes registers the permission checks of the todo routes. It must
+// be called on the todo router before the todo routes are added.
+func GuardTodoRoutes(router fiber.Router, authorizer *Authorizer) fiber.Router {
+	router.Post("/", authorizer.RequireTargetList(RoleEditor))
+	router.Get("/:id", authorizer.RequireTodo(RoleViewer))
+	router.Put("/:id", authorizer.RequireTodo(RoleEditor), authorizer.RequireTargetList(RoleEditor))
+	router.Delete("/:id", authorizer.RequireTodo(RoleOwner))
+	router.Post("/:id/archive", authorizer.RequireTodo(RoleEditor))
+	router.Post("/:id/unarchive", authorizer.RequireTodo(RoleEditor))
+	router.Get("/:id/comments", authorizer.RequireTodo(RoleViewer))
+	router.Post("/:id/comments", authorizer.RequireTodo(RoleViewer))
+	router.Put("/:id/comments/:commentId", authorizer.RequireTodo(RoleViewer))
+	router.Delete("/:id/comments/:commentId", authorizer.RequireTodo(RoleViewer))
+	router.Get("/:id/attachments", authorizer.RequireTodo(RoleViewer))
+	router.Get("/:id/attachments/:attachmentId", authorizer.RequireTodo(RoleViewer))
+	router.Get("/:id/attachments/:attachmentId/content", authorizer.RequireTodo(RoleViewer))
+	router.Post("/:id/attachments", authorizer.RequireTodo(RoleEditor))
+	router.Delete("/:id/attachments/:attachmentId", authorizer.RequireTodo(RoleEditor))
+	return router
+}
+
+// GuardListRoutes registers the permission checks of the list routes. It must
+// be called on the list router before the list routes are added.
+func GuardListRoutes(router fiber.Router, authorizer *Authorizer) fiber.Router {
+	router.Get("/:id", authorizer.RequireList(RoleViewer))
+	router.Put("/:id", authorizer.RequireList(RoleEditor))
+	router.Delete("/:id", authorizer.RequireList(RoleOwner))
+	router.Get("/:id/todos", authorizer.RequireList(RoleViewer))
+	router.Post("/:id/archive", authorizer.RequireList(RoleEditor))
+	router.Post("/:id/unarchive", authorizer.RequireList(RoleEditor))
+	return router
+}
@@ -0,0 +1,20 @@
+package sharing
+
+import "github.com/raphael-foliveira/fiber-todo/pkg/database"
+
+type SharingModule struct {
+	Repository ISharingRepository
+	Authorizer *Authorizer
+	Controller *SharingController
+}
+
+func New(db *database.Database) *SharingModule {
+	repository := NewSharingRepository(db)
+	authorizer := NewAuthorizer(repository)
+	controller := NewSharingController(repository, authorizer)
+	return &SharingModule{
+		Repository: repository,
+		Authorizer: authorizer,
+		Controller: controller,
+	}
+}
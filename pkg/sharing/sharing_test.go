@@ -0,0 +1,235 @@
+package sharing
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type mockRepository struct {
+	todos       map[int]Access
+	lists       map[int]Access
+	invitations []CreateInvitationDto
+}
+
+func (mr *mockRepository) TodoAccess(id int, userId *int) (*Access, error) {
+	access, ok := mr.todos[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &access, nil
+}
+
+func (mr *mockRepository) ListAccess(id int, userId *int) (*Access, error) {
+	access, ok := mr.lists[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &access, nil
+}
+
+func (mr *mockRepository) Shares(resource Resource) ([]Share, error) {
+	return []Share{}, nil
+}
+
+func (mr *mockRepository) RetrieveShare(id int) (*Share, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (mr *mockRepository) DeleteShare(id int) (int64, error) {
+	return 0, nil
+}
+
+func (mr *mockRepository) SharedWith(userId int) ([]SharedItem, error) {
+	return []SharedItem{}, nil
+}
+
+func (mr *mockRepository) CreateInvitation(invitation CreateInvitationDto, hash string, invitedBy *int, expiresAt time.Time) (*Invitation, error) {
+	mr.invitations = append(mr.invitations, invitation)
+	return &Invitation{Id: len(mr.invitations), Resource: invitation.Resource, Email: invitation.Email, Role: invitation.Role}, nil
+}
+
+func (mr *mockRepository) AcceptInvitation(hash string, userId int) (*Share, error) {
+	return nil, ErrInvitationNotFound
+}
+
+func userPrincipal(id int) *common.Principal {
+	return &common.Principal{KeyId: 1, UserId: &id}
+}
+
+func TestRoleOf(t *testing.T) {
+	tests := []struct {
+		name      string
+		access    Access
+		principal *common.Principal
+		expect    Role
+	}{
+		{"unowned is open to anonymous callers", Access{}, nil, RoleOwner},
+		{"service keys own everything", Access{Owners: []int{1}}, &common.Principal{KeyId: 1}, RoleOwner},
+		{"owned is closed to anonymous callers", Access{Owners: []int{1}}, nil, RoleNone},
+		{"owner", Access{Owners: []int{1}}, userPrincipal(1), RoleOwner},
+		{"stranger", Access{Owners: []int{1}}, userPrincipal(2), RoleNone},
+		{"highest grant wins", Access{Owners: []int{1}, Grants: []Role{RoleViewer, RoleEditor}}, userPrincipal(2), RoleEditor},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if role := test.access.RoleOf(test.principal); role != test.expect {
+				t.Errorf("Expected role %q, got %q", test.expect, role)
+			}
+		})
+	}
+}
+
+func sharingTestsSetup(principal *common.Principal) (*fiber.App, *mockRepository) {
+	mr := &mockRepository{
+		todos: map[int]Access{
+			1: {Owners: []int{1}},
+			2: {Owners: []int{1}, Grants: []Role{RoleViewer}},
+			3: {Owners: []int{1}, Grants: []Role{RoleEditor}},
+		},
+		lists: map[int]Access{
+			1: {Owners: []int{1}, Grants: []Role{RoleViewer}},
+		},
+	}
+	authorizer := NewAuthorizer(mr)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		common.SetPrincipal(c, principal)
+		return c.Next()
+	})
+	todoRoutes := app.Group("/todos")
+	GuardTodoRoutes(todoRoutes, authorizer)
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	todoRoutes.Post("/", ok)
+	todoRoutes.Get("/:id", ok)
+	todoRoutes.Put("/:id", ok)
+	todoRoutes.Delete("/:id", ok)
+	todoRoutes.Post("/:id/comments", ok)
+	todoRoutes.Post("/:id/attachments", ok)
+	GetSharingRoutes(app, NewSharingController(mr, authorizer))
+	return app, mr
+}
+
+func TestGuards(t *testing.T) {
+	tests := []struct {
+		name         string
+		principal    *common.Principal
+		method       string
+		url          string
+		body         string
+		expectStatus int
+	}{
+		{"owner deletes", userPrincipal(1), "DELETE", "/todos/1", "", 200},
+		{"stranger reads", userPrincipal(2), "GET", "/todos/1", "", 403},
+		{"anonymous reads owned todo", nil, "GET", "/todos/1", "", 403},
+		{"viewer reads", userPrincipal(2), "GET", "/todos/2", "", 200},
+		{"viewer updates", userPrincipal(2), "PUT", "/todos/2", `{"title": "x"}`, 403},
+		{"editor updates", userPrincipal(2), "PUT", "/todos/3", `{"title": "x"}`, 200},
+		{"editor moves into viewed list", userPrincipal(2), "PUT", "/todos/3", `{"title": "x", "list_id": 1}`, 403},
+		{"editor deletes", userPrincipal(2), "DELETE", "/todos/3", "", 403},
+		{"viewer comments", userPrincipal(2), "POST", "/todos/2/comments", `{"body": "x"}`, 200},
+		{"stranger comments", userPrincipal(2), "POST", "/todos/1/comments", `{"body": "x"}`, 403},
+		{"viewer attaches", userPrincipal(2), "POST", "/todos/2/attachments", "", 403},
+		{"editor attaches", userPrincipal(2), "POST", "/todos/3/attachments", "", 200},
+		{"create in viewed list", userPrincipal(2), "POST", "/todos", `{"title": "x", "list_id": 1}`, 403},
+		{"unknown todo is left to the handler", userPrincipal(2), "GET", "/todos/9", "", 200},
+		{"service key", &common.Principal{KeyId: 1}, "DELETE", "/todos/1", "", 200},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app, _ := sharingTestsSetup(test.principal)
+			req, _ := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Errorf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestInvite(t *testing.T) {
+	tests := []struct {
+		name         string
+		principal    *common.Principal
+		body         string
+		expectStatus int
+	}{
+		{"owner invites", userPrincipal(1), `{"todo_id": 1, "email": "bob@example.com", "role": "editor"}`, 201},
+		{"editor invites", userPrincipal(2), `{"todo_id": 3, "email": "bob@example.com", "role": "viewer"}`, 403},
+		{"both todo and list", userPrincipal(1), `{"todo_id": 1, "list_id": 1, "email": "bob@example.com", "role": "viewer"}`, 400},
+		{"unknown role", userPrincipal(1), `{"todo_id": 1, "email": "bob@example.com", "role": "admin"}`, 400},
+		{"invalid email", userPrincipal(1), `{"todo_id": 1, "email": "bob", "role": "viewer"}`, 400},
+		{"unknown todo", userPrincipal(1), `{"todo_id": 9, "email": "bob@example.com", "role": "viewer"}`, 404},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app, mr := sharingTestsSetup(test.principal)
+			req, _ := http.NewRequest("POST", "/invitations", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Errorf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+			if created := test.expectStatus == 201; created != (len(mr.invitations) == 1) {
+				t.Errorf("Unexpected invitations %+v", mr.invitations)
+			}
+		})
+	}
+}
+
+func TestCanSee(t *testing.T) {
+	mr := &mockRepository{todos: map[int]Access{}, lists: map[int]Access{1: {Owners: []int{1}}}}
+	authorizer := NewAuthorizer(mr)
+	owner, listId := 1, 1
+	deleted := todo.Todo{Id: 5, ListId: &listId}
+	if !authorizer.CanSee(userPrincipal(1), deleted) {
+		t.Errorf("Expected the list owner to see the deleted todo")
+	}
+	if authorizer.CanSee(userPrincipal(2), deleted) || authorizer.CanSee(nil, todo.Todo{Id: 6, OwnerId: &owner}) {
+		t.Errorf("Expected the deleted todo to be hidden from others")
+	}
+	if !authorizer.CanSee(nil, todo.Todo{Id: 7}) {
+		t.Errorf("Expected public todos to be visible to everyone")
+	}
+}
+
+func TestCanAssign(t *testing.T) {
+	mr := &mockRepository{todos: map[int]Access{}, lists: map[int]Access{1: {Owners: []int{1}}}}
+	authorizer := NewAuthorizer(mr)
+	owner, listId := 2, 1
+	tests := []struct {
+		name   string
+		userId int
+		todo   todo.Todo
+		expect bool
+	}{
+		{"test assign to list owner", 1, todo.Todo{ListId: &listId, OwnerId: &owner}, true},
+		{"test assign to todo owner", 2, todo.Todo{ListId: &listId, OwnerId: &owner}, true},
+		{"test assign to stranger", 3, todo.Todo{ListId: &listId, OwnerId: &owner}, false},
+		{"test assign public todo", 3, todo.Todo{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ok, err := authorizer.CanAssign(test.userId, test.todo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != test.expect {
+				t.Errorf("Expected CanAssign to be %v", test.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+const (
+	// maxBuckets bounds the completion series a request can ask for
+	maxBuckets = 366
+	// defaultDays and defaultWeeks are how far back the completion series
+	// goes when from isn't given
+	defaultDays  = 30
+	defaultWeeks = 12
+)
+
+var bucketSizes = map[string]time.Duration{
+	BucketDay:  24 * time.Hour,
+	BucketWeek: 7 * 24 * time.Hour,
+}
+
+type StatsController struct {
+	repository IStatsRepository
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func NewStatsController(repository IStatsRepository) *StatsController {
+	return &StatsController{repository: repository, now: time.Now}
+}
+
+// @Get godoc
+// @Summary Get todo statistics
+// @Description Count open, completed and overdue todos, with the average time to complete them, as a whole, by list and by assignee. The completion series tells, for each day or week, how many of the todos created in it are completed; it covers the last 30 days or 12 weeks unless from is given. Todos created before creation times were recorded are only counted when from isn't given.
+// @Tags Stats
+// @Produce json
+// @Param from query string false "Only todos created at or after this time, as RFC 3339 or a date"
+// @Param to query string false "Only todos created before this time, as RFC 3339 or a date"
+// @Param bucket query string false "Completion series bucket, day (default) or week"
+// @Param include query string false "archived to include archived todos"
+// @Success 200 {object} Stats
+// @Failure 400 {object} string "Bad Request"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /stats [get]
+func (sc *StatsController) Get(c *fiber.Ctx) error {
+	filter := Filter{
+		OrgId:    common.GetOrgId(c),
+		Audience: common.AudienceOf(common.GetPrincipal(c)),
+	}
+	var err error
+	if filter.From, err = parseTime(c.Query("from")); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid from")
+	}
+	if filter.To, err = parseTime(c.Query("to")); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid to")
+	}
+	if filter.IncludeArchived, err = common.IncludeArchived(c); err != nil {
+		return err
+	}
+	bucket := c.Query("bucket", BucketDay)
+	size, ok := bucketSizes[bucket]
+	if !ok {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid bucket %q", bucket))
+	}
+	to := sc.now().UTC()
+	if filter.To != nil {
+		to = *filter.To
+	}
+	from := to.Add(-defaultDays * size)
+	if bucket == BucketWeek {
+		from = to.Add(-defaultWeeks * size)
+	}
+	if filter.From != nil {
+		from = *filter.From
+	}
+	if !from.Before(to) {
+		return fiber.NewError(fiber.StatusBadRequest, "from must be before to")
+	}
+	if to.Sub(from) > maxBuckets*size {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("the range spans more than %d buckets", maxBuckets))
+	}
+	breakdown, err := sc.repository.Breakdown(filter)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	completion, err := sc.repository.Completion(filter, bucket, from, to)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(Stats{
+		From:       filter.From,
+		To:         to,
+		Bucket:     bucket,
+		Breakdown:  *breakdown,
+		Completion: completion,
+	})
+}
+
+// parseTime reads an RFC 3339 time or a date, taken as midnight UTC. It
+// returns nil for an empty value.
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
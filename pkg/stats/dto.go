@@ -0,0 +1,19 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+// Filter picks the todos to report on
+type Filter struct {
+	OrgId int
+	common.Audience
+	// From and To, when set, only keep todos created in [From, To). Todos
+	// with no creation time are only kept when From is unset.
+	From *time.Time
+	To   *time.Time
+	// IncludeArchived keeps archived todos, which are left out otherwise
+	IncludeArchived bool
+}
@@ -0,0 +1,55 @@
+package stats
+
+import "time"
+
+const (
+	BucketDay  = "day"
+	BucketWeek = "week"
+)
+
+// Summary counts todos by state. AverageCompletionSeconds is the average
+// time completed todos took from creation to completion, nil when none can
+// tell.
+type Summary struct {
+	Open                     int      `json:"open"`
+	Completed                int      `json:"completed"`
+	Overdue                  int      `json:"overdue"`
+	AverageCompletionSeconds *float64 `json:"average_completion_seconds"`
+}
+
+// ListSummary is the summary of the todos in a list, or of those in none
+// for a nil ListId
+type ListSummary struct {
+	ListId *int `json:"list_id"`
+	Summary
+}
+
+// AssigneeSummary is the summary of the todos assigned to a user, or of the
+// unassigned ones for a nil AssigneeId
+type AssigneeSummary struct {
+	AssigneeId *int `json:"assignee_id"`
+	Summary
+}
+
+// Breakdown is the summary of the todos, split by list and by assignee
+type Breakdown struct {
+	Summary
+	ByList     []ListSummary     `json:"by_list"`
+	ByAssignee []AssigneeSummary `json:"by_assignee"`
+}
+
+// Bucket tells how many of the todos created in a day or week are completed
+type Bucket struct {
+	Start          time.Time `json:"start"`
+	Created        int       `json:"created"`
+	Completed      int       `json:"completed"`
+	CompletionRate float64   `json:"completion_rate"`
+}
+
+type Stats struct {
+	From   *time.Time `json:"from"`
+	To     time.Time  `json:"to"`
+	Bucket string     `json:"bucket"`
+	Breakdown
+	Completion []Bucket `json:"completion"`
+}
@@ -0,0 +1,108 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type IStatsRepository interface {
+	Breakdown(filter Filter) (*Breakdown, error)
+	Completion(filter Filter, bucket string, from time.Time, to time.Time) ([]Bucket, error)
+}
+
+type StatsRepository struct {
+	Db *database.Database
+}
+
+func NewStatsRepository(db *database.Database) *StatsRepository {
+	return &StatsRepository{Db: db}
+}
+
+// picked is the condition for a todo to be picked by a Filter, given as $1
+// to $6
+const picked = `todo.org_id = $3 AND ` + todo.Visible + `
+	AND ($4::timestamptz IS NULL OR todo.created_at >= $4)
+	AND ($5::timestamptz IS NULL OR todo.created_at < $5)
+	AND ($6 OR todo.archived_at IS NULL)`
+
+// Breakdown summarizes the todos as a whole, by list and by assignee in a
+// single pass. It reads from a replica when there is one, see
+// database.Reader.
+func (sr *StatsRepository) Breakdown(filter Filter) (*Breakdown, error) {
+	rows, err := sr.Db.Reader().Query(`
+	SELECT GROUPING(todo.list_id), GROUPING(todo.assignee_id), todo.list_id, todo.assignee_id,
+		COUNT(*) FILTER (WHERE todo.completed IS NOT TRUE),
+		COUNT(*) FILTER (WHERE todo.completed),
+		COUNT(*) FILTER (WHERE todo.completed IS NOT TRUE AND todo.due_date < NOW()),
+		EXTRACT(EPOCH FROM AVG(todo.completed_at - todo.created_at) FILTER (WHERE todo.completed))::float8
+	FROM todo
+	WHERE `+picked+`
+	GROUP BY GROUPING SETS ((), (todo.list_id), (todo.assignee_id))
+	ORDER BY 1, 2, 3, 4
+	`, filter.All, filter.UserId, filter.OrgId, filter.From, filter.To, filter.IncludeArchived)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	breakdown := Breakdown{ByList: []ListSummary{}, ByAssignee: []AssigneeSummary{}}
+	for rows.Next() {
+		var byList, byAssignee bool
+		var listId, assigneeId *int
+		var summary Summary
+		err := rows.Scan(&byList, &byAssignee, &listId, &assigneeId,
+			&summary.Open, &summary.Completed, &summary.Overdue, &summary.AverageCompletionSeconds)
+		if err != nil {
+			return nil, err
+		}
+		// GROUPING is 1 for the columns a row is not grouped by
+		switch {
+		case byList && byAssignee:
+			breakdown.Summary = summary
+		case byAssignee:
+			breakdown.ByList = append(breakdown.ByList, ListSummary{ListId: listId, Summary: summary})
+		default:
+			breakdown.ByAssignee = append(breakdown.ByAssignee, AssigneeSummary{AssigneeId: assigneeId, Summary: summary})
+		}
+	}
+	return &breakdown, rows.Err()
+}
+
+// Completion tells how many of the todos created in each day or week
+// between from and to are completed, with a bucket for every day or week
+// even when no todo was created in it. Buckets are in UTC and weeks start
+// on Mondays.
+func (sr *StatsRepository) Completion(filter Filter, bucket string, from time.Time, to time.Time) ([]Bucket, error) {
+	rows, err := sr.Db.Reader().Query(`
+	WITH bucket AS (
+		SELECT generate_series(
+			date_trunc($7, $4::timestamptz AT TIME ZONE 'UTC'),
+			($5::timestamptz AT TIME ZONE 'UTC') - INTERVAL '1 microsecond',
+			('1 ' || $7)::interval
+		) AS start
+	)
+	SELECT bucket.start AT TIME ZONE 'UTC', COUNT(todo.id), COUNT(todo.id) FILTER (WHERE todo.completed)
+	FROM bucket
+	LEFT JOIN todo ON date_trunc($7, todo.created_at AT TIME ZONE 'UTC') = bucket.start AND `+picked+`
+	GROUP BY bucket.start
+	ORDER BY bucket.start
+	`, filter.All, filter.UserId, filter.OrgId, from, to, filter.IncludeArchived, bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	buckets := []Bucket{}
+	for rows.Next() {
+		var b Bucket
+		if err := rows.Scan(&b.Start, &b.Created, &b.Completed); err != nil {
+			return nil, err
+		}
+		b.Start = b.Start.UTC()
+		if b.Created > 0 {
+			b.CompletionRate = float64(b.Completed) / float64(b.Created)
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
@@ -0,0 +1,8 @@
+package stats
+
+import "github.com/gofiber/fiber/v2"
+
+func GetStatsRoutes(router fiber.Router, controller *StatsController) fiber.Router {
+	router.Get("/", controller.Get)
+	return router
+}
@@ -0,0 +1,17 @@
+package stats
+
+import "github.com/raphael-foliveira/fiber-todo/pkg/database"
+
+type StatsModule struct {
+	Repository IStatsRepository
+	Controller *StatsController
+}
+
+func New(db *database.Database) *StatsModule {
+	repository := NewStatsRepository(db)
+	controller := NewStatsController(repository)
+	return &StatsModule{
+		Repository: repository,
+		Controller: controller,
+	}
+}
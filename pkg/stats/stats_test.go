@@ -0,0 +1,95 @@
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+type mockRepository struct {
+	IStatsRepository
+	filter   Filter
+	bucket   string
+	from, to time.Time
+	err      error
+}
+
+func (mr *mockRepository) Breakdown(filter Filter) (*Breakdown, error) {
+	mr.filter = filter
+	return &Breakdown{Summary: Summary{Open: 2, Completed: 1}, ByList: []ListSummary{}, ByAssignee: []AssigneeSummary{}}, mr.err
+}
+
+func (mr *mockRepository) Completion(filter Filter, bucket string, from time.Time, to time.Time) ([]Bucket, error) {
+	mr.bucket, mr.from, mr.to = bucket, from, to
+	return []Bucket{{Start: from, Created: 4, Completed: 1, CompletionRate: 0.25}}, nil
+}
+
+func TestGet(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		url          string
+		err          error
+		expectStatus int
+		expectBucket string
+		expectFrom   time.Time
+		expectTo     time.Time
+	}{
+		{"test default range", "/stats", nil, 200, BucketDay, now.AddDate(0, 0, -30), now},
+		{"test weekly default range", "/stats?bucket=week", nil, 200, BucketWeek, now.AddDate(0, 0, -84), now},
+		{"test date range", "/stats?from=2024-03-01&to=2024-03-08T00:00:00Z", nil, 200, BucketDay, from, from.AddDate(0, 0, 7)},
+		{"test archived", "/stats?include=archived", nil, 200, BucketDay, now.AddDate(0, 0, -30), now},
+		{"test invalid from", "/stats?from=yesterday", nil, 400, "", time.Time{}, time.Time{}},
+		{"test invalid to", "/stats?to=2024-13-01", nil, 400, "", time.Time{}, time.Time{}},
+		{"test from after to", "/stats?from=2024-03-08&to=2024-03-01", nil, 400, "", time.Time{}, time.Time{}},
+		{"test invalid bucket", "/stats?bucket=month", nil, 400, "", time.Time{}, time.Time{}},
+		{"test too many buckets", "/stats?from=2020-01-01", nil, 400, "", time.Time{}, time.Time{}},
+		{"test weeks over years", "/stats?from=2020-01-01&bucket=week", nil, 200, BucketWeek, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), now},
+		{"test invalid include", "/stats?include=deleted", nil, 400, "", time.Time{}, time.Time{}},
+		{"test repository error", "/stats", errors.New("connection refused"), 500, "", time.Time{}, time.Time{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mr := &mockRepository{err: test.err}
+			controller := NewStatsController(mr)
+			controller.now = func() time.Time { return now }
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				common.SetPrincipal(c, &common.Principal{})
+				return c.Next()
+			})
+			GetStatsRoutes(app.Group("/stats"), controller)
+			req, _ := http.NewRequest("GET", test.url, nil)
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Fatalf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+			if res.StatusCode != 200 {
+				return
+			}
+			if mr.bucket != test.expectBucket || !mr.from.Equal(test.expectFrom) || !mr.to.Equal(test.expectTo) {
+				t.Errorf("Expected a %s series from %v to %v, got a %s one from %v to %v",
+					test.expectBucket, test.expectFrom, test.expectTo, mr.bucket, mr.from, mr.to)
+			}
+			if !mr.filter.All {
+				t.Errorf("Expected a service key to see every todo")
+			}
+			var stats Stats
+			if err := json.NewDecoder(res.Body).Decode(&stats); err != nil {
+				t.Fatal(err)
+			}
+			if stats.Open != 2 || stats.Completed != 1 || len(stats.Completion) != 1 || stats.Completion[0].CompletionRate != 0.25 {
+				t.Errorf("Unexpected stats %+v", stats)
+			}
+		})
+	}
+}
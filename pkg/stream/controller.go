@@ -0,0 +1,154 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const replayLimit = 1000
+
+// Filter returns whether the client making the request may receive an event.
+// It is called while handling the request, so it can read what middleware
+// stored about the client; what it returns is called for every event.
+type Filter func(c *fiber.Ctx) func(event StoredEvent) bool
+
+type StreamController struct {
+	repository IStreamRepository
+	hub        *Hub
+	heartbeat  time.Duration
+	filters    []Filter
+}
+
+// NewStreamController creates the controller. Clients only receive the events
+// every filter lets through.
+func NewStreamController(repository IStreamRepository, hub *Hub, heartbeat time.Duration, filters ...Filter) *StreamController {
+	return &StreamController{repository: repository, hub: hub, heartbeat: heartbeat, filters: filters}
+}
+
+// @Events godoc
+// @Summary Stream To Do changes
+// @Description Server-Sent Events stream of todo.created, todo.updated, todo.completed and todo.deleted events from every instance, for the To Dos visible to the caller. Reconnecting with Last-Event-ID replays what was missed.
+// @Tags To Do
+// @Produce text/event-stream
+// @Param Last-Event-ID header int false "Resume after this event id"
+// @Param lastEventId query int false "Resume after this event id, for clients that can't set headers"
+// @Success 200 {string} string "event stream"
+// @Failure 400 {object} string "Bad Request"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /todos/events [get]
+func (sc *StreamController) Events(c *fiber.Ctx) error {
+	lastId, err := parseLastEventId(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid Last-Event-ID")
+	}
+	// subscribe before reading the backlog so nothing falls in between; the
+	// overlap is skipped by id below, which is safe because ids follow commit
+	// order
+	live, unsubscribe := sc.hub.Subscribe()
+	backlog := []StoredEvent{}
+	if lastId > 0 {
+		backlog, err = sc.repository.Since(lastId, replayLimit)
+		if err != nil {
+			unsubscribe()
+			return fiber.NewError(fiber.StatusInternalServerError)
+		}
+	}
+	allow := sc.allow(c)
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+		sent := lastId
+		fmt.Fprintf(w, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+		// the backlog is read a page at a time until it has caught up
+		for {
+			for _, event := range backlog {
+				send(w, allow, event)
+				sent = event.Id
+			}
+			if w.Flush() != nil {
+				return
+			}
+			if len(backlog) < replayLimit {
+				break
+			}
+			var err error
+			if backlog, err = sc.repository.Since(sent, replayLimit); err != nil {
+				// the client reconnects and resumes after what it was sent
+				fmt.Println("error replaying events:", err)
+				return
+			}
+		}
+		heartbeat := time.NewTicker(sc.heartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case event, ok := <-live:
+				if !ok {
+					return
+				}
+				if event.Id <= sent {
+					continue
+				}
+				send(w, allow, event)
+				sent = event.Id
+			case <-heartbeat.C:
+				w.WriteString(": heartbeat\n\n")
+			}
+			if w.Flush() != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func (sc *StreamController) allow(c *fiber.Ctx) func(event StoredEvent) bool {
+	allowed := make([]func(StoredEvent) bool, len(sc.filters))
+	for i, filter := range sc.filters {
+		allowed[i] = filter(c)
+	}
+	return func(event StoredEvent) bool {
+		for _, allow := range allowed {
+			if !allow(event) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func send(w io.Writer, allow func(StoredEvent) bool, event StoredEvent) {
+	if allow(event) {
+		writeEvent(w, event)
+	}
+}
+
+func parseLastEventId(c *fiber.Ctx) (int64, error) {
+	value := c.Get("Last-Event-ID")
+	if value == "" {
+		value = c.Query("lastEventId")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func writeEvent(w io.Writer, event StoredEvent) {
+	data := new(bytes.Buffer)
+	if err := json.Compact(data, event.Data); err != nil {
+		data.Reset()
+		data.WriteString("null")
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+}
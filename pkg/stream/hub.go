@@ -0,0 +1,50 @@
+package stream
+
+import "sync"
+
+const subscriberBuffer = 64
+
+// Hub fans stored events out to the streams connected to this instance
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[chan StoredEvent]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: map[chan StoredEvent]struct{}{}}
+}
+
+// Subscribe returns a channel of events and a function to stop receiving
+// them. The channel is closed when the subscriber falls too far behind, in
+// which case the client is expected to reconnect with Last-Event-ID.
+func (h *Hub) Subscribe() (<-chan StoredEvent, func()) {
+	ch := make(chan StoredEvent, subscriberBuffer)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(ch)
+	}
+}
+
+func (h *Hub) Broadcast(event StoredEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			h.remove(ch)
+		}
+	}
+}
+
+// remove must be called with the lock held
+func (h *Hub) remove(ch chan StoredEvent) {
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
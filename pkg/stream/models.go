@@ -0,0 +1,16 @@
+package stream
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// StoredEvent is a change event persisted to the todo_event log. Ids follow
+// commit order, and are what clients send back in Last-Event-ID to resume a
+// stream.
+type StoredEvent struct {
+	Id        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data" swaggertype:"object"`
+	CreatedAt time.Time       `json:"created_at"`
+}
@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	catchUpLimit = 1000
+	pingInterval = 90 * time.Second
+	pruneEvery   = time.Hour
+)
+
+// Relay listens for NOTIFYs sent by any instance and broadcasts the matching
+// events to the streams connected to this one. Postgres delivers notifications
+// in commit order, which Append makes the order of ids, so events reach the
+// hub in id order.
+type Relay struct {
+	repository IStreamRepository
+	hub        *Hub
+	url        string
+	retention  time.Duration
+	listener   *pq.Listener
+	lastId     int64
+	stop       chan struct{}
+	done       sync.WaitGroup
+}
+
+func NewRelay(url string, repository IStreamRepository, hub *Hub, retention time.Duration) *Relay {
+	return &Relay{repository: repository, hub: hub, url: url, retention: retention}
+}
+
+func (r *Relay) Start() error {
+	lastId, err := r.repository.LastId()
+	if err != nil {
+		return err
+	}
+	r.lastId = lastId
+	r.listener = pq.NewListener(r.url, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			fmt.Println("todo event listener:", err)
+		}
+	})
+	if err := r.listener.Listen(Channel); err != nil {
+		r.listener.Close()
+		return err
+	}
+	r.stop = make(chan struct{})
+	r.done.Add(1)
+	go r.run()
+	return nil
+}
+
+func (r *Relay) Stop() {
+	close(r.stop)
+	r.done.Wait()
+	r.listener.Close()
+}
+
+func (r *Relay) run() {
+	defer r.done.Done()
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	prune := time.NewTicker(pruneEvery)
+	defer prune.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case notification := <-r.listener.Notify:
+			// a nil notification means the connection was re-established and
+			// anything sent in between was lost
+			if notification == nil {
+				r.catchUp()
+				continue
+			}
+			r.relay(notification.Extra)
+		case <-ping.C:
+			go r.listener.Ping()
+		case <-prune.C:
+			if _, err := r.repository.Prune(time.Now().Add(-r.retention)); err != nil {
+				fmt.Println("error pruning todo events:", err)
+			}
+		}
+	}
+}
+
+func (r *Relay) relay(payload string) {
+	id, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return
+	}
+	event, err := r.repository.Retrieve(id)
+	if err != nil {
+		fmt.Println("error loading todo event:", err)
+		return
+	}
+	r.broadcast(*event)
+}
+
+func (r *Relay) catchUp() {
+	events, err := r.repository.Since(r.lastId, catchUpLimit)
+	if err != nil {
+		fmt.Println("error catching up on todo events:", err)
+		return
+	}
+	for _, event := range events {
+		r.broadcast(event)
+	}
+}
+
+func (r *Relay) broadcast(event StoredEvent) {
+	if event.Id > r.lastId {
+		r.lastId = event.Id
+	}
+	r.hub.Broadcast(event)
+}
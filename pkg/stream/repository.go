@@ -0,0 +1,93 @@
+package stream
+
+import (
+	"context"
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+)
+
+// Channel is the Postgres NOTIFY channel that carries new event ids
+const Channel = "todo_events"
+
+type IStreamRepository interface {
+	Append(eventType string, data []byte) (int64, error)
+	Retrieve(id int64) (*StoredEvent, error)
+	Since(id int64, limit int) ([]StoredEvent, error)
+	LastId() (int64, error)
+	Prune(before time.Time) (int64, error)
+}
+
+type StreamRepository struct {
+	Db *database.Database
+}
+
+func NewStreamRepository(db *database.Database) *StreamRepository {
+	return &StreamRepository{Db: db}
+}
+
+// appendLock is the advisory lock that serializes appends. A sequence hands
+// out ids in the order rows are inserted, not the order they commit, so
+// without it an event could become visible after a later id was already
+// streamed and be skipped by clients resuming from that id.
+const appendLock = 4242002
+
+// Append stores an event and notifies every listening instance of its id.
+// Each event is committed before the next one takes an id, so ids follow
+// commit order.
+func (sr *StreamRepository) Append(eventType string, data []byte) (int64, error) {
+	var id int64
+	err := sr.Db.WithTx(context.Background(), func(tx *database.Database) error {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", appendLock); err != nil {
+			return err
+		}
+		return tx.QueryRow(`
+		WITH inserted AS (
+			INSERT INTO todo_event (type, data) VALUES ($1, $2) RETURNING id
+		)
+		SELECT id FROM inserted, pg_notify($3, id::text)
+		`, eventType, data, Channel).Scan(&id)
+	})
+	return id, err
+}
+
+func (sr *StreamRepository) Retrieve(id int64) (*StoredEvent, error) {
+	var event StoredEvent
+	err := sr.Db.QueryRow("SELECT id, type, data, created_at FROM todo_event WHERE id = $1", id).
+		Scan(&event.Id, &event.Type, &event.Data, &event.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (sr *StreamRepository) Since(id int64, limit int) ([]StoredEvent, error) {
+	rows, err := sr.Db.Query("SELECT id, type, data, created_at FROM todo_event WHERE id > $1 ORDER BY id LIMIT $2", id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []StoredEvent{}
+	for rows.Next() {
+		var event StoredEvent
+		if err := rows.Scan(&event.Id, &event.Type, &event.Data, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (sr *StreamRepository) LastId() (int64, error) {
+	var id int64
+	err := sr.Db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM todo_event").Scan(&id)
+	return id, err
+}
+
+func (sr *StreamRepository) Prune(before time.Time) (int64, error) {
+	result, err := sr.Db.Exec("DELETE FROM todo_event WHERE created_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
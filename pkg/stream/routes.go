@@ -0,0 +1,10 @@
+package stream
+
+import "github.com/gofiber/fiber/v2"
+
+// GetStreamRoutes must be registered before the todo routes so that /events
+// isn't captured by /:id
+func GetStreamRoutes(router fiber.Router, controller *StreamController) fiber.Router {
+	router.Get("/events", controller.Events)
+	return router
+}
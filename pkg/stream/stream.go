@@ -0,0 +1,48 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+)
+
+const (
+	heartbeatInterval = 15 * time.Second
+	retention         = 24 * time.Hour
+)
+
+type StreamModule struct {
+	Repository IStreamRepository
+	Hub        *Hub
+	Relay      *Relay
+	Controller *StreamController
+}
+
+// New wires the stream module. Events published on the bus are appended to
+// the todo_event log, and the relay brings them back from Postgres so streams
+// on every instance see the same sequence. The filters decide which events
+// each client receives.
+func New(db *database.Database, bus *events.Bus, filters ...Filter) *StreamModule {
+	repository := NewStreamRepository(db)
+	hub := NewHub()
+	relay := NewRelay(db.Url, repository, hub, retention)
+	controller := NewStreamController(repository, hub, heartbeatInterval, filters...)
+	bus.Subscribe(func(event events.Event) {
+		data, err := json.Marshal(event.Data)
+		if err == nil {
+			_, err = repository.Append(event.Type, data)
+		}
+		if err != nil {
+			fmt.Println("error appending todo event:", err)
+		}
+	})
+	return &StreamModule{
+		Repository: repository,
+		Hub:        hub,
+		Relay:      relay,
+		Controller: controller,
+	}
+}
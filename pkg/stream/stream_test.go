@@ -0,0 +1,199 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+type mockRepository struct {
+	IStreamRepository
+	since   int64
+	backlog []StoredEvent
+}
+
+func (mr *mockRepository) Since(id int64, limit int) ([]StoredEvent, error) {
+	if mr.since == 0 {
+		mr.since = id
+	}
+	events := []StoredEvent{}
+	for _, event := range mr.backlog {
+		if event.Id > id && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// closeWhenSubscribed broadcasts the events once a stream subscribes, then
+// ends every subscription so the stream returns
+func closeWhenSubscribed(hub *Hub, events ...StoredEvent) {
+	for {
+		hub.mu.Lock()
+		subscribed := len(hub.subscribers) > 0
+		hub.mu.Unlock()
+		if subscribed {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for _, event := range events {
+		hub.Broadcast(event)
+	}
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for ch := range hub.subscribers {
+		hub.remove(ch)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		lastEventId  string
+		expectStatus int
+		expectSince  int64
+		expectIds    string
+	}{
+		{"test resume", "/events", "1", 200, 1, "[2 3 4]"},
+		{"test resume from query", "/events?lastEventId=1", "", 200, 1, "[2 3 4]"},
+		{"test new stream", "/events", "", 200, 0, "[3 4]"},
+		{"test invalid last event id", "/events", "first", 400, 0, "[]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mr := &mockRepository{backlog: []StoredEvent{{Id: 2, Type: "todo.created", Data: json.RawMessage("{}")}, {Id: 3, Type: "todo.updated", Data: json.RawMessage("{}")}}}
+			hub := NewHub()
+			sc := NewStreamController(mr, hub, time.Minute)
+			app := fiber.New()
+			app.Get("/events", sc.Events)
+			if test.expectStatus == 200 {
+				// the live stream repeats event 3, which the backlog already sent
+				go closeWhenSubscribed(hub, StoredEvent{Id: 3, Type: "todo.updated", Data: json.RawMessage("{}")}, StoredEvent{Id: 4, Type: "todo.deleted", Data: json.RawMessage("{}")})
+			}
+			req := httptest.NewRequest("GET", test.url, nil)
+			if test.lastEventId != "" {
+				req.Header.Set("Last-Event-ID", test.lastEventId)
+			}
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Fatalf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+			body, _ := io.ReadAll(res.Body)
+			ids := []string{}
+			for _, match := range regexp.MustCompile(`(?m)^id: (\d+)$`).FindAllStringSubmatch(string(body), -1) {
+				ids = append(ids, match[1])
+			}
+			if fmt.Sprint(ids) != test.expectIds {
+				t.Errorf("Expected events %s, got %v", test.expectIds, ids)
+			}
+			if mr.since != test.expectSince {
+				t.Errorf("Expected the backlog after %d, got it after %d", test.expectSince, mr.since)
+			}
+		})
+	}
+}
+
+func TestEventsReplayPages(t *testing.T) {
+	mr := &mockRepository{}
+	for id := int64(2); id <= 2*replayLimit+1; id++ {
+		mr.backlog = append(mr.backlog, StoredEvent{Id: id, Type: "todo.created", Data: json.RawMessage("{}")})
+	}
+	hub := NewHub()
+	app := fiber.New()
+	app.Get("/events", NewStreamController(mr, hub, time.Minute).Events)
+	go closeWhenSubscribed(hub)
+	req := httptest.NewRequest("GET", "/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	ids := regexp.MustCompile(`(?m)^id: (\d+)$`).FindAllStringSubmatch(string(body), -1)
+	if len(ids) != len(mr.backlog) || ids[len(ids)-1][1] != fmt.Sprint(2*replayLimit+1) {
+		t.Errorf("Expected the whole backlog of %d events to be replayed, got %d", len(mr.backlog), len(ids))
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	b := new(bytes.Buffer)
+	writeEvent(b, StoredEvent{Id: 7, Type: "todo.created", Data: json.RawMessage("{\n  \"id\": 1\n}")})
+	expected := "id: 7\nevent: todo.created\ndata: {\"id\":1}\n\n"
+	if b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+}
+
+func TestFilter(t *testing.T) {
+	service := func(c *fiber.Ctx) func(StoredEvent) bool {
+		principal := common.GetPrincipal(c)
+		return func(StoredEvent) bool { return principal.Service() }
+	}
+	sc := NewStreamController(nil, NewHub(), time.Minute, service)
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		if c.Query("service") != "" {
+			common.SetPrincipal(c, &common.Principal{KeyId: 1})
+		}
+		b := new(bytes.Buffer)
+		send(b, sc.allow(c), StoredEvent{Id: 1, Type: "todo.created", Data: json.RawMessage("{}")})
+		return c.Send(b.Bytes())
+	})
+	for url, expectSent := range map[string]bool{"/": false, "/?service=1": true} {
+		res, err := app.Test(httptest.NewRequest("GET", url, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		if sent := len(body) > 0; sent != expectSent {
+			t.Errorf("%s: expected sent to be %v, got %q", url, expectSent, body)
+		}
+	}
+}
+
+func TestHub(t *testing.T) {
+	t.Run("should deliver broadcasts to every subscriber", func(t *testing.T) {
+		hub := NewHub()
+		first, unsubscribeFirst := hub.Subscribe()
+		defer unsubscribeFirst()
+		second, unsubscribeSecond := hub.Subscribe()
+		hub.Broadcast(StoredEvent{Id: 1})
+		if (<-first).Id != 1 || (<-second).Id != 1 {
+			t.Errorf("Expected both subscribers to receive event 1")
+		}
+		unsubscribeSecond()
+		if _, ok := <-second; ok {
+			t.Errorf("Expected channel to be closed after unsubscribing")
+		}
+		unsubscribeSecond()
+	})
+
+	t.Run("should drop subscribers that fall behind", func(t *testing.T) {
+		hub := NewHub()
+		slow, unsubscribe := hub.Subscribe()
+		defer unsubscribe()
+		for i := 0; i <= subscriberBuffer; i++ {
+			hub.Broadcast(StoredEvent{Id: int64(i)})
+		}
+		received := 0
+		for range slow {
+			received++
+		}
+		if received != subscriberBuffer {
+			t.Errorf("Expected %d buffered events before closing, got %d", subscriberBuffer, received)
+		}
+	})
+}
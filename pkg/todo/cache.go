@@ -0,0 +1,167 @@
+package todo
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/cache"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+)
+
+// CacheScope is the cache scope of the todos of an organization, invalidated
+// whenever one of them changes
+func CacheScope(orgId int) string {
+	return "todo:" + strconv.Itoa(orgId)
+}
+
+// CachedRepository caches the lists and todos read from a repository. Writes
+// through it invalidate the todos of their organization.
+type CachedRepository struct {
+	repository ITodoRepository
+	cache      *cache.Cache
+	// namespace keeps apart what is read from different places, such as the
+	// primary and the replicas
+	namespace string
+	// cacheReads is false for repositories that only invalidate
+	cacheReads bool
+	// tx is the transaction the repository is bound to, see WithTx
+	tx *database.Database
+}
+
+func NewCachedRepository(repository ITodoRepository, c *cache.Cache, namespace string) *CachedRepository {
+	return &CachedRepository{repository: repository, cache: c, namespace: namespace, cacheReads: true}
+}
+
+// NewInvalidatingRepository returns a CachedRepository whose writes
+// invalidate the cache but whose reads always reach the repository, for
+// reads that must see the latest todos such as the read before an update
+func NewInvalidatingRepository(repository ITodoRepository, c *cache.Cache) *CachedRepository {
+	return &CachedRepository{repository: repository, cache: c}
+}
+
+func (cr *CachedRepository) Create(todo CreateTodoDto) (*Todo, error) {
+	created, err := cr.repository.Create(todo)
+	if err == nil {
+		cr.invalidate(todo.OrgId)
+	}
+	return created, err
+}
+
+// List caches results by filter, which includes the audience, so callers
+// only get the todos they may see
+func (cr *CachedRepository) List(filter ListFilter) ([]Todo, error) {
+	if !cr.cacheReads {
+		return cr.repository.List(filter)
+	}
+	filterKey, err := json.Marshal(filter)
+	if err != nil {
+		return nil, err
+	}
+	key := cr.cache.Key(CacheScope(filter.OrgId), cr.namespace+":list:"+string(filterKey))
+	if cached, ok := cr.cache.Get(key); ok {
+		todos := []Todo{}
+		if err := json.Unmarshal(cached, &todos); err == nil {
+			return todos, nil
+		}
+	}
+	todos, err := cr.repository.List(filter)
+	if err != nil {
+		return nil, err
+	}
+	cr.set(key, todos)
+	return todos, nil
+}
+
+func (cr *CachedRepository) Retrieve(orgId int, id int) (*Todo, error) {
+	if !cr.cacheReads {
+		return cr.repository.Retrieve(orgId, id)
+	}
+	key := cr.cache.Key(CacheScope(orgId), cr.namespace+":todo:"+strconv.Itoa(id))
+	if cached, ok := cr.cache.Get(key); ok {
+		todo := &Todo{}
+		if err := json.Unmarshal(cached, todo); err == nil {
+			return todo, nil
+		}
+	}
+	todo, err := cr.repository.Retrieve(orgId, id)
+	if err != nil {
+		return nil, err
+	}
+	cr.set(key, todo)
+	return todo, nil
+}
+
+func (cr *CachedRepository) Update(todo Todo) (*Todo, error) {
+	updated, err := cr.repository.Update(todo)
+	if err == nil {
+		cr.invalidate(todo.OrgId)
+	}
+	return updated, err
+}
+
+func (cr *CachedRepository) Delete(orgId int, id int) (int64, error) {
+	affected, err := cr.repository.Delete(orgId, id)
+	if err == nil {
+		cr.invalidate(orgId)
+	}
+	return affected, err
+}
+
+func (cr *CachedRepository) Archive(orgId int, id int, archived bool) (*Todo, error) {
+	todo, err := cr.repository.Archive(orgId, id, archived)
+	if err == nil {
+		cr.invalidate(orgId)
+	}
+	return todo, err
+}
+
+// Count isn't cached, since counts must see every todo
+func (cr *CachedRepository) Count(orgId int, ownerId *int) (int, error) {
+	return cr.repository.Count(orgId, ownerId)
+}
+
+// WithTx runs work with a repository bound to the transaction. Its writes
+// invalidate the cache once the transaction commits, and its reads aren't
+// cached since they may see uncommitted todos.
+func (cr *CachedRepository) WithTx(work func(repository ITodoRepository, tx *database.Database) error) error {
+	return cr.repository.WithTx(func(repository ITodoRepository, tx *database.Database) error {
+		return work(&CachedRepository{repository: repository, cache: cr.cache, namespace: cr.namespace, tx: tx}, tx)
+	})
+}
+
+// invalidate invalidates the todos of the organization, after the commit for
+// repositories bound to a transaction
+func (cr *CachedRepository) invalidate(orgId int) {
+	if cr.tx != nil {
+		cr.tx.AfterCommit(func() { cr.cache.Invalidate(CacheScope(orgId)) })
+		return
+	}
+	cr.cache.Invalidate(CacheScope(orgId))
+}
+
+// set caches the value under a key taken before it was read, so a value
+// read while its todos changed isn't cached past the invalidation
+func (cr *CachedRepository) set(key cache.Key, value any) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	cr.cache.Set(key, encoded)
+}
+
+// invalidateOnEvents invalidates the todos of an organization when an event
+// says one of them changed, for writes that don't go through a
+// CachedRepository such as the retention purge
+func invalidateOnEvents(c *cache.Cache) events.Handler {
+	return func(e events.Event) {
+		switch t := e.Data.(type) {
+		case *Todo:
+			if t != nil {
+				c.Invalidate(CacheScope(t.OrgId))
+			}
+		case Todo:
+			c.Invalidate(CacheScope(t.OrgId))
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+)
+
+// The functions below make a change and publish the events about it in one
+// transaction, so the handlers that run in it, such as webhook deliveries,
+// are committed with the change. Every module that changes todos uses them.
+
+// ErrPublish wraps the errors of the handlers that run in the transaction of
+// a change, which roll the change back
+var ErrPublish = errors.New("error publishing event")
+
+// Create creates the todo and publishes todo.created, then todo.assigned when
+// it is assigned to someone
+func Create(repository ITodoRepository, bus *events.Bus, dto CreateTodoDto) (*Todo, error) {
+	var created *Todo
+	err := repository.WithTx(func(repository ITodoRepository, tx *database.Database) error {
+		var err error
+		created, err = repository.Create(dto)
+		if err != nil {
+			return err
+		}
+		if err := publish(bus, tx, EventCreated, created); err != nil {
+			return err
+		}
+		if created.AssigneeId != nil {
+			return publish(bus, tx, EventAssigned, created)
+		}
+		return nil
+	})
+	return created, err
+}
+
+// Update updates the todo and publishes todo.updated, then todo.completed and
+// todo.assigned when the update completed or reassigned it. It returns a todo
+// without an id when there is no todo to update.
+func Update(repository ITodoRepository, bus *events.Bus, previous Todo, todo Todo) (*Todo, error) {
+	var updated *Todo
+	err := repository.WithTx(func(repository ITodoRepository, tx *database.Database) error {
+		var err error
+		updated, err = repository.Update(todo)
+		if err != nil || updated.Id == 0 {
+			return err
+		}
+		if err := publish(bus, tx, EventUpdated, Moved(previous, updated)); err != nil {
+			return err
+		}
+		if updated.Completed && !previous.Completed {
+			if err := publish(bus, tx, EventCompleted, updated); err != nil {
+				return err
+			}
+		}
+		if !sameId(updated.AssigneeId, previous.AssigneeId) {
+			return publish(bus, tx, EventAssigned, updated)
+		}
+		return nil
+	})
+	return updated, err
+}
+
+// Delete deletes the todo and publishes todo.deleted, and returns how many
+// todos were deleted
+func Delete(repository ITodoRepository, bus *events.Bus, todo *Todo) (int64, error) {
+	var affected int64
+	err := repository.WithTx(func(repository ITodoRepository, tx *database.Database) error {
+		var err error
+		affected, err = repository.Delete(todo.OrgId, todo.Id)
+		if err != nil || affected == 0 {
+			return err
+		}
+		return publish(bus, tx, EventDeleted, todo)
+	})
+	return affected, err
+}
+
+// SetArchived archives or unarchives the todo, publishing todo.archived or
+// todo.unarchived when that changed it
+func SetArchived(repository ITodoRepository, bus *events.Bus, previous Todo, archived bool) (*Todo, error) {
+	var todo *Todo
+	err := repository.WithTx(func(repository ITodoRepository, tx *database.Database) error {
+		var err error
+		todo, err = repository.Archive(previous.OrgId, previous.Id, archived)
+		if err != nil || todo.Archived == previous.Archived {
+			return err
+		}
+		if archived {
+			return publish(bus, tx, EventArchived, todo)
+		}
+		return publish(bus, tx, EventUnarchived, todo)
+	})
+	return todo, err
+}
+
+func publish(bus *events.Bus, tx *database.Database, eventType string, todo *Todo) error {
+	if err := bus.PublishTx(tx, eventType, todo); err != nil {
+		return fmt.Errorf("%w %s: %w", ErrPublish, eventType, err)
+	}
+	return nil
+}
@@ -1,29 +1,68 @@
 package todo
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/cache"
 	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/consistency"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
 )
 
+// HeaderNextCursor holds the cursor of the next page of a paginated list
+const HeaderNextCursor = "X-Next-Cursor"
+
+const maxPageSize = 500
+
+// Assignees decides who todos can be assigned to
+type Assignees interface {
+	// CanAssign tells whether the user can be assigned the todo as it is
+	// about to be saved
+	CanAssign(userId int, todo Todo) (bool, error)
+}
+
 type TodoController struct {
 	repository ITodoRepository
+	// replicated serves List and Retrieve, possibly a little behind repository
+	replicated ITodoRepository
+	bus        *events.Bus
+	// assignees checks assignments, which are not checked when it is nil
+	assignees Assignees
+}
+
+func NewTodoController(repository ITodoRepository, replicated ITodoRepository, bus *events.Bus, assignees Assignees) *TodoController {
+	return &TodoController{repository: repository, replicated: replicated, bus: bus, assignees: assignees}
 }
 
-func NewTodoController(repository ITodoRepository) *TodoController {
-	return &TodoController{repository: repository}
+// reads returns the repository reads of the request go to: the replicated
+// one unless the client just wrote and must read its writes, behind the
+// cache unless the request bypasses it
+func (tc *TodoController) reads(c *fiber.Ctx) ITodoRepository {
+	repository := tc.replicated
+	if consistency.ReadsPrimary(c) {
+		repository = tc.repository
+	}
+	if cached, ok := repository.(*CachedRepository); ok && cache.Bypass(c) {
+		return cached.repository
+	}
+	return repository
 }
 
 // @Create godoc
 // @Summary Create a new To Do
-// @Description Create a new To Do
+// @Description Create a new To Do. It can only be assigned to a user who can see it.
 // @Tags To Do
 // @Accept json
 // @Produce json
 // @Param todo body CreateTodoDto true "To Do Create"
 // @Success 201 {object} CreateResponse
 // @Failure 400 {object} string "Bad Request"
+// @Failure 403 {object} string "Quota exceeded"
+// @Failure 409 {object} string "Conflict"
+// @Failure 422 {object} string "Unprocessable Entity"
 // @Failure 500 {object} string "Internal Server Error"
 // @Router /todos [post]
 func (tc *TodoController) Create(c *fiber.Ctx) error {
@@ -32,7 +71,22 @@ func (tc *TodoController) Create(c *fiber.Ctx) error {
 		fmt.Println(err)
 		return fiber.NewError(fiber.StatusBadRequest, "bad request body")
 	}
-	createdTodo, err := tc.repository.Create(todo)
+	todo.OwnerId = common.UserIdOf(common.GetPrincipal(c))
+	todo.OrgId = common.GetOrgId(c)
+	if err := tc.checkAssignee(Todo{ListId: todo.ListId, OwnerId: todo.OwnerId, AssigneeId: todo.AssigneeId}); err != nil {
+		return err
+	}
+	createdTodo, err := Create(tc.repository, tc.bus, todo)
+	if errors.Is(err, ErrAssigneeNotFound) {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
+	if errors.Is(err, ErrQuotaExceeded) {
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	}
+	if errors.Is(err, ErrPublish) {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
 	if err != nil {
 		fmt.Println(err)
 		return fiber.NewError(fiber.StatusConflict, "todo already exists")
@@ -42,18 +96,84 @@ func (tc *TodoController) Create(c *fiber.Ctx) error {
 
 // @List godoc
 // @Summary List To Dos
-// @Description List To Dos
+// @Description List the To Dos visible to the caller
 // @Tags To Do
 // @Accept json
 // @Produce json
+// @Param completed query bool false "Only completed (true) or open (false) To Dos"
+// @Param list_id query int false "Only the To Dos of this list"
+// @Param limit query int false "Page size, at most 500; without it every To Do is returned"
+// @Param cursor query string false "Cursor of the page, from the X-Next-Cursor header of the previous one"
+// @Param include query string false "archived to include archived To Dos" Enums(archived)
+// @Param assignee query string false "Only the To Dos assigned to me (the caller), none (nobody) or a user ID"
+// @Param Cache-Control header string false "no-cache to skip the cache"
 // @Success 200 {array} Todo
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, when there is one"
+// @Failure 400 {object} string "Bad Request"
 // @Failure 500 {object} string "Internal Server Error"
 // @Router /todos [get]
 func (tc *TodoController) List(c *fiber.Ctx) error {
-	todos, err := tc.repository.List()
+	filter := ListFilter{
+		OrgId:    common.GetOrgId(c),
+		Audience: common.AudienceOf(common.GetPrincipal(c)),
+	}
+	if value := c.Query("completed"); value != "" {
+		completed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid completed filter")
+		}
+		filter.Completed = &completed
+	}
+	if value := c.Query("list_id"); value != "" {
+		listId, err := strconv.Atoi(value)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid list_id filter")
+		}
+		filter.ListIds = []int{listId}
+	}
+	includeArchived, err := common.IncludeArchived(c)
+	if err != nil {
+		return err
+	}
+	filter.IncludeArchived = includeArchived
+	switch value := c.Query("assignee"); value {
+	case "":
+	case "me":
+		filter.AssigneeId = filter.UserId
+		if filter.AssigneeId == nil {
+			return fiber.NewError(fiber.StatusBadRequest, "assignee=me needs a user API key")
+		}
+	case "none":
+		filter.Unassigned = true
+	default:
+		assigneeId, err := strconv.Atoi(value)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid assignee filter")
+		}
+		filter.AssigneeId = &assigneeId
+	}
+	afterId, err := DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid cursor")
+	}
+	filter.AfterId = afterId
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+		}
+		// one more than the limit tells whether there is a next page
+		filter.Limit = limit + 1
+	}
+	todos, err := tc.reads(c).List(filter)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError)
 	}
+	if limit > 0 && len(todos) > limit {
+		todos = todos[:limit]
+		c.Set(HeaderNextCursor, EncodeCursor(todos[limit-1].Id))
+	}
 	return c.Status(fiber.StatusOK).JSON(todos)
 }
 
@@ -64,6 +184,7 @@ func (tc *TodoController) List(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Param id path int true "To Do ID"
+// @Param Cache-Control header string false "no-cache to skip the cache"
 // @Success 200 {object} Todo
 // @Failure 404 {object} string "Not Found"
 // @Failure 422 {object} string "Unprocessable Entity"
@@ -73,7 +194,7 @@ func (tc *TodoController) Retrieve(c *fiber.Ctx) error {
 	if err != nil {
 		return fiber.NewError(fiber.StatusUnprocessableEntity)
 	}
-	todo, err := tc.repository.Retrieve(intId)
+	todo, err := tc.reads(c).Retrieve(common.GetOrgId(c), intId)
 	if err != nil {
 		return fiber.NewError(fiber.StatusNotFound)
 	}
@@ -102,7 +223,29 @@ func (tc *TodoController) Update(c *fiber.Ctx) (err error) {
 	if err != nil {
 		return fiber.NewError(fiber.StatusUnprocessableEntity)
 	}
-	uTodo, err := tc.repository.Update(Todo{Id: todoId, Title: todo.Title, Description: todo.Description, Completed: todo.Completed})
+	previous, err := tc.repository.Retrieve(common.GetOrgId(c), todoId)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	update := Todo{
+		Id:          todoId,
+		Title:       todo.Title,
+		Description: todo.Description,
+		Completed:   todo.Completed,
+		DueDate:     todo.DueDate,
+		Priority:    todo.Priority,
+		ListId:      todo.ListId,
+		OwnerId:     previous.OwnerId,
+		OrgId:       previous.OrgId,
+		AssigneeId:  todo.AssigneeId,
+	}
+	if err := tc.checkAssignee(update); err != nil {
+		return err
+	}
+	uTodo, err := Update(tc.repository, tc.bus, *previous, update)
+	if errors.Is(err, ErrAssigneeNotFound) {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError)
 	}
@@ -120,6 +263,7 @@ func (tc *TodoController) Update(c *fiber.Ctx) (err error) {
 // @Produce json
 // @Param id path int true "To Do ID"
 // @Success 204 "No Content"
+// @Failure 404 {object} string "Not Found"
 // @Failure 422 {object} string "Unprocessable Entity"
 // @Failure 500 {object} string "Internal Server Error"
 // @Router /todos/{id} [delete]
@@ -128,7 +272,11 @@ func (tc *TodoController) Delete(c *fiber.Ctx) error {
 	if err != nil {
 		return fiber.NewError(fiber.StatusUnprocessableEntity)
 	}
-	affected, err := tc.repository.Delete(intId)
+	todo, err := tc.repository.Retrieve(common.GetOrgId(c), intId)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	affected, err := Delete(tc.repository, tc.bus, todo)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError)
 	}
@@ -138,6 +286,75 @@ func (tc *TodoController) Delete(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+// @Archive godoc
+// @Summary Archive a To Do
+// @Description Archive a To Do, which leaves it out of lists unless they include archived To Dos
+// @Tags To Do
+// @Produce json
+// @Param id path int true "To Do ID"
+// @Success 200 {object} Todo
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Router /todos/{id}/archive [post]
+func (tc *TodoController) Archive(c *fiber.Ctx) error {
+	return tc.setArchived(c, true)
+}
+
+// @Unarchive godoc
+// @Summary Unarchive a To Do
+// @Description Bring an archived To Do back into lists
+// @Tags To Do
+// @Produce json
+// @Param id path int true "To Do ID"
+// @Success 200 {object} Todo
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Router /todos/{id}/unarchive [post]
+func (tc *TodoController) Unarchive(c *fiber.Ctx) error {
+	return tc.setArchived(c, false)
+}
+
+func (tc *TodoController) setArchived(c *fiber.Ctx, archived bool) error {
+	intId, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	previous, err := tc.repository.Retrieve(common.GetOrgId(c), intId)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	todo, err := SetArchived(tc.repository, tc.bus, *previous, archived)
+	if errors.Is(err, ErrPublish) {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.Status(fiber.StatusOK).JSON(todo)
+}
+
+// checkAssignee refuses with 422 assignments to users who couldn't see the
+// todo
+func (tc *TodoController) checkAssignee(todo Todo) error {
+	if todo.AssigneeId == nil || tc.assignees == nil {
+		return nil
+	}
+	ok, err := tc.assignees.CanAssign(*todo.AssigneeId, todo)
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("user %d can't see the todo, so it can't be assigned to them", *todo.AssigneeId))
+	}
+	return nil
+}
+
+func sameId(a *int, b *int) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
 func parseTodoFromBody(c *fiber.Ctx) (CreateTodoDto, error) {
 	var todo CreateTodoDto
 	err := c.BodyParser(&todo)
@@ -1,13 +1,47 @@
 package todo
 
+import (
+	"time"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
 type CreateTodoDto struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Completed   bool   `json:"completed"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Completed   bool       `json:"completed"`
+	DueDate     *time.Time `json:"due_date"`
+	Priority    int        `json:"priority"`
+	ListId      *int       `json:"list_id"`
+	AssigneeId  *int       `json:"assignee_id"`
+	// OwnerId is set from the caller, never from the request body
+	OwnerId *int `json:"-"`
+	// OrgId is the organization of the request, never from the request body
+	OrgId int `json:"-"`
 }
 
 type UpdateTodoDto CreateTodoDto
 
+// ListFilter narrows what List returns
+type ListFilter struct {
+	OrgId int
+	common.Audience
+	// Completed, when set, only keeps todos that are or aren't completed
+	Completed *bool
+	// ListIds, when set, only keeps todos in these lists
+	ListIds []int
+	// AfterId and Limit page through todos in id order; a zero Limit
+	// returns every todo after AfterId
+	AfterId int
+	Limit   int
+	// IncludeArchived keeps archived todos, which are left out otherwise
+	IncludeArchived bool
+	// AssigneeId, when set, only keeps todos assigned to this user
+	AssigneeId *int
+	// Unassigned only keeps todos assigned to nobody
+	Unassigned bool
+}
+
 type CreateResponse struct {
 	Id int `json:"id"`
 }
@@ -0,0 +1,25 @@
+package todo
+
+const (
+	EventCreated    = "todo.created"
+	EventUpdated    = "todo.updated"
+	EventCompleted  = "todo.completed"
+	EventDeleted    = "todo.deleted"
+	EventArchived   = "todo.archived"
+	EventUnarchived = "todo.unarchived"
+	// EventAssigned is published when the assignee of a todo changes,
+	// including to nobody
+	EventAssigned = "todo.assigned"
+)
+
+var Events = []string{EventCreated, EventUpdated, EventCompleted, EventDeleted, EventArchived, EventUnarchived, EventAssigned}
+
+// Moved returns the todo to publish with EventUpdated, carrying the list it
+// was in when the update moved it to another list or out of its list
+func Moved(previous Todo, updated *Todo) *Todo {
+	event := *updated
+	if previous.ListId != nil && !sameId(previous.ListId, updated.ListId) {
+		event.PreviousListId = previous.ListId
+	}
+	return &event
+}
@@ -1,8 +1,28 @@
 package todo
 
+import "time"
+
 type Todo struct {
-	Id          int    `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Completed   bool   `json:"completed"`
+	Id          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Completed   bool       `json:"completed"`
+	DueDate     *time.Time `json:"due_date"`
+	Priority    int        `json:"priority"`
+	ListId      *int       `json:"list_id"`
+	OwnerId     *int       `json:"owner_id"`
+	// AssigneeId is the user the todo is assigned to, who must be able to
+	// see it
+	AssigneeId  *int       `json:"assignee_id"`
+	OrgId       int        `json:"org_id"`
+	CompletedAt *time.Time `json:"completed_at"`
+	// Archived todos are left out of lists unless asked for. Archiving is
+	// separate from completing, and keeps the todo as it is.
+	Archived   bool       `json:"archived"`
+	ArchivedAt *time.Time `json:"archived_at"`
+	// CommentCount is the number of comments on the todo
+	CommentCount int `json:"comment_count"`
+	// PreviousListId is only set in todo.updated events, to the list the
+	// update moved the todo out of
+	PreviousListId *int `json:"previous_list_id,omitempty"`
 }
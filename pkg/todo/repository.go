@@ -1,58 +1,141 @@
 package todo
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 
+	"github.com/lib/pq"
 	"github.com/raphael-foliveira/fiber-todo/pkg/database"
 )
 
 type ITodoRepository interface {
 	Create(todo CreateTodoDto) (*Todo, error)
-	List() ([]Todo, error)
-	Retrieve(id int) (*Todo, error)
+	List(filter ListFilter) ([]Todo, error)
+	Retrieve(orgId int, id int) (*Todo, error)
 	Update(todo Todo) (*Todo, error)
-	Delete(id int) (int64, error)
+	Delete(orgId int, id int) (int64, error)
+	Count(orgId int, ownerId *int) (int, error)
+	Archive(orgId int, id int, archived bool) (*Todo, error)
+	// WithTx runs work in a transaction, with a repository whose queries run
+	// in it
+	WithTx(work func(repository ITodoRepository, tx *database.Database) error) error
 }
 
 type TodoRepository struct {
 	Db *database.Database
+	// Quota, when above zero, is the most todos each user may own in an
+	// organization, see Create
+	Quota int
 }
 
 func NewTodoRepository(db *database.Database) *TodoRepository {
 	return &TodoRepository{Db: db}
 }
 
+// ErrAssigneeNotFound is returned when a todo is assigned to a user that
+// doesn't exist
+var ErrAssigneeNotFound = errors.New("assignee not found")
+
+// ErrQuotaExceeded is returned when creating a todo would take its owner
+// past the quota
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Columns lists the todo columns in the order ScanTodo reads them, ending
+// with the number of comments on the todo
+const Columns = `id, title, description, completed, due_date, priority, list_id, owner_id, org_id, completed_at, archived_at, assignee_id,
+	(SELECT COUNT(*) FROM todo_comment WHERE todo_comment.todo_id = todo.id)`
+
+// Visible is the condition for a todo to be visible to an audience, given as
+// $1 (see everything) and $2 (user id). Todos that neither they nor their list
+// have an owner for are public; the others are visible to the owners and the
+// users the todo or its list is shared with.
+const Visible = `($1
+	OR (todo.owner_id IS NULL AND (todo.list_id IS NULL OR (SELECT owner_id FROM todo_list WHERE todo_list.id = todo.list_id) IS NULL))
+	OR todo.owner_id = $2
+	OR todo.list_id IN (SELECT id FROM todo_list WHERE owner_id = $2)
+	OR EXISTS (SELECT 1 FROM todo_share WHERE todo_share.user_id = $2 AND (todo_share.todo_id = todo.id OR todo_share.list_id = todo.list_id)))`
+
+type Scanner interface {
+	Scan(dest ...any) error
+}
+
+func ScanTodo(row Scanner) (Todo, error) {
+	var todo Todo
+	err := row.Scan(&todo.Id, &todo.Title, &todo.Description, &todo.Completed, &todo.DueDate, &todo.Priority, &todo.ListId, &todo.OwnerId,
+		&todo.OrgId, &todo.CompletedAt, &todo.ArchivedAt, &todo.AssigneeId, &todo.CommentCount)
+	todo.Archived = todo.ArchivedAt != nil
+	return todo, err
+}
+
+// Create inserts the todo. With a quota, the count of the owner's todos and
+// the insert run in a transaction holding a lock on the owner in the
+// organization, so concurrent creations can't both take the last place.
 func (tr *TodoRepository) Create(todo CreateTodoDto) (*Todo, error) {
-	tx, err := tr.Db.Begin()
-	if err != nil {
-		return nil, err
+	if tr.Quota <= 0 {
+		return tr.insert(todo)
 	}
-	stmt, err := tx.Prepare(`
+	var created *Todo
+	err := tr.Db.WithTx(context.Background(), func(tx *database.Database) error {
+		_, err := tx.Exec("SELECT pg_advisory_xact_lock($1, COALESCE($2::int, 0))", todo.OrgId, todo.OwnerId)
+		if err != nil {
+			return err
+		}
+		count, err := (&TodoRepository{Db: tx}).Count(todo.OrgId, todo.OwnerId)
+		if err != nil {
+			return err
+		}
+		if count >= tr.Quota {
+			return ErrQuotaExceeded
+		}
+		created, err = (&TodoRepository{Db: tx}).insert(todo)
+		return err
+	})
+	return created, err
+}
+
+func (tr *TodoRepository) WithTx(work func(repository ITodoRepository, tx *database.Database) error) error {
+	return tr.Db.WithTx(context.Background(), func(tx *database.Database) error {
+		return work(&TodoRepository{Db: tx, Quota: tr.Quota}, tx)
+	})
+}
+
+func (tr *TodoRepository) insert(todo CreateTodoDto) (*Todo, error) {
+	row := tr.Db.QueryRow(`
 	INSERT INTO todo 
-		(title, description, completed) 
+		(title, description, completed, due_date, priority, list_id, owner_id, org_id, assignee_id, completed_at) 
 	VALUES 
-		($1, $2, $3) 
-	RETURNING id, title, description, completed
-	`)
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, CASE WHEN $3 THEN NOW() END) 
+	RETURNING `+Columns,
+		todo.Title, todo.Description, todo.Completed, todo.DueDate, todo.Priority, todo.ListId, todo.OwnerId, todo.OrgId, todo.AssigneeId)
+	createdTodo, err := ScanTodo(row)
 	if err != nil {
-		return nil, err
+		return nil, assigneeError(err)
 	}
-	row := stmt.QueryRow(todo.Title, todo.Description, todo.Completed)
-	var createdTodo Todo
-	err = row.Scan(&createdTodo.Id, &createdTodo.Title, &createdTodo.Description, &createdTodo.Completed)
-	return &createdTodo, err
+	return &createdTodo, nil
 }
 
-func (tr *TodoRepository) List() ([]Todo, error) {
-	rows, err := tr.Db.Query("SELECT id, title, description, completed FROM todo")
+// List reads from a replica when there is one, see database.Reader
+func (tr *TodoRepository) List(filter ListFilter) ([]Todo, error) {
+	rows, err := tr.Db.Reader().Query(`
+	SELECT `+Columns+` FROM todo
+	WHERE org_id = $3 AND id > $4 AND `+Visible+`
+		AND ($6::boolean IS NULL OR completed = $6)
+		AND ($7::int[] IS NULL OR list_id = ANY($7))
+		AND ($8 OR archived_at IS NULL)
+		AND ($9::int IS NULL OR assignee_id = $9)
+		AND (NOT $10 OR assignee_id IS NULL)
+	ORDER BY id
+	LIMIT NULLIF($5, 0)
+	`, filter.All, filter.UserId, filter.OrgId, filter.AfterId, filter.Limit, filter.Completed, listIds(filter.ListIds),
+		filter.IncludeArchived, filter.AssigneeId, filter.Unassigned)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	todos := []Todo{}
-	var todo Todo
 	for rows.Next() {
-		err := rows.Scan(&todo.Id, &todo.Title, &todo.Description, &todo.Completed)
+		todo, err := ScanTodo(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -61,34 +144,56 @@ func (tr *TodoRepository) List() ([]Todo, error) {
 	return todos, nil
 }
 
-func (tr *TodoRepository) Retrieve(id int) (*Todo, error) {
-	row := tr.Db.QueryRow("SELECT id, title, description, completed FROM todo WHERE id = $1", id)
-	var todo Todo
-	err := row.Scan(&todo.Id, &todo.Title, &todo.Description, &todo.Completed)
+// assigneeError reports assignments to users that don't exist as
+// ErrAssigneeNotFound
+func assigneeError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" && pqErr.Constraint == "todo_assignee_id_fkey" {
+		return ErrAssigneeNotFound
+	}
+	return err
+}
+
+// listIds passes the list filter as a Postgres array, or NULL when unset
+func listIds(ids []int) any {
+	if ids == nil {
+		return nil
+	}
+	return pq.Array(ids)
+}
+
+// Retrieve reads from a replica when there is one, see database.Reader
+func (tr *TodoRepository) Retrieve(orgId int, id int) (*Todo, error) {
+	row := tr.Db.Reader().QueryRow("SELECT "+Columns+" FROM todo WHERE id = $1 AND org_id = $2", id, orgId)
+	todo, err := ScanTodo(row)
 	if err != nil {
 		return nil, err
 	}
 	return &todo, nil
 }
 
+// Update saves the todo within its organization. completed_at keeps the time
+// the todo was first completed until it is reopened.
 func (tr *TodoRepository) Update(todo Todo) (*Todo, error) {
-	result, err := tr.Db.Exec("UPDATE todo SET title = $1, description = $2, completed = $3 WHERE id = $4",
-		todo.Title, todo.Description, todo.Completed, todo.Id)
-	if err != nil {
-		return nil, err
+	row := tr.Db.QueryRow(`
+	UPDATE todo SET
+		title = $1, description = $2, completed = $3, due_date = $4, priority = $5, list_id = $6, assignee_id = $9,
+		completed_at = CASE WHEN $3 THEN COALESCE(completed_at, NOW()) END
+	WHERE id = $7 AND org_id = $8
+	RETURNING `+Columns,
+		todo.Title, todo.Description, todo.Completed, todo.DueDate, todo.Priority, todo.ListId, todo.Id, todo.OrgId, todo.AssigneeId)
+	updated, err := ScanTodo(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("todo not found")
 	}
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return nil, err
-	}
-	if rowsAffected == 0 {
-		return nil, errors.New("todo not found")
+		return nil, assigneeError(err)
 	}
-	return &todo, nil
+	return &updated, nil
 }
 
-func (tr *TodoRepository) Delete(id int) (int64, error) {
-	result, err := tr.Db.Exec("DELETE FROM todo WHERE id = $1", id)
+func (tr *TodoRepository) Delete(orgId int, id int) (int64, error) {
+	result, err := tr.Db.Exec("DELETE FROM todo WHERE id = $1 AND org_id = $2", id, orgId)
 	if err != nil {
 		return 0, err
 	}
@@ -101,3 +206,29 @@ func (tr *TodoRepository) Delete(id int) (int64, error) {
 	}
 	return affectedRows, nil
 }
+
+// Count counts the todos of the organization owned by the user, or the
+// unowned ones for nil
+func (tr *TodoRepository) Count(orgId int, ownerId *int) (int, error) {
+	var count int
+	err := tr.Db.QueryRow("SELECT COUNT(*) FROM todo WHERE org_id = $1 AND owner_id IS NOT DISTINCT FROM $2", orgId, ownerId).
+		Scan(&count)
+	return count, err
+}
+
+// Archive archives or unarchives the todo. Archiving an archived todo keeps
+// the time it was first archived.
+func (tr *TodoRepository) Archive(orgId int, id int, archived bool) (*Todo, error) {
+	row := tr.Db.QueryRow(`
+	UPDATE todo SET archived_at = CASE WHEN $3 THEN COALESCE(archived_at, NOW()) END
+	WHERE id = $1 AND org_id = $2
+	RETURNING `+Columns, id, orgId, archived)
+	todo, err := ScanTodo(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("todo not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
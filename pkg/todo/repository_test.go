@@ -1,6 +1,8 @@
 package todo
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/raphael-foliveira/fiber-todo/pkg/common"
@@ -49,7 +51,7 @@ func TestRepositoryList(t *testing.T) {
 	repositoryTestsSetup()
 	defer repositoryTestsTeardown()
 	repository.Db.Exec(queries.InsertTodoFixtures)
-	todos, err := repository.List()
+	todos, err := repository.List(ListFilter{OrgId: common.DefaultOrgId, Audience: common.Audience{All: true}})
 	if err != nil {
 		t.Errorf("Error listing todos: %s", err)
 	}
@@ -63,7 +65,7 @@ func TestRepositoryRetrieve(t *testing.T) {
 		repositoryTestsSetup()
 		defer repositoryTestsTeardown()
 		repository.Db.Exec(queries.InsertTodoFixtures)
-		todo, err := repository.Retrieve(1)
+		todo, err := repository.Retrieve(common.DefaultOrgId, 1)
 		if err != nil {
 			t.Errorf("Error retrieving todo: %s", err)
 		}
@@ -75,7 +77,7 @@ func TestRepositoryRetrieve(t *testing.T) {
 	t.Run("should return an error when given an id that doesn't exist", func(t *testing.T) {
 		repositoryTestsSetup()
 		defer repositoryTestsTeardown()
-		_, err := repository.Retrieve(1)
+		_, err := repository.Retrieve(common.DefaultOrgId, 1)
 		if err == nil {
 			t.Errorf("Expected error, got nil")
 		}
@@ -92,6 +94,7 @@ func TestRepositoryUpdate(t *testing.T) {
 			Title:       "Updated",
 			Description: "Updated",
 			Completed:   true,
+			OrgId:       common.DefaultOrgId,
 		})
 		if err != nil {
 			t.Errorf("Error updating todo: %s", err)
@@ -116,6 +119,7 @@ func TestRepositoryUpdate(t *testing.T) {
 			Title:       "Updated",
 			Description: "Updated",
 			Completed:   true,
+			OrgId:       common.DefaultOrgId,
 		})
 		if err == nil {
 			t.Errorf("Expected error, got nil")
@@ -128,7 +132,7 @@ func TestRepositoryDelete(t *testing.T) {
 		repositoryTestsSetup()
 		defer repositoryTestsTeardown()
 		repository.Db.Exec(queries.InsertTodoFixtures)
-		rowsAffected, err := repository.Delete(1)
+		rowsAffected, err := repository.Delete(common.DefaultOrgId, 1)
 		if err != nil {
 			t.Errorf("Error deleting todo: %s", err)
 		}
@@ -141,9 +145,106 @@ func TestRepositoryDelete(t *testing.T) {
 		repositoryTestsSetup()
 		defer repositoryTestsTeardown()
 		repository.Db.Exec(queries.ClearTodoTable)
-		_, err := repository.Delete(1)
+		_, err := repository.Delete(common.DefaultOrgId, 1)
 		if err == nil {
 			t.Errorf("Expected error, got nil")
 		}
 	})
 }
+
+func TestRepositoryArchive(t *testing.T) {
+	repositoryTestsSetup()
+	defer repositoryTestsTeardown()
+	repository.Db.Exec(queries.InsertTodoFixtures)
+	filter := ListFilter{OrgId: common.DefaultOrgId, Audience: common.Audience{All: true}}
+	todos, err := repository.List(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived, err := repository.Archive(common.DefaultOrgId, todos[0].Id, true)
+	if err != nil {
+		t.Fatalf("Error archiving todo: %s", err)
+	}
+	if !archived.Archived || archived.ArchivedAt == nil {
+		t.Errorf("Expected the todo to be archived, got %+v", archived)
+	}
+	if todos, _ := repository.List(filter); len(todos) != 1 {
+		t.Errorf("Expected archived todos to be left out, got %d todos", len(todos))
+	}
+	filter.IncludeArchived = true
+	if todos, _ := repository.List(filter); len(todos) != 2 {
+		t.Errorf("Expected archived todos to be included, got %d todos", len(todos))
+	}
+	unarchived, err := repository.Archive(common.DefaultOrgId, todos[0].Id, false)
+	if err != nil {
+		t.Fatalf("Error unarchiving todo: %s", err)
+	}
+	if unarchived.Archived || unarchived.ArchivedAt != nil {
+		t.Errorf("Expected the todo to be unarchived, got %+v", unarchived)
+	}
+	if _, err := repository.Archive(common.DefaultOrgId, 999, true); err == nil {
+		t.Error("Expected an error for a missing todo")
+	}
+}
+
+func TestRepositoryCommentCount(t *testing.T) {
+	repositoryTestsSetup()
+	defer repositoryTestsTeardown()
+	repository.Db.Exec(queries.InsertTodoFixtures)
+	repository.Db.Exec("INSERT INTO todo_comment (todo_id, body) VALUES (1, 'first'), (1, 'second')")
+	todo, err := repository.Retrieve(common.DefaultOrgId, 1)
+	if err != nil {
+		t.Fatalf("Error retrieving todo: %s", err)
+	}
+	if todo.CommentCount != 2 {
+		t.Errorf("Expected 2 comments, got %d", todo.CommentCount)
+	}
+}
+
+func TestRepositoryAssignee(t *testing.T) {
+	repositoryTestsSetup()
+	defer repositoryTestsTeardown()
+	repository.Db.Exec(queries.InsertTodoFixtures)
+	repository.Db.Exec("INSERT INTO users (id, email, name) VALUES (1, 'ada@example.com', 'Ada')")
+	assigneeId := 1
+	todo, err := repository.Retrieve(common.DefaultOrgId, 1)
+	if err != nil {
+		t.Fatalf("Error retrieving todo: %s", err)
+	}
+	todo.AssigneeId = &assigneeId
+	if _, err := repository.Update(*todo); err != nil {
+		t.Fatalf("Error assigning todo: %s", err)
+	}
+	filter := ListFilter{OrgId: common.DefaultOrgId, Audience: common.Audience{All: true}, AssigneeId: &assigneeId}
+	todos, err := repository.List(filter)
+	if err != nil {
+		t.Fatalf("Error listing todos: %s", err)
+	}
+	if len(todos) != 1 || todos[0].Id != 1 {
+		t.Errorf("Expected only todo 1 to be assigned, got %v", todos)
+	}
+	stranger := 99
+	todo.AssigneeId = &stranger
+	if _, err := repository.Update(*todo); err != ErrAssigneeNotFound {
+		t.Errorf("Expected ErrAssigneeNotFound, got %v", err)
+	}
+}
+
+func TestRepositoryQuota(t *testing.T) {
+	repositoryTestsSetup()
+	defer repositoryTestsTeardown()
+	repository.Quota = 2
+	defer func() { repository.Quota = 0 }()
+	ownerId := 1
+	repository.Db.Exec("INSERT INTO users (id, email, name) VALUES (1, 'ada@example.com', 'Ada')")
+	for i, expectErr := range []error{nil, nil, ErrQuotaExceeded} {
+		_, err := repository.Create(CreateTodoDto{Title: fmt.Sprintf("Test %d", i), OwnerId: &ownerId, OrgId: common.DefaultOrgId})
+		if !errors.Is(err, expectErr) {
+			t.Errorf("Expected %v creating todo %d, got %v", expectErr, i, err)
+		}
+	}
+	// the quota is per owner, so unowned todos can still be created
+	if _, err := repository.Create(CreateTodoDto{Title: "Unowned", OrgId: common.DefaultOrgId}); err != nil {
+		t.Errorf("Error creating unowned todo: %s", err)
+	}
+}
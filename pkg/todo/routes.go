@@ -10,5 +10,7 @@ func GetTodoRoutes(router fiber.Router, controller *TodoController) fiber.Router
 	router.Get("/:id", controller.Retrieve)
 	router.Put("/:id", controller.Update)
 	router.Delete("/:id", controller.Delete)
+	router.Post("/:id/archive", controller.Archive)
+	router.Post("/:id/unarchive", controller.Unarchive)
 	return router
 }
@@ -1,15 +1,38 @@
 package todo
 
-import "github.com/raphael-foliveira/fiber-todo/pkg/database"
+import (
+	"github.com/raphael-foliveira/fiber-todo/pkg/cache"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+)
 
 type TodoModule struct {
+	// Repository always reads from the primary, so the modules built on it
+	// see their own writes
 	Repository ITodoRepository
 	Controller *TodoController
 }
 
-func New(db *database.Database) *TodoModule {
-	repository := NewTodoRepository(db)
-	controller := NewTodoController(repository)
+// New builds the module, caching reads when c isn't nil. A quota above zero
+// limits how many todos each user may create in an organization, whichever
+// module creates them.
+func New(db *database.Database, bus *events.Bus, c *cache.Cache, assignees Assignees, quota int) *TodoModule {
+	primary := NewTodoRepository(db.Primary())
+	primary.Quota = quota
+	var repository, replicated ITodoRepository = primary, NewTodoRepository(db)
+	namespace := "replicated"
+	if db.Replicas == nil {
+		replicated = repository
+		namespace = "primary"
+	}
+	if c != nil {
+		// only the reads the controller serves are cached; reads through
+		// repository, such as the one before an update, see the latest todos
+		replicated = NewCachedRepository(replicated, c, namespace)
+		repository = NewInvalidatingRepository(repository, c)
+		bus.Subscribe(invalidateOnEvents(c))
+	}
+	controller := NewTodoController(repository, replicated, bus, assignees)
 	return &TodoModule{
 		Repository: repository,
 		Controller: controller,
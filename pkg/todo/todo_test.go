@@ -8,14 +8,21 @@ import (
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/go-faker/faker/v4"
 	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/cache"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/consistency"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
 )
 
 // var db *database.Database
 var app *fiber.App
 var mr *mockRepository
+var bus *events.Bus
 
 type todoTest struct {
 	name         string
@@ -27,9 +34,13 @@ type todoTest struct {
 type mockRepository struct {
 	todos      []Todo
 	shouldFail bool
+	quota      int
 }
 
 func (mr *mockRepository) Create(todo CreateTodoDto) (*Todo, error) {
+	if mr.quota > 0 && len(mr.todos) >= mr.quota {
+		return nil, ErrQuotaExceeded
+	}
 	id := 0
 	for _, t := range mr.todos {
 		if t.Title == todo.Title {
@@ -42,18 +53,19 @@ func (mr *mockRepository) Create(todo CreateTodoDto) (*Todo, error) {
 		Title:       todo.Title,
 		Description: todo.Description,
 		Completed:   todo.Completed,
+		AssigneeId:  todo.AssigneeId,
 	})
-	return nil, nil
+	return &mr.todos[len(mr.todos)-1], nil
 }
 
-func (mr *mockRepository) List() ([]Todo, error) {
+func (mr *mockRepository) List(filter ListFilter) ([]Todo, error) {
 	if mr.shouldFail {
 		return nil, errors.New("error listing todos")
 	}
 	return mr.todos, nil
 }
 
-func (mr *mockRepository) Retrieve(id int) (*Todo, error) {
+func (mr *mockRepository) Retrieve(orgId int, id int) (*Todo, error) {
 	for _, todo := range mr.todos {
 		if todo.Id == id {
 			return &todo, nil
@@ -72,13 +84,14 @@ func (mr *mockRepository) Update(todo Todo) (*Todo, error) {
 			t.Title = todo.Title
 			t.Description = todo.Description
 			t.Completed = todo.Completed
+			t.AssigneeId = todo.AssigneeId
 			return &t, nil
 		}
 	}
 	return &Todo{Id: 0}, nil
 }
 
-func (mr *mockRepository) Delete(id int) (int64, error) {
+func (mr *mockRepository) Delete(orgId int, id int) (int64, error) {
 	if mr.shouldFail {
 		return 0, errors.New("error deleting todo")
 	}
@@ -91,12 +104,31 @@ func (mr *mockRepository) Delete(id int) (int64, error) {
 	return 0, nil
 }
 
+func (mr *mockRepository) Count(orgId int, ownerId *int) (int, error) {
+	return len(mr.todos), nil
+}
+
+func (mr *mockRepository) Archive(orgId int, id int, archived bool) (*Todo, error) {
+	for i, t := range mr.todos {
+		if t.Id == id {
+			mr.todos[i].Archived = archived
+			return &mr.todos[i], nil
+		}
+	}
+	return nil, errors.New("todo not found in mock repository")
+}
+
+func (mr *mockRepository) WithTx(work func(repository ITodoRepository, tx *database.Database) error) error {
+	return work(mr, nil)
+}
+
 func (mr *mockRepository) InsertFixtures() {
 	mr.todos = []Todo{}
 	for i := 0; i < 30; i++ {
 		var todo Todo
 		faker.FakeData(&todo)
 		todo.Id = i + 1
+		todo.AssigneeId = nil
 		mr.todos = append(mr.todos, todo)
 	}
 }
@@ -115,7 +147,8 @@ func todoTestsSetup() {
 	app = fiber.New()
 	group := app.Group("/todos")
 	mr = new(mockRepository)
-	controller := NewTodoController(mr)
+	bus = events.NewBus()
+	controller := NewTodoController(mr, mr, bus, nil)
 	mr.InsertFixtures()
 	GetTodoRoutes(group, controller)
 }
@@ -123,6 +156,7 @@ func todoTestsSetup() {
 func todoTestsTeardown() {
 	mr.todos = []Todo{}
 	mr.shouldFail = false
+	mr.quota = 0
 }
 
 func TestMain(m *testing.M) {
@@ -165,6 +199,14 @@ func TestCreate(t *testing.T) {
 			func() string { return "/todos" },
 			409,
 		},
+		{
+			"create todo past the quota",
+			func(b *bytes.Buffer) {
+				mr.quota = len(mr.todos)
+			},
+			func() string { return "/todos" },
+			403,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -207,6 +249,72 @@ func TestList(t *testing.T) {
 			func() string { return "/todos" },
 			500,
 		},
+		{
+			"test list filtered",
+			func(b *bytes.Buffer) {},
+			func() string { return "/todos?completed=true&list_id=1" },
+			200,
+		},
+		{
+			"test list invalid filter",
+			func(b *bytes.Buffer) {},
+			func() string { return "/todos?completed=maybe" },
+			400,
+		},
+		{
+			"test list page",
+			func(b *bytes.Buffer) {},
+			func() string { return "/todos?limit=1&cursor=" + EncodeCursor(1) },
+			200,
+		},
+		{
+			"test list invalid limit",
+			func(b *bytes.Buffer) {},
+			func() string { return "/todos?limit=501" },
+			400,
+		},
+		{
+			"test list invalid cursor",
+			func(b *bytes.Buffer) {},
+			func() string { return "/todos?cursor=!" },
+			400,
+		},
+		{
+			"test list including archived",
+			func(b *bytes.Buffer) {},
+			func() string { return "/todos?include=archived" },
+			200,
+		},
+		{
+			"test list invalid include",
+			func(b *bytes.Buffer) {},
+			func() string { return "/todos?include=deleted" },
+			400,
+		},
+		{
+			"test list unassigned",
+			func(b *bytes.Buffer) {},
+			func() string { return "/todos?assignee=none" },
+			200,
+		},
+		{
+			"test list assigned to user",
+			func(b *bytes.Buffer) {},
+			func() string { return "/todos?assignee=2" },
+			200,
+		},
+		{
+			"test list assigned to me without user",
+			func(b *bytes.Buffer) {},
+			func() string { return "/todos?assignee=me" },
+			400,
+		},
+		{
+			"test list invalid assignee",
+			func(b *bytes.Buffer) {},
+			func() string { return "/todos?assignee=someone" },
+			400,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -400,3 +508,315 @@ func TestDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestEvents(t *testing.T) {
+	todoTestsSetup()
+	defer todoTestsTeardown()
+	published := []string{}
+	bus.Subscribe(func(e events.Event) {
+		published = append(published, e.Type)
+	})
+	mr.todos[0].Completed = false
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(&CreateTodoDto{Title: "done", Completed: true})
+	req, _ := http.NewRequest("PUT", "/todos/1", body)
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+	req, _ = http.NewRequest("DELETE", "/todos/1", nil)
+	if _, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{EventUpdated, EventCompleted, EventDeleted}
+	if fmt.Sprint(published) != fmt.Sprint(expected) {
+		t.Errorf("Expected events %v, got %v", expected, published)
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	todoTestsSetup()
+	defer todoTestsTeardown()
+	// the replica hasn't caught up with any of the fixtures
+	app := fiber.New()
+	app.Use(consistency.New(consistency.Config{Window: time.Minute, Secret: []byte("s3cret")}))
+	GetTodoRoutes(app.Group("/todos"), NewTodoController(mr, new(mockRepository), bus, nil))
+
+	req, _ := http.NewRequest("GET", "/todos/1", nil)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 404 {
+		t.Errorf("Expected reads to go to the replica, got status code %v", res.StatusCode)
+	}
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(&CreateTodoDto{Title: "updated"})
+	req, _ = http.NewRequest("PUT", "/todos/1", body)
+	req.Header.Set("Content-Type", "application/json")
+	res, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := res.Header.Get(consistency.Header)
+	req, _ = http.NewRequest("GET", "/todos/1", nil)
+	req.Header.Set(consistency.Header, token)
+	res, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 {
+		t.Errorf("Expected reads to go to the primary after a write, got status code %v", res.StatusCode)
+	}
+}
+
+// countingRepository counts the reads that reach the repository
+type countingRepository struct {
+	*mockRepository
+	reads int
+}
+
+func (cr *countingRepository) List(filter ListFilter) ([]Todo, error) {
+	cr.reads++
+	return cr.mockRepository.List(filter)
+}
+
+func (cr *countingRepository) Retrieve(orgId int, id int) (*Todo, error) {
+	cr.reads++
+	return cr.mockRepository.Retrieve(orgId, id)
+}
+
+func TestCache(t *testing.T) {
+	todoTestsSetup()
+	defer todoTestsTeardown()
+	for i := range mr.todos {
+		mr.todos[i].OrgId = common.DefaultOrgId
+	}
+	counting := &countingRepository{mockRepository: mr}
+	c := cache.New(cache.NewMemoryStore(100), time.Minute)
+	cached := NewCachedRepository(counting, c, "primary")
+	app := fiber.New()
+	GetTodoRoutes(app.Group("/todos"), NewTodoController(NewInvalidatingRepository(counting, c), cached, bus, nil))
+
+	get := func(url string, bypass bool) {
+		req, _ := http.NewRequest("GET", url, nil)
+		if bypass {
+			req.Header.Set("Cache-Control", "no-cache")
+		}
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != 200 {
+			t.Fatalf("Expected status code 200, got %v", res.StatusCode)
+		}
+	}
+	get("/todos", false)
+	get("/todos", false)
+	get("/todos/1", false)
+	get("/todos/1", false)
+	if counting.reads != 2 {
+		t.Errorf("Expected repeated reads to be cached, got %d reads", counting.reads)
+	}
+	get("/todos/1", true)
+	if counting.reads != 3 {
+		t.Errorf("Expected Cache-Control: no-cache to bypass the cache, got %d reads", counting.reads)
+	}
+
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(&CreateTodoDto{Title: "updated"})
+	req, _ := http.NewRequest("PUT", "/todos/1", body)
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+	// the update read the latest todo rather than the cached one
+	if counting.reads != 4 {
+		t.Errorf("Expected an update to read the todo past the cache, got %d reads", counting.reads)
+	}
+	get("/todos", false)
+	if counting.reads != 5 {
+		t.Errorf("Expected an update to invalidate the cache, got %d reads", counting.reads)
+	}
+
+	bus.Publish(EventDeleted, Todo{Id: 2, OrgId: common.DefaultOrgId})
+	if stats := c.Metrics.Stats(); stats.Invalidations != 1 {
+		t.Errorf("Expected only the update to invalidate, got %+v", stats)
+	}
+	bus.Subscribe(invalidateOnEvents(c))
+	bus.Publish(EventDeleted, Todo{Id: 2, OrgId: common.DefaultOrgId})
+	get("/todos", false)
+	if counting.reads != 6 {
+		t.Errorf("Expected todo events to invalidate the cache, got %d reads", counting.reads)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		archived     bool
+		expectStatus int
+		expectEvents []string
+	}{
+		{"test archive", "/todos/1/archive", true, 200, []string{EventArchived}},
+		{"test archive archived", "/todos/2/archive", true, 200, []string{}},
+		{"test unarchive", "/todos/2/unarchive", false, 200, []string{EventUnarchived}},
+		{"test archive not found", "/todos/999/archive", false, 404, []string{}},
+		{"test archive invalid id", "/todos/one/archive", false, 422, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			todoTestsSetup()
+			defer todoTestsTeardown()
+			mr.todos[0].Archived = false
+			mr.todos[1].Archived = true
+			published := []string{}
+			bus.Subscribe(func(e events.Event) {
+				published = append(published, e.Type)
+			})
+			req, _ := http.NewRequest("POST", test.url, nil)
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Fatalf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+			if res.StatusCode == 200 {
+				var todo Todo
+				json.NewDecoder(res.Body).Decode(&todo)
+				if todo.Archived != test.archived {
+					t.Errorf("Expected archived to be %v", test.archived)
+				}
+			}
+			if fmt.Sprint(published) != fmt.Sprint(test.expectEvents) {
+				t.Errorf("Expected events %v, got %v", test.expectEvents, published)
+			}
+		})
+	}
+}
+
+type mockAssignees struct {
+	allowed map[int]bool
+}
+
+func (ma mockAssignees) CanAssign(userId int, todo Todo) (bool, error) {
+	return ma.allowed[userId], nil
+}
+
+func TestAssign(t *testing.T) {
+	one, two, stranger := 1, 2, 3
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		assigneeId   *int
+		expectStatus int
+		expectEvents []string
+	}{
+		{"test create assigned", "POST", "/todos", &one, 201, []string{EventCreated, EventAssigned}},
+		{"test create unassigned", "POST", "/todos", nil, 201, []string{EventCreated}},
+		{"test create assigned to stranger", "POST", "/todos", &stranger, 422, []string{}},
+		{"test assign", "PUT", "/todos/1", &two, 200, []string{EventUpdated, EventAssigned}},
+		{"test keep assignee", "PUT", "/todos/1", &one, 200, []string{EventUpdated}},
+		{"test unassign", "PUT", "/todos/1", nil, 200, []string{EventUpdated, EventAssigned}},
+		{"test assign to stranger", "PUT", "/todos/1", &stranger, 422, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			todoTestsSetup()
+			defer todoTestsTeardown()
+			app = fiber.New()
+			GetTodoRoutes(app.Group("/todos"), NewTodoController(mr, mr, bus, mockAssignees{map[int]bool{one: true, two: true}}))
+			mr.todos[0].AssigneeId = &one
+			mr.todos[0].Completed = false
+			published := []string{}
+			bus.Subscribe(func(e events.Event) {
+				published = append(published, e.Type)
+			})
+			body := new(bytes.Buffer)
+			json.NewEncoder(body).Encode(&CreateTodoDto{Title: "assigned", AssigneeId: test.assigneeId})
+			req, _ := http.NewRequest(test.method, test.url, body)
+			req.Header.Set("Content-Type", "application/json")
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Fatalf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+			if fmt.Sprint(published) != fmt.Sprint(test.expectEvents) {
+				t.Errorf("Expected events %v, got %v", test.expectEvents, published)
+			}
+		})
+	}
+}
+
+func TestMoved(t *testing.T) {
+	one, two := 1, 2
+	tests := []struct {
+		name     string
+		from, to *int
+		expected *int
+	}{
+		{"test move to another list", &one, &two, &one},
+		{"test take out of its list", &one, nil, &one},
+		{"test keep its list", &one, &one, nil},
+		{"test put in a list", nil, &two, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updated := &Todo{Id: 1, ListId: test.to}
+			event := Moved(Todo{Id: 1, ListId: test.from}, updated)
+			if !sameId(event.PreviousListId, test.expected) {
+				t.Errorf("Expected previous list %v, got %v", test.expected, event.PreviousListId)
+			}
+			if updated.PreviousListId != nil {
+				t.Errorf("Expected the updated todo to be left as it is")
+			}
+		})
+	}
+}
+
+func TestPublishInTx(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		expectStatus int
+	}{
+		{"test create", "POST", "/todos", 500},
+		{"test update", "PUT", "/todos/1", 500},
+		{"test delete", "DELETE", "/todos/1", 500},
+		{"test archive", "POST", "/todos/1/archive", 500},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			todoTestsSetup()
+			defer todoTestsTeardown()
+			mr.todos[0].Archived = false
+			published := []string{}
+			bus.Subscribe(func(e events.Event) {
+				published = append(published, e.Type)
+			})
+			bus.SubscribeTx(func(tx *database.Database, e events.Event) error {
+				return errors.New("connection refused")
+			})
+			req, _ := http.NewRequest(test.method, test.url, bytes.NewBufferString(`{"title": "published"}`))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Errorf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+			if len(published) != 0 {
+				t.Errorf("Expected nothing to be published after a failed transaction, got %v", published)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package user
+
+import (
+	"fmt"
+	"net/mail"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+type UserController struct {
+	repository IUserRepository
+}
+
+func NewUserController(repository IUserRepository) *UserController {
+	return &UserController{repository: repository}
+}
+
+// @Create godoc
+// @Summary Create a user
+// @Description Create a user. Only service API keys, which don't belong to a user, can create users, even when authentication isn't required; give the user access by creating an API key with their user_id.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param user body CreateUserDto true "User Create"
+// @Success 201 {object} User
+// @Failure 400 {object} string "Bad Request"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 409 {object} string "Conflict"
+// @Router /users [post]
+func (uc *UserController) Create(c *fiber.Ctx) error {
+	principal := common.GetPrincipal(c)
+	if principal == nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "missing API key")
+	}
+	if !principal.Service() {
+		return fiber.NewError(fiber.StatusForbidden, "users can't create other users")
+	}
+	var dto CreateUserDto
+	if err := c.BodyParser(&dto); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "bad request body")
+	}
+	if _, err := mail.ParseAddress(dto.Email); err != nil || dto.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "a name and a valid email are required")
+	}
+	created, err := uc.repository.Create(dto)
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusConflict, "user already exists")
+	}
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// @List godoc
+// @Summary List users
+// @Description List users. Service keys see every user; users see the members of the organization, which are all users for the default one. Emails are only shown to service keys and to members added to the organization, for the other members.
+// @Tags Users
+// @Produce json
+// @Success 200 {array} User
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /users [get]
+func (uc *UserController) List(c *fiber.Ctx) error {
+	principal := common.GetPrincipal(c)
+	if principal == nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "missing API key")
+	}
+	if principal.Service() {
+		users, err := uc.repository.List()
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError)
+		}
+		return c.Status(fiber.StatusOK).JSON(users)
+	}
+	members, err := uc.membersOf(c)
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	var users []User
+	if members.all {
+		users, err = uc.repository.List()
+	} else {
+		users, err = uc.repository.RetrieveMany(members.ids)
+		sort.Slice(users, func(i, j int) bool { return users[i].Id < users[j].Id })
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	for i := range users {
+		members.redact(&users[i])
+	}
+	return c.Status(fiber.StatusOK).JSON(users)
+}
+
+// @Me godoc
+// @Summary Retrieve the calling user
+// @Description Retrieve the user the API key of the request belongs to
+// @Tags Users
+// @Produce json
+// @Success 200 {object} User
+// @Failure 404 {object} string "Not Found"
+// @Router /users/me [get]
+func (uc *UserController) Me(c *fiber.Ctx) error {
+	userId := common.UserIdOf(common.GetPrincipal(c))
+	if userId == nil {
+		return fiber.NewError(fiber.StatusNotFound, "the request isn't made by a user")
+	}
+	user, err := uc.repository.Retrieve(*userId)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.Status(fiber.StatusOK).JSON(user)
+}
+
+// @Retrieve godoc
+// @Summary Retrieve a user
+// @Description Retrieve a user, from the members of the organization for users. Emails are shown as in the list.
+// @Tags Users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} User
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /users/{id} [get]
+func (uc *UserController) Retrieve(c *fiber.Ctx) error {
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	principal := common.GetPrincipal(c)
+	if principal == nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "missing API key")
+	}
+	// service keys see every user whole and leave members nil
+	var members *orgMembers
+	if !principal.Service() {
+		if members, err = uc.membersOf(c); err != nil {
+			fmt.Println(err)
+			return fiber.NewError(fiber.StatusInternalServerError)
+		}
+		if !members.all && !common.Contains(members.ids, id) {
+			return fiber.NewError(fiber.StatusNotFound)
+		}
+	}
+	user, err := uc.repository.Retrieve(id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	if members != nil {
+		members.redact(user)
+	}
+	return c.Status(fiber.StatusOK).JSON(user)
+}
+
+// orgMembers is who a user calling in an organization may see
+type orgMembers struct {
+	caller int
+	// all is set in the default organization, which every user belongs to
+	all bool
+	// ids are the users added to the organization, the caller included
+	ids []int
+	// emails is set when the caller was added to the organization, which
+	// lets them see the emails of the others that were
+	emails bool
+}
+
+// membersOf returns the members of the organization of the request, which
+// the caller belongs to as org.Scope checked
+func (uc *UserController) membersOf(c *fiber.Ctx) (*orgMembers, error) {
+	caller := *common.UserIdOf(common.GetPrincipal(c))
+	orgId := common.GetOrgId(c)
+	ids, err := uc.repository.MemberIds(orgId)
+	if err != nil {
+		return nil, err
+	}
+	emails := common.Contains(ids, caller)
+	if !emails {
+		ids = append(ids, caller)
+	}
+	return &orgMembers{caller: caller, all: orgId == common.DefaultOrgId, ids: ids, emails: emails}, nil
+}
+
+// redact clears the email of the user unless the caller may see it
+func (m *orgMembers) redact(user *User) {
+	if user.Id == m.caller || (m.emails && common.Contains(m.ids, user.Id)) {
+		return
+	}
+	user.Email = ""
+}
@@ -0,0 +1,6 @@
+package user
+
+type CreateUserDto struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
@@ -0,0 +1,11 @@
+package user
+
+import "time"
+
+// User is left without an email for callers that may not see it
+type User struct {
+	Id        int       `json:"id"`
+	Email     string    `json:"email,omitempty"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
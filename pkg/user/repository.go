@@ -0,0 +1,108 @@
+package user
+
+import (
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+)
+
+type IUserRepository interface {
+	Create(user CreateUserDto) (*User, error)
+	List() ([]User, error)
+	Retrieve(id int) (*User, error)
+	RetrieveMany(ids []int) ([]User, error)
+	FindByEmail(email string) (*User, error)
+	// MemberIds returns the users added to the organization as members
+	MemberIds(orgId int) ([]int, error)
+}
+
+type UserRepository struct {
+	Db *database.Database
+}
+
+func NewUserRepository(db *database.Database) *UserRepository {
+	return &UserRepository{Db: db}
+}
+
+const userColumns = "id, email, name, created_at"
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (*User, error) {
+	var user User
+	if err := row.Scan(&user.Id, &user.Email, &user.Name, &user.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Create stores the user with a lower-cased email, so lookups by email don't
+// depend on how it was typed
+func (ur *UserRepository) Create(user CreateUserDto) (*User, error) {
+	row := ur.Db.QueryRow("INSERT INTO users (email, name) VALUES ($1, $2) RETURNING "+userColumns,
+		strings.ToLower(user.Email), user.Name)
+	return scanUser(row)
+}
+
+func (ur *UserRepository) List() ([]User, error) {
+	rows, err := ur.Db.Query("SELECT " + userColumns + " FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (ur *UserRepository) Retrieve(id int) (*User, error) {
+	return scanUser(ur.Db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = $1", id))
+}
+
+// RetrieveMany returns the users with the ids, in no particular order
+func (ur *UserRepository) RetrieveMany(ids []int) ([]User, error) {
+	rows, err := ur.Db.Query("SELECT "+userColumns+" FROM users WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (ur *UserRepository) FindByEmail(email string) (*User, error) {
+	return scanUser(ur.Db.QueryRow("SELECT "+userColumns+" FROM users WHERE email = $1", strings.ToLower(email)))
+}
+
+func (ur *UserRepository) MemberIds(orgId int) ([]int, error) {
+	rows, err := ur.Db.Query("SELECT user_id FROM org_member WHERE org_id = $1", orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,11 @@
+package user
+
+import "github.com/gofiber/fiber/v2"
+
+func GetUserRoutes(router fiber.Router, controller *UserController) fiber.Router {
+	router.Post("/", controller.Create)
+	router.Get("/", controller.List)
+	router.Get("/me", controller.Me)
+	router.Get("/:id", controller.Retrieve)
+	return router
+}
@@ -0,0 +1,17 @@
+package user
+
+import "github.com/raphael-foliveira/fiber-todo/pkg/database"
+
+type UserModule struct {
+	Repository IUserRepository
+	Controller *UserController
+}
+
+func New(db *database.Database) *UserModule {
+	repository := NewUserRepository(db)
+	controller := NewUserController(repository)
+	return &UserModule{
+		Repository: repository,
+		Controller: controller,
+	}
+}
@@ -0,0 +1,160 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+)
+
+type mockRepository struct {
+	IUserRepository
+	created []CreateUserDto
+	users   []User
+	members map[int][]int
+}
+
+func (mr *mockRepository) List() ([]User, error) {
+	return append([]User{}, mr.users...), nil
+}
+
+func (mr *mockRepository) Retrieve(id int) (*User, error) {
+	for _, user := range mr.users {
+		if user.Id == id {
+			return &user, nil
+		}
+	}
+	return nil, errors.New("user not found in mock repository")
+}
+
+func (mr *mockRepository) RetrieveMany(ids []int) ([]User, error) {
+	users := []User{}
+	for _, user := range mr.users {
+		if common.Contains(ids, user.Id) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (mr *mockRepository) MemberIds(orgId int) ([]int, error) {
+	return mr.members[orgId], nil
+}
+
+func (mr *mockRepository) Create(dto CreateUserDto) (*User, error) {
+	mr.created = append(mr.created, dto)
+	return &User{Id: len(mr.created), Email: dto.Email, Name: dto.Name}, nil
+}
+
+func TestCreate(t *testing.T) {
+	userId := 1
+	tests := []struct {
+		name         string
+		principal    *common.Principal
+		expectStatus int
+	}{
+		{"test service key", &common.Principal{}, 201},
+		{"test user key", &common.Principal{UserId: &userId}, 403},
+		{"test anonymous", nil, 401},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mr := new(mockRepository)
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				if test.principal != nil {
+					common.SetPrincipal(c, test.principal)
+				}
+				return c.Next()
+			})
+			GetUserRoutes(app.Group("/users"), NewUserController(mr))
+			req, _ := http.NewRequest("POST", "/users", strings.NewReader(`{"email": "ada@example.com", "name": "Ada"}`))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Errorf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+			if created := len(mr.created) == 1; created != (test.expectStatus == 201) {
+				t.Errorf("Unexpected users created: %+v", mr.created)
+			}
+		})
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	ada, eve := 1, 3
+	tests := []struct {
+		name         string
+		principal    *common.Principal
+		orgId        int
+		url          string
+		expectStatus int
+		expectUsers  string
+	}{
+		{"list anonymously", nil, 1, "/users", 401, ""},
+		{"list with a service key", &common.Principal{}, 1, "/users", 200, "1:ada@example.com 2:bob@example.com 3:eve@example.com"},
+		{"list as a member", &common.Principal{UserId: &ada}, 2, "/users", 200, "1:ada@example.com 2:bob@example.com"},
+		{"list in the default organization", &common.Principal{UserId: &ada}, 1, "/users", 200, "1:ada@example.com 2: 3:"},
+		{"retrieve anonymously", nil, 1, "/users/2", 401, ""},
+		{"retrieve with a service key", &common.Principal{}, 1, "/users/2", 200, "2:bob@example.com"},
+		{"retrieve a member", &common.Principal{UserId: &ada}, 2, "/users/2", 200, "2:bob@example.com"},
+		{"retrieve a stranger", &common.Principal{UserId: &ada}, 2, "/users/3", 404, ""},
+		{"retrieve in the default organization", &common.Principal{UserId: &eve}, 1, "/users/2", 200, "2:"},
+		{"retrieve yourself in the default organization", &common.Principal{UserId: &eve}, 1, "/users/3", 200, "3:eve@example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mr := &mockRepository{
+				users: []User{
+					{Id: 1, Email: "ada@example.com", Name: "Ada"},
+					{Id: 2, Email: "bob@example.com", Name: "Bob"},
+					{Id: 3, Email: "eve@example.com", Name: "Eve"},
+				},
+				members: map[int][]int{2: {1, 2}},
+			}
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				if test.principal != nil {
+					common.SetPrincipal(c, test.principal)
+				}
+				common.SetOrgId(c, test.orgId)
+				return c.Next()
+			})
+			GetUserRoutes(app.Group("/users"), NewUserController(mr))
+			req, _ := http.NewRequest("GET", test.url, nil)
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Fatalf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+			if test.expectStatus != 200 {
+				return
+			}
+			var users []User
+			if test.url == "/users" {
+				json.NewDecoder(res.Body).Decode(&users)
+			} else {
+				var user User
+				json.NewDecoder(res.Body).Decode(&user)
+				users = append(users, user)
+			}
+			got := []string{}
+			for _, user := range users {
+				got = append(got, fmt.Sprintf("%d:%s", user.Id, user.Email))
+			}
+			if strings.Join(got, " ") != test.expectUsers {
+				t.Errorf("Expected users %q, got %q", test.expectUsers, strings.Join(got, " "))
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type WebhookController struct {
+	repository IWebhookRepository
+	// lookup resolves webhook hosts; it is replaced in tests
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+func NewWebhookController(repository IWebhookRepository) *WebhookController {
+	return &WebhookController{repository: repository, lookup: net.DefaultResolver.LookupIPAddr}
+}
+
+// @Create godoc
+// @Summary Register a webhook
+// @Description Register a URL to receive signed To Do lifecycle events of the organization. Leave events empty to receive all of them. A webhook registered with a user key only receives events about To Dos that user may see. A secret is generated when none is given. The URL must resolve to public addresses only, which is checked again for every delivery. Webhooks are managed with service keys or by organization admins.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body CreateWebhookDto true "Webhook Create"
+// @Success 201 {object} CreateWebhookResponse
+// @Failure 400 {object} string "Bad Request"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /webhooks [post]
+func (wc *WebhookController) Create(c *fiber.Ctx) error {
+	var dto CreateWebhookDto
+	if err := c.BodyParser(&dto); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "bad request body")
+	}
+	if err := wc.validateWebhook(c.UserContext(), dto); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if dto.Events == nil {
+		dto.Events = []string{}
+	}
+	if dto.Secret == "" {
+		secret, err := generateSecret()
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError)
+		}
+		dto.Secret = secret
+	}
+	created, err := wc.repository.Create(common.GetOrgId(c), common.UserIdOf(common.GetPrincipal(c)), dto)
+	if err != nil {
+		fmt.Println(err)
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusCreated).JSON(CreateWebhookResponse{Webhook: *created, Secret: created.Secret})
+}
+
+// @List godoc
+// @Summary List webhooks
+// @Description List the webhooks of the organization
+// @Tags Webhooks
+// @Produce json
+// @Success 200 {array} Webhook
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /webhooks [get]
+func (wc *WebhookController) List(c *fiber.Ctx) error {
+	webhooks, err := wc.repository.List(common.GetOrgId(c))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(webhooks)
+}
+
+// @Retrieve godoc
+// @Summary Retrieve a webhook
+// @Description Retrieve a webhook
+// @Tags Webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} Webhook
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Router /webhooks/{id} [get]
+func (wc *WebhookController) Retrieve(c *fiber.Ctx) error {
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	webhook, err := wc.repository.Retrieve(common.GetOrgId(c), id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.Status(fiber.StatusOK).JSON(webhook)
+}
+
+// @Delete godoc
+// @Summary Delete a webhook
+// @Description Delete a webhook along with its delivery log
+// @Tags Webhooks
+// @Param id path int true "Webhook ID"
+// @Success 204 "No Content"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /webhooks/{id} [delete]
+func (wc *WebhookController) Delete(c *fiber.Ctx) error {
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	affected, err := wc.repository.Delete(common.GetOrgId(c), id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	if affected == 0 {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// @ListDeliveries godoc
+// @Summary List webhook deliveries
+// @Description List the delivery log of a webhook, newest first
+// @Tags Webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {array} Delivery
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Failure 500 {object} string "Internal Server Error"
+// @Router /webhooks/{id}/deliveries [get]
+func (wc *WebhookController) ListDeliveries(c *fiber.Ctx) error {
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	if _, err := wc.repository.Retrieve(common.GetOrgId(c), id); err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	deliveries, err := wc.repository.ListDeliveries(id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusOK).JSON(deliveries)
+}
+
+// @Replay godoc
+// @Summary Replay a webhook delivery
+// @Description Enqueue a new delivery with the same event and payload
+// @Tags Webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param deliveryId path int true "Delivery ID"
+// @Success 202 {object} Delivery
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Not Found"
+// @Failure 422 {object} string "Unprocessable Entity"
+// @Router /webhooks/{id}/deliveries/{deliveryId}/replay [post]
+func (wc *WebhookController) Replay(c *fiber.Ctx) error {
+	id, err := common.ParseIdFromParams(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	deliveryId, err := c.ParamsInt("deliveryId")
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity)
+	}
+	if _, err := wc.repository.Retrieve(common.GetOrgId(c), id); err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	delivery, err := wc.repository.Replay(id, deliveryId)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound)
+	}
+	return c.Status(fiber.StatusAccepted).JSON(delivery)
+}
+
+func (wc *WebhookController) validateWebhook(ctx context.Context, dto CreateWebhookDto) error {
+	parsed, err := url.Parse(dto.Url)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return fmt.Errorf("url must be an absolute http(s) URL")
+	}
+	if err := checkHost(ctx, wc.lookup, parsed.Hostname()); err != nil {
+		return err
+	}
+	for _, event := range dto.Events {
+		if !common.Contains(todo.Events, event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
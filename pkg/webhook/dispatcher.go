@@ -0,0 +1,145 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// Sign returns the value of the signature header for a payload: the hex
+// encoded HMAC-SHA256 of the body keyed with the webhook secret
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type DispatcherConfig struct {
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	BaseBackoff time.Duration
+	Timeout     time.Duration
+}
+
+var DefaultDispatcherConfig = DispatcherConfig{
+	Interval:    2 * time.Second,
+	BatchSize:   20,
+	MaxAttempts: 8,
+	BaseBackoff: 10 * time.Second,
+	Timeout:     10 * time.Second,
+}
+
+// Dispatcher periodically sends pending deliveries, retrying failures with
+// exponential backoff until MaxAttempts is reached
+type Dispatcher struct {
+	repository IWebhookRepository
+	// client only reaches public addresses; it is replaced in tests
+	client *http.Client
+	config DispatcherConfig
+	stop   chan struct{}
+	done   sync.WaitGroup
+}
+
+func NewDispatcher(repository IWebhookRepository, config DispatcherConfig) *Dispatcher {
+	return &Dispatcher{
+		repository: repository,
+		client:     publicClient(config.Timeout),
+		config:     config,
+	}
+}
+
+func (d *Dispatcher) Start() error {
+	d.stop = make(chan struct{})
+	d.done.Add(1)
+	go func() {
+		defer d.done.Done()
+		ticker := time.NewTicker(d.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				d.RunOnce()
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *Dispatcher) Stop() {
+	close(d.stop)
+	d.done.Wait()
+}
+
+// RunOnce claims and sends one batch of due deliveries
+func (d *Dispatcher) RunOnce() {
+	// the lease must outlive every send in the batch or another instance could
+	// pick the same deliveries up again
+	lease := d.config.Timeout*time.Duration(d.config.BatchSize) + time.Minute
+	pending, err := d.repository.ClaimDue(d.config.BatchSize, lease)
+	if err != nil {
+		fmt.Println("error claiming webhook deliveries:", err)
+		return
+	}
+	for _, delivery := range pending {
+		d.deliver(delivery)
+	}
+}
+
+func (d *Dispatcher) deliver(delivery pendingDelivery) {
+	code, err := d.send(delivery)
+	if err == nil {
+		err = d.repository.MarkSucceeded(delivery.Id, code)
+	} else {
+		err = d.repository.MarkAttemptFailed(delivery.Id, code, err.Error(), d.nextAttempt(delivery.Attempts+1))
+	}
+	if err != nil {
+		fmt.Println("error recording webhook delivery:", err)
+	}
+}
+
+func (d *Dispatcher) send(delivery pendingDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.Id))
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, delivery.Payload))
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// nextAttempt returns when to retry after the given number of attempts, or nil
+// once the delivery has run out of attempts
+func (d *Dispatcher) nextAttempt(attempts int) *time.Time {
+	if attempts >= d.config.MaxAttempts {
+		return nil
+	}
+	next := time.Now().Add(d.config.BaseBackoff << (attempts - 1))
+	return &next
+}
@@ -0,0 +1,13 @@
+package webhook
+
+type CreateWebhookDto struct {
+	Url    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+// CreateWebhookResponse is the only response that includes the secret
+type CreateWebhookResponse struct {
+	Webhook
+	Secret string `json:"secret"`
+}
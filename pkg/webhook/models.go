@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+type Webhook struct {
+	Id     int      `json:"id"`
+	Url    string   `json:"url"`
+	Secret string   `json:"-"`
+	Events []string `json:"events"`
+	Active bool     `json:"active"`
+	OrgId  int      `json:"org_id"`
+	// OwnerId is the user who registered the webhook, nil for service keys.
+	// The webhook only receives events about todos its owner may see.
+	OwnerId   *int      `json:"owner_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Delivery struct {
+	Id            int             `json:"id"`
+	WebhookId     int             `json:"webhook_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload" swaggertype:"object"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	ResponseCode  int             `json:"response_code"`
+	LastError     string          `json:"last_error"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at"`
+}
+
+// pendingDelivery is a delivery claimed by the dispatcher along with the
+// webhook fields needed to send it
+type pendingDelivery struct {
+	Delivery
+	Url    string
+	Secret string
+}
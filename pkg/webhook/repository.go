@@ -0,0 +1,233 @@
+package webhook
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type IWebhookRepository interface {
+	Create(orgId int, ownerId *int, webhook CreateWebhookDto) (*Webhook, error)
+	List(orgId int) ([]Webhook, error)
+	Retrieve(orgId int, id int) (*Webhook, error)
+	Delete(orgId int, id int) (int64, error)
+	Enqueue(event string, payload []byte, t todo.Todo) error
+	ListDeliveries(webhookId int) ([]Delivery, error)
+	Replay(webhookId int, deliveryId int) (*Delivery, error)
+	ClaimDue(limit int, lease time.Duration) ([]pendingDelivery, error)
+	MarkSucceeded(id int, responseCode int) error
+	MarkAttemptFailed(id int, responseCode int, lastError string, nextAttemptAt *time.Time) error
+	// WithDb returns the repository running its queries on db, such as a
+	// transaction
+	WithDb(db *database.Database) IWebhookRepository
+}
+
+type WebhookRepository struct {
+	Db *database.Database
+}
+
+func NewWebhookRepository(db *database.Database) *WebhookRepository {
+	return &WebhookRepository{Db: db}
+}
+
+const webhookColumns = "id, url, secret, events, active, org_id, owner_id, created_at"
+
+const deliveryColumns = `id, webhook_id, event, payload, status, attempts, next_attempt_at,
+	response_code, last_error, created_at, delivered_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWebhook(row scanner) (Webhook, error) {
+	var webhook Webhook
+	err := row.Scan(&webhook.Id, &webhook.Url, &webhook.Secret, pq.Array(&webhook.Events), &webhook.Active,
+		&webhook.OrgId, &webhook.OwnerId, &webhook.CreatedAt)
+	return webhook, err
+}
+
+func scanDelivery(row scanner, extra ...any) (Delivery, error) {
+	var d Delivery
+	dest := []any{&d.Id, &d.WebhookId, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.ResponseCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt}
+	err := row.Scan(append(dest, extra...)...)
+	return d, err
+}
+
+func (wr *WebhookRepository) Create(orgId int, ownerId *int, webhook CreateWebhookDto) (*Webhook, error) {
+	row := wr.Db.QueryRow(`
+	INSERT INTO webhook
+		(url, secret, events, org_id, owner_id)
+	VALUES
+		($1, $2, $3, $4, $5)
+	RETURNING `+webhookColumns, webhook.Url, webhook.Secret, pq.Array(webhook.Events), orgId, ownerId)
+	created, err := scanWebhook(row)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (wr *WebhookRepository) List(orgId int) ([]Webhook, error) {
+	rows, err := wr.Db.Query("SELECT "+webhookColumns+" FROM webhook WHERE org_id = $1 ORDER BY id", orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	webhooks := []Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (wr *WebhookRepository) Retrieve(orgId int, id int) (*Webhook, error) {
+	row := wr.Db.QueryRow("SELECT "+webhookColumns+" FROM webhook WHERE org_id = $1 AND id = $2", orgId, id)
+	webhook, err := scanWebhook(row)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (wr *WebhookRepository) Delete(orgId int, id int) (int64, error) {
+	result, err := wr.Db.Exec("DELETE FROM webhook WHERE org_id = $1 AND id = $2", orgId, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (wr *WebhookRepository) WithDb(db *database.Database) IWebhookRepository {
+	return &WebhookRepository{Db: db}
+}
+
+// Enqueue records one pending delivery for every active webhook of the
+// todo's organization subscribed to the event. A webhook without events is
+// subscribed to all of them. Webhooks with an owner only get events about
+// todos their owner may see, judged like todo.Visible but by the owner and
+// list the todo has in the event, so deleted todos are judged too, and only
+// while the owner is still in the organization.
+func (wr *WebhookRepository) Enqueue(event string, payload []byte, t todo.Todo) error {
+	_, err := wr.Db.Exec(`
+	INSERT INTO webhook_delivery
+		(webhook_id, event, payload)
+	SELECT w.id, $1, $2 FROM webhook w
+	WHERE w.active AND (cardinality(w.events) = 0 OR $1 = ANY(w.events)) AND w.org_id = $3
+	AND (w.owner_id IS NULL OR (
+		(w.org_id = $7 OR EXISTS (SELECT 1 FROM org_member WHERE org_member.org_id = w.org_id AND org_member.user_id = w.owner_id))
+		AND (($4::INTEGER IS NULL AND ($5::INTEGER IS NULL OR (SELECT owner_id FROM todo_list WHERE todo_list.id = $5) IS NULL))
+			OR w.owner_id = $4
+			OR $5 IN (SELECT id FROM todo_list WHERE owner_id = w.owner_id)
+			OR EXISTS (SELECT 1 FROM todo_share WHERE todo_share.user_id = w.owner_id AND (todo_share.todo_id = $6 OR todo_share.list_id = $5)))))
+	`, event, payload, t.OrgId, t.OwnerId, t.ListId, t.Id, common.DefaultOrgId)
+	return err
+}
+
+func (wr *WebhookRepository) ListDeliveries(webhookId int) ([]Delivery, error) {
+	rows, err := wr.Db.Query("SELECT "+deliveryColumns+" FROM webhook_delivery WHERE webhook_id = $1 ORDER BY id DESC", webhookId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := []Delivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// Replay enqueues a fresh copy of an earlier delivery
+func (wr *WebhookRepository) Replay(webhookId int, deliveryId int) (*Delivery, error) {
+	row := wr.Db.QueryRow(`
+	INSERT INTO webhook_delivery
+		(webhook_id, event, payload)
+	SELECT webhook_id, event, payload FROM webhook_delivery
+	WHERE webhook_id = $1 AND id = $2
+	RETURNING `+deliveryColumns, webhookId, deliveryId)
+	delivery, err := scanDelivery(row)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// ClaimDue locks up to limit pending deliveries that are due and pushes their
+// next attempt past the lease, so other instances leave them alone while they
+// are being sent
+func (wr *WebhookRepository) ClaimDue(limit int, lease time.Duration) ([]pendingDelivery, error) {
+	rows, err := wr.Db.Query(`
+	UPDATE webhook_delivery d
+	SET next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond'
+	FROM webhook w
+	WHERE w.id = d.webhook_id AND d.id IN (
+		SELECT id FROM webhook_delivery
+		WHERE status = 'pending' AND next_attempt_at <= NOW()
+		ORDER BY next_attempt_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at,
+		d.response_code, d.last_error, d.created_at, d.delivered_at, w.url, w.secret
+	`, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	claimed := []pendingDelivery{}
+	for rows.Next() {
+		var pending pendingDelivery
+		pending.Delivery, err = scanDelivery(rows, &pending.Url, &pending.Secret)
+		if err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, pending)
+	}
+	return claimed, rows.Err()
+}
+
+func (wr *WebhookRepository) MarkSucceeded(id int, responseCode int) error {
+	_, err := wr.Db.Exec(`
+	UPDATE webhook_delivery
+	SET status = 'succeeded', attempts = attempts + 1, response_code = $2, last_error = '', delivered_at = NOW()
+	WHERE id = $1
+	`, id, responseCode)
+	return err
+}
+
+// MarkAttemptFailed records a failed attempt. A nil nextAttemptAt means no
+// retries are left and the delivery is given up on.
+func (wr *WebhookRepository) MarkAttemptFailed(id int, responseCode int, lastError string, nextAttemptAt *time.Time) error {
+	status := DeliveryPending
+	next := time.Now()
+	if nextAttemptAt == nil {
+		status = DeliveryFailed
+	} else {
+		next = *nextAttemptAt
+	}
+	result, err := wr.Db.Exec(`
+	UPDATE webhook_delivery
+	SET status = $2, attempts = attempts + 1, response_code = $3, last_error = $4, next_attempt_at = $5
+	WHERE id = $1
+	`, id, status, responseCode, lastError, next)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return errors.New("delivery not found")
+	}
+	return err
+}
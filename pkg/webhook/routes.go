@@ -0,0 +1,13 @@
+package webhook
+
+import "github.com/gofiber/fiber/v2"
+
+func GetWebhookRoutes(router fiber.Router, controller *WebhookController) fiber.Router {
+	router.Post("/", controller.Create)
+	router.Get("/", controller.List)
+	router.Get("/:id", controller.Retrieve)
+	router.Delete("/:id", controller.Delete)
+	router.Get("/:id/deliveries", controller.ListDeliveries)
+	router.Post("/:id/deliveries/:deliveryId/replay", controller.Replay)
+	return router
+}
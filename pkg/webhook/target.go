@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// errPrivateTarget is returned for webhook URLs that reach the server's own
+// network, so registering a webhook can't be used to probe or call it
+var errPrivateTarget = errors.New("url must not resolve to a loopback, link-local or private address")
+
+// reservedNetworks are the non-public ranges the net.IP predicates don't cover
+var reservedNetworks = parseNetworks(
+	"0.0.0.0/8",     // this network
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+	"240.0.0.0/4",   // reserved, and the broadcast address
+	"64:ff9b::/96",  // NAT64, which maps onto IPv4 addresses
+	"2001:db8::/32", // documentation
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// publicIp tells whether webhooks may be sent to ip
+func publicIp(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHost resolves host and returns errPrivateTarget unless every address it
+// resolves to is public
+func checkHost(ctx context.Context, lookup func(ctx context.Context, host string) ([]net.IPAddr, error), host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !publicIp(ip) {
+			return errPrivateTarget
+		}
+		return nil
+	}
+	addrs, err := lookup(ctx, host)
+	if err != nil {
+		return fmt.Errorf("could not resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if !publicIp(addr.IP) {
+			return errPrivateTarget
+		}
+	}
+	return nil
+}
+
+// publicClient sends requests to public addresses only. The address is
+// checked when it's dialed, after the host was resolved, so a host can't be
+// pointed at a private address once its webhook was saved, and redirects are
+// checked too. It doesn't use proxies, which would dial on its behalf.
+func publicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicIp(net.ParseIP(host)) {
+				return errPrivateTarget
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type WebhookModule struct {
+	Repository IWebhookRepository
+	Controller *WebhookController
+	Dispatcher *Dispatcher
+}
+
+// New wires the webhook module and subscribes it to the event bus, so every
+// published event is persisted as pending deliveries
+func New(db *database.Database, bus *events.Bus) *WebhookModule {
+	repository := NewWebhookRepository(db)
+	controller := NewWebhookController(repository)
+	dispatcher := NewDispatcher(repository, DefaultDispatcherConfig)
+	bus.SubscribeTx(enqueue(repository))
+	return &WebhookModule{
+		Repository: repository,
+		Controller: controller,
+		Dispatcher: dispatcher,
+	}
+}
+
+// enqueue records the deliveries of an event in the transaction of the change
+// it tells about, so they are committed with the change and a failure rolls
+// the change back. Events that aren't about a todo have no organization to
+// deliver them in and are left out.
+func enqueue(repository IWebhookRepository) events.TxHandler {
+	return func(tx *database.Database, event events.Event) error {
+		t, ok := eventTodo(event)
+		if !ok {
+			return nil
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		deliveries := repository
+		if tx != nil {
+			deliveries = repository.WithDb(tx)
+		}
+		if err := deliveries.Enqueue(event.Type, payload, t); err != nil {
+			return fmt.Errorf("error enqueuing webhook deliveries: %w", err)
+		}
+		return nil
+	}
+}
+
+// eventTodo returns the todo an event is about
+func eventTodo(event events.Event) (todo.Todo, bool) {
+	var t todo.Todo
+	switch data := event.Data.(type) {
+	case *todo.Todo:
+		if data == nil {
+			return t, false
+		}
+		t = *data
+	case todo.Todo:
+		t = data
+	default:
+		return t, false
+	}
+	// todos from before organizations existed belong to the default one
+	if t.OrgId == 0 {
+		t.OrgId = common.DefaultOrgId
+	}
+	return t, true
+}
@@ -0,0 +1,266 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/raphael-foliveira/fiber-todo/pkg/common"
+	"github.com/raphael-foliveira/fiber-todo/pkg/database"
+	"github.com/raphael-foliveira/fiber-todo/pkg/events"
+	"github.com/raphael-foliveira/fiber-todo/pkg/todo"
+)
+
+type mockRepository struct {
+	webhooks   []Webhook
+	pending    []pendingDelivery
+	succeeded  map[int]int
+	failed     map[int]*time.Time
+	enqueued   []string
+	orgs       []int
+	shouldFail bool
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{succeeded: map[int]int{}, failed: map[int]*time.Time{}}
+}
+
+func (mr *mockRepository) Create(orgId int, ownerId *int, dto CreateWebhookDto) (*Webhook, error) {
+	if mr.shouldFail {
+		return nil, errors.New("error creating webhook")
+	}
+	webhook := Webhook{Id: len(mr.webhooks) + 1, Url: dto.Url, Secret: dto.Secret, Events: dto.Events, Active: true,
+		OrgId: orgId, OwnerId: ownerId}
+	mr.webhooks = append(mr.webhooks, webhook)
+	return &webhook, nil
+}
+
+func (mr *mockRepository) List(orgId int) ([]Webhook, error) {
+	webhooks := []Webhook{}
+	for _, w := range mr.webhooks {
+		if w.OrgId == orgId {
+			webhooks = append(webhooks, w)
+		}
+	}
+	return webhooks, nil
+}
+
+func (mr *mockRepository) Retrieve(orgId int, id int) (*Webhook, error) {
+	for _, w := range mr.webhooks {
+		if w.OrgId == orgId && w.Id == id {
+			return &w, nil
+		}
+	}
+	return nil, errors.New("webhook not found in mock repository")
+}
+
+func (mr *mockRepository) Delete(orgId int, id int) (int64, error) {
+	return 0, nil
+}
+
+func (mr *mockRepository) Enqueue(event string, payload []byte, t todo.Todo) error {
+	if mr.shouldFail {
+		return errors.New("error enqueuing deliveries")
+	}
+	mr.enqueued = append(mr.enqueued, event)
+	mr.orgs = append(mr.orgs, t.OrgId)
+	return nil
+}
+
+func (mr *mockRepository) WithDb(db *database.Database) IWebhookRepository {
+	return mr
+}
+
+func (mr *mockRepository) ListDeliveries(webhookId int) ([]Delivery, error) {
+	return []Delivery{}, nil
+}
+
+func (mr *mockRepository) Replay(webhookId int, deliveryId int) (*Delivery, error) {
+	return nil, errors.New("delivery not found in mock repository")
+}
+
+func (mr *mockRepository) ClaimDue(limit int, lease time.Duration) ([]pendingDelivery, error) {
+	claimed := mr.pending
+	mr.pending = nil
+	return claimed, nil
+}
+
+func (mr *mockRepository) MarkSucceeded(id int, responseCode int) error {
+	mr.succeeded[id] = responseCode
+	return nil
+}
+
+func (mr *mockRepository) MarkAttemptFailed(id int, responseCode int, lastError string, nextAttemptAt *time.Time) error {
+	mr.failed[id] = nextAttemptAt
+	return nil
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		expectStatus int
+	}{
+		{"create valid webhook", `{"url": "https://example.com/hook", "events": ["todo.created"]}`, 201},
+		{"create webhook with invalid url", `{"url": "example.com/hook"}`, 400},
+		{"create webhook with unknown event", `{"url": "https://example.com/hook", "events": ["todo.exploded"]}`, 400},
+		{"create webhook with invalid body", `invalid`, 400},
+		{"create webhook to loopback", `{"url": "http://127.0.0.1:8080/hook"}`, 400},
+		{"create webhook to IPv6 loopback", `{"url": "http://[::1]/hook"}`, 400},
+		{"create webhook to link-local", `{"url": "http://169.254.169.254/latest/meta-data"}`, 400},
+		{"create webhook to a host resolving to a private address", `{"url": "https://intranet.example.com/hook"}`, 400},
+		{"create webhook to a host that doesn't resolve", `{"url": "https://nowhere.example.com/hook"}`, 400},
+	}
+	resolved := map[string][]net.IPAddr{
+		"example.com":          {{IP: net.ParseIP("93.184.216.34")}},
+		"intranet.example.com": {{IP: net.ParseIP("93.184.216.34")}, {IP: net.ParseIP("10.0.0.5")}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := fiber.New()
+			controller := NewWebhookController(newMockRepository())
+			controller.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+				if addrs, ok := resolved[host]; ok {
+					return addrs, nil
+				}
+				return nil, errors.New("no such host")
+			}
+			GetWebhookRoutes(app.Group("/webhooks"), controller)
+			req, _ := http.NewRequest("POST", "/webhooks", bytes.NewBufferString(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.expectStatus {
+				t.Errorf("Expected status code %v, got %v", test.expectStatus, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestOrgScope(t *testing.T) {
+	mr := newMockRepository()
+	owner := 7
+	mr.Create(2, &owner, CreateWebhookDto{Url: "https://example.com/hook"})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		common.SetOrgId(c, common.DefaultOrgId)
+		return c.Next()
+	})
+	GetWebhookRoutes(app.Group("/webhooks"), NewWebhookController(mr))
+	for _, url := range []string{"/webhooks/1", "/webhooks/1/deliveries"} {
+		res, err := app.Test(httptest.NewRequest("GET", url, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != 404 {
+			t.Errorf("Expected the webhook of another organization not to be found at %s, got %v", url, res.StatusCode)
+		}
+	}
+	res, err := app.Test(httptest.NewRequest("GET", "/webhooks", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	if string(body) != "[]" {
+		t.Errorf("Expected no webhooks listed from another organization, got %s", body)
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	payload := []byte(`{"type":"todo.created"}`)
+	config := DispatcherConfig{BatchSize: 10, MaxAttempts: 3, BaseBackoff: time.Minute, Timeout: time.Second}
+
+	t.Run("should sign and send pending deliveries", func(t *testing.T) {
+		var signature, event string
+		var body []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			signature = r.Header.Get(SignatureHeader)
+			event = r.Header.Get(EventHeader)
+			body, _ = io.ReadAll(r.Body)
+		}))
+		defer server.Close()
+		mr := newMockRepository()
+		mr.pending = []pendingDelivery{{Delivery: Delivery{Id: 1, Event: "todo.created", Payload: payload}, Url: server.URL, Secret: "s3cret"}}
+		dispatcher := NewDispatcher(mr, config)
+		// the test server listens on loopback
+		dispatcher.client = http.DefaultClient
+		dispatcher.RunOnce()
+		if mr.succeeded[1] != 200 {
+			t.Errorf("Expected delivery to succeed, got %v", mr.succeeded)
+		}
+		if signature != Sign("s3cret", payload) || !bytes.Equal(body, payload) || event != "todo.created" {
+			t.Errorf("Unexpected request: signature %q, event %q, body %s", signature, event, body)
+		}
+	})
+
+	t.Run("should back off exponentially and give up after the last attempt", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+		mr := newMockRepository()
+		mr.pending = []pendingDelivery{
+			{Delivery: Delivery{Id: 1, Attempts: 1, Payload: payload}, Url: server.URL},
+			{Delivery: Delivery{Id: 2, Attempts: 2, Payload: payload}, Url: server.URL},
+		}
+		before := time.Now()
+		dispatcher := NewDispatcher(mr, config)
+		dispatcher.client = http.DefaultClient
+		dispatcher.RunOnce()
+		next := mr.failed[1]
+		if next == nil || next.Before(before.Add(2*time.Minute)) || next.After(time.Now().Add(2*time.Minute)) {
+			t.Errorf("Expected retry in 2 minutes, got %v", next)
+		}
+		if next, ok := mr.failed[2]; !ok || next != nil {
+			t.Errorf("Expected delivery to be given up on, got %v", next)
+		}
+	})
+
+	t.Run("should refuse to send to private addresses", func(t *testing.T) {
+		called := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+		defer server.Close()
+		mr := newMockRepository()
+		mr.pending = []pendingDelivery{{Delivery: Delivery{Id: 1, Payload: payload}, Url: server.URL}}
+		NewDispatcher(mr, config).RunOnce()
+		if _, ok := mr.failed[1]; !ok || called {
+			t.Errorf("Expected the delivery to a loopback address to fail without being sent")
+		}
+	})
+}
+
+func TestEnqueue(t *testing.T) {
+	mr := newMockRepository()
+	bus := events.NewBus()
+	bus.SubscribeTx(enqueue(mr))
+	if err := bus.PublishTx(nil, "todo.created", &todo.Todo{Id: 1, OrgId: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.PublishTx(nil, "todo.archived", todo.Todo{Id: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.PublishTx(nil, "list.created", map[string]int{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(mr.enqueued) != 2 || mr.enqueued[0] != "todo.created" || mr.enqueued[1] != "todo.archived" {
+		t.Errorf("Expected the deliveries of the todo events to be enqueued, got %v", mr.enqueued)
+	}
+	if len(mr.orgs) != 2 || mr.orgs[0] != 2 || mr.orgs[1] != common.DefaultOrgId {
+		t.Errorf("Expected the deliveries to be enqueued in the organization of the todo, got %v", mr.orgs)
+	}
+	mr.shouldFail = true
+	if err := bus.PublishTx(nil, "todo.deleted", &todo.Todo{Id: 1}); err == nil {
+		t.Errorf("Expected a failure to enqueue to be returned to the publisher")
+	}
+}